@@ -10,6 +10,7 @@ import (
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/proxy"
 	"flowsilicon/internal/web"
 	"fmt"
 	"os"
@@ -115,6 +116,36 @@ func main() {
 		logger.Info("确保API密钥表存在成功")
 	}
 
+	// 确保Responses API响应表存在
+	if err := config.EnsureResponsesTable(); err != nil {
+		logger.Error("创建responses表失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	}
+
+	// 确保视频生成任务表存在
+	if err := config.EnsureVideoJobsTable(); err != nil {
+		logger.Error("创建video_jobs表失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	}
+
+	// 确保批量任务的files和batches表存在
+	if err := config.EnsureBatchTables(); err != nil {
+		logger.Error("创建files/batches表失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	}
+
+	// 确保下游客户端密钥表存在并加载客户端密钥
+	if err := config.EnsureClientKeysTable(); err != nil {
+		logger.Error("创建client_keys表失败: %v", err)
+		// 继续执行，未加载客户端密钥时只能使用共享API密钥
+	}
+
+	// 初始化响应缓存数据库
+	if err := config.InitResponseCacheDB(getAbsolutePath("data/cache.db")); err != nil {
+		logger.Error("初始化响应缓存数据库失败: %v", err)
+		// 继续执行，缓存不可用时请求直接转发
+	}
+
 	// 设置数据文件路径
 	config.SetDailyFilePath(getAbsolutePath("data/daily.json"))
 
@@ -204,6 +235,9 @@ func main() {
 	key.StartKeyManager()
 	logger.Info("API密钥管理器已启动")
 
+	// 恢复重启前未完成的批量任务
+	proxy.ResumeBatches()
+
 	// 输出模型策略配置
 	logModelStrategies()
 
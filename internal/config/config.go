@@ -33,11 +33,36 @@ var (
 type Config struct {
 	Server struct {
 		Port int `mapstructure:"port"`
+		// 健康检查配置，/readyz 按该配置判断服务是否就绪
+		Health HealthConfig `mapstructure:"health"`
 	} `mapstructure:"server"`
 	ApiProxy struct {
 		BaseURL    string      `mapstructure:"base_url"`
 		ModelIndex int         `mapstructure:"model_index"` // 当前使用的模型索引
 		Retry      RetryConfig `mapstructure:"retry"`       // 重试配置
+		// 备用模型切换配置，模型的备用链保存在模型表中
+		Fallback FallbackConfig `mapstructure:"fallback"`
+		// 响应缓存配置，缓存数据保存在config.db同目录的cache.db中
+		Cache ResponseCacheConfig `mapstructure:"cache"`
+		// 流式请求对冲配置
+		Hedging HedgingConfig `mapstructure:"hedging"`
+		// 视频生成任务配置
+		Video VideoConfig `mapstructure:"video"`
+		// 本地批量任务配置
+		Batch BatchConfig `mapstructure:"batch"`
+		// 推理内容输出格式配置
+		Reasoning ReasoningConfig `mapstructure:"reasoning"`
+		// 结构化输出校验配置
+		StructuredOutput StructuredOutputConfig `mapstructure:"structured_output"`
+		// 上下文裁剪配置，模型的上下文长度保存在模型表中
+		ContextTrim ContextTrimConfig `mapstructure:"context_trim"`
+		// 请求准入控制配置，并发数上限使用RequestSettings.ProxyHandler.MaxConcurrency
+		Admission AdmissionConfig `mapstructure:"admission"`
+		// 按模型的熔断配置，熔断时切换到模型的备用链或直接返回错误
+		CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+		OllamaMode bool        `mapstructure:"ollama_mode"` // 是否启用Ollama接口模拟
+		// 额外的上游提供商，BaseURL对应的硅基流动为默认提供商
+		Providers []ProviderConfig `mapstructure:"providers"`
 	} `mapstructure:"api_proxy"`
 	Proxy struct {
 		HttpProxy  string `mapstructure:"http_proxy"`  // HTTP代理地址
@@ -53,15 +78,17 @@ type Config struct {
 		ExpirationMinutes int    `mapstructure:"expiration_minutes"` // 登录过期时间（分钟），0表示关闭浏览器即过期
 		ApiKeyEnabled     bool   `mapstructure:"api_key_enabled"`    // 是否启用API密钥验证
 		ApiKey            string `mapstructure:"api_key"`            // API密钥
+		RateLimit         RateLimitConfig `mapstructure:"rate_limit"` // 下游调用方的请求速率限制
+		// Prometheus指标接口的访问配置
+		Metrics MetricsConfig `mapstructure:"metrics"`
 	} `mapstructure:"security"`
 	App struct {
-		Title                  string  `mapstructure:"title"`                    // 应用标题
-		MinBalanceThreshold    float64 `mapstructure:"min_balance_threshold"`    // 最低余额阈值
-		MaxBalanceDisplay      float64 `mapstructure:"max_balance_display"`      // 余额显示最大值
-		ItemsPerPage           int     `mapstructure:"items_per_page"`           // 每页显示的密钥数量
-		MaxStatsEntries        int     `mapstructure:"max_stats_entries"`        // 最大统计条目数
-		RecoveryInterval       int     `mapstructure:"recovery_interval"`        // 恢复检查间隔（分钟）
-		MaxConsecutiveFailures int     `mapstructure:"max_consecutive_failures"` // 最大连续失败次数
+		Title               string  `mapstructure:"title"`                 // 应用标题
+		MinBalanceThreshold float64 `mapstructure:"min_balance_threshold"` // 最低余额阈值
+		MaxBalanceDisplay   float64 `mapstructure:"max_balance_display"`   // 余额显示最大值
+		ItemsPerPage        int     `mapstructure:"items_per_page"`        // 每页显示的密钥数量
+		MaxStatsEntries     int     `mapstructure:"max_stats_entries"`     // 最大统计条目数
+		RecoveryInterval    int     `mapstructure:"recovery_interval"`     // 恢复检查间隔（分钟）
 		// 权重配置
 		BalanceWeight     float64 `mapstructure:"balance_weight"`      // 余额评分权重
 		SuccessRateWeight float64 `mapstructure:"success_rate_weight"` // 成功率评分权重
@@ -147,6 +174,31 @@ type ApiKey struct {
 	Delete bool `json:"delete"` // 是否标记为删除
 	// 新增使用标记字段
 	IsUsed bool `json:"is_used"` // 是否被使用过
+	// 密钥所属的上游提供商，为空表示默认提供商
+	Provider string `json:"provider"`
+	// 冷却原因和冷却到期时间戳，到期时间为0表示直到被重新启用
+	CooldownReason string `json:"cooldown_reason"`
+	CooldownUntil  int64  `json:"cooldown_until"`
+}
+
+// 密钥冷却原因
+const (
+	KeyCooldownInvalid             = "invalid"              // 密钥无效（401），永久禁用直到手动启用
+	KeyCooldownInsufficientBalance = "insufficient_balance" // 余额不足，禁用到下一次余额刷新
+	KeyCooldownRateLimited         = "rate_limited"         // 触发上游速率限制（429），冷却到到期时间
+)
+
+// CoolingDown 返回密钥是否处于速率限制冷却中
+func (k ApiKey) CoolingDown() bool {
+	return k.CooldownReason == KeyCooldownRateLimited && k.CooldownUntil > time.Now().Unix()
+}
+
+// ProviderName 返回密钥所属的提供商名称
+func (k ApiKey) ProviderName() string {
+	if k.Provider == "" {
+		return DefaultProvider
+	}
+	return k.Provider
 }
 
 // RequestStats 请求统计结构
@@ -164,6 +216,449 @@ type RetryConfig struct {
 	RetryOnNetworkErrors bool  `yaml:"retry_on_network_errors" mapstructure:"retry_on_network_errors"` // 是否对网络错误进行重试
 }
 
+// FallbackConfig 备用模型切换配置
+type FallbackConfig struct {
+	StatusCodes  []int    `yaml:"status_codes" mapstructure:"status_codes"`   // 触发切换的HTTP状态码
+	OnTimeout    bool     `yaml:"on_timeout" mapstructure:"on_timeout"`       // 请求超时时是否切换
+	BusyKeywords []string `yaml:"busy_keywords" mapstructure:"busy_keywords"` // 错误响应中包含这些关键词时切换
+}
+
+// ResponseCacheConfig 响应缓存配置
+type ResponseCacheConfig struct {
+	Enabled    bool `yaml:"enabled" mapstructure:"enabled"`         // 是否启用响应缓存
+	TTLMinutes int  `yaml:"ttl_minutes" mapstructure:"ttl_minutes"` // 缓存有效期（分钟）
+	MaxEntries int  `yaml:"max_entries" mapstructure:"max_entries"` // 最大缓存条数
+	MaxSizeMB  int  `yaml:"max_size_mb" mapstructure:"max_size_mb"` // 缓存最大总大小（MB）
+}
+
+// HedgingConfig 流式请求对冲配置
+type HedgingConfig struct {
+	Enabled bool `yaml:"enabled" mapstructure:"enabled"`   // 是否启用请求对冲
+	DelayMs int  `yaml:"delay_ms" mapstructure:"delay_ms"` // 首个数据块超过该时间未到达时发送对冲请求（毫秒）
+}
+
+// 未配置对冲延迟时使用的默认值（毫秒）
+const defaultHedgingDelayMs = 2000
+
+// GetDelay 返回发送对冲请求前的等待时间，未配置时使用默认值
+func (h HedgingConfig) GetDelay() time.Duration {
+	if h.DelayMs <= 0 {
+		return defaultHedgingDelayMs * time.Millisecond
+	}
+	return time.Duration(h.DelayMs) * time.Millisecond
+}
+
+// VideoConfig 视频生成任务配置
+type VideoConfig struct {
+	DownloadEnabled bool   `yaml:"download_enabled" mapstructure:"download_enabled"` // 任务成功后是否将视频下载到本地，避免上游地址过期
+	DownloadDir     string `yaml:"download_dir" mapstructure:"download_dir"`         // 视频保存目录
+}
+
+// 未配置视频保存目录时使用的默认值
+const defaultVideoDownloadDir = "data/videos"
+
+// GetDownloadDir 返回视频保存目录，未配置时使用默认值
+func (v VideoConfig) GetDownloadDir() string {
+	if v.DownloadDir == "" {
+		return defaultVideoDownloadDir
+	}
+	return v.DownloadDir
+}
+
+// BatchConfig 本地Batches API配置
+type BatchConfig struct {
+	Concurrency int    `yaml:"concurrency" mapstructure:"concurrency"` // 所有批量任务同时执行的请求总数
+	FilesDir    string `yaml:"files_dir" mapstructure:"files_dir"`     // 上传文件和结果文件的保存目录
+}
+
+// 批量任务未配置时使用的默认值
+const (
+	defaultBatchConcurrency = 8
+	defaultBatchFilesDir    = "data/files"
+)
+
+// GetConcurrency 返回批量请求的总并发数，未配置时使用默认值，且不超过代理的最大并发数
+func (b BatchConfig) GetConcurrency(maxConcurrency int) int {
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if maxConcurrency > 0 && concurrency > maxConcurrency {
+		concurrency = maxConcurrency
+	}
+	return concurrency
+}
+
+// GetFilesDir 返回文件保存目录，未配置时使用默认值
+func (b BatchConfig) GetFilesDir() string {
+	if b.FilesDir == "" {
+		return defaultBatchFilesDir
+	}
+	return b.FilesDir
+}
+
+// 推理内容的输出格式
+const (
+	ReasoningFormatRaw       = "raw"       // 保持上游的reasoning_content字段
+	ReasoningFormatThink     = "think"     // 以<think>...</think>形式内联到content中
+	ReasoningFormatDrop      = "drop"      // 丢弃推理内容
+	ReasoningFormatReasoning = "reasoning" // 使用OpenAI风格的reasoning字段
+)
+
+// ReasoningConfig 推理内容输出格式配置
+type ReasoningConfig struct {
+	Format        string            `yaml:"format" mapstructure:"format"`                 // 默认输出格式
+	ClientFormats map[string]string `yaml:"client_formats" mapstructure:"client_formats"` // 按下游客户端设置的输出格式
+}
+
+// IsValidReasoningFormat 判断推理内容输出格式是否有效
+func IsValidReasoningFormat(format string) bool {
+	switch format {
+	case ReasoningFormatRaw, ReasoningFormatThink, ReasoningFormatDrop, ReasoningFormatReasoning:
+		return true
+	}
+	return false
+}
+
+// GetFormat 返回下游客户端使用的推理内容输出格式，未配置时保持上游格式
+func (r ReasoningConfig) GetFormat(client string) string {
+	if format := r.ClientFormats[client]; client != "" && IsValidReasoningFormat(format) {
+		return format
+	}
+	if IsValidReasoningFormat(r.Format) {
+		return r.Format
+	}
+	return ReasoningFormatRaw
+}
+
+// StructuredOutputConfig 结构化输出校验配置，对要求json_schema格式的非流式聊天请求校验模型输出
+type StructuredOutputConfig struct {
+	Enabled    bool `yaml:"enabled" mapstructure:"enabled"`         // 是否校验模型输出
+	MaxRetries int  `yaml:"max_retries" mapstructure:"max_retries"` // 输出不符合Schema时使用纠正提示重试的最大次数
+}
+
+// 未配置结构化输出重试次数时使用的默认值
+const defaultStructuredOutputMaxRetries = 2
+
+// GetMaxRetries 返回纠正重试的最大次数，小于0时使用默认值
+func (s StructuredOutputConfig) GetMaxRetries() int {
+	if s.MaxRetries < 0 {
+		return defaultStructuredOutputMaxRetries
+	}
+	return s.MaxRetries
+}
+
+// 超出上下文长度时的裁剪策略
+const (
+	ContextTrimOff       = "off"       // 不裁剪
+	ContextTrimDrop      = "drop"      // 保留系统提示，丢弃最早的消息
+	ContextTrimSummarize = "summarize" // 使用摘要模型总结最早的消息，替换原消息
+)
+
+// ContextTrimConfig 上下文裁剪配置
+type ContextTrimConfig struct {
+	Policy        string `yaml:"policy" mapstructure:"policy"`                 // 裁剪策略：off、drop或summarize
+	SummaryModel  string `yaml:"summary_model" mapstructure:"summary_model"`   // 生成摘要使用的模型，建议使用低价模型
+	ReserveTokens int    `yaml:"reserve_tokens" mapstructure:"reserve_tokens"` // 请求未指定max_tokens时为输出预留的令牌数
+}
+
+// 上下文裁剪未配置时使用的默认值
+const (
+	defaultContextTrimSummaryModel  = "Qwen/Qwen2.5-7B-Instruct"
+	defaultContextTrimReserveTokens = 1024
+)
+
+// IsValidContextTrimPolicy 判断上下文裁剪策略是否有效
+func IsValidContextTrimPolicy(policy string) bool {
+	switch policy {
+	case ContextTrimOff, ContextTrimDrop, ContextTrimSummarize:
+		return true
+	}
+	return false
+}
+
+// GetPolicy 返回裁剪策略，未配置或无效时不裁剪
+func (t ContextTrimConfig) GetPolicy() string {
+	if IsValidContextTrimPolicy(t.Policy) {
+		return t.Policy
+	}
+	return ContextTrimOff
+}
+
+// GetSummaryModel 返回生成摘要使用的模型，未配置时使用默认值
+func (t ContextTrimConfig) GetSummaryModel() string {
+	if t.SummaryModel == "" {
+		return defaultContextTrimSummaryModel
+	}
+	return t.SummaryModel
+}
+
+// GetReserveTokens 返回为输出预留的令牌数，未配置时使用默认值
+func (t ContextTrimConfig) GetReserveTokens() int {
+	if t.ReserveTokens <= 0 {
+		return defaultContextTrimReserveTokens
+	}
+	return t.ReserveTokens
+}
+
+// AdmissionConfig 请求准入控制配置，并发请求达到上限时按优先级排队等待
+// 推理模型和普通模型使用独立的并发池，两个并发池的大小之和为代理的最大并发数
+type AdmissionConfig struct {
+	Enabled          bool `yaml:"enabled" mapstructure:"enabled"`                     // 是否启用准入控制
+	HeavyConcurrency int  `yaml:"heavy_concurrency" mapstructure:"heavy_concurrency"` // 推理模型并发池的大小，从最大并发数中划分
+	MaxQueueSize     int  `yaml:"max_queue_size" mapstructure:"max_queue_size"`       // 每个并发池的最大排队请求数
+	MaxWaitSeconds   int  `yaml:"max_wait_seconds" mapstructure:"max_wait_seconds"`   // 最长排队时间（秒），超过后返回503
+}
+
+// 准入控制未配置时使用的默认值
+const (
+	defaultAdmissionMaxQueueSize   = 200
+	defaultAdmissionMaxWaitSeconds = 30
+)
+
+// GetPoolSizes 按最大并发数返回推理模型和普通模型并发池的大小，每个并发池至少为1
+// 未配置推理模型并发数时划分最大并发数的1/4
+func (a AdmissionConfig) GetPoolSizes(maxConcurrency int) (int, int) {
+	if maxConcurrency < 2 {
+		maxConcurrency = 2
+	}
+	heavy := a.HeavyConcurrency
+	if heavy <= 0 {
+		heavy = maxConcurrency / 4
+	}
+	if heavy < 1 {
+		heavy = 1
+	}
+	if heavy > maxConcurrency-1 {
+		heavy = maxConcurrency - 1
+	}
+	return heavy, maxConcurrency - heavy
+}
+
+// GetMaxQueueSize 返回每个并发池的最大排队请求数，未配置时使用默认值
+func (a AdmissionConfig) GetMaxQueueSize() int {
+	if a.MaxQueueSize <= 0 {
+		return defaultAdmissionMaxQueueSize
+	}
+	return a.MaxQueueSize
+}
+
+// GetMaxWait 返回最长排队时间，未配置时使用默认值
+func (a AdmissionConfig) GetMaxWait() time.Duration {
+	if a.MaxWaitSeconds <= 0 {
+		return defaultAdmissionMaxWaitSeconds * time.Second
+	}
+	return time.Duration(a.MaxWaitSeconds) * time.Second
+}
+
+// CircuitBreakerConfig 按模型的熔断配置
+// 统计窗口内的请求数达到最小请求数且上游错误率达到阈值时打开熔断器，打开期间直接失败或切换到备用模型，
+// 经过打开时间后进入半开状态，放行探测请求，探测全部成功时关闭，任一失败时重新打开
+type CircuitBreakerConfig struct {
+	Enabled          bool `yaml:"enabled" mapstructure:"enabled"`                       // 是否启用熔断
+	WindowSeconds    int  `yaml:"window_seconds" mapstructure:"window_seconds"`         // 统计窗口（秒）
+	MinRequests      int  `yaml:"min_requests" mapstructure:"min_requests"`             // 统计窗口内的最小请求数，少于该值时不熔断
+	ErrorRatePercent int  `yaml:"error_rate_percent" mapstructure:"error_rate_percent"` // 错误率阈值（百分比）
+	OpenSeconds      int  `yaml:"open_seconds" mapstructure:"open_seconds"`             // 熔断器打开后进入半开状态前的等待时间（秒）
+	HalfOpenProbes   int  `yaml:"half_open_probes" mapstructure:"half_open_probes"`     // 半开状态放行的探测请求数，全部成功后关闭熔断器
+}
+
+// 熔断未配置时使用的默认值
+const (
+	defaultBreakerWindowSeconds    = 60
+	defaultBreakerMinRequests      = 10
+	defaultBreakerErrorRatePercent = 50
+	defaultBreakerOpenSeconds      = 30
+	defaultBreakerHalfOpenProbes   = 3
+)
+
+// GetWindow 返回统计窗口，未配置时使用默认值
+func (b CircuitBreakerConfig) GetWindow() time.Duration {
+	if b.WindowSeconds <= 0 {
+		return defaultBreakerWindowSeconds * time.Second
+	}
+	return time.Duration(b.WindowSeconds) * time.Second
+}
+
+// GetMinRequests 返回统计窗口内的最小请求数，未配置时使用默认值
+func (b CircuitBreakerConfig) GetMinRequests() int {
+	if b.MinRequests <= 0 {
+		return defaultBreakerMinRequests
+	}
+	return b.MinRequests
+}
+
+// GetErrorRate 返回错误率阈值（0到1），未配置或无效时使用默认值
+func (b CircuitBreakerConfig) GetErrorRate() float64 {
+	if b.ErrorRatePercent <= 0 || b.ErrorRatePercent > 100 {
+		return defaultBreakerErrorRatePercent / 100.0
+	}
+	return float64(b.ErrorRatePercent) / 100
+}
+
+// GetOpenDuration 返回熔断器打开的时间，未配置时使用默认值
+func (b CircuitBreakerConfig) GetOpenDuration() time.Duration {
+	if b.OpenSeconds <= 0 {
+		return defaultBreakerOpenSeconds * time.Second
+	}
+	return time.Duration(b.OpenSeconds) * time.Second
+}
+
+// GetHalfOpenProbes 返回半开状态的探测请求数，未配置时使用默认值
+func (b CircuitBreakerConfig) GetHalfOpenProbes() int {
+	if b.HalfOpenProbes <= 0 {
+		return defaultBreakerHalfOpenProbes
+	}
+	return b.HalfOpenProbes
+}
+
+// HealthConfig 健康检查配置
+// /readyz 检查配置数据库、模型数据库、可用API密钥数和上游地址，上游检查结果缓存一段时间，避免探针频繁请求上游
+type HealthConfig struct {
+	MinActiveKeys          int  `yaml:"min_active_keys" mapstructure:"min_active_keys"`                   // 就绪需要的最少可用API密钥数
+	UpstreamCheck          bool `yaml:"upstream_check" mapstructure:"upstream_check"`                     // 是否检查上游地址可达
+	UpstreamCacheSeconds   int  `yaml:"upstream_cache_seconds" mapstructure:"upstream_cache_seconds"`     // 上游检查结果的缓存时间（秒）
+	UpstreamTimeoutSeconds int  `yaml:"upstream_timeout_seconds" mapstructure:"upstream_timeout_seconds"` // 上游检查的超时时间（秒）
+}
+
+// 健康检查未配置时使用的默认值
+const (
+	defaultHealthMinActiveKeys          = 1
+	defaultHealthUpstreamCacheSeconds   = 30
+	defaultHealthUpstreamTimeoutSeconds = 5
+)
+
+// GetMinActiveKeys 返回就绪需要的最少可用API密钥数，未配置时使用默认值
+func (h HealthConfig) GetMinActiveKeys() int {
+	if h.MinActiveKeys <= 0 {
+		return defaultHealthMinActiveKeys
+	}
+	return h.MinActiveKeys
+}
+
+// GetUpstreamCacheDuration 返回上游检查结果的缓存时间，未配置时使用默认值
+func (h HealthConfig) GetUpstreamCacheDuration() time.Duration {
+	if h.UpstreamCacheSeconds <= 0 {
+		return defaultHealthUpstreamCacheSeconds * time.Second
+	}
+	return time.Duration(h.UpstreamCacheSeconds) * time.Second
+}
+
+// GetUpstreamTimeout 返回上游检查的超时时间，未配置时使用默认值
+func (h HealthConfig) GetUpstreamTimeout() time.Duration {
+	if h.UpstreamTimeoutSeconds <= 0 {
+		return defaultHealthUpstreamTimeoutSeconds * time.Second
+	}
+	return time.Duration(h.UpstreamTimeoutSeconds) * time.Second
+}
+
+// RateLimitConfig 下游调用方的速率限制配置，按API密钥区分调用方，未使用API密钥时按IP区分
+type RateLimitConfig struct {
+	Enabled           bool `yaml:"enabled" mapstructure:"enabled"`                         // 是否启用速率限制
+	RequestsPerMinute int  `yaml:"requests_per_minute" mapstructure:"requests_per_minute"` // 每分钟请求数，0表示不限制
+	TokensPerMinute   int  `yaml:"tokens_per_minute" mapstructure:"tokens_per_minute"`     // 每分钟令牌数，0表示不限制
+}
+
+// 指标接口的访问方式
+const (
+	MetricsAccessOpen     = "open"     // 主端口的/metrics无需认证
+	MetricsAccessPassword = "password" // 主端口的/metrics使用访问密码认证（Basic或Bearer）
+	MetricsAccessListener = "listener" // 只在单独的监听地址上提供/metrics
+)
+
+// 单独监听时未配置地址使用的默认值
+const defaultMetricsListenAddr = ":9464"
+
+// MetricsConfig Prometheus指标接口的访问配置
+type MetricsConfig struct {
+	Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`         // 是否启用指标接口
+	Access     string `yaml:"access" mapstructure:"access"`           // 访问方式：open、password或listener
+	ListenAddr string `yaml:"listen_addr" mapstructure:"listen_addr"` // 单独监听的地址，修改后需要重启
+}
+
+// GetAccess 返回指标接口的访问方式，未配置或无法识别时使用密码认证
+func (m MetricsConfig) GetAccess() string {
+	switch m.Access {
+	case MetricsAccessOpen, MetricsAccessListener:
+		return m.Access
+	default:
+		return MetricsAccessPassword
+	}
+}
+
+// GetListenAddr 返回单独监听的地址，未配置时使用默认值
+func (m MetricsConfig) GetListenAddr() string {
+	if m.ListenAddr == "" {
+		return defaultMetricsListenAddr
+	}
+	return m.ListenAddr
+}
+
+// 响应缓存未配置时使用的默认值
+const (
+	defaultCacheTTLMinutes = 24 * 60
+	defaultCacheMaxEntries = 10000
+	defaultCacheMaxSizeMB  = 200
+)
+
+// GetTTL 返回缓存有效期，未配置时使用默认值
+func (r ResponseCacheConfig) GetTTL() time.Duration {
+	if r.TTLMinutes <= 0 {
+		return defaultCacheTTLMinutes * time.Minute
+	}
+	return time.Duration(r.TTLMinutes) * time.Minute
+}
+
+// GetMaxEntries 返回最大缓存条数，未配置时使用默认值
+func (r ResponseCacheConfig) GetMaxEntries() int {
+	if r.MaxEntries <= 0 {
+		return defaultCacheMaxEntries
+	}
+	return r.MaxEntries
+}
+
+// GetMaxSizeBytes 返回缓存最大总大小（字节），未配置时使用默认值
+func (r ResponseCacheConfig) GetMaxSizeBytes() int64 {
+	if r.MaxSizeMB <= 0 {
+		return defaultCacheMaxSizeMB << 20
+	}
+	return int64(r.MaxSizeMB) << 20
+}
+
+// 旧配置中没有备用切换配置时使用的默认值
+var (
+	defaultFallbackStatusCodes  = []int{429, 503, 504}
+	defaultFallbackBusyKeywords = []string{"busy", "overloaded", "繁忙", "过载"}
+)
+
+// GetStatusCodes 返回触发切换的状态码，未配置时使用默认值
+func (f FallbackConfig) GetStatusCodes() []int {
+	if f.StatusCodes == nil {
+		return defaultFallbackStatusCodes
+	}
+	return f.StatusCodes
+}
+
+// GetBusyKeywords 返回繁忙关键词，未配置时使用默认值
+func (f FallbackConfig) GetBusyKeywords() []string {
+	if f.BusyKeywords == nil {
+		return defaultFallbackBusyKeywords
+	}
+	return f.BusyKeywords
+}
+
+// DefaultProvider 默认提供商名称，使用ApiProxy.BaseURL
+const DefaultProvider = "siliconflow"
+
+// ProviderConfig 上游提供商配置
+type ProviderConfig struct {
+	Name    string   `yaml:"name" mapstructure:"name"`         // 提供商名称，密钥通过名称关联提供商
+	Type    string   `yaml:"type" mapstructure:"type"`         // 提供商类型：siliconflow、deepseek、moonshot、openai
+	BaseURL string   `yaml:"base_url" mapstructure:"base_url"` // API基础URL，不包含/v1
+	Models  []string `yaml:"models" mapstructure:"models"`     // 该提供商服务的模型，支持前缀通配如deepseek-*，为空时从上游获取
+	Enabled bool     `yaml:"enabled" mapstructure:"enabled"`   // 是否启用
+}
+
 // standardizeModelKeyStrategies 统一模型名称的大小写处理
 func standardizeModelKeyStrategies() {
 	if config == nil || config.App.ModelKeyStrategies == nil {
@@ -252,16 +747,26 @@ func MaskKey(key string) string {
 	return prefix + "..." + suffix
 }
 
-// AddApiKey 添加新的API密钥
+// AddApiKey 添加新的API密钥，归属默认提供商
 func AddApiKey(key string, balance float64) {
+	AddProviderApiKey(key, "", balance)
+}
+
+// AddProviderApiKey 添加属于指定提供商的API密钥
+func AddProviderApiKey(key string, provider string, balance float64) {
+	if provider == DefaultProvider {
+		provider = ""
+	}
+
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
 	// 检查密钥是否已存在（包括被逻辑删除的密钥）
 	for i, k := range apiKeys {
 		if k.Key == key {
-			// 更新现有密钥的余额
+			// 更新现有密钥的余额和提供商
 			apiKeys[i].Balance = balance
+			apiKeys[i].Provider = provider
 			// 如果密钥被标记为删除，恢复它
 			if apiKeys[i].Delete {
 				apiKeys[i].Delete = false
@@ -292,8 +797,8 @@ func AddApiKey(key string, balance float64) {
 
 		if err == nil && exists && isDeleted {
 			// 密钥存在但被逻辑删除，恢复它
-			_, err := db.Exec(`UPDATE `+apikeysTableName+` SET is_delete = ?, balance = ? WHERE key = ?`,
-				false, balance, key)
+			_, err := db.Exec(`UPDATE `+apikeysTableName+` SET is_delete = ?, balance = ?, provider = ? WHERE key = ?`,
+				false, balance, provider, key)
 			if err == nil {
 				// 重新加载密钥
 				if loadErr := LoadApiKeysFromDB(); loadErr != nil {
@@ -308,8 +813,9 @@ func AddApiKey(key string, balance float64) {
 
 	// 添加新密钥
 	newKey := ApiKey{
-		Key:     key,
-		Balance: balance,
+		Key:      key,
+		Balance:  balance,
+		Provider: provider,
 	}
 
 	// 检查余额并设置初始禁用状态
@@ -756,6 +1262,102 @@ func DisableApiKey(key string) bool {
 	return true
 }
 
+// DisableApiKeyWithReason 按冷却原因禁用API密钥，密钥已经禁用时更新冷却原因
+func DisableApiKeyWithReason(key string, reason string) bool {
+	keysMutex.Lock()
+
+	var keyFound bool
+	var keyDisabledAt int64
+
+	for i, k := range apiKeys {
+		if k.Key == key {
+			// 已经因为相同原因禁用，不需要再做操作
+			if k.Disabled && k.CooldownReason == reason {
+				keysMutex.Unlock()
+				return true
+			}
+
+			keyFound = true
+			keyDisabledAt = k.DisabledAt
+			if !k.Disabled {
+				keyDisabledAt = time.Now().Unix()
+			}
+
+			apiKeys[i].Disabled = true
+			apiKeys[i].DisabledAt = keyDisabledAt
+			apiKeys[i].CooldownReason = reason
+			apiKeys[i].CooldownUntil = 0
+			break
+		}
+	}
+
+	if !keyFound {
+		keysMutex.Unlock()
+		return false
+	}
+
+	keysMutex.Unlock()
+
+	if db != nil {
+		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
+			SET disabled = ?, disabled_at = ?, cooldown_reason = ?, cooldown_until = ? 
+			WHERE key = ?`,
+			true, keyDisabledAt, reason, 0, key)
+		if err != nil {
+			logger.Error("更新API密钥禁用状态到数据库失败: %v", err)
+		} else {
+			logger.Info("已更新API密钥禁用状态到数据库: %s, 原因: %s", MaskKey(key), reason)
+		}
+	}
+
+	return true
+}
+
+// CooldownApiKey 让API密钥在指定时间戳之前暂停使用，不改变禁用状态
+func CooldownApiKey(key string, reason string, until int64) bool {
+	keysMutex.Lock()
+
+	var keyFound bool
+	for i, k := range apiKeys {
+		if k.Key == key {
+			// 已经禁用的密钥不需要冷却，保留禁用原因
+			if k.Disabled {
+				keysMutex.Unlock()
+				return true
+			}
+			// 已有更晚的冷却到期时间时保留
+			if k.CooldownReason == reason && k.CooldownUntil >= until {
+				keysMutex.Unlock()
+				return true
+			}
+
+			keyFound = true
+			apiKeys[i].CooldownReason = reason
+			apiKeys[i].CooldownUntil = until
+			break
+		}
+	}
+
+	if !keyFound {
+		keysMutex.Unlock()
+		return false
+	}
+
+	keysMutex.Unlock()
+
+	if db != nil {
+		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
+			SET cooldown_reason = ?, cooldown_until = ? 
+			WHERE key = ?`,
+			reason, until, key)
+		if err != nil {
+			logger.Error("更新API密钥冷却状态到数据库失败: %v", err)
+		}
+	}
+
+	return true
+}
+
 // EnableApiKey 启用API密钥
 func EnableApiKey(key string) bool {
 	keysMutex.Lock()
@@ -781,8 +1383,8 @@ func EnableApiKey(key string) bool {
 				return false
 			}
 
-			// 如果已经启用，不需要再做操作
-			if !k.Disabled {
+			// 如果已经启用且没有冷却，不需要再做操作
+			if !k.Disabled && k.CooldownReason == "" {
 				keysMutex.Unlock()
 				return true
 			}
@@ -791,6 +1393,8 @@ func EnableApiKey(key string) bool {
 			apiKeys[i].Disabled = false
 			apiKeys[i].DisabledAt = 0
 			apiKeys[i].ConsecutiveFailures = 0
+			apiKeys[i].CooldownReason = ""
+			apiKeys[i].CooldownUntil = 0
 			break
 		}
 	}
@@ -807,9 +1411,9 @@ func EnableApiKey(key string) bool {
 	// 保存更新到数据库
 	if db != nil {
 		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
-			SET disabled = ?, disabled_at = ?, consecutive_failures = ? 
+			SET disabled = ?, disabled_at = ?, consecutive_failures = ?, cooldown_reason = ?, cooldown_until = ? 
 			WHERE key = ?`,
-			false, 0, 0, key)
+			false, 0, 0, "", 0, key)
 		if err != nil {
 			logger.Error("更新API密钥启用状态到数据库失败: %v", err)
 		} else {
@@ -997,14 +1601,14 @@ func SortApiKeysByPriority() {
 	apiKeys = sortedKeys
 }
 
-// GetActiveApiKeys 获取所有未禁用且余额充足的API密钥
+// GetActiveApiKeys 获取所有未禁用、不在冷却中且余额充足的API密钥
 func GetActiveApiKeys() []ApiKey {
 	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
 
-	// 筛选出未禁用且余额充足的密钥
+	// 筛选出未禁用、不在冷却中且余额充足的密钥
 	var activeKeys []ApiKey
 	for _, key := range allKeys {
-		if !key.Disabled && key.Balance >= config.App.MinBalanceThreshold {
+		if !key.Disabled && !key.CoolingDown() && key.Balance >= config.App.MinBalanceThreshold {
 			activeKeys = append(activeKeys, key)
 		}
 	}
@@ -1012,6 +1616,18 @@ func GetActiveApiKeys() []ApiKey {
 	return activeKeys
 }
 
+// GetActiveApiKeysByProvider 获取指定提供商下所有未禁用且余额充足的API密钥
+func GetActiveApiKeysByProvider(provider string) []ApiKey {
+	var providerKeys []ApiKey
+	for _, key := range GetActiveApiKeys() {
+		if key.ProviderName() == provider {
+			providerKeys = append(providerKeys, key)
+		}
+	}
+
+	return providerKeys
+}
+
 // GetDisabledApiKeys 获取所有禁用的API密钥
 func GetDisabledApiKeys() []ApiKey {
 	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
@@ -1369,7 +1985,15 @@ func EnsureDefaultConfig(dbPath string) error {
 
 		// 插入默认配置
 		defaultConfig := fmt.Sprintf(`{
-			"Server":{"Port":3016},
+			"Server":{
+				"Port":3016,
+				"Health":{
+					"MinActiveKeys":1,
+					"UpstreamCheck":true,
+					"UpstreamCacheSeconds":30,
+					"UpstreamTimeoutSeconds":5
+				}
+			},
 			"ApiProxy":{
 				"BaseURL":"https://api.siliconflow.cn",
 				"ModelIndex":0,
@@ -1378,7 +2002,59 @@ func EnsureDefaultConfig(dbPath string) error {
 					"RetryDelayMs":1000,
 					"RetryOnStatusCodes":[500,502,503,504],
 					"RetryOnNetworkErrors":true
-				}
+				},
+				"Fallback":{
+					"StatusCodes":[429,503,504],
+					"OnTimeout":true,
+					"BusyKeywords":["busy","overloaded","繁忙","过载"]
+				},
+				"Cache":{
+					"Enabled":true,
+					"TTLMinutes":1440,
+					"MaxEntries":10000,
+					"MaxSizeMB":200
+				},
+				"Hedging":{
+					"Enabled":false,
+					"DelayMs":2000
+				},
+				"Video":{
+					"DownloadEnabled":false,
+					"DownloadDir":"data/videos"
+				},
+				"Batch":{
+					"Concurrency":8,
+					"FilesDir":"data/files"
+				},
+				"Reasoning":{
+					"Format":"raw",
+					"ClientFormats":{}
+				},
+				"StructuredOutput":{
+					"Enabled":true,
+					"MaxRetries":2
+				},
+				"ContextTrim":{
+					"Policy":"off",
+					"SummaryModel":"Qwen/Qwen2.5-7B-Instruct",
+					"ReserveTokens":1024
+				},
+				"Admission":{
+					"Enabled":true,
+					"HeavyConcurrency":0,
+					"MaxQueueSize":200,
+					"MaxWaitSeconds":30
+				},
+				"CircuitBreaker":{
+					"Enabled":false,
+					"WindowSeconds":60,
+					"MinRequests":10,
+					"ErrorRatePercent":50,
+					"OpenSeconds":30,
+					"HalfOpenProbes":3
+				},
+				"OllamaMode":false,
+				"Providers":[]
 			},
 			"Proxy":{
 				"HttpProxy":"",
@@ -1392,7 +2068,17 @@ func EnsureDefaultConfig(dbPath string) error {
 				"Password":"",
 				"ExpirationMinutes":1,
 				"ApiKeyEnabled":false,
-				"ApiKey":""
+				"ApiKey":"",
+				"RateLimit":{
+					"Enabled":false,
+					"RequestsPerMinute":60,
+					"TokensPerMinute":100000
+				},
+				"Metrics":{
+					"Enabled":false,
+					"Access":"password",
+					"ListenAddr":":9464"
+				}
 			},
 			"App":{
 				"Title":"流动硅基 FlowSilicon %s",
@@ -1401,7 +2087,6 @@ func EnsureDefaultConfig(dbPath string) error {
 				"ItemsPerPage":5,
 				"MaxStatsEntries":60,
 				"RecoveryInterval":10,
-				"MaxConsecutiveFailures":5,
 				"BalanceWeight":0.4,
 				"SuccessRateWeight":0.3,
 				"RPMWeight":0.15,
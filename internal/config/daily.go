@@ -22,11 +22,13 @@ var (
 
 // DailyStats 每日统计数据结构
 type DailyStats struct {
-	Date     string                `json:"date"`
-	Requests DailyRequestStats     `json:"requests"`
-	Tokens   DailyTokenStats       `json:"tokens"`
-	Models   map[string]ModelStats `json:"models"`
-	Hourly   []HourlyStats         `json:"hourly"`
+	Date     string                 `json:"date"`
+	Requests DailyRequestStats      `json:"requests"`
+	Tokens   DailyTokenStats        `json:"tokens"`
+	Audio    DailyAudioStats        `json:"audio"`
+	Models   map[string]ModelStats  `json:"models"`
+	Hourly   []HourlyStats          `json:"hourly"`
+	Clients  map[string]ClientStats `json:"clients,omitempty"` // 按客户端名称统计
 }
 
 // DailyRequestStats 每日请求统计
@@ -41,12 +43,47 @@ type DailyTokenStats struct {
 	Total      int `json:"total"`
 	Prompt     int `json:"prompt"`
 	Completion int `json:"completion"`
+	Reasoning  int `json:"reasoning"` // 推理令牌数，已包含在Completion中
+}
+
+// DailyAudioStats 每日音频用量统计
+type DailyAudioStats struct {
+	Seconds    float64 `json:"seconds"`    // 语音识别的音频时长（秒）
+	Characters int     `json:"characters"` // 语音合成的文本字符数
 }
 
 // ModelStats 模型使用统计
 type ModelStats struct {
-	Requests int `json:"requests"`
-	Tokens   int `json:"tokens"`
+	Requests     int     `json:"requests"`
+	Tokens       int     `json:"tokens"`
+	Fallbacks    int     `json:"fallbacks,omitempty"`     // 作为备用模型提供服务的次数
+	AudioSeconds float64 `json:"audio_seconds,omitempty"` // 语音识别的音频时长（秒）
+	Characters   int     `json:"characters,omitempty"`    // 语音合成的文本字符数
+	Reasoning    int     `json:"reasoning,omitempty"`     // 推理令牌数，已包含在Tokens中
+	// 结构化输出校验结果，统计模型对json_schema的遵循情况
+	SchemaValid    int `json:"schema_valid,omitempty"`    // 首次输出即符合Schema的次数
+	SchemaRepaired int `json:"schema_repaired,omitempty"` // 经过本地修复后符合Schema的次数
+	SchemaRetried  int `json:"schema_retried,omitempty"`  // 经过纠正重试后符合Schema的次数
+	SchemaFailed   int `json:"schema_failed,omitempty"`   // 重试后仍不符合Schema的次数
+}
+
+// 结构化输出校验结果
+const (
+	SchemaOutcomeValid    = "valid"
+	SchemaOutcomeRepaired = "repaired"
+	SchemaOutcomeRetried  = "retried"
+	SchemaOutcomeFailed   = "failed"
+)
+
+// ClientStats 客户端使用统计
+type ClientStats struct {
+	Requests   int                 `json:"requests"`
+	Failed     int                 `json:"failed"`
+	Prompt     int                 `json:"prompt"`
+	Completion int                 `json:"completion"`
+	Tokens     int                 `json:"tokens"`
+	Cost       float64             `json:"cost"`             // 按模型价格计算的消费金额（元）
+	Models     map[string]KeyUsage `json:"models,omitempty"` // 按模型统计
 }
 
 // HourlyStats 每小时统计
@@ -145,10 +182,10 @@ func loadDailyDataLocked() error {
 	return nil
 }
 
-// saveDailyData 保存每日统计数据到文件
+// saveDailyData 保存每日统计数据到文件，保存时会更新最后更新时间，需要持有写锁
 func saveDailyData() error {
-	dailyDataLock.RLock()
-	defer dailyDataLock.RUnlock()
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
 	return saveDailyDataLocked()
 }
 
@@ -387,6 +424,250 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 	}()
 }
 
+// todayStatsLocked 获取今天的统计数据（已加锁）
+func todayStatsLocked() *DailyStats {
+	ensureTodayDataExistsLocked()
+
+	today := time.Now().Format("2006-01-02")
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			if dailyData.DailyStats[i].Models == nil {
+				dailyData.DailyStats[i].Models = make(map[string]ModelStats)
+			}
+			return &dailyData.DailyStats[i]
+		}
+	}
+	return nil
+}
+
+// AddDailyFallbackStat 记录模型作为备用模型提供服务的次数，请求和令牌统计由AddDailyRequestStat记录
+func AddDailyFallbackStat(model string) {
+	if model == "" {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats == nil {
+		return
+	}
+
+	modelStats := todayStats.Models[model]
+	modelStats.Fallbacks++
+	todayStats.Models[model] = modelStats
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// AddDailySchemaStat 记录模型结构化输出的校验结果
+func AddDailySchemaStat(model string, outcome string) {
+	if model == "" {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats == nil {
+		return
+	}
+
+	modelStats := todayStats.Models[model]
+	switch outcome {
+	case SchemaOutcomeValid:
+		modelStats.SchemaValid++
+	case SchemaOutcomeRepaired:
+		modelStats.SchemaRepaired++
+	case SchemaOutcomeRetried:
+		modelStats.SchemaRetried++
+	case SchemaOutcomeFailed:
+		modelStats.SchemaFailed++
+	default:
+		return
+	}
+	todayStats.Models[model] = modelStats
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// AddDailyAudioStat 记录音频请求的用量，语音识别按音频秒数，语音合成按文本字符数，请求次数由AddDailyRequestStat记录
+func AddDailyAudioStat(model string, seconds float64, characters int) {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats == nil {
+		return
+	}
+
+	todayStats.Audio.Seconds += seconds
+	todayStats.Audio.Characters += characters
+	if model != "" {
+		modelStats := todayStats.Models[model]
+		modelStats.AudioSeconds += seconds
+		modelStats.Characters += characters
+		todayStats.Models[model] = modelStats
+	}
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// AddDailyReasoningStat 记录推理模型输出的推理令牌数，推理令牌已包含在AddDailyRequestStat记录的completion令牌中
+func AddDailyReasoningStat(model string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats == nil {
+		return
+	}
+
+	todayStats.Tokens.Reasoning += tokens
+	if model != "" {
+		modelStats := todayStats.Models[model]
+		modelStats.Reasoning += tokens
+		todayStats.Models[model] = modelStats
+	}
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// AddDailyClientStat 记录客户端的请求、令牌和消费，总请求和令牌统计由AddDailyRequestStat记录
+func AddDailyClientStat(client, model string, promptTokens, completionTokens int, cost float64, isSuccess bool) {
+	if client == "" {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	todayStats := todayStatsLocked()
+	if todayStats == nil {
+		return
+	}
+	if todayStats.Clients == nil {
+		todayStats.Clients = make(map[string]ClientStats)
+	}
+
+	clientStats := todayStats.Clients[client]
+	clientStats.Requests++
+	if !isSuccess {
+		clientStats.Failed++
+	}
+	clientStats.Prompt += promptTokens
+	clientStats.Completion += completionTokens
+	clientStats.Tokens += promptTokens + completionTokens
+	clientStats.Cost += cost
+	if model != "" {
+		if clientStats.Models == nil {
+			clientStats.Models = make(map[string]KeyUsage)
+		}
+		usage := clientStats.Models[model]
+		usage.Requests++
+		usage.Tokens += promptTokens + completionTokens
+		clientStats.Models[model] = usage
+	}
+	todayStats.Clients[client] = clientStats
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// RenameDailyClientStats 客户端重命名后将所有日期中旧名称的统计合并到新名称下
+func RenameDailyClientStats(oldName, newName string) {
+	if oldName == "" || newName == "" || oldName == newName {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	if dailyData == nil {
+		return
+	}
+	renamed := false
+	for i := range dailyData.DailyStats {
+		clients := dailyData.DailyStats[i].Clients
+		old, ok := clients[oldName]
+		if !ok {
+			continue
+		}
+		merged := clients[newName]
+		merged.Requests += old.Requests
+		merged.Failed += old.Failed
+		merged.Prompt += old.Prompt
+		merged.Completion += old.Completion
+		merged.Tokens += old.Tokens
+		merged.Cost += old.Cost
+		for model, usage := range old.Models {
+			if merged.Models == nil {
+				merged.Models = make(map[string]KeyUsage)
+			}
+			total := merged.Models[model]
+			total.Requests += usage.Requests
+			total.Tokens += usage.Tokens
+			merged.Models[model] = total
+		}
+		clients[newName] = merged
+		delete(clients, oldName)
+		renamed = true
+	}
+
+	if renamed {
+		if err := saveDailyDataLocked(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}
+}
+
+// GetTodayClientStats 获取客户端今天的使用统计，用于检查每日配额
+func GetTodayClientStats(client string) ClientStats {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return ClientStats{}
+	}
+	today := time.Now().Format("2006-01-02")
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == today {
+			return stats.Clients[client]
+		}
+	}
+	return ClientStats{}
+}
+
 // GetDailyStats 获取指定日期的统计数据
 func GetDailyStats(date string) (*DailyStats, error) {
 	dailyDataLock.RLock()
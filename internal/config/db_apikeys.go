@@ -60,10 +60,53 @@ func InitApiKeysDB() error {
 		tpm INTEGER NOT NULL,
 		score REAL NOT NULL,
 		is_delete BOOLEAN NOT NULL,
-		is_used BOOLEAN NOT NULL DEFAULT FALSE
+		is_used BOOLEAN NOT NULL DEFAULT FALSE,
+		provider TEXT NOT NULL DEFAULT '',
+		cooldown_reason TEXT NOT NULL DEFAULT '',
+		cooldown_until INTEGER NOT NULL DEFAULT 0
 	)`
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// 检查provider字段是否存在
+	var providerColumnExists int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('" + apikeysTableName + "') WHERE name='provider'").Scan(&providerColumnExists)
+	if err != nil {
+		logger.Error("检查provider字段存在失败: %v", err)
+		return err
+	}
+
+	// 如果provider列不存在，添加它，已有密钥归属默认提供商
+	if providerColumnExists == 0 {
+		if _, err := db.Exec("ALTER TABLE " + apikeysTableName + " ADD COLUMN provider TEXT NOT NULL DEFAULT ''"); err != nil {
+			logger.Error("添加provider字段失败: %v", err)
+			return err
+		}
+		logger.Info("成功添加provider字段到apikeys表")
+	}
+
+	// 检查冷却字段是否存在，不存在时添加
+	for _, column := range []struct{ name, definition string }{
+		{"cooldown_reason", "TEXT NOT NULL DEFAULT ''"},
+		{"cooldown_until", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		var columnExists int
+		err := db.QueryRow("SELECT count(*) FROM pragma_table_info('" + apikeysTableName + "') WHERE name='" + column.name + "'").Scan(&columnExists)
+		if err != nil {
+			logger.Error("检查%s字段存在失败: %v", column.name, err)
+			return err
+		}
+		if columnExists == 0 {
+			if _, err := db.Exec("ALTER TABLE " + apikeysTableName + " ADD COLUMN " + column.name + " " + column.definition); err != nil {
+				logger.Error("添加%s字段失败: %v", column.name, err)
+				return err
+			}
+			logger.Info("成功添加%s字段到apikeys表", column.name)
+		}
+	}
+
+	return nil
 }
 
 // LoadApiKeysFromDB 从数据库加载API密钥
@@ -106,7 +149,7 @@ func LoadApiKeysFromDB() error {
 	// 查询所有密钥，包括被逻辑删除的密钥
 	rows, err := db.Query(`SELECT 
 		key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, provider, cooldown_reason, cooldown_until 
 		FROM ` + apikeysTableName)
 	if err != nil {
 		// 如果是因为表不存在，尝试重新创建表
@@ -148,6 +191,9 @@ func LoadApiKeysFromDB() error {
 			&key.Score,
 			&key.Delete,
 			&key.IsUsed,
+			&key.Provider,
+			&key.CooldownReason,
+			&key.CooldownUntil,
 		); err != nil {
 			logger.Error("扫描API密钥数据失败: %v", err)
 			continue
@@ -220,8 +266,8 @@ func SaveApiKeysToDB() error {
 	// 准备插入语句
 	stmt, err := tx.Prepare(`INSERT INTO ` + apikeysTableName + ` 
 		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, provider, cooldown_reason, cooldown_until) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -252,6 +298,9 @@ func SaveApiKeysToDB() error {
 			keyCopy.Score,
 			keyCopy.Delete,
 			keyCopy.IsUsed,
+			keyCopy.Provider,
+			keyCopy.CooldownReason,
+			keyCopy.CooldownUntil,
 		)
 		if err != nil {
 			logger.Error("插入API密钥失败: %v", err)
@@ -283,8 +332,8 @@ func AddApiKeyToDB(key ApiKey) error {
 	// 插入到数据库
 	_, err := db.Exec(`INSERT OR REPLACE INTO `+apikeysTableName+` 
 		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, provider, cooldown_reason, cooldown_until) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		keyCopy.Key,
 		keyCopy.Balance,
 		keyCopy.LastUsed,
@@ -300,6 +349,9 @@ func AddApiKeyToDB(key ApiKey) error {
 		keyCopy.Score,
 		keyCopy.Delete,
 		keyCopy.IsUsed,
+		keyCopy.Provider,
+		keyCopy.CooldownReason,
+		keyCopy.CooldownUntil,
 	)
 
 	if err != nil {
@@ -0,0 +1,298 @@
+/**
+  @author: Hanhai
+  @desc: 批量请求存储模块，保存本地Files API上传的文件和Batches API批量任务的状态，支持重启后恢复
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+)
+
+const (
+	// 上传文件表名
+	filesTableName = "files"
+	// 批量任务表名
+	batchesTableName = "batches"
+)
+
+// 批量任务状态，与OpenAI Batches API一致
+const (
+	BatchValidating = "validating"
+	BatchFailed     = "failed"
+	BatchInProgress = "in_progress"
+	BatchFinalizing = "finalizing"
+	BatchCompleted  = "completed"
+	BatchExpired    = "expired"
+	BatchCancelling = "cancelling"
+	BatchCancelled  = "cancelled"
+)
+
+// StoredFile 本地保存的文件
+type StoredFile struct {
+	ID        string // 文件ID
+	Filename  string // 原始文件名
+	Purpose   string // 用途：batch、batch_output等
+	Bytes     int64  // 文件大小
+	Path      string // 本地保存路径
+	Client    string // 上传文件的下游客户端，只有该客户端可以访问
+	CreatedAt int64  // 创建时间
+}
+
+// Batch 批量任务
+type Batch struct {
+	ID               string
+	Endpoint         string // 批量请求的接口，如/v1/chat/completions
+	InputFileID      string
+	CompletionWindow string
+	Status           string
+	OutputFileID     string
+	ErrorFileID      string
+	Client           string // 创建任务的下游客户端，只有该客户端可以访问，执行请求时使用该客户端的模型别名
+	Metadata         string // 元数据JSON
+	Errors           string // 校验失败时的错误列表JSON
+	Total            int
+	Completed        int
+	Failed           int
+	CreatedAt        int64
+	InProgressAt     int64
+	ExpiresAt        int64
+	FinalizingAt     int64
+	CompletedAt      int64
+	FailedAt         int64
+	ExpiredAt        int64
+	CancellingAt     int64
+	CancelledAt      int64
+}
+
+// Finished 判断任务是否已结束
+func (b *Batch) Finished() bool {
+	switch b.Status {
+	case BatchCompleted, BatchFailed, BatchExpired, BatchCancelled:
+		return true
+	}
+	return false
+}
+
+// batchColumns 批量任务表的列，顺序与scanBatch一致
+const batchColumns = `id, endpoint, input_file_id, completion_window, status, output_file_id, error_file_id, client, metadata, errors,
+	total, completed, failed, created_at, in_progress_at, expires_at, finalizing_at, completed_at, failed_at, expired_at, cancelling_at, cancelled_at`
+
+// EnsureBatchTables 确保files和batches表已创建
+func EnsureBatchTables() error {
+	if db == nil {
+		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
+		return errors.New("数据库连接未初始化")
+	}
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS ` + filesTableName + ` (
+			id TEXT PRIMARY KEY,
+			filename TEXT NOT NULL,
+			purpose TEXT NOT NULL,
+			bytes INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			client TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + batchesTableName + ` (
+			id TEXT PRIMARY KEY,
+			endpoint TEXT NOT NULL,
+			input_file_id TEXT NOT NULL,
+			completion_window TEXT NOT NULL,
+			status TEXT NOT NULL,
+			output_file_id TEXT NOT NULL DEFAULT '',
+			error_file_id TEXT NOT NULL DEFAULT '',
+			client TEXT NOT NULL DEFAULT '',
+			metadata TEXT NOT NULL DEFAULT '',
+			errors TEXT NOT NULL DEFAULT '',
+			total INTEGER NOT NULL DEFAULT 0,
+			completed INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			in_progress_at INTEGER NOT NULL DEFAULT 0,
+			expires_at INTEGER NOT NULL DEFAULT 0,
+			finalizing_at INTEGER NOT NULL DEFAULT 0,
+			completed_at INTEGER NOT NULL DEFAULT 0,
+			failed_at INTEGER NOT NULL DEFAULT 0,
+			expired_at INTEGER NOT NULL DEFAULT 0,
+			cancelling_at INTEGER NOT NULL DEFAULT 0,
+			cancelled_at INTEGER NOT NULL DEFAULT 0
+		)`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveStoredFile 保存文件记录
+func SaveStoredFile(file *StoredFile) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("保存文件", 3,
+		`INSERT OR REPLACE INTO `+filesTableName+` (id, filename, purpose, bytes, path, client, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		file.ID, file.Filename, file.Purpose, file.Bytes, file.Path, file.Client, file.CreatedAt)
+	return err
+}
+
+// GetStoredFile 根据ID获取文件记录，不存在时返回nil
+func GetStoredFile(id string) (*StoredFile, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	var file StoredFile
+	err := db.QueryRow(`SELECT id, filename, purpose, bytes, path, client, created_at FROM `+filesTableName+` WHERE id = ?`, id).
+		Scan(&file.ID, &file.Filename, &file.Purpose, &file.Bytes, &file.Path, &file.Client, &file.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ListStoredFiles 按创建时间倒序列出客户端的文件，purpose为空时列出该客户端的所有文件
+func ListStoredFiles(client string, purpose string) ([]StoredFile, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	rows, err := db.Query(`SELECT id, filename, purpose, bytes, path, client, created_at FROM `+filesTableName+` WHERE client = ? AND (? = '' OR purpose = ?) ORDER BY created_at DESC`,
+		client, purpose, purpose)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]StoredFile, 0)
+	for rows.Next() {
+		var file StoredFile
+		if err := rows.Scan(&file.ID, &file.Filename, &file.Purpose, &file.Bytes, &file.Path, &file.Client, &file.CreatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// DeleteStoredFile 删除文件记录，返回是否存在
+func DeleteStoredFile(id string) (bool, error) {
+	if db == nil {
+		return false, errors.New("数据库连接未初始化")
+	}
+
+	result, err := ExecWithRetry("删除文件", 3, `DELETE FROM `+filesTableName+` WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// SaveBatch 保存批量任务的完整状态
+func SaveBatch(batch *Batch) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("保存批量任务", 3,
+		`INSERT OR REPLACE INTO `+batchesTableName+` (`+batchColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		batch.ID, batch.Endpoint, batch.InputFileID, batch.CompletionWindow, batch.Status, batch.OutputFileID, batch.ErrorFileID,
+		batch.Client, batch.Metadata, batch.Errors, batch.Total, batch.Completed, batch.Failed, batch.CreatedAt, batch.InProgressAt,
+		batch.ExpiresAt, batch.FinalizingAt, batch.CompletedAt, batch.FailedAt, batch.ExpiredAt, batch.CancellingAt, batch.CancelledAt)
+	return err
+}
+
+// UpdateBatchProgress 更新批量任务的请求计数
+func UpdateBatchProgress(id string, total int, completed int, failed int) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("更新批量任务进度", 3,
+		`UPDATE `+batchesTableName+` SET total = ?, completed = ?, failed = ? WHERE id = ?`,
+		total, completed, failed, id)
+	return err
+}
+
+// scanBatch 读取一行批量任务
+func scanBatch(scanner interface{ Scan(...interface{}) error }) (*Batch, error) {
+	var batch Batch
+	err := scanner.Scan(&batch.ID, &batch.Endpoint, &batch.InputFileID, &batch.CompletionWindow, &batch.Status, &batch.OutputFileID,
+		&batch.ErrorFileID, &batch.Client, &batch.Metadata, &batch.Errors, &batch.Total, &batch.Completed, &batch.Failed,
+		&batch.CreatedAt, &batch.InProgressAt, &batch.ExpiresAt, &batch.FinalizingAt, &batch.CompletedAt, &batch.FailedAt,
+		&batch.ExpiredAt, &batch.CancellingAt, &batch.CancelledAt)
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetBatch 根据ID获取批量任务，不存在时返回nil
+func GetBatch(id string) (*Batch, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	batch, err := scanBatch(db.QueryRow(`SELECT `+batchColumns+` FROM `+batchesTableName+` WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return batch, err
+}
+
+// ListBatches 按创建时间倒序列出客户端的批量任务
+func ListBatches(client string, limit int) ([]*Batch, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	rows, err := db.Query(`SELECT `+batchColumns+` FROM `+batchesTableName+` WHERE client = ? ORDER BY created_at DESC LIMIT ?`, client, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]*Batch, 0)
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+	return batches, rows.Err()
+}
+
+// ListUnfinishedBatches 列出未结束的批量任务，用于重启后恢复执行
+func ListUnfinishedBatches() ([]*Batch, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	rows, err := db.Query(`SELECT `+batchColumns+` FROM `+batchesTableName+` WHERE status IN (?, ?, ?, ?) ORDER BY created_at`,
+		BatchValidating, BatchInProgress, BatchFinalizing, BatchCancelling)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]*Batch, 0)
+	for rows.Next() {
+		batch, err := scanBatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, batch)
+	}
+	return batches, rows.Err()
+}
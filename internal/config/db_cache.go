@@ -0,0 +1,247 @@
+/**
+  @author: Hanhai
+  @desc: 响应缓存存储模块，将确定性请求的响应保存在独立的SQLite数据库中，支持有效期和容量限制
+**/
+
+package config
+
+import (
+	"database/sql"
+	"flowsilicon/internal/logger"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 响应缓存数据库文件名，与config.db放在同一目录
+	cacheDBFileName = "cache.db"
+	// 响应缓存表名
+	responseCacheTableName = "response_cache"
+)
+
+var (
+	// 响应缓存数据库实例
+	cacheDB *sql.DB
+
+	// 启动以来的缓存命中、未命中和跳过次数
+	cacheHits     atomic.Int64
+	cacheMisses   atomic.Int64
+	cacheBypasses atomic.Int64
+)
+
+// ResponseCacheStats 响应缓存统计
+type ResponseCacheStats struct {
+	Enabled   bool    `json:"enabled"`    // 是否启用
+	Entries   int     `json:"entries"`    // 缓存条数
+	SizeBytes int64   `json:"size_bytes"` // 缓存总大小（字节）
+	Hits      int64   `json:"hits"`       // 命中次数
+	Misses    int64   `json:"misses"`     // 未命中次数
+	Bypasses  int64   `json:"bypasses"`   // 客户端要求跳过缓存的次数
+	HitRate   float64 `json:"hit_rate"`   // 命中率
+}
+
+// InitResponseCacheDB 初始化响应缓存数据库，并清理过期的缓存
+// dbPath 是数据库文件的路径，如果为空则使用默认路径 data/cache.db
+func InitResponseCacheDB(dbPath string) error {
+	if dbPath == "" {
+		dataDir := "data"
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			return err
+		}
+		dbPath = filepath.Join(dataDir, cacheDBFileName)
+	}
+
+	var err error
+	cacheDB, err = sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+
+	// 与配置数据库相同，使用单连接和WAL模式降低锁定风险
+	cacheDB.SetMaxOpenConns(1)
+	cacheDB.SetMaxIdleConns(1)
+	cacheDB.SetConnMaxLifetime(30 * time.Minute)
+
+	if _, err = cacheDB.Exec("PRAGMA journal_mode=WAL; PRAGMA synchronous=NORMAL; PRAGMA busy_timeout=5000;"); err != nil {
+		logger.Warn("设置响应缓存数据库PRAGMA失败: %v", err)
+	}
+
+	query := `CREATE TABLE IF NOT EXISTS ` + responseCacheTableName + ` (
+		hash TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		model TEXT NOT NULL,
+		body BLOB NOT NULL,
+		size INTEGER NOT NULL,
+		hits INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		last_hit INTEGER NOT NULL
+	)`
+	if _, err = cacheDB.Exec(query); err != nil {
+		logger.Error("创建响应缓存表失败: %v", err)
+		cacheDB.Close()
+		cacheDB = nil
+		return err
+	}
+
+	if _, err := cacheDB.Exec(`DELETE FROM `+responseCacheTableName+` WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		logger.Warn("清理过期响应缓存失败: %v", err)
+	}
+
+	logger.Info("响应缓存数据库初始化成功: %s", dbPath)
+	return nil
+}
+
+// closeResponseCacheDB 关闭响应缓存数据库
+func closeResponseCacheDB() {
+	if cacheDB != nil {
+		cacheDB.Close()
+		cacheDB = nil
+	}
+}
+
+// GetCachedResponse 获取未过期的缓存响应，同时记录命中或未命中
+func GetCachedResponse(hash string) ([]byte, bool) {
+	if cacheDB == nil {
+		return nil, false
+	}
+
+	now := time.Now().Unix()
+	var body []byte
+	err := cacheDB.QueryRow(`SELECT body FROM `+responseCacheTableName+` WHERE hash = ? AND expires_at > ?`, hash, now).Scan(&body)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Warn("读取响应缓存失败: %v", err)
+		}
+		cacheMisses.Add(1)
+		return nil, false
+	}
+
+	cacheHits.Add(1)
+	// 记录最近命中时间，容量超限时优先淘汰最久未命中的缓存
+	if _, err := cacheDB.Exec(`UPDATE `+responseCacheTableName+` SET hits = hits + 1, last_hit = ? WHERE hash = ?`, now, hash); err != nil {
+		logger.Warn("更新响应缓存命中记录失败: %v", err)
+	}
+	return body, true
+}
+
+// SaveCachedResponse 保存响应到缓存，保存后按配置的容量限制淘汰旧缓存
+func SaveCachedResponse(hash string, path string, model string, body []byte) {
+	if cacheDB == nil {
+		return
+	}
+
+	cacheConfig := GetConfig().ApiProxy.Cache
+	maxSize := cacheConfig.GetMaxSizeBytes()
+	if int64(len(body)) > maxSize {
+		logger.Warn("响应大小 %d 字节超过缓存容量上限，不缓存", len(body))
+		return
+	}
+
+	now := time.Now()
+	_, err := cacheDB.Exec(`INSERT OR REPLACE INTO `+responseCacheTableName+` (hash, path, model, body, size, hits, created_at, expires_at, last_hit) VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		hash, path, model, body, len(body), now.Unix(), now.Add(cacheConfig.GetTTL()).Unix(), now.Unix())
+	if err != nil {
+		logger.Warn("保存响应缓存失败: %v", err)
+		return
+	}
+
+	pruneResponseCache(cacheConfig.GetMaxEntries(), maxSize)
+}
+
+// pruneResponseCache 删除过期缓存，并按最近命中时间淘汰超出条数或大小限制的缓存
+func pruneResponseCache(maxEntries int, maxSize int64) {
+	if _, err := cacheDB.Exec(`DELETE FROM `+responseCacheTableName+` WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		logger.Warn("清理过期响应缓存失败: %v", err)
+		return
+	}
+
+	var entries int
+	var totalSize int64
+	if err := cacheDB.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM `+responseCacheTableName).Scan(&entries, &totalSize); err != nil {
+		logger.Warn("统计响应缓存失败: %v", err)
+		return
+	}
+	if entries <= maxEntries && totalSize <= maxSize {
+		return
+	}
+
+	rows, err := cacheDB.Query(`SELECT hash, size FROM ` + responseCacheTableName + ` ORDER BY last_hit ASC`)
+	if err != nil {
+		logger.Warn("查询响应缓存失败: %v", err)
+		return
+	}
+	// 数据库只有一个连接，需要先读取完要淘汰的缓存再执行删除
+	var evicted []string
+	for rows.Next() && (entries > maxEntries || totalSize > maxSize) {
+		var hash string
+		var size int64
+		if err := rows.Scan(&hash, &size); err != nil {
+			break
+		}
+		evicted = append(evicted, hash)
+		entries--
+		totalSize -= size
+	}
+	rows.Close()
+
+	for _, hash := range evicted {
+		if _, err := cacheDB.Exec(`DELETE FROM `+responseCacheTableName+` WHERE hash = ?`, hash); err != nil {
+			logger.Warn("淘汰响应缓存失败: %v", err)
+			return
+		}
+	}
+	logger.Info("响应缓存超出容量限制，已淘汰 %d 条缓存", len(evicted))
+}
+
+// RecordResponseCacheBypass 记录客户端要求跳过缓存的请求
+func RecordResponseCacheBypass() {
+	cacheBypasses.Add(1)
+}
+
+// PurgeResponseCache 清空响应缓存，返回删除的条数
+func PurgeResponseCache() (int64, error) {
+	if cacheDB == nil {
+		return 0, nil
+	}
+
+	result, err := cacheDB.Exec(`DELETE FROM ` + responseCacheTableName)
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := result.RowsAffected()
+
+	// 回收数据库文件空间
+	if _, err := cacheDB.Exec("VACUUM"); err != nil {
+		logger.Warn("回收响应缓存数据库空间失败: %v", err)
+	}
+
+	logger.Info("已清空响应缓存，共删除 %d 条", deleted)
+	return deleted, nil
+}
+
+// GetResponseCacheStats 获取响应缓存统计
+func GetResponseCacheStats() ResponseCacheStats {
+	stats := ResponseCacheStats{
+		Hits:     cacheHits.Load(),
+		Misses:   cacheMisses.Load(),
+		Bypasses: cacheBypasses.Load(),
+	}
+	if cfg := GetConfig(); cfg != nil {
+		stats.Enabled = cfg.ApiProxy.Cache.Enabled
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+
+	if cacheDB != nil {
+		err := cacheDB.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM `+responseCacheTableName+` WHERE expires_at > ?`, time.Now().Unix()).
+			Scan(&stats.Entries, &stats.SizeBytes)
+		if err != nil {
+			logger.Warn("统计响应缓存失败: %v", err)
+		}
+	}
+	return stats
+}
@@ -0,0 +1,375 @@
+/**
+  @author: Hanhai
+  @desc: 下游客户端密钥存储模块，每个密钥有名称、启用状态、有效期、允许的模型、每日配额和消费预算
+**/
+
+package config
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flowsilicon/internal/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 客户端密钥表名
+	clientKeysTableName = "client_keys"
+	// DefaultClientName 使用Security.ApiKey共享密钥的请求在统计中使用的客户端名称
+	DefaultClientName = "default"
+)
+
+var (
+	// 客户端密钥缓存，键为密钥
+	clientKeys     = make(map[string]*ClientKey)
+	clientKeysLock sync.RWMutex
+)
+
+// ClientKey 下游客户端密钥
+type ClientKey struct {
+	ID                int64    `json:"id"`
+	Name              string   `json:"name"`                // 客户端名称，用于统计和日志
+	Key               string   `json:"key"`                 // 客户端调用时使用的密钥
+	Enabled           bool     `json:"enabled"`             // 是否启用
+	ExpiresAt         int64    `json:"expires_at"`          // 过期时间（Unix秒），0表示永不过期
+	AllowedModels     []string `json:"allowed_models"`      // 允许使用的模型，为空时不限制，支持以*结尾的前缀匹配
+	DailyTokenQuota   int      `json:"daily_token_quota"`   // 每日令牌配额，0表示不限制
+	DailyRequestQuota int      `json:"daily_request_quota"` // 每日请求配额，0表示不限制
+	Budget            float64  `json:"budget"`              // 消费预算（元），0表示不限制
+	Spent             float64  `json:"spent"`               // 已消费金额（元），按模型价格计算
+	Priority          int      `json:"priority"`            // 排队时的优先级，数值越大越先处理
+	CreatedAt         int64    `json:"created_at"`
+	UpdatedAt         int64    `json:"updated_at"`
+}
+
+// Expired 判断密钥是否已过期
+func (k *ClientKey) Expired() bool {
+	return k.ExpiresAt > 0 && time.Now().Unix() >= k.ExpiresAt
+}
+
+// AllowsModel 判断密钥是否允许使用指定模型
+func (k *ClientKey) AllowsModel(model string) bool {
+	if len(k.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range k.AllowedModels {
+		if allowed == model {
+			return true
+		}
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(model, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// OverBudget 判断密钥是否已用完消费预算
+func (k *ClientKey) OverBudget() bool {
+	return k.Budget > 0 && k.Spent >= k.Budget
+}
+
+// EnsureClientKeysTable 确保client_keys表已创建，并加载所有客户端密钥到缓存
+func EnsureClientKeysTable() error {
+	if db == nil {
+		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
+		return errors.New("数据库连接未初始化")
+	}
+
+	query := `CREATE TABLE IF NOT EXISTS ` + clientKeysTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		key TEXT NOT NULL UNIQUE,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		allowed_models TEXT NOT NULL DEFAULT '',
+		daily_token_quota INTEGER NOT NULL DEFAULT 0,
+		daily_request_quota INTEGER NOT NULL DEFAULT 0,
+		budget REAL NOT NULL DEFAULT 0,
+		spent REAL NOT NULL DEFAULT 0,
+		priority INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+	return loadClientKeys()
+}
+
+// loadClientKeys 从数据库加载所有客户端密钥到缓存
+func loadClientKeys() error {
+	rows, err := db.Query(`SELECT id, name, key, enabled, expires_at, allowed_models, daily_token_quota, daily_request_quota, budget, spent, priority, created_at, updated_at FROM ` + clientKeysTableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]*ClientKey)
+	for rows.Next() {
+		var key ClientKey
+		var allowedModels string
+		if err := rows.Scan(&key.ID, &key.Name, &key.Key, &key.Enabled, &key.ExpiresAt, &allowedModels,
+			&key.DailyTokenQuota, &key.DailyRequestQuota, &key.Budget, &key.Spent, &key.Priority, &key.CreatedAt, &key.UpdatedAt); err != nil {
+			return err
+		}
+		key.AllowedModels = splitModelList(allowedModels)
+		keys[key.Key] = &key
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	clientKeysLock.Lock()
+	clientKeys = keys
+	clientKeysLock.Unlock()
+	logger.Info("已加载%d个客户端密钥", len(keys))
+	return nil
+}
+
+// splitModelList 解析以逗号分隔的模型列表
+func splitModelList(value string) []string {
+	models := make([]string, 0)
+	for _, model := range strings.Split(value, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// ListClientKeys 按名称排序列出所有客户端密钥
+func ListClientKeys() []ClientKey {
+	clientKeysLock.RLock()
+	defer clientKeysLock.RUnlock()
+
+	keys := make([]ClientKey, 0, len(clientKeys))
+	for _, key := range clientKeys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
+
+// GetClientKey 根据密钥获取客户端密钥的副本
+func GetClientKey(key string) (*ClientKey, bool) {
+	if key == "" {
+		return nil, false
+	}
+	clientKeysLock.RLock()
+	defer clientKeysLock.RUnlock()
+
+	clientKey, ok := clientKeys[key]
+	if !ok {
+		return nil, false
+	}
+	keyCopy := *clientKey
+	return &keyCopy, true
+}
+
+// GetClientKeyByID 根据ID获取客户端密钥的副本
+func GetClientKeyByID(id int64) (*ClientKey, bool) {
+	clientKeysLock.RLock()
+	defer clientKeysLock.RUnlock()
+
+	for _, clientKey := range clientKeys {
+		if clientKey.ID == id {
+			keyCopy := *clientKey
+			return &keyCopy, true
+		}
+	}
+	return nil, false
+}
+
+// GetClientKeyByName 根据名称获取客户端密钥的副本
+func GetClientKeyByName(name string) (*ClientKey, bool) {
+	if name == "" {
+		return nil, false
+	}
+	clientKeysLock.RLock()
+	defer clientKeysLock.RUnlock()
+
+	for _, clientKey := range clientKeys {
+		if clientKey.Name == name {
+			keyCopy := *clientKey
+			return &keyCopy, true
+		}
+	}
+	return nil, false
+}
+
+// generateClientKey 生成随机的客户端密钥
+func generateClientKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sk-fs-" + hex.EncodeToString(buf), nil
+}
+
+// SaveClientKey 保存客户端密钥，ID为0时新建，密钥为空时自动生成；已消费金额不会被覆盖
+func SaveClientKey(key *ClientKey) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	key.Name = strings.TrimSpace(key.Name)
+	key.Key = strings.TrimSpace(key.Key)
+	if key.Name == "" {
+		return errors.New("客户端名称不能为空")
+	}
+	if key.Name == DefaultClientName {
+		return errors.New("客户端名称" + DefaultClientName + "已被共享密钥使用")
+	}
+	if key.Key == "" {
+		generated, err := generateClientKey()
+		if err != nil {
+			return err
+		}
+		key.Key = generated
+	}
+	if cfg := GetConfig(); cfg != nil && cfg.Security.ApiKey != "" && key.Key == cfg.Security.ApiKey {
+		return errors.New("客户端密钥不能与共享API密钥相同")
+	}
+	if key.ExpiresAt < 0 {
+		key.ExpiresAt = 0
+	}
+	if key.DailyTokenQuota < 0 {
+		key.DailyTokenQuota = 0
+	}
+	if key.DailyRequestQuota < 0 {
+		key.DailyRequestQuota = 0
+	}
+	if key.Budget < 0 {
+		key.Budget = 0
+	}
+	key.AllowedModels = splitModelList(strings.Join(key.AllowedModels, ","))
+
+	now := time.Now().Unix()
+	key.UpdatedAt = now
+	allowedModels := strings.Join(key.AllowedModels, ",")
+	if key.ID == 0 {
+		key.CreatedAt = now
+		key.Spent = 0
+		result, err := ExecWithRetry("创建客户端密钥", 3,
+			`INSERT INTO `+clientKeysTableName+` (name, key, enabled, expires_at, allowed_models, daily_token_quota, daily_request_quota, budget, spent, priority, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+			key.Name, key.Key, key.Enabled, key.ExpiresAt, allowedModels, key.DailyTokenQuota, key.DailyRequestQuota, key.Budget, key.Priority, now, now)
+		if err != nil {
+			return err
+		}
+		if key.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	} else {
+		result, err := ExecWithRetry("更新客户端密钥", 3,
+			`UPDATE `+clientKeysTableName+` SET name = ?, key = ?, enabled = ?, expires_at = ?, allowed_models = ?, daily_token_quota = ?, daily_request_quota = ?, budget = ?, priority = ?, updated_at = ? WHERE id = ?`,
+			key.Name, key.Key, key.Enabled, key.ExpiresAt, allowedModels, key.DailyTokenQuota, key.DailyRequestQuota, key.Budget, key.Priority, now, key.ID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return errors.New("客户端密钥不存在")
+		}
+	}
+
+	if err := db.QueryRow(`SELECT spent, created_at FROM `+clientKeysTableName+` WHERE id = ?`, key.ID).Scan(&key.Spent, &key.CreatedAt); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// 更新缓存，密钥可能已修改，先移除旧的记录
+	clientKeysLock.Lock()
+	for k, existing := range clientKeys {
+		if existing.ID == key.ID {
+			delete(clientKeys, k)
+		}
+	}
+	keyCopy := *key
+	clientKeys[key.Key] = &keyCopy
+	clientKeysLock.Unlock()
+
+	logger.Info("已保存客户端密钥 %s", key.Name)
+	return nil
+}
+
+// DeleteClientKey 删除客户端密钥，返回是否存在
+func DeleteClientKey(id int64) (bool, error) {
+	if db == nil {
+		return false, errors.New("数据库连接未初始化")
+	}
+
+	result, err := ExecWithRetry("删除客户端密钥", 3, `DELETE FROM `+clientKeysTableName+` WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	clientKeysLock.Lock()
+	for k, existing := range clientKeys {
+		if existing.ID == id {
+			delete(clientKeys, k)
+			logger.Info("已删除客户端密钥 %s", existing.Name)
+		}
+	}
+	clientKeysLock.Unlock()
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// ResetClientKeySpent 将客户端密钥的已消费金额清零
+func ResetClientKeySpent(id int64) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	result, err := ExecWithRetry("重置客户端密钥消费", 3,
+		`UPDATE `+clientKeysTableName+` SET spent = 0, updated_at = ? WHERE id = ?`, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("客户端密钥不存在")
+	}
+
+	clientKeysLock.Lock()
+	for _, existing := range clientKeys {
+		if existing.ID == id {
+			existing.Spent = 0
+		}
+	}
+	clientKeysLock.Unlock()
+	return nil
+}
+
+// AddClientKeySpent 累加客户端密钥的消费金额，缓存立即更新，数据库异步更新
+func AddClientKeySpent(id int64, cost float64) {
+	if cost <= 0 {
+		return
+	}
+
+	found := false
+	clientKeysLock.Lock()
+	for _, existing := range clientKeys {
+		if existing.ID == id {
+			existing.Spent += cost
+			found = true
+			break
+		}
+	}
+	clientKeysLock.Unlock()
+	if !found {
+		return
+	}
+
+	go func() {
+		if _, err := ExecWithRetry("更新客户端密钥消费", 3,
+			`UPDATE `+clientKeysTableName+` SET spent = spent + ? WHERE id = ?`, cost, id); err != nil {
+			logger.Error("更新客户端密钥 %d 的消费金额失败: %v", id, err)
+		}
+	}()
+}
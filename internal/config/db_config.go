@@ -118,8 +118,9 @@ func UpdateDBConnectionParams() {
 		cfg.RequestSettings.Database.ConnMaxLifetime)
 }
 
-// CloseConfigDB 关闭配置数据库
+// CloseConfigDB 关闭配置数据库，同时关闭响应缓存数据库
 func CloseConfigDB() error {
+	closeResponseCacheDB()
 	if db != nil {
 		return db.Close()
 	}
@@ -189,7 +190,6 @@ func LoadConfigFromDB() (*Config, error) {
 		// 			"ItemsPerPage":5,
 		// 			"MaxStatsEntries":60,
 		// 			"RecoveryInterval":10,
-		// 			"MaxConsecutiveFailures":5,
 		// 			"BalanceWeight":0.4,
 		// 			"SuccessRateWeight":0.3,
 		// 			"RPMWeight":0.15,
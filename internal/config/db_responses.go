@@ -0,0 +1,102 @@
+/**
+  @author: Hanhai
+  @desc: Responses API响应存储模块，保存本地生成的响应以支持previous_response_id对话串联
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"time"
+)
+
+const (
+	// Responses API响应表名
+	responsesTableName = "responses"
+	// 响应保留天数
+	responsesRetentionDays = 30
+)
+
+// StoredResponse 本地保存的Responses API响应
+type StoredResponse struct {
+	ID        string // 响应ID
+	Client    string // 创建响应的客户端标识，只有该客户端可以读取和删除
+	Model     string // 模型名称
+	Messages  string // 包含本次输出在内的完整对话（chat消息数组的JSON）
+	Response  string // 响应对象的JSON
+	CreatedAt int64  // 创建时间
+}
+
+// EnsureResponsesTable 确保responses表已创建，并清理过期的响应
+func EnsureResponsesTable() error {
+	if db == nil {
+		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
+		return errors.New("数据库连接未初始化")
+	}
+
+	query := `CREATE TABLE IF NOT EXISTS ` + responsesTableName + ` (
+		id TEXT PRIMARY KEY,
+		client TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL,
+		messages TEXT NOT NULL,
+		response TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// 清理过期的响应
+	expireBefore := time.Now().AddDate(0, 0, -responsesRetentionDays).Unix()
+	if _, err := ExecWithRetry("清理过期响应", 3, `DELETE FROM `+responsesTableName+` WHERE created_at < ?`, expireBefore); err != nil {
+		logger.Warn("清理过期响应失败: %v", err)
+	}
+
+	return nil
+}
+
+// SaveStoredResponse 保存响应
+func SaveStoredResponse(resp *StoredResponse) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("保存响应", 3,
+		`INSERT OR REPLACE INTO `+responsesTableName+` (id, client, model, messages, response, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		resp.ID, resp.Client, resp.Model, resp.Messages, resp.Response, resp.CreatedAt)
+	return err
+}
+
+// GetStoredResponse 根据ID获取客户端的响应，不存在或属于其他客户端时返回nil
+func GetStoredResponse(id string, client string) (*StoredResponse, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	var resp StoredResponse
+	err := db.QueryRow(`SELECT id, client, model, messages, response, created_at FROM `+responsesTableName+` WHERE id = ? AND client = ?`, id, client).
+		Scan(&resp.ID, &resp.Client, &resp.Model, &resp.Messages, &resp.Response, &resp.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// DeleteStoredResponse 删除客户端的响应，返回是否存在
+func DeleteStoredResponse(id string, client string) (bool, error) {
+	if db == nil {
+		return false, errors.New("数据库连接未初始化")
+	}
+
+	result, err := ExecWithRetry("删除响应", 3, `DELETE FROM `+responsesTableName+` WHERE id = ? AND client = ?`, id, client)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
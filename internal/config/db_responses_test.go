@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoredResponsesAreScopedToClient(t *testing.T) {
+	if err := EnsureResponsesTable(); err != nil {
+		t.Fatalf("EnsureResponsesTable() error = %v", err)
+	}
+
+	now := time.Now().Unix()
+	if err := SaveStoredResponse(&StoredResponse{ID: "resp_a", Client: "alice", Model: "m", Messages: "[]", Response: "{}", CreatedAt: now}); err != nil {
+		t.Fatalf("SaveStoredResponse() error = %v", err)
+	}
+
+	tests := []struct {
+		id     string
+		client string
+		found  bool
+	}{
+		{"resp_a", "alice", true},
+		{"resp_a", "bob", false},
+		{"resp_a", DefaultClientName, false},
+		{"resp_missing", "alice", false},
+	}
+	for _, tt := range tests {
+		stored, err := GetStoredResponse(tt.id, tt.client)
+		if err != nil {
+			t.Fatalf("GetStoredResponse(%q, %q) error = %v", tt.id, tt.client, err)
+		}
+		if (stored != nil) != tt.found {
+			t.Errorf("GetStoredResponse(%q, %q) found = %v, want %v", tt.id, tt.client, stored != nil, tt.found)
+		}
+		if stored != nil && stored.Client != tt.client {
+			t.Errorf("GetStoredResponse(%q, %q).Client = %q", tt.id, tt.client, stored.Client)
+		}
+	}
+
+	if deleted, err := DeleteStoredResponse("resp_a", "bob"); err != nil || deleted {
+		t.Errorf("DeleteStoredResponse by another client = %v, %v, want false", deleted, err)
+	}
+	if deleted, err := DeleteStoredResponse("resp_a", "alice"); err != nil || !deleted {
+		t.Errorf("DeleteStoredResponse by owner = %v, %v, want true", deleted, err)
+	}
+}
@@ -0,0 +1,149 @@
+/**
+  @author: Hanhai
+  @desc: 视频生成任务存储模块，记录提交任务时使用的密钥，查询任务状态时使用同一密钥
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"time"
+)
+
+const (
+	// 视频生成任务表名
+	videoJobsTableName = "video_jobs"
+)
+
+// 视频生成任务状态，与上游返回的状态一致
+const (
+	VideoJobInQueue    = "InQueue"
+	VideoJobInProgress = "InProgress"
+	VideoJobSucceed    = "Succeed"
+	VideoJobFailed     = "Failed"
+)
+
+// VideoJob 视频生成任务
+type VideoJob struct {
+	RequestID string `json:"request_id"` // 上游返回的任务ID
+	ApiKey    string `json:"-"`          // 提交任务时使用的密钥
+	Model     string `json:"model"`      // 模型名称
+	Prompt    string `json:"prompt"`     // 提示词
+	Client    string `json:"client"`     // 提交任务的下游客户端
+	Status    string `json:"status"`     // 任务状态
+	Reason    string `json:"reason"`     // 失败原因
+	VideoURL  string `json:"video_url"`  // 上游返回的视频地址
+	LocalPath string `json:"local_path"` // 下载到本地的视频路径
+	Result    string `json:"-"`          // 最近一次查询到的状态响应JSON
+	CreatedAt int64  `json:"created_at"` // 创建时间
+	UpdatedAt int64  `json:"updated_at"` // 更新时间
+}
+
+// Finished 判断任务是否已结束
+func (j *VideoJob) Finished() bool {
+	return j.Status == VideoJobSucceed || j.Status == VideoJobFailed
+}
+
+// EnsureVideoJobsTable 确保video_jobs表已创建
+func EnsureVideoJobsTable() error {
+	if db == nil {
+		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
+		return errors.New("数据库连接未初始化")
+	}
+
+	query := `CREATE TABLE IF NOT EXISTS ` + videoJobsTableName + ` (
+		request_id TEXT PRIMARY KEY,
+		api_key TEXT NOT NULL,
+		model TEXT NOT NULL,
+		prompt TEXT NOT NULL DEFAULT '',
+		client TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		video_url TEXT NOT NULL DEFAULT '',
+		local_path TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`
+	_, err := db.Exec(query)
+	return err
+}
+
+// SaveVideoJob 保存新提交的视频生成任务
+func SaveVideoJob(job *VideoJob) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("保存视频任务", 3,
+		`INSERT OR REPLACE INTO `+videoJobsTableName+` (request_id, api_key, model, prompt, client, status, reason, video_url, local_path, result, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.RequestID, job.ApiKey, job.Model, job.Prompt, job.Client, job.Status, job.Reason, job.VideoURL, job.LocalPath, job.Result, job.CreatedAt, job.UpdatedAt)
+	return err
+}
+
+// UpdateVideoJobStatus 更新任务状态和最近一次查询到的状态响应
+func UpdateVideoJobStatus(requestID string, status string, reason string, videoURL string, result string) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("更新视频任务状态", 3,
+		`UPDATE `+videoJobsTableName+` SET status = ?, reason = ?, video_url = ?, result = ?, updated_at = ? WHERE request_id = ?`,
+		status, reason, videoURL, result, time.Now().Unix(), requestID)
+	return err
+}
+
+// UpdateVideoJobLocalPath 记录视频下载到本地的路径
+func UpdateVideoJobLocalPath(requestID string, localPath string) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+
+	_, err := ExecWithRetry("更新视频任务本地路径", 3,
+		`UPDATE `+videoJobsTableName+` SET local_path = ?, updated_at = ? WHERE request_id = ?`,
+		localPath, time.Now().Unix(), requestID)
+	return err
+}
+
+// GetVideoJob 根据任务ID获取视频生成任务，不存在时返回nil
+func GetVideoJob(requestID string) (*VideoJob, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	var job VideoJob
+	err := db.QueryRow(`SELECT request_id, api_key, model, prompt, client, status, reason, video_url, local_path, result, created_at, updated_at FROM `+videoJobsTableName+` WHERE request_id = ?`, requestID).
+		Scan(&job.RequestID, &job.ApiKey, &job.Model, &job.Prompt, &job.Client, &job.Status, &job.Reason, &job.VideoURL, &job.LocalPath, &job.Result, &job.CreatedAt, &job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListVideoJobs 按创建时间倒序列出视频生成任务
+func ListVideoJobs(limit int) ([]VideoJob, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	rows, err := db.Query(`SELECT request_id, api_key, model, prompt, client, status, reason, video_url, local_path, created_at, updated_at FROM `+videoJobsTableName+` ORDER BY created_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]VideoJob, 0)
+	for rows.Next() {
+		var job VideoJob
+		if err := rows.Scan(&job.RequestID, &job.ApiKey, &job.Model, &job.Prompt, &job.Client, &job.Status, &job.Reason, &job.VideoURL, &job.LocalPath, &job.CreatedAt, &job.UpdatedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
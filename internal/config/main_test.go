@@ -0,0 +1,16 @@
+package config
+
+import (
+	"flowsilicon/internal/testutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, func(dir string) (func(), error) {
+		if err := InitConfigDB(filepath.Join(dir, "config.db")); err != nil {
+			return nil, err
+		}
+		return func() { CloseConfigDB() }, nil
+	})
+}
@@ -0,0 +1,114 @@
+/**
+  @author: Hanhai
+  @desc: 按上游错误类型冷却API密钥：401标记无效，余额不足禁用到下一次余额刷新，429按Retry-After冷却，其他错误不影响密钥
+**/
+
+package key
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/provider"
+)
+
+// 429响应没有Retry-After时的默认冷却时间和最长冷却时间
+const (
+	defaultRateLimitCooldown = 60 * time.Second
+	maxRateLimitCooldown     = time.Hour
+)
+
+// 表示余额不足的错误信息关键字，匹配时忽略大小写
+var insufficientBalanceKeywords = []string{
+	"insufficient_quota",
+	"insufficient_balance",
+	"insufficient balance",
+	"balance is insufficient",
+	"balance not enough",
+	"余额不足",
+}
+
+// ClassifyApiKeyError 按状态码和错误响应判断密钥的冷却原因，返回空字符串表示错误与密钥无关
+func ClassifyApiKeyError(statusCode int, body []byte) string {
+	// 余额不足时上游可能返回402、403或429，先按错误信息判断
+	if statusCode == http.StatusPaymentRequired || isInsufficientBalanceError(body) {
+		return config.KeyCooldownInsufficientBalance
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return config.KeyCooldownInvalid
+	case http.StatusTooManyRequests:
+		return config.KeyCooldownRateLimited
+	}
+	return ""
+}
+
+// isInsufficientBalanceError 判断错误响应是否表示余额不足
+func isInsufficientBalanceError(body []byte) bool {
+	if len(body) == 0 {
+		return false
+	}
+	message := strings.ToLower(string(body))
+	for _, keyword := range insufficientBalanceKeywords {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterDuration 解析Retry-After响应头，支持秒数和HTTP日期，没有或无法解析时使用默认冷却时间
+func retryAfterDuration(header http.Header) time.Duration {
+	value := ""
+	if header != nil {
+		value = strings.TrimSpace(header.Get("Retry-After"))
+	}
+
+	cooldown := defaultRateLimitCooldown
+	if value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			cooldown = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			cooldown = time.Until(at)
+		}
+	}
+
+	if cooldown <= 0 {
+		cooldown = time.Second
+	}
+	if cooldown > maxRateLimitCooldown {
+		cooldown = maxRateLimitCooldown
+	}
+	return cooldown
+}
+
+// ReportApiKeyResponse 根据上游响应更新密钥状态，失败时按错误类型冷却密钥
+// 5xx、超时和请求本身的4xx错误只记录失败统计，不影响密钥的可用状态
+func ReportApiKeyResponse(key string, statusCode int, header http.Header, body []byte) {
+	if statusCode >= 200 && statusCode < 300 {
+		UpdateApiKeyStatus(key, true)
+		return
+	}
+
+	config.UpdateApiKeyFailure(key)
+	metrics.RecordUpstreamError(provider.ForKey(key).Name(), statusCode)
+
+	switch reason := ClassifyApiKeyError(statusCode, body); reason {
+	case config.KeyCooldownInvalid, config.KeyCooldownInsufficientBalance:
+		logger.Warn("API密钥 %s 返回状态码 %d，原因: %s，禁用该密钥", MaskKey(key), statusCode, reason)
+		config.DisableApiKeyWithReason(key, reason)
+	case config.KeyCooldownRateLimited:
+		cooldown := retryAfterDuration(header)
+		logger.Warn("API密钥 %s 触发上游速率限制，冷却 %v", MaskKey(key), cooldown)
+		config.CooldownApiKey(key, reason, time.Now().Add(cooldown).Unix())
+	}
+
+	// 重新排序密钥
+	config.SortApiKeysByPriority()
+}
@@ -0,0 +1,123 @@
+package key
+
+import (
+	"flowsilicon/internal/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyApiKeyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"message":"Invalid token"}`, config.KeyCooldownInvalid},
+		{"payment required", http.StatusPaymentRequired, "", config.KeyCooldownInsufficientBalance},
+		{"rate limited", http.StatusTooManyRequests, `{"message":"TPM limit reached"}`, config.KeyCooldownRateLimited},
+		{"429 with insufficient quota", http.StatusTooManyRequests, `{"error":{"code":"insufficient_quota"}}`, config.KeyCooldownInsufficientBalance},
+		{"403 with insufficient balance", http.StatusForbidden, `{"message":"Sorry, your account balance is insufficient"}`, config.KeyCooldownInsufficientBalance},
+		{"chinese balance message", http.StatusBadRequest, `{"message":"账户余额不足"}`, config.KeyCooldownInsufficientBalance},
+		{"keyword case insensitive", http.StatusForbidden, `Insufficient Balance`, config.KeyCooldownInsufficientBalance},
+		{"forbidden without balance message", http.StatusForbidden, `{"message":"forbidden"}`, ""},
+		{"bad request", http.StatusBadRequest, `{"message":"invalid model"}`, ""},
+		{"server error", http.StatusInternalServerError, "", ""},
+		{"service unavailable", http.StatusServiceUnavailable, `{"message":"busy"}`, ""},
+		{"timeout", http.StatusGatewayTimeout, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyApiKeyError(tt.statusCode, []byte(tt.body)); got != tt.want {
+				t.Errorf("ClassifyApiKeyError(%d, %q) = %q, want %q", tt.statusCode, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"missing", "", defaultRateLimitCooldown},
+		{"seconds", "30", 30 * time.Second},
+		{"padded seconds", " 5 ", 5 * time.Second},
+		{"zero", "0", time.Second},
+		{"negative", "-10", time.Second},
+		{"capped", "86400", maxRateLimitCooldown},
+		{"invalid", "soon", defaultRateLimitCooldown},
+		{"date in the past", "Mon, 02 Jan 2006 15:04:05 GMT", time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			if got := retryAfterDuration(header); got != tt.want {
+				t.Errorf("retryAfterDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	if got := retryAfterDuration(nil); got != defaultRateLimitCooldown {
+		t.Errorf("retryAfterDuration(nil) = %v, want %v", got, defaultRateLimitCooldown)
+	}
+	date := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfterDuration(http.Header{"Retry-After": {date}}); got < time.Minute || got > 2*time.Minute {
+		t.Errorf("retryAfterDuration(%q) = %v, want about 2m", date, got)
+	}
+}
+
+// findApiKey 返回内存中的密钥状态
+func findApiKey(t *testing.T, key string) config.ApiKey {
+	t.Helper()
+	for _, k := range config.GetApiKeys() {
+		if k.Key == key {
+			return k
+		}
+	}
+	t.Fatalf("API key %s not found", key)
+	return config.ApiKey{}
+}
+
+func TestReportApiKeyResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		header       http.Header
+		body         string
+		wantDisabled bool
+		wantReason   string
+		wantCooling  bool
+	}{
+		{"success", http.StatusOK, nil, "", false, "", false},
+		{"invalid key", http.StatusUnauthorized, nil, "", true, config.KeyCooldownInvalid, false},
+		{"insufficient balance", http.StatusForbidden, nil, `{"code":"insufficient_balance"}`, true, config.KeyCooldownInsufficientBalance, false},
+		{"rate limited", http.StatusTooManyRequests, http.Header{"Retry-After": {"120"}}, "", false, config.KeyCooldownRateLimited, true},
+		{"server error", http.StatusInternalServerError, nil, "", false, "", false},
+		{"bad request", http.StatusBadRequest, nil, `{"message":"invalid model"}`, false, "", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey := "sk-cooldown-test-" + string(rune('a'+i))
+			config.AddApiKey(apiKey, 10)
+
+			ReportApiKeyResponse(apiKey, tt.statusCode, tt.header, []byte(tt.body))
+
+			got := findApiKey(t, apiKey)
+			if got.Disabled != tt.wantDisabled || got.CooldownReason != tt.wantReason || got.CoolingDown() != tt.wantCooling {
+				t.Errorf("key state = disabled %v, reason %q, cooling %v, want %v, %q, %v",
+					got.Disabled, got.CooldownReason, got.CoolingDown(), tt.wantDisabled, tt.wantReason, tt.wantCooling)
+			}
+			if tt.wantCooling {
+				if remaining := time.Until(time.Unix(got.CooldownUntil, 0)); remaining < 110*time.Second || remaining > 121*time.Second {
+					t.Errorf("cooldown remaining = %v, want about 120s", remaining)
+				}
+			}
+		})
+	}
+}
@@ -7,18 +7,16 @@ package key
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"strconv"
 	"sync"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/robfig/cron/v3"
 
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/provider"
 )
 
 // KeyMode 定义 API 密钥使用模式
@@ -36,7 +34,6 @@ const (
 var (
 	currentKeyIndex int
 	keyIndexMutex   sync.Mutex
-	client          *resty.Client
 
 	// 密钥使用模式
 	currentMode  KeyMode = KeyModeAll
@@ -47,12 +44,6 @@ var (
 	cronScheduler *cron.Cron
 )
 
-// 初始化 HTTP 客户端
-func init() {
-	client = resty.New()
-	client.SetTimeout(30 * time.Second)
-}
-
 // StartKeyManager 启动 API 密钥管理器
 func StartKeyManager() {
 
@@ -143,12 +134,12 @@ func checkAllKeysBalance() {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
-				config.DisableApiKey(key.Key)
+				config.DisableApiKeyWithReason(key.Key, config.KeyCooldownInsufficientBalance)
 				return
 			}
 
-			// 如果余额高于阈值但状态为禁用，启用它
-			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled {
+			// 如果余额高于阈值但状态为禁用，启用它，无效的密钥只能手动启用
+			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled && key.CooldownReason != config.KeyCooldownInvalid {
 				logger.Info("API密钥 %s 余额 %.2f 高于阈值 %.2f，启用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
 				config.EnableApiKey(key.Key)
@@ -177,65 +168,22 @@ func checkAllKeysBalance() {
 	logger.Info("API密钥余额检查完成")
 }
 
-// CheckKeyBalance 检查 API 密钥余额
-// TODO 等待优化
+// CheckKeyBalance 检查 API 密钥余额，使用密钥所属提供商的余额接口
 func CheckKeyBalance(key string) (float64, error) {
-
-	// 使用硅基流动 API 的用户信息接口
-	userInfoURL := "https://api.siliconflow.cn/v1/user/info"
-
-	resp, err := client.R().
-		SetHeader("Authorization", fmt.Sprintf("Bearer %s", key)).
-		Get(userInfoURL)
-
-	if err != nil {
-		return 0, fmt.Errorf("请求失败: %w", err)
-	}
-
-	if resp.StatusCode() != 200 {
-		return 0, fmt.Errorf("API 返回状态码 %d", resp.StatusCode())
+	p := provider.ForKey(key)
+	if p == nil {
+		return 0, fmt.Errorf("密钥所属的提供商不存在或未启用")
 	}
-
-	// 解析响应
-	var result SiliconFlowUserInfoResponse
-
-	if err = json.Unmarshal(resp.Body(), &result); err != nil {
-		return 0, fmt.Errorf("解析响应失败: %w", err)
-	}
-
-	// 检查 API 响应状态
-	if !result.Status || result.Code != 20000 {
-		return 0, fmt.Errorf("API 响应错误: %s", result.Message)
-	}
-
-	// 解析余额字符串为浮点数
-	balance, err := strconv.ParseFloat(result.Data.TotalBalance, 64)
-	if err != nil {
-		return 0, fmt.Errorf("解析余额失败: %w", err)
-	}
-
-	return balance, nil
+	return p.CheckBalance(key)
 }
 
-// SiliconFlowUserInfoResponse 硅基流动用户信息响应结构
-type SiliconFlowUserInfoResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Status  bool   `json:"status"`
-	Data    struct {
-		ID            string `json:"id"`
-		Name          string `json:"name"`
-		Image         string `json:"image"`
-		Email         string `json:"email"`
-		IsAdmin       bool   `json:"isAdmin"`
-		Balance       string `json:"balance"`
-		Status        string `json:"status"`
-		Introduction  string `json:"introduction"`
-		Role          string `json:"role"`
-		ChargeBalance string `json:"chargeBalance"`
-		TotalBalance  string `json:"totalBalance"`
-		Category      string `json:"category"`
-	} `json:"data"`
+// CheckProviderKeyBalance 使用指定提供商的余额接口检查密钥余额，用于添加新密钥
+func CheckProviderKeyBalance(key string, providerName string) (float64, error) {
+	p := provider.Get(providerName)
+	if p == nil {
+		return 0, fmt.Errorf("提供商 %s 不存在或未启用", providerName)
+	}
+	return p.CheckBalance(key)
 }
 
 // GetNextApiKey 获取下一个要使用的 API 密钥
@@ -282,11 +230,11 @@ func GetNextApiKey() (string, error) {
 			keyMap[k] = true
 		}
 
-		// 过滤出选中的且未禁用的密钥，且余额充足
+		// 过滤出选中的且未禁用、不在冷却中的密钥，且余额充足
 		var selectedKeysList []config.ApiKey
 		allKeys := config.GetApiKeys()
 		for _, k := range allKeys {
-			if keyMap[k.Key] && !k.Disabled && k.Balance >= config.GetConfig().App.MinBalanceThreshold {
+			if keyMap[k.Key] && !k.Disabled && !k.CoolingDown() && k.Balance >= config.GetConfig().App.MinBalanceThreshold {
 				selectedKeysList = append(selectedKeysList, k)
 			}
 		}
@@ -407,6 +355,11 @@ func tryRecoverDisabledKeys() {
 		go func(key config.ApiKey) {
 			defer wg.Done()
 
+			// 无效的密钥只能手动启用
+			if key.CooldownReason == config.KeyCooldownInvalid {
+				return
+			}
+
 			// 检查是否已经过了足够的时间
 			now := time.Now().Unix()
 			if now-key.DisabledAt < int64(config.GetConfig().App.RecoveryInterval*60) {
@@ -431,8 +384,13 @@ func tryRecoverDisabledKeys() {
 				return
 			}
 
-			// 检查密钥是否可用
-			success, _, err := common.TestChatAPI(key.Key)
+			// 使用密钥所属提供商检查密钥是否可用
+			var success bool
+			if p := provider.Get(key.ProviderName()); p != nil {
+				success, err = p.TestKey(key.Key)
+			} else {
+				err = fmt.Errorf("提供商 %s 不存在或未启用", key.ProviderName())
+			}
 
 			// 更新最后测试时间
 			config.UpdateApiKeyLastTested(key.Key, now)
@@ -463,7 +421,8 @@ func tryRecoverDisabledKeys() {
 	}
 }
 
-// UpdateApiKeyStatus 根据API调用结果更新密钥状态
+// UpdateApiKeyStatus 根据API调用结果更新密钥的调用统计
+// 失败时只记录统计，不禁用密钥；需要按错误类型冷却密钥时使用ReportApiKeyResponse
 func UpdateApiKeyStatus(key string, success bool) {
 	if success {
 		// 成功调用，更新成功记录
@@ -471,19 +430,6 @@ func UpdateApiKeyStatus(key string, success bool) {
 	} else {
 		// 失败调用，更新失败记录
 		config.UpdateApiKeyFailure(key)
-
-		// 获取密钥信息
-		allKeys := config.GetApiKeys()
-		for _, k := range allKeys {
-			if k.Key == key {
-				// 检查连续失败次数是否超过阈值
-				if k.ConsecutiveFailures >= config.GetConfig().App.MaxConsecutiveFailures {
-					// 禁用密钥
-					config.DisableApiKey(key)
-				}
-				break
-			}
-		}
 	}
 
 	// 重新排序密钥
@@ -567,12 +513,12 @@ func ForceRefreshAllKeysBalance() error {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("强制刷新: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
-				config.DisableApiKey(key.Key)
+				config.DisableApiKeyWithReason(key.Key, config.KeyCooldownInsufficientBalance)
 				return
 			}
 
-			// 如果余额高于阈值但状态为禁用，启用它
-			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled {
+			// 如果余额高于阈值但状态为禁用，启用它，无效的密钥只能手动启用
+			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled && key.CooldownReason != config.KeyCooldownInvalid {
 				logger.Info("强制刷新: API密钥 %s 余额 %.2f 高于阈值 %.2f，启用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
 				config.EnableApiKey(key.Key)
@@ -692,12 +638,12 @@ func RefreshUsedKeysBalance() {
 			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
 				logger.Info("刷新已使用密钥: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
-				config.DisableApiKey(key.Key)
+				config.DisableApiKeyWithReason(key.Key, config.KeyCooldownInsufficientBalance)
 				return
 			}
 
-			// 如果余额高于阈值但状态为禁用，启用它
-			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled {
+			// 如果余额高于阈值但状态为禁用，启用它，无效的密钥只能手动启用
+			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled && key.CooldownReason != config.KeyCooldownInvalid {
 				logger.Info("刷新已使用密钥: API密钥 %s 余额 %.2f 高于阈值 %.2f，启用该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
 				config.EnableApiKey(key.Key)
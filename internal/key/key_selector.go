@@ -13,6 +13,8 @@ import (
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/provider"
 	"flowsilicon/pkg/utils"
 )
 
@@ -35,8 +37,8 @@ func GetOptimalApiKey() (string, error) {
 type RequestType string
 
 // 获取任意可用密钥
-func getAnyAvailableKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getAnyAvailableKey(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -44,17 +46,20 @@ func getAnyAvailableKey() (string, error) {
 }
 
 // 获取余额最高的密钥
-func getHighestBalanceKey() (string, error) {
-	return getHighestBalanceKeyWithRoundRobin()
+func getHighestBalanceKey(providerName string) (string, error) {
+	return getHighestBalanceKeyWithRoundRobin(providerName)
 }
 
 // 获取余额最高的密钥（支持轮询）
-func getHighestBalanceKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getHighestBalanceKeyWithRoundRobin(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("high_balance", providerName)
+
 	// 先找出最高余额值
 	var highestBalance float64 = -1
 	for _, key := range activeKeys {
@@ -88,21 +93,21 @@ func getHighestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["high_balance"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=high_balance, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(highestBalanceKeys))
 
 	// 使用轮询选择器获取密钥
-	selectedKey := selectKeyByRoundRobin(highestBalanceKeys, "high_balance")
+	selectedKey := selectKeyByRoundRobin(highestBalanceKeys, strategyName)
 	if selectedKey == "" {
 		return "", common.ErrNoActiveKeys
 	}
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["high_balance"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=high_balance, 选择密钥=%s, 新索引=%d",
@@ -114,8 +119,8 @@ func getHighestBalanceKeyWithRoundRobin() (string, error) {
 }
 
 // 获取历史成功率高的密钥
-func getHighSuccessRateKey(modelName string) (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getHighSuccessRateKey(modelName string, providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -141,7 +146,7 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 	}
 
 	if len(highSuccessKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(providerName)
 	}
 
 	// 增加详细日志
@@ -160,7 +165,7 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 	}
 
 	// 使用轮询选择器
-	strategyKey := "high_success_rate"
+	strategyKey := roundRobinStrategy("high_success_rate", providerName)
 	if modelName != "" {
 		strategyKey = "high_success_rate_" + modelName
 	}
@@ -188,18 +193,21 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 }
 
 // 获取响应速度快的密钥
-func getFastResponseKey() (string, error) {
+func getFastResponseKey(providerName string) (string, error) {
 	// 使用低RPM策略
-	return getLowRPMKey()
+	return getLowRPMKey(providerName)
 }
 
 // getLowRPMKey 获取RPM最低的密钥
-func getLowRPMKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowRPMKey(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("low_rpm", providerName)
+
 	// 找出最低RPM值
 	var lowestRPM int = 999999
 	for _, key := range activeKeys {
@@ -221,7 +229,7 @@ func getLowRPMKey() (string, error) {
 	}
 
 	if len(lowestRPMKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(providerName)
 	}
 
 	// 增加详细日志
@@ -241,18 +249,18 @@ func getLowRPMKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_rpm"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_rpm, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(lowestRPMKeys))
 
 	// 使用轮询选择器
-	selectedKey := selectKeyByRoundRobin(lowestRPMKeys, "low_rpm")
+	selectedKey := selectKeyByRoundRobin(lowestRPMKeys, strategyName)
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_rpm"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_rpm, 选择密钥=%s, 新索引=%d",
@@ -263,12 +271,15 @@ func getLowRPMKey() (string, error) {
 }
 
 // getLowTPMKey 获取TPM最低的密钥
-func getLowTPMKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowTPMKey(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("low_tpm", providerName)
+
 	// 找出最低TPM值
 	var lowestTPM int = 999999
 	for _, key := range activeKeys {
@@ -290,7 +301,7 @@ func getLowTPMKey() (string, error) {
 	}
 
 	if len(lowestTPMKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(providerName)
 	}
 
 	// 增加详细日志
@@ -310,18 +321,18 @@ func getLowTPMKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_tpm"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_tpm, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(lowestTPMKeys))
 
 	// 使用轮询选择器
-	selectedKey := selectKeyByRoundRobin(lowestTPMKeys, "low_tpm")
+	selectedKey := selectKeyByRoundRobin(lowestTPMKeys, strategyName)
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_tpm"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_tpm, 选择密钥=%s, 新索引=%d",
@@ -337,6 +348,9 @@ func GetBestKeyForRequest(requestType string, modelName string, tokenEstimate in
 	// 添加调试日志
 	logger.Info("GetBestKeyForRequest被调用: 模型=%s, 请求类型=%s, 预估token=%d", modelName, requestType, tokenEstimate)
 
+	// 只在服务该模型的提供商的密钥中选择
+	providerName := provider.ForModel(modelName).Name()
+
 	// 检查是否有针对该模型的特定策略配置
 	key, found, err := GetModelSpecificKey(modelName)
 	logger.Info("模型特定策略查找结果: 模型=%s, 找到策略=%v", modelName, found)
@@ -348,16 +362,27 @@ func GetBestKeyForRequest(requestType string, modelName string, tokenEstimate in
 
 	// 对于大型请求，选择余额高的密钥
 	if tokenEstimate > 5000 {
-		return getHighestBalanceKey()
+		metrics.RecordKeySelection("high_balance")
+		return getHighestBalanceKey(providerName)
 	}
 
 	// 对于流式请求，选择响应速度快的密钥
 	if requestType == "streaming" {
-		return getFastResponseKey()
+		metrics.RecordKeySelection("fast_response")
+		return getFastResponseKey(providerName)
 	}
 
 	// 默认使用普通轮询策略（而不是智能负载均衡策略）
-	return getRoundRobinKey()
+	metrics.RecordKeySelection("round_robin")
+	return getRoundRobinKey(providerName)
+}
+
+// roundRobinStrategy 返回区分提供商的轮询索引名称，默认提供商保持原名称
+func roundRobinStrategy(strategy string, providerName string) string {
+	if providerName == config.DefaultProvider {
+		return strategy
+	}
+	return strategy + "@" + providerName
 }
 
 // selectKeyByRoundRobin 使用轮询方式从密钥列表中选择一个
@@ -405,12 +430,15 @@ func selectKeyByRoundRobin(keys []config.ApiKey, strategyName string) string {
 }
 
 // GetOptimalApiKeyWithRoundRobin 获取得分最高的API密钥，带轮询功能
-func GetOptimalApiKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func GetOptimalApiKeyWithRoundRobin(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("high_score", providerName)
+
 	// 计算密钥得分
 	keysWithScores := CalculateKeyScores(activeKeys)
 	if len(keysWithScores) == 0 {
@@ -445,21 +473,21 @@ func GetOptimalApiKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["high_score"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=high_score, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(highestScoreKeys))
 
 	// 使用轮询选择器
-	selectedKey := selectKeyByRoundRobin(highestScoreKeys, "high_score")
+	selectedKey := selectKeyByRoundRobin(highestScoreKeys, strategyName)
 	if selectedKey == "" {
 		return "", common.ErrNoActiveKeys
 	}
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["high_score"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=high_score, 选择密钥=%s, 新索引=%d",
@@ -472,12 +500,15 @@ func GetOptimalApiKeyWithRoundRobin() (string, error) {
 }
 
 // getRoundRobinKey 实现普通轮询策略，轮询所有可用的API密钥
-func getRoundRobinKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getRoundRobinKey(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("round_robin", providerName)
+
 	// 增加详细日志
 	logger.Info("轮询策略: 找到%d个可用的API密钥进行轮询", len(activeKeys))
 
@@ -495,21 +526,21 @@ func getRoundRobinKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["round_robin"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=round_robin, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(activeKeys))
 
 	// 使用轮询选择器获取密钥
-	selectedKey := selectKeyByRoundRobin(activeKeys, "round_robin")
+	selectedKey := selectKeyByRoundRobin(activeKeys, strategyName)
 	if selectedKey == "" {
 		return "", common.ErrNoActiveKeys
 	}
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["round_robin"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=round_robin, 选择密钥=%s, 新索引=%d",
@@ -521,12 +552,15 @@ func getRoundRobinKey() (string, error) {
 }
 
 // 获取余额最低的密钥（支持轮询）
-func getLowestBalanceKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowestBalanceKeyWithRoundRobin(providerName string) (string, error) {
+	activeKeys := config.GetActiveApiKeysByProvider(providerName)
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 不同提供商的密钥分别轮询
+	strategyName := roundRobinStrategy("low_balance", providerName)
+
 	// 先找出最低余额值
 	var lowestBalance float64 = 999999.0
 	for _, key := range activeKeys {
@@ -560,21 +594,21 @@ func getLowestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_balance"]
+	currentIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_balance, 当前索引=%d, 总密钥数=%d",
 		currentIndex, len(lowestBalanceKeys))
 
 	// 使用轮询选择器获取密钥
-	selectedKey := selectKeyByRoundRobin(lowestBalanceKeys, "low_balance")
+	selectedKey := selectKeyByRoundRobin(lowestBalanceKeys, strategyName)
 	if selectedKey == "" {
 		return "", common.ErrNoActiveKeys
 	}
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_balance"]
+	newIndex := strategyRoundRobinIndex[strategyName]
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_balance, 选择密钥=%s, 新索引=%d",
@@ -586,28 +620,33 @@ func getLowestBalanceKeyWithRoundRobin() (string, error) {
 }
 
 // getLowestBalanceKey 获取余额最低的密钥
-func getLowestBalanceKey() (string, error) {
-	return getLowestBalanceKeyWithRoundRobin()
+func getLowestBalanceKey(providerName string) (string, error) {
+	return getLowestBalanceKeyWithRoundRobin(providerName)
 }
 
 // getFreeModelKey 实现免费模型的策略
 // 先轮询is_delete为1的密钥，再轮询disabled为1的密钥，再轮询is_used为0的密钥，最后使用低余额策略
-func getFreeModelKey() (string, error) {
-	// 获取所有API密钥（包括禁用的，但不包括已标记为删除的）
-	allKeys := config.GetApiKeys()
+func getFreeModelKey(providerName string) (string, error) {
+	// 获取该提供商的所有API密钥（包括禁用的，但不包括已标记为删除、无效和冷却中的）
+	var allKeys []config.ApiKey
+	for _, key := range config.GetApiKeys() {
+		if key.ProviderName() == providerName && freeModelKeyUsable(key) {
+			allKeys = append(allKeys, key)
+		}
+	}
 	if len(allKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
 	// 1. 首先尝试使用已标记为删除的密钥（不在GetApiKeys结果中，需要单独获取）
-	deletedKeys, err := getDeletedApiKeys()
+	deletedKeys, err := getDeletedApiKeys(providerName)
 	if err != nil {
 		logger.Error("获取已删除密钥失败: %v", err)
 	} else if len(deletedKeys) > 0 {
 		logger.Info("找到%d个已删除的密钥，尝试使用", len(deletedKeys))
 
 		// 使用轮询选择器
-		selectedKey := selectKeyByRoundRobin(deletedKeys, "free_deleted")
+		selectedKey := selectKeyByRoundRobin(deletedKeys, roundRobinStrategy("free_deleted", providerName))
 		if selectedKey != "" {
 			logger.Info("使用已删除的密钥: %s", utils.MaskKey(selectedKey))
 			return selectedKey, nil
@@ -626,7 +665,7 @@ func getFreeModelKey() (string, error) {
 		logger.Info("找到%d个已禁用的密钥，尝试使用", len(disabledKeys))
 
 		// 使用轮询选择器
-		selectedKey := selectKeyByRoundRobin(disabledKeys, "free_disabled")
+		selectedKey := selectKeyByRoundRobin(disabledKeys, roundRobinStrategy("free_disabled", providerName))
 		if selectedKey != "" {
 			logger.Info("使用已禁用的密钥: %s", utils.MaskKey(selectedKey))
 			return selectedKey, nil
@@ -645,7 +684,7 @@ func getFreeModelKey() (string, error) {
 		logger.Info("找到%d个未使用过的密钥，尝试使用", len(unusedKeys))
 
 		// 使用轮询选择器
-		selectedKey := selectKeyByRoundRobin(unusedKeys, "free_unused")
+		selectedKey := selectKeyByRoundRobin(unusedKeys, roundRobinStrategy("free_unused", providerName))
 		if selectedKey != "" {
 			logger.Info("使用未使用过的密钥: %s", utils.MaskKey(selectedKey))
 			return selectedKey, nil
@@ -654,11 +693,16 @@ func getFreeModelKey() (string, error) {
 
 	// 4. 最后尝试使用低余额策略
 	logger.Info("尝试使用低余额策略选择密钥")
-	return getLowestBalanceKey()
+	return getLowestBalanceKey(providerName)
+}
+
+// freeModelKeyUsable 免费模型可以使用禁用和删除的密钥，但无效和冷却中的密钥无法调用
+func freeModelKeyUsable(key config.ApiKey) bool {
+	return key.CooldownReason != config.KeyCooldownInvalid && !key.CoolingDown()
 }
 
 // getDeletedApiKeys 获取所有标记为已删除的API密钥
-func getDeletedApiKeys() ([]config.ApiKey, error) {
+func getDeletedApiKeys(providerName string) ([]config.ApiKey, error) {
 	// 从数据库中查询已标记为删除的密钥
 	if config.DB() == nil {
 		return nil, fmt.Errorf("数据库连接未初始化")
@@ -666,7 +710,7 @@ func getDeletedApiKeys() ([]config.ApiKey, error) {
 
 	rows, err := config.DB().Query(`SELECT 
 		key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, provider, cooldown_reason, cooldown_until 
 		FROM apikeys WHERE is_delete = 1`)
 	if err != nil {
 		return nil, err
@@ -692,10 +736,17 @@ func getDeletedApiKeys() ([]config.ApiKey, error) {
 			&key.Score,
 			&key.Delete,
 			&key.IsUsed,
+			&key.Provider,
+			&key.CooldownReason,
+			&key.CooldownUntil,
 		); err != nil {
 			return nil, err
 		}
 
+		// 只返回该提供商的可用密钥
+		if key.ProviderName() != providerName || !freeModelKeyUsable(key) {
+			continue
+		}
 		deletedKeys = append(deletedKeys, key)
 	}
 
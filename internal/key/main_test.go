@@ -0,0 +1,21 @@
+package key
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/testutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, func(dir string) (func(), error) {
+		if err := config.InitConfigDB(filepath.Join(dir, "config.db")); err != nil {
+			return nil, err
+		}
+		if err := config.InitApiKeysDB(); err != nil {
+			return nil, err
+		}
+		config.UpdateConfig(&config.Config{})
+		return func() { config.CloseConfigDB() }, nil
+	})
+}
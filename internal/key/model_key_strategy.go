@@ -8,7 +8,9 @@ package key
 import (
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/metrics"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
 	"strings"
 )
 
@@ -82,44 +84,65 @@ func getModelStrategyFromConfig(modelName string) (string, bool, error) {
 	return "", false, nil
 }
 
+// 模型策略ID对应的指标标签，未知的策略按普通轮询处理
+var strategyMetricNames = map[int]string{
+	1: "high_success_rate",
+	2: "high_score",
+	3: "low_rpm",
+	4: "low_tpm",
+	5: "high_balance",
+	6: "round_robin",
+	7: "low_balance",
+	8: "free",
+}
+
 // applyModelStrategy 应用模型特定策略
 func applyModelStrategy(modelName string, strategyID int) (string, bool, error) {
+	// 只在服务该模型的提供商的密钥中选择
+	providerName := provider.ForModel(modelName).Name()
+
+	strategyName, ok := strategyMetricNames[strategyID]
+	if !ok {
+		strategyName = "round_robin"
+	}
+	metrics.RecordKeySelection(strategyName)
+
 	switch strategyID {
 	case 1: // 高成功率策略
 		logger.Info("使用高成功率策略选择密钥: 模型=%s", modelName)
-		key, err := getHighSuccessRateKey(modelName)
+		key, err := getHighSuccessRateKey(modelName, providerName)
 		return key, true, err
 	case 2: // 高分数策略
 		logger.Info("使用高分数策略选择密钥: 模型=%s", modelName)
-		key, err := GetOptimalApiKeyWithRoundRobin()
+		key, err := GetOptimalApiKeyWithRoundRobin(providerName)
 		return key, true, err
 	case 3: // 低RPM策略
 		logger.Info("使用低RPM策略选择密钥: 模型=%s", modelName)
-		key, err := getLowRPMKey()
+		key, err := getLowRPMKey(providerName)
 		return key, true, err
 	case 4: // 低TPM策略
 		logger.Info("使用低TPM策略选择密钥: 模型=%s", modelName)
-		key, err := getLowTPMKey()
+		key, err := getLowTPMKey(providerName)
 		return key, true, err
 	case 5: // 高余额策略
 		logger.Info("使用高余额策略选择密钥: 模型=%s", modelName)
-		key, err := getHighestBalanceKey()
+		key, err := getHighestBalanceKey(providerName)
 		return key, true, err
 	case 6: // 普通轮询策略
 		logger.Info("使用普通轮询策略选择密钥: 模型=%s", modelName)
-		key, err := getRoundRobinKey()
+		key, err := getRoundRobinKey(providerName)
 		return key, true, err
 	case 7: // 低余额策略
 		logger.Info("使用低余额策略选择密钥: 模型=%s", modelName)
-		key, err := getLowestBalanceKey()
+		key, err := getLowestBalanceKey(providerName)
 		return key, true, err
 	case 8: // 免费模型策略
 		logger.Info("使用免费模型策略选择密钥: 模型=%s", modelName)
-		key, err := getFreeModelKey()
+		key, err := getFreeModelKey(providerName)
 		return key, true, err
 	default:
 		logger.Info("使用默认策略(普通轮询)选择密钥: 模型=%s", modelName)
-		key, err := getRoundRobinKey()
+		key, err := getRoundRobinKey(providerName)
 		return key, true, err
 	}
 }
@@ -0,0 +1,82 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求相关的指标：请求数和耗时、重试、上游错误状态码、密钥选择策略和流式响应时长
+**/
+
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 模型标签最多保留的模型数，超过后记为other
+const maxModelLabels = 200
+
+var (
+	requestsTotal = NewCounterVec("flowsilicon_requests_total",
+		"Total number of proxied API requests.", "route", "model", "status")
+	requestDuration = NewHistogramVec("flowsilicon_request_duration_seconds",
+		"Latency of proxied API requests in seconds.", DurationBuckets, "route", "model", "status")
+	retriesTotal = NewCounterVec("flowsilicon_retries_total",
+		"Total number of upstream request retries.", "model")
+	upstreamErrorsTotal = NewCounterVec("flowsilicon_upstream_errors_total",
+		"Total number of non-2xx upstream responses by status code.", "provider", "code")
+	keySelectionsTotal = NewCounterVec("flowsilicon_key_selections_total",
+		"Total number of API key selections by strategy.", "strategy")
+	streamDuration = NewHistogramVec("flowsilicon_stream_duration_seconds",
+		"Duration of streaming responses in seconds.", DurationBuckets, "model")
+)
+
+// 已使用的模型标签
+var (
+	modelLabelsMu sync.Mutex
+	modelLabels   = make(map[string]struct{})
+)
+
+// modelLabel 返回模型的标签值，没有模型时为none，不同模型数超过上限后新的模型记为other
+func modelLabel(modelName string) string {
+	if modelName == "" {
+		return "none"
+	}
+
+	modelLabelsMu.Lock()
+	defer modelLabelsMu.Unlock()
+	if _, ok := modelLabels[modelName]; ok {
+		return modelName
+	}
+	if len(modelLabels) >= maxModelLabels {
+		return "other"
+	}
+	modelLabels[modelName] = struct{}{}
+	return modelName
+}
+
+// RecordRequest 记录一次代理请求的状态码和耗时
+func RecordRequest(route string, modelName string, status int, duration time.Duration) {
+	model := modelLabel(modelName)
+	code := strconv.Itoa(status)
+	requestsTotal.Inc(route, model, code)
+	requestDuration.Observe(duration.Seconds(), route, model, code)
+}
+
+// RecordRetry 记录一次上游请求重试
+func RecordRetry(modelName string) {
+	retriesTotal.Inc(modelLabel(modelName))
+}
+
+// RecordUpstreamError 记录一次上游的非2xx响应
+func RecordUpstreamError(provider string, status int) {
+	upstreamErrorsTotal.Inc(provider, strconv.Itoa(status))
+}
+
+// RecordKeySelection 记录一次按策略选择密钥
+func RecordKeySelection(strategy string) {
+	keySelectionsTotal.Inc(strategy)
+}
+
+// RecordStreamDuration 记录一次流式响应的时长
+func RecordStreamDuration(modelName string, duration time.Duration) {
+	streamDuration.Observe(duration.Seconds(), modelLabel(modelName))
+}
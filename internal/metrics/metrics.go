@@ -0,0 +1,298 @@
+/**
+  @author: Hanhai
+  @desc: 指标注册表，提供计数器、直方图和按需采集的仪表，按Prometheus文本格式输出
+**/
+
+package metrics
+
+import (
+	"bufio"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus文本格式的响应类型
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 每个指标最多记录的标签组合数，超过后新的标签组合不再记录，避免客户端传入的模型名等导致内存无限增长
+const maxSeries = 2000
+
+// DurationBuckets 请求耗时直方图的分桶（秒）
+var DurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// collector 可以输出到指标接口的指标
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// 注册的指标，按注册顺序输出
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+// register 注册指标
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText 按Prometheus文本格式输出所有指标
+func WriteText(w io.Writer) error {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// desc 指标的名称、说明和标签名
+type desc struct {
+	name   string
+	help   string
+	labels []string
+	// 标签组合数超过上限时只提示一次
+	overflowOnce sync.Once
+}
+
+// writeHeader 输出指标的说明和类型
+func (d *desc) writeHeader(w *bufio.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, metricType)
+}
+
+// seriesKey 返回标签值组合的键，标签值数量与标签名不一致时补空值或截断
+func (d *desc) seriesKey(values []string) (string, []string) {
+	normalized := make([]string, len(d.labels))
+	copy(normalized, values)
+	return strings.Join(normalized, "\xff"), normalized
+}
+
+// overflow 提示标签组合数已达到上限
+func (d *desc) overflow() {
+	d.overflowOnce.Do(func() {
+		logger.Warn("指标 %s 的标签组合数已达到上限 %d，新的标签组合不再记录", d.name, maxSeries)
+	})
+}
+
+// formatLabels 输出标签，extraName非空时追加一个标签（用于直方图的le）
+func formatLabels(names []string, values []string, extraName string, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatValue 按Prometheus的格式输出数值
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys 返回排序后的标签组合键，保证输出顺序稳定
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// counterSeries 计数器的一个标签组合
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	v := &CounterVec{desc: desc{name: name, help: help, labels: labels}, series: make(map[string]*counterSeries)}
+	register(v)
+	return v
+}
+
+// Inc 计数加一
+func (v *CounterVec) Inc(values ...string) {
+	v.Add(1, values...)
+}
+
+// Add 计数增加delta，delta不能为负
+func (v *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	key, normalized := v.seriesKey(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		if len(v.series) >= maxSeries {
+			v.overflow()
+			return
+		}
+		s = &counterSeries{values: normalized}
+		v.series[key] = s
+	}
+	s.value += delta
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w, "counter")
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.values, "", ""), formatValue(s.value))
+	}
+}
+
+// histogramSeries 直方图的一个标签组合
+type histogramSeries struct {
+	values []string
+	counts []uint64 // 每个分桶的计数（不累计）
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec 创建并注册直方图，buckets为升序的分桶上限
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(v)
+	return v
+}
+
+// Observe 记录一个观测值
+func (v *HistogramVec) Observe(value float64, values ...string) {
+	key, normalized := v.seriesKey(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		if len(v.series) >= maxSeries {
+			v.overflow()
+			return
+		}
+		s = &histogramSeries{values: normalized, counts: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	for i, upper := range v.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.values, "le", formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.values, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, s.values, "", ""), s.count)
+	}
+}
+
+// GaugeSample 仪表的一个标签组合及其当前值
+type GaugeSample struct {
+	Values []string
+	Value  float64
+}
+
+// GaugeFunc 在输出指标时调用collect采集当前值的仪表，用于密钥池等已有状态
+type GaugeFunc struct {
+	desc
+	collect func() []GaugeSample
+}
+
+// NewGaugeFunc 创建并注册仪表
+func NewGaugeFunc(name string, help string, labels []string, collect func() []GaugeSample) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, labels: labels}, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	for _, sample := range g.collect() {
+		_, values := g.seriesKey(sample.Values)
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, values, "", ""), formatValue(sample.Value))
+	}
+}
@@ -6,14 +6,84 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// 上下文中保存下游客户端身份的键
+// 客户端标识为客户端密钥的ID，重命名后不变，用于数据归属和速率限制；共享密钥的标识和名称都是config.DefaultClientName
+// 客户端名称用于模型别名、推理格式、统计和界面显示；不保存客户端使用的密钥本身
+const (
+	ClientIDKey   = "client_id"
+	ClientNameKey = "client_name"
+)
+
+// Client 下游客户端身份
+type Client struct {
+	ID   string
+	Name string
+}
+
+// GetClient 获取发起请求的下游客户端身份，未启用API密钥验证时为空
+func GetClient(c *gin.Context) Client {
+	return Client{ID: GetClientID(c), Name: GetClientName(c)}
+}
+
+// SetClient 设置请求的下游客户端身份，用于批量任务等内部构造的请求
+func SetClient(c *gin.Context, client Client) {
+	c.Set(ClientIDKey, client.ID)
+	c.Set(ClientNameKey, client.Name)
+}
+
+// GetClientID 获取发起请求的下游客户端标识，未启用API密钥验证时为空
+func GetClientID(c *gin.Context) string {
+	return c.GetString(ClientIDKey)
+}
+
+// GetClientName 获取发起请求的下游客户端名称，用于按客户端统计，未启用API密钥验证时为空
+func GetClientName(c *gin.Context) string {
+	return c.GetString(ClientNameKey)
+}
+
+// ClientForID 根据客户端标识获取当前的客户端身份，客户端密钥已删除时名称为空
+func ClientForID(id string) Client {
+	if clientKey, ok := GetClientKey(id); ok {
+		return Client{ID: id, Name: clientKey.Name}
+	}
+	if id == config.DefaultClientName {
+		return Client{ID: id, Name: config.DefaultClientName}
+	}
+	return Client{ID: id}
+}
+
+// ClientForName 根据客户端名称获取客户端身份，用于只保存了名称的内部请求
+func ClientForName(name string) Client {
+	if clientKey, ok := config.GetClientKeyByName(name); ok {
+		return Client{ID: strconv.FormatInt(clientKey.ID, 10), Name: name}
+	}
+	return Client{ID: name, Name: name}
+}
+
+// GetClientKey 根据客户端标识获取客户端密钥的副本，共享密钥和未启用API密钥验证时返回false
+func GetClientKey(id string) (*config.ClientKey, bool) {
+	keyID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return config.GetClientKeyByID(keyID)
+}
+
 // APIKeyMiddleware 检查API请求是否包含有效的API密钥
 func APIKeyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -54,25 +124,143 @@ func APIKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 验证API密钥
-		if apiKey != cfg.Security.ApiKey {
-			logger.Info("API请求提供了无效的API密钥")
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": gin.H{
-					"message": "无效的API密钥",
-					"type":    "unauthorized",
-					"code":    401,
-				},
-			})
-			c.Abort()
-			return
+		// 验证API密钥，先匹配共享密钥，再匹配客户端密钥
+		client := Client{ID: config.DefaultClientName, Name: config.DefaultClientName}
+		if cfg.Security.ApiKey == "" || apiKey != cfg.Security.ApiKey {
+			clientKey, ok := config.GetClientKey(apiKey)
+			if !ok {
+				logger.Info("API请求提供了无效的API密钥")
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": gin.H{
+						"message": "无效的API密钥",
+						"type":    "unauthorized",
+						"code":    401,
+					},
+				})
+				c.Abort()
+				return
+			}
+			if status, code, message := checkClientPolicy(clientKey); status != 0 {
+				logger.Info("客户端 %s 的请求被拒绝: %s", clientKey.Name, message)
+				abortClientPolicy(c, status, code, message)
+				return
+			}
+			client = Client{ID: strconv.FormatInt(clientKey.ID, 10), Name: clientKey.Name}
 		}
 
-		// API密钥验证通过，继续处理请求
+		// API密钥验证通过，记录客户端身份后继续处理请求
+		SetClient(c, client)
 		c.Next()
 	}
 }
 
+// abortClientPolicy 返回客户端策略错误并中止请求
+func abortClientPolicy(c *gin.Context, status int, code string, message string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "client_policy_error",
+			"code":    code,
+		},
+	})
+	c.Abort()
+}
+
+// CheckClientPolicy 检查客户端密钥当前是否可以发起请求，用于批量任务等不经过中间件的请求
+// 通过时返回的状态码为0，共享密钥和未启用API密钥验证时不限制
+func CheckClientPolicy(clientID string) (int, string, string) {
+	clientKey, ok := GetClientKey(clientID)
+	if !ok {
+		return 0, "", ""
+	}
+	return checkClientPolicy(clientKey)
+}
+
+// ClientAllowsModel 判断客户端是否可以使用指定模型，模型需要是解析别名后的实际模型
+func ClientAllowsModel(clientID string, modelName string) bool {
+	clientKey, ok := GetClientKey(clientID)
+	return !ok || clientKey.AllowsModel(modelName)
+}
+
+// CheckClientModel 检查当前客户端是否可以使用解析别名后的实际模型，不允许时返回403并中止请求
+func CheckClientModel(c *gin.Context, modelName string) bool {
+	if ClientAllowsModel(GetClientID(c), modelName) {
+		return true
+	}
+	logger.Info("客户端 %s 的请求被拒绝: 无权使用模型 %s", GetClientName(c), modelName)
+	abortClientPolicy(c, http.StatusForbidden, "model_not_allowed", fmt.Sprintf("API密钥无权使用模型 %s", modelName))
+	return false
+}
+
+// checkClientPolicy 检查客户端密钥的启用状态、有效期、每日配额和消费预算，允许的模型在解析别名后检查
+// 通过时返回的状态码为0
+func checkClientPolicy(clientKey *config.ClientKey) (int, string, string) {
+	if !clientKey.Enabled {
+		return http.StatusUnauthorized, "client_key_disabled", "API密钥已被禁用"
+	}
+	if clientKey.Expired() {
+		return http.StatusUnauthorized, "client_key_expired", "API密钥已过期"
+	}
+
+	// 失败的请求不计入每日请求配额
+	usage := config.GetTodayClientStats(clientKey.Name)
+	if clientKey.DailyRequestQuota > 0 && usage.Requests-usage.Failed >= clientKey.DailyRequestQuota {
+		return http.StatusTooManyRequests, "daily_request_quota_exceeded", fmt.Sprintf("已达到每日请求配额 %d 次", clientKey.DailyRequestQuota)
+	}
+	if clientKey.DailyTokenQuota > 0 && usage.Tokens >= clientKey.DailyTokenQuota {
+		return http.StatusTooManyRequests, "daily_token_quota_exceeded", fmt.Sprintf("已达到每日令牌配额 %d", clientKey.DailyTokenQuota)
+	}
+	if clientKey.OverBudget() {
+		return http.StatusTooManyRequests, "insufficient_quota", fmt.Sprintf("已用完消费预算 %.2f 元", clientKey.Budget)
+	}
+	return 0, "", ""
+}
+
+// RequestModel 获取请求使用的模型，读取请求体后恢复，供后续处理继续读取
+func RequestModel(c *gin.Context) string {
+	// Gemini客户端的模型在路径中，如/v1beta/models/gemini-pro:generateContent
+	if action := c.Param("action"); action != "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		modelName := strings.TrimPrefix(action, "/")
+		if idx := strings.Index(modelName, ":"); idx >= 0 {
+			modelName = modelName[:idx]
+		}
+		return modelName
+	}
+
+	if c.Request.Body == nil || c.Request.Method == http.MethodGet {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+
+	// 语音识别等上传文件的请求使用multipart表单
+	mediaType, params, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return ""
+			}
+			if part.FormName() == "model" {
+				value, _ := io.ReadAll(io.LimitReader(part, 1024))
+				return strings.TrimSpace(string(value))
+			}
+		}
+	}
+
+	var requestData struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return ""
+	}
+	return requestData.Model
+}
+
 // extractAPIKey 从请求中提取API密钥
 func extractAPIKey(c *gin.Context) string {
 	// 尝试从Authorization头部获取API密钥
@@ -84,12 +272,28 @@ func extractAPIKey(c *gin.Context) string {
 		return auth
 	}
 
+	// 尝试从x-api-key头部获取API密钥（Anthropic客户端）
+	if apiKey := c.GetHeader("x-api-key"); apiKey != "" {
+		return apiKey
+	}
+
+	// 尝试从x-goog-api-key头部获取API密钥（Gemini客户端）
+	if apiKey := c.GetHeader("x-goog-api-key"); apiKey != "" {
+		return apiKey
+	}
+
 	// 尝试从查询参数获取API密钥
 	apiKey := c.Query("api_key")
 	if apiKey != "" {
 		return apiKey
 	}
 
+	// Gemini客户端使用key查询参数
+	apiKey = c.Query("key")
+	if apiKey != "" {
+		return apiKey
+	}
+
 	// 如果是POST请求，尝试从form参数获取API密钥
 	if c.Request.Method == "POST" {
 		apiKey = c.PostForm("api_key")
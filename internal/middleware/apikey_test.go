@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"flowsilicon/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckClientPolicy(t *testing.T) {
+	// 今天的用量：3个请求中1个失败，共300个令牌
+	config.AddDailyClientStat("quota-client", "m", 100, 100, 0, true)
+	config.AddDailyClientStat("quota-client", "m", 50, 50, 0, true)
+	config.AddDailyClientStat("quota-client", "m", 0, 0, 0, false)
+
+	tests := []struct {
+		name     string
+		key      config.ClientKey
+		wantCode string
+	}{
+		{"allowed", config.ClientKey{Name: "a", Enabled: true}, ""},
+		{"disabled", config.ClientKey{Name: "a"}, "client_key_disabled"},
+		{"expired", config.ClientKey{Name: "a", Enabled: true, ExpiresAt: time.Now().Add(-time.Minute).Unix()}, "client_key_expired"},
+		{"not yet expired", config.ClientKey{Name: "a", Enabled: true, ExpiresAt: time.Now().Add(time.Hour).Unix()}, ""},
+		{"models are checked after alias resolution", config.ClientKey{Name: "a", Enabled: true, AllowedModels: []string{"Qwen/*"}}, ""},
+		{"failed requests not counted", config.ClientKey{Name: "quota-client", Enabled: true, DailyRequestQuota: 3}, ""},
+		{"request quota reached", config.ClientKey{Name: "quota-client", Enabled: true, DailyRequestQuota: 2}, "daily_request_quota_exceeded"},
+		{"token quota reached", config.ClientKey{Name: "quota-client", Enabled: true, DailyTokenQuota: 300}, "daily_token_quota_exceeded"},
+		{"token quota left", config.ClientKey{Name: "quota-client", Enabled: true, DailyTokenQuota: 301}, ""},
+		{"over budget", config.ClientKey{Name: "a", Enabled: true, Budget: 10, Spent: 10}, "insufficient_quota"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code, _ := checkClientPolicy(&tt.key)
+			if code != tt.wantCode {
+				t.Errorf("checkClientPolicy() code = %q, want %q", code, tt.wantCode)
+			}
+			if (status == 0) != (tt.wantCode == "") {
+				t.Errorf("checkClientPolicy() status = %d for code %q", status, code)
+			}
+		})
+	}
+}
+
+func TestClientAllowsModel(t *testing.T) {
+	clientKey := &config.ClientKey{Name: "qwen-only", Key: "sk-qwen-only", Enabled: true, AllowedModels: []string{"Qwen/*", "BAAI/bge-m3"}}
+	if err := config.SaveClientKey(clientKey); err != nil {
+		t.Fatalf("SaveClientKey() error = %v", err)
+	}
+	defer config.DeleteClientKey(clientKey.ID)
+	id := strconv.FormatInt(clientKey.ID, 10)
+
+	tests := []struct {
+		client string
+		model  string
+		want   bool
+	}{
+		{id, "Qwen/Qwen2.5-7B-Instruct", true},
+		{id, "BAAI/bge-m3", true},
+		{id, "deepseek-ai/DeepSeek-V3", false},
+		{config.DefaultClientName, "deepseek-ai/DeepSeek-V3", true},
+		{"", "deepseek-ai/DeepSeek-V3", true},
+	}
+	for _, tt := range tests {
+		if got := ClientAllowsModel(tt.client, tt.model); got != tt.want {
+			t.Errorf("ClientAllowsModel(%q, %q) = %v, want %v", tt.client, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyMiddlewareClientID(t *testing.T) {
+	original := config.GetConfig()
+	cfg := &config.Config{}
+	cfg.Security.ApiKeyEnabled = true
+	cfg.Security.ApiKey = "sk-shared"
+	config.UpdateConfig(cfg)
+	defer config.UpdateConfig(original)
+
+	clientKey := &config.ClientKey{Name: "alice", Key: "sk-alice", Enabled: true}
+	if err := config.SaveClientKey(clientKey); err != nil {
+		t.Fatalf("SaveClientKey() error = %v", err)
+	}
+	defer config.DeleteClientKey(clientKey.ID)
+
+	serve := func(header string) (int, Client) {
+		router := gin.New()
+		var client Client
+		router.POST("/v1/chat/completions", APIKeyMiddleware(), func(c *gin.Context) {
+			client = GetClient(c)
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code, client
+	}
+
+	aliceID := strconv.FormatInt(clientKey.ID, 10)
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantClient Client
+	}{
+		{"shared key", "Bearer sk-shared", http.StatusOK, Client{ID: config.DefaultClientName, Name: config.DefaultClientName}},
+		{"client key is identified by id", "Bearer sk-alice", http.StatusOK, Client{ID: aliceID, Name: "alice"}},
+		{"unknown key", "Bearer sk-unknown", http.StatusUnauthorized, Client{}},
+		{"missing key", "", http.StatusUnauthorized, Client{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, client := serve(tt.header); status != tt.wantStatus || client != tt.wantClient {
+				t.Errorf("status = %d, client = %+v, want %d, %+v", status, client, tt.wantStatus, tt.wantClient)
+			}
+		})
+	}
+
+	// 重命名后客户端标识不变，只有名称变化
+	clientKey.Name = "alice-renamed"
+	if err := config.SaveClientKey(clientKey); err != nil {
+		t.Fatalf("SaveClientKey() error = %v", err)
+	}
+	want := Client{ID: aliceID, Name: "alice-renamed"}
+	if _, client := serve("Bearer sk-alice"); client != want {
+		t.Errorf("after rename client = %+v, want %+v", client, want)
+	}
+	if got := ClientForID(aliceID); got != want {
+		t.Errorf("ClientForID(%q) = %+v, want %+v", aliceID, got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/testutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, func(dir string) (func(), error) {
+		if err := config.InitConfigDB(filepath.Join(dir, "config.db")); err != nil {
+			return nil, err
+		}
+		if err := config.EnsureClientKeysTable(); err != nil {
+			return nil, err
+		}
+		config.SetDailyFilePath(filepath.Join(dir, "daily.json"))
+		if err := config.InitDailyStats(); err != nil {
+			return nil, err
+		}
+		return func() { config.CloseConfigDB() }, nil
+	})
+}
@@ -0,0 +1,196 @@
+/**
+  @author: Hanhai
+  @desc: 模型别名模块，将客户端请求的模型名映射为实际的模型ID，支持前缀通配和按客户端配置
+**/
+
+package model
+
+import (
+	"flowsilicon/internal/logger"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAlias 请求未指定模型时使用的别名
+const DefaultAlias = "default"
+
+// ModelAlias 模型别名
+type ModelAlias struct {
+	ID        int64     `json:"id"`         // 别名ID
+	Alias     string    `json:"alias"`      // 别名，以*结尾时按前缀匹配
+	Target    string    `json:"target"`     // 实际的模型ID
+	Client    string    `json:"client"`     // 生效的客户端，为空时对所有客户端生效
+	CreatedAt time.Time `json:"created_at"` // 创建时间
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+}
+
+var (
+	// 别名缓存，避免每次请求都查询数据库
+	aliasCache []ModelAlias
+	aliasMutex sync.RWMutex
+)
+
+// initModelAliasTable 创建模型别名表并加载缓存
+func initModelAliasTable() error {
+	query := `CREATE TABLE IF NOT EXISTS model_aliases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alias TEXT NOT NULL,
+		target TEXT NOT NULL,
+		client TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(alias, client)
+	)`
+	if _, err := modelDB.Exec(query); err != nil {
+		logger.Error("创建模型别名表失败: %v", err)
+		return err
+	}
+
+	return reloadModelAliases()
+}
+
+// reloadModelAliases 从数据库重新加载别名缓存
+func reloadModelAliases() error {
+	rows, err := modelDB.Query("SELECT id, alias, target, client, created_at, updated_at FROM model_aliases ORDER BY alias, client")
+	if err != nil {
+		logger.Error("查询模型别名失败: %v", err)
+		return err
+	}
+	defer rows.Close()
+
+	aliases := make([]ModelAlias, 0)
+	for rows.Next() {
+		var a ModelAlias
+		if err := rows.Scan(&a.ID, &a.Alias, &a.Target, &a.Client, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			logger.Error("读取模型别名失败: %v", err)
+			return err
+		}
+		aliases = append(aliases, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	aliasMutex.Lock()
+	aliasCache = aliases
+	aliasMutex.Unlock()
+	return nil
+}
+
+// GetModelAliases 获取所有模型别名
+func GetModelAliases() []ModelAlias {
+	aliasMutex.RLock()
+	defer aliasMutex.RUnlock()
+
+	aliases := make([]ModelAlias, len(aliasCache))
+	copy(aliases, aliasCache)
+	return aliases
+}
+
+// SaveModelAlias 添加或更新模型别名，同一客户端的相同别名会被覆盖
+func SaveModelAlias(alias string, target string, client string) error {
+	if modelDB == nil {
+		return fmt.Errorf("数据库连接未初始化")
+	}
+
+	alias = strings.TrimSpace(alias)
+	target = strings.TrimSpace(target)
+	client = strings.TrimSpace(client)
+	if alias == "" || target == "" {
+		return fmt.Errorf("别名和目标模型不能为空")
+	}
+	if strings.HasSuffix(target, "*") {
+		return fmt.Errorf("目标模型不能使用通配符")
+	}
+
+	stmt := `INSERT INTO model_aliases (alias, target, client) VALUES (?, ?, ?)
+			ON CONFLICT(alias, client) DO UPDATE SET target = excluded.target, updated_at = CURRENT_TIMESTAMP`
+	if _, err := ModelDBExecWithRetry("保存模型别名", 3, stmt, alias, target, client); err != nil {
+		logger.Error("保存模型别名 %s 失败: %v", alias, err)
+		return err
+	}
+
+	logger.Info("已保存模型别名 %s -> %s (客户端: %s)", alias, target, client)
+	return reloadModelAliases()
+}
+
+// RenameModelAliasClient 客户端重命名后将旧名称的别名转移到新名称下，新名称已有的同名别名会被覆盖
+func RenameModelAliasClient(oldClient string, newClient string) error {
+	if modelDB == nil {
+		return fmt.Errorf("数据库连接未初始化")
+	}
+	if oldClient == "" || newClient == "" || oldClient == newClient {
+		return nil
+	}
+
+	result, err := ModelDBExecWithRetry("重命名别名客户端", 3,
+		"UPDATE OR REPLACE model_aliases SET client = ?, updated_at = CURRENT_TIMESTAMP WHERE client = ?", newClient, oldClient)
+	if err != nil {
+		logger.Error("将客户端 %s 的模型别名转移到 %s 失败: %v", oldClient, newClient, err)
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		logger.Info("已将客户端 %s 的 %d 个模型别名转移到 %s", oldClient, affected, newClient)
+	}
+	return reloadModelAliases()
+}
+
+// DeleteModelAlias 删除模型别名
+func DeleteModelAlias(id int64) error {
+	if modelDB == nil {
+		return fmt.Errorf("数据库连接未初始化")
+	}
+
+	if _, err := ModelDBExecWithRetry("删除模型别名", 3, "DELETE FROM model_aliases WHERE id = ?", id); err != nil {
+		logger.Error("删除模型别名 %d 失败: %v", id, err)
+		return err
+	}
+
+	logger.Info("已删除模型别名 %d", id)
+	return reloadModelAliases()
+}
+
+// ResolveModelAlias 解析模型别名，返回实际的模型ID
+// 匹配顺序：客户端精确匹配、客户端前缀匹配、全局精确匹配、全局前缀匹配，前缀匹配时最长的前缀优先
+func ResolveModelAlias(modelName string, client string) (string, bool) {
+	aliasMutex.RLock()
+	defer aliasMutex.RUnlock()
+
+	if len(aliasCache) == 0 {
+		return modelName, false
+	}
+
+	lowerName := strings.ToLower(modelName)
+	clients := []string{""}
+	if client != "" {
+		clients = []string{client, ""}
+	}
+
+	for _, c := range clients {
+		// 精确匹配
+		for _, a := range aliasCache {
+			if a.Client == c && strings.ToLower(a.Alias) == lowerName {
+				return a.Target, true
+			}
+		}
+
+		// 前缀匹配
+		var best *ModelAlias
+		for i, a := range aliasCache {
+			if a.Client != c || !strings.HasSuffix(a.Alias, "*") {
+				continue
+			}
+			prefix := strings.ToLower(strings.TrimSuffix(a.Alias, "*"))
+			if strings.HasPrefix(lowerName, prefix) && (best == nil || len(a.Alias) > len(best.Alias)) {
+				best = &aliasCache[i]
+			}
+		}
+		if best != nil {
+			return best.Target, true
+		}
+	}
+
+	return modelName, false
+}
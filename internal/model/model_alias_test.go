@@ -0,0 +1,49 @@
+package model
+
+import "testing"
+
+func TestResolveModelAlias(t *testing.T) {
+	aliasMutex.Lock()
+	saved := aliasCache
+	aliasCache = []ModelAlias{
+		{Alias: "gpt-4o", Target: "Qwen/Qwen2.5-72B-Instruct"},
+		{Alias: "gpt-4o", Target: "deepseek-ai/DeepSeek-V3", Client: "alice"},
+		{Alias: "gpt-*", Target: "Qwen/Qwen2.5-7B-Instruct"},
+		{Alias: "gpt-4*", Target: "Qwen/Qwen2.5-32B-Instruct"},
+		{Alias: "claude-*", Target: "deepseek-ai/DeepSeek-R1", Client: "bob"},
+		{Alias: DefaultAlias, Target: "THUDM/glm-4-9b-chat"},
+	}
+	aliasMutex.Unlock()
+	defer func() {
+		aliasMutex.Lock()
+		aliasCache = saved
+		aliasMutex.Unlock()
+	}()
+
+	tests := []struct {
+		name   string
+		model  string
+		client string
+		want   string
+		found  bool
+	}{
+		{"global exact", "gpt-4o", "", "Qwen/Qwen2.5-72B-Instruct", true},
+		{"case insensitive", "GPT-4o", "", "Qwen/Qwen2.5-72B-Instruct", true},
+		{"client exact overrides global", "gpt-4o", "alice", "deepseek-ai/DeepSeek-V3", true},
+		{"other client falls back to global", "gpt-4o", "bob", "Qwen/Qwen2.5-72B-Instruct", true},
+		{"longest prefix wins", "gpt-4-turbo", "", "Qwen/Qwen2.5-32B-Instruct", true},
+		{"shorter prefix", "gpt-3.5-turbo", "", "Qwen/Qwen2.5-7B-Instruct", true},
+		{"client prefix", "claude-3-opus", "bob", "deepseek-ai/DeepSeek-R1", true},
+		{"client prefix not visible to others", "claude-3-opus", "alice", "claude-3-opus", false},
+		{"default alias", DefaultAlias, "", "THUDM/glm-4-9b-chat", true},
+		{"no match", "Qwen/QwQ-32B", "", "Qwen/QwQ-32B", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := ResolveModelAlias(tt.model, tt.client)
+			if got != tt.want || found != tt.found {
+				t.Errorf("ResolveModelAlias(%q, %q) = %q, %v, want %q, %v", tt.model, tt.client, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
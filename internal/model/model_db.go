@@ -6,6 +6,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
 	"encoding/json"
@@ -58,6 +59,11 @@ func InitModelDB(dbPath string) error {
 		strategy_id INTEGER DEFAULT 0 NOT NULL,
 		type INTEGER DEFAULT 1 NOT NULL,
 		call_count INTEGER DEFAULT 0 NOT NULL,
+		fallback_models TEXT DEFAULT '' NOT NULL,
+		tool_emulation BOOLEAN DEFAULT 0 NOT NULL,
+		context_length INTEGER DEFAULT 0 NOT NULL,
+		input_price REAL DEFAULT 0 NOT NULL,
+		output_price REAL DEFAULT 0 NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		deleted_at TIMESTAMP
@@ -105,6 +111,38 @@ func InitModelDB(dbPath string) error {
 		return err
 	}
 
+	// 检查fallback_models字段是否存在
+	var fallbackColumnExists int
+	err = modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name='fallback_models'").Scan(&fallbackColumnExists)
+	if err != nil {
+		logger.Error("检查fallback_models字段存在失败: %v", err)
+		return err
+	}
+
+	// 检查tool_emulation字段是否存在
+	var toolEmulationColumnExists int
+	err = modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name='tool_emulation'").Scan(&toolEmulationColumnExists)
+	if err != nil {
+		logger.Error("检查tool_emulation字段存在失败: %v", err)
+		return err
+	}
+
+	// 检查context_length字段是否存在
+	var contextLengthColumnExists int
+	err = modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name='context_length'").Scan(&contextLengthColumnExists)
+	if err != nil {
+		logger.Error("检查context_length字段存在失败: %v", err)
+		return err
+	}
+
+	// 检查input_price字段是否存在，output_price与其同时添加
+	var priceColumnExists int
+	err = modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name='input_price'").Scan(&priceColumnExists)
+	if err != nil {
+		logger.Error("检查input_price字段存在失败: %v", err)
+		return err
+	}
+
 	// 如果列不存在，添加它
 	if strategyColumnExists == 0 {
 		_, err = modelDB.Exec("ALTER TABLE models ADD COLUMN strategy_id INTEGER DEFAULT 0 NOT NULL")
@@ -135,6 +173,48 @@ func InitModelDB(dbPath string) error {
 		logger.Info("成功添加call_count字段到models表")
 	}
 
+	// 如果fallback_models列不存在，添加它
+	if fallbackColumnExists == 0 {
+		_, err = modelDB.Exec("ALTER TABLE models ADD COLUMN fallback_models TEXT DEFAULT '' NOT NULL")
+		if err != nil {
+			logger.Error("添加fallback_models字段失败: %v", err)
+			return err
+		}
+		logger.Info("成功添加fallback_models字段到models表")
+	}
+
+	// 如果tool_emulation列不存在，添加它
+	if toolEmulationColumnExists == 0 {
+		_, err = modelDB.Exec("ALTER TABLE models ADD COLUMN tool_emulation BOOLEAN DEFAULT 0 NOT NULL")
+		if err != nil {
+			logger.Error("添加tool_emulation字段失败: %v", err)
+			return err
+		}
+		logger.Info("成功添加tool_emulation字段到models表")
+	}
+
+	// 如果context_length列不存在，添加它
+	if contextLengthColumnExists == 0 {
+		_, err = modelDB.Exec("ALTER TABLE models ADD COLUMN context_length INTEGER DEFAULT 0 NOT NULL")
+		if err != nil {
+			logger.Error("添加context_length字段失败: %v", err)
+			return err
+		}
+		logger.Info("成功添加context_length字段到models表")
+	}
+
+	// 如果input_price和output_price列不存在，添加它们
+	if priceColumnExists == 0 {
+		for _, column := range []string{"input_price", "output_price"} {
+			_, err = modelDB.Exec("ALTER TABLE models ADD COLUMN " + column + " REAL DEFAULT 0 NOT NULL")
+			if err != nil {
+				logger.Error("添加%s字段失败: %v", column, err)
+				return err
+			}
+		}
+		logger.Info("成功添加input_price和output_price字段到models表")
+	}
+
 	// 更新所有免费模型的策略为8（免费策略），默认策略为6（普通策略）
 	_, err = modelDB.Exec(`UPDATE models SET 
 							strategy_id = CASE 
@@ -151,6 +231,11 @@ func InitModelDB(dbPath string) error {
 		logger.Info("已更新模型默认策略：免费模型使用策略8，其他模型使用策略6")
 	}
 
+	// 创建模型别名表
+	if err = initModelAliasTable(); err != nil {
+		return err
+	}
+
 	logger.Info("模型表初始化成功")
 	return nil
 }
@@ -183,6 +268,14 @@ func CloseModelDB() error {
 	return nil
 }
 
+// PingModelDB 检查模型数据库连接是否可用
+func PingModelDB(ctx context.Context) error {
+	if modelDB == nil {
+		return fmt.Errorf("模型数据库未初始化")
+	}
+	return modelDB.PingContext(ctx)
+}
+
 // GetAllModels 获取所有模型
 func GetAllModels() ([]Model, error) {
 	// 确保数据库连接已经初始化
@@ -215,7 +308,7 @@ func GetAllModels() ([]Model, error) {
 	}
 
 	// 查询所有未删除的模型
-	query := `SELECT id, is_free, is_giftable, strategy_id, type, call_count FROM models WHERE deleted_at IS NULL`
+	query := `SELECT id, is_free, is_giftable, strategy_id, type, call_count, fallback_models, tool_emulation, context_length, input_price, output_price FROM models WHERE deleted_at IS NULL`
 	rows, err := modelDB.Query(query)
 	if err != nil {
 		return nil, err
@@ -225,9 +318,11 @@ func GetAllModels() ([]Model, error) {
 	var models []Model
 	for rows.Next() {
 		var model Model
-		if err := rows.Scan(&model.ID, &model.IsFree, &model.IsGiftable, &model.StrategyID, &model.Type, &model.CallCount); err != nil {
+		var fallbackModels string
+		if err := rows.Scan(&model.ID, &model.IsFree, &model.IsGiftable, &model.StrategyID, &model.Type, &model.CallCount, &fallbackModels, &model.ToolEmulation, &model.ContextLength, &model.InputPrice, &model.OutputPrice); err != nil {
 			return nil, err
 		}
+		model.FallbackModels = splitFallbackModels(fallbackModels)
 		models = append(models, model)
 	}
 
@@ -251,7 +346,11 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 		return nil, 0, err
 	}
 
-	apikeys := config.GetActiveApiKeys()
+	// 模型列表来自默认提供商，需要使用默认提供商的密钥
+	apikeys := config.GetActiveApiKeysByProvider(config.DefaultProvider)
+	if len(apikeys) == 0 {
+		return nil, 0, fmt.Errorf("没有可用的API密钥")
+	}
 	utils.SetCommonHeaders(req, apikeys[0].Key)
 
 	// 发送请求
@@ -570,6 +669,188 @@ func UpdateModelStrategyWithTx(tx *sql.Tx, modelId string, strategyId int) error
 	return nil
 }
 
+// UpdateModelFallbacksWithTx 使用事务更新模型的备用模型链
+func UpdateModelFallbacksWithTx(tx *sql.Tx, modelId string, fallbacks []string) error {
+	if tx == nil {
+		return fmt.Errorf("事务对象为空")
+	}
+
+	// 过滤空值、重复项和模型自身
+	seen := map[string]bool{modelId: true}
+	chain := make([]string, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		fallback = strings.TrimSpace(fallback)
+		if fallback == "" || seen[fallback] {
+			continue
+		}
+		seen[fallback] = true
+		chain = append(chain, fallback)
+	}
+
+	_, err := tx.Exec(
+		"UPDATE models SET fallback_models = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		strings.Join(chain, ","), modelId)
+	if err != nil {
+		logger.Error("使用事务更新模型备用链失败: %v", err)
+		return err
+	}
+
+	logger.Info("已使用事务更新模型 %s 的备用链为 %v", modelId, chain)
+	return nil
+}
+
+// GetModelFallbacks 获取模型的备用模型链
+func GetModelFallbacks(modelId string) ([]string, error) {
+	if modelDB == nil {
+		return nil, fmt.Errorf("数据库连接未初始化")
+	}
+
+	var fallbackModels string
+	err := modelDB.QueryRow(
+		"SELECT fallback_models FROM models WHERE id = ? AND deleted_at IS NULL",
+		modelId).Scan(&fallbackModels)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // 未找到模型，没有备用链
+		}
+		logger.Error("获取模型备用链失败: %v", err)
+		return nil, err
+	}
+
+	return splitFallbackModels(fallbackModels), nil
+}
+
+// UpdateModelToolEmulationWithTx 使用事务更新模型是否模拟工具调用
+func UpdateModelToolEmulationWithTx(tx *sql.Tx, modelId string, toolEmulation bool) error {
+	if tx == nil {
+		return fmt.Errorf("事务对象为空")
+	}
+
+	_, err := tx.Exec(
+		"UPDATE models SET tool_emulation = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		toolEmulation, modelId)
+	if err != nil {
+		logger.Error("使用事务更新模型工具调用模拟失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsToolEmulationModel 检查模型是否不支持原生工具调用，需要使用提示词模拟
+func IsToolEmulationModel(modelId string) bool {
+	if modelDB == nil {
+		return false
+	}
+
+	var toolEmulation bool
+	err := modelDB.QueryRow(
+		"SELECT tool_emulation FROM models WHERE id = ? AND deleted_at IS NULL",
+		modelId).Scan(&toolEmulation)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("获取模型工具调用模拟设置失败: %v", err)
+		}
+		return false
+	}
+
+	return toolEmulation
+}
+
+// UpdateModelContextLengthWithTx 使用事务更新模型的上下文长度
+func UpdateModelContextLengthWithTx(tx *sql.Tx, modelId string, contextLength int) error {
+	if tx == nil {
+		return fmt.Errorf("事务对象为空")
+	}
+	if contextLength < 0 {
+		contextLength = 0
+	}
+
+	_, err := tx.Exec(
+		"UPDATE models SET context_length = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		contextLength, modelId)
+	if err != nil {
+		logger.Error("使用事务更新模型上下文长度失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetModelContextLength 获取模型的上下文长度，未设置时返回0
+func GetModelContextLength(modelId string) int {
+	if modelDB == nil {
+		return 0
+	}
+
+	var contextLength int
+	err := modelDB.QueryRow(
+		"SELECT context_length FROM models WHERE id = ? AND deleted_at IS NULL",
+		modelId).Scan(&contextLength)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("获取模型上下文长度失败: %v", err)
+		}
+		return 0
+	}
+
+	return contextLength
+}
+
+// UpdateModelPriceWithTx 使用事务更新模型的输入和输出价格（元/百万令牌）
+func UpdateModelPriceWithTx(tx *sql.Tx, modelId string, inputPrice float64, outputPrice float64) error {
+	if tx == nil {
+		return fmt.Errorf("事务对象为空")
+	}
+	if inputPrice < 0 {
+		inputPrice = 0
+	}
+	if outputPrice < 0 {
+		outputPrice = 0
+	}
+
+	_, err := tx.Exec(
+		"UPDATE models SET input_price = ?, output_price = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		inputPrice, outputPrice, modelId)
+	if err != nil {
+		logger.Error("使用事务更新模型价格失败: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetModelPrice 获取模型的输入和输出价格（元/百万令牌），未设置时返回0
+func GetModelPrice(modelId string) (float64, float64) {
+	if modelDB == nil {
+		return 0, 0
+	}
+
+	var inputPrice, outputPrice float64
+	err := modelDB.QueryRow(
+		"SELECT input_price, output_price FROM models WHERE id = ? AND deleted_at IS NULL",
+		modelId).Scan(&inputPrice, &outputPrice)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("获取模型价格失败: %v", err)
+		}
+		return 0, 0
+	}
+
+	return inputPrice, outputPrice
+}
+
+// splitFallbackModels 解析以逗号分隔的备用模型链
+func splitFallbackModels(value string) []string {
+	fallbacks := make([]string, 0)
+	for _, fallback := range strings.Split(value, ",") {
+		if fallback = strings.TrimSpace(fallback); fallback != "" {
+			fallbacks = append(fallbacks, fallback)
+		}
+	}
+	return fallbacks
+}
+
 // UpdateModelFreeStatusWithTx 使用事务更新模型免费状态
 func UpdateModelFreeStatusWithTx(tx *sql.Tx, modelIds []string, isFree bool) (int, error) {
 	if tx == nil {
@@ -11,15 +11,20 @@ import (
 
 // Model 模型信息
 type Model struct {
-	ID         string     `json:"id"`          // 模型ID
-	IsFree     bool       `json:"is_free"`     // 是否免费
-	IsGiftable bool       `json:"is_giftable"` // 是否可用赠费
-	StrategyID int        `json:"strategy_id"` // 模型使用的策略ID
-	Type       int        `json:"type"`        // 模型类型：1-对话，2-生图，3-视频，4-语音，5-嵌入，6-重排序，7-推理
-	CallCount  int        `json:"call_count"`  // 调用次数
-	CreatedAt  time.Time  `json:"created_at"`  // 创建时间
-	UpdatedAt  time.Time  `json:"updated_at"`  // 更新时间
-	DeletedAt  *time.Time `json:"deleted_at"`  // 删除时间（软删除）
+	ID             string     `json:"id"`              // 模型ID
+	IsFree         bool       `json:"is_free"`         // 是否免费
+	IsGiftable     bool       `json:"is_giftable"`     // 是否可用赠费
+	StrategyID     int        `json:"strategy_id"`     // 模型使用的策略ID
+	Type           int        `json:"type"`            // 模型类型：1-对话，2-生图，3-视频，4-语音，5-嵌入，6-重排序，7-推理
+	CallCount      int        `json:"call_count"`      // 调用次数
+	FallbackModels []string   `json:"fallback_models"` // 备用模型链，模型繁忙或超时时按顺序切换
+	ToolEmulation  bool       `json:"tool_emulation"`  // 模型不支持原生工具调用，使用提示词模拟
+	ContextLength  int        `json:"context_length"`  // 上下文长度（令牌数），0表示未设置，不做上下文裁剪
+	InputPrice     float64    `json:"input_price"`     // 输入价格（元/百万令牌），用于计算客户端密钥的消费
+	OutputPrice    float64    `json:"output_price"`    // 输出价格（元/百万令牌）
+	CreatedAt      time.Time  `json:"created_at"`      // 创建时间
+	UpdatedAt      time.Time  `json:"updated_at"`      // 更新时间
+	DeletedAt      *time.Time `json:"deleted_at"`      // 删除时间（软删除）
 }
 
 // TableName 指定表名
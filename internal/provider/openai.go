@@ -0,0 +1,114 @@
+/**
+  @author: Hanhai
+  @desc: OpenAI兼容提供商，以及基于它实现余额查询的DeepSeek、Moonshot提供商
+**/
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 没有余额接口的提供商（如本地vLLM）使用的固定余额，保证密钥不会因余额不足被禁用
+const unlimitedBalance = 100.0
+
+// openAIProvider 通用的OpenAI兼容提供商
+type openAIProvider struct {
+	name    string
+	baseURL string
+}
+
+func (p *openAIProvider) Name() string {
+	return p.name
+}
+
+func (p *openAIProvider) BaseURL() string {
+	return p.baseURL
+}
+
+// CheckBalance OpenAI兼容接口没有余额查询，返回固定余额
+func (p *openAIProvider) CheckBalance(apiKey string) (float64, error) {
+	return unlimitedBalance, nil
+}
+
+// ListModels 通过 /v1/models 获取模型列表
+func (p *openAIProvider) ListModels(apiKey string) ([]string, error) {
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := getJSON(p.baseURL+"/v1/models", apiKey, &result); err != nil {
+		return nil, err
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		if m.ID != "" {
+			models = append(models, m.ID)
+		}
+	}
+	return models, nil
+}
+
+// TestKey 通过获取模型列表测试密钥是否可用
+func (p *openAIProvider) TestKey(apiKey string) (bool, error) {
+	if _, err := p.ListModels(apiKey); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deepSeekProvider DeepSeek提供商
+type deepSeekProvider struct {
+	openAIProvider
+}
+
+// CheckBalance 通过 /user/balance 查询余额，累加所有币种的总余额
+func (p *deepSeekProvider) CheckBalance(apiKey string) (float64, error) {
+	var result struct {
+		IsAvailable  bool `json:"is_available"`
+		BalanceInfos []struct {
+			Currency     string `json:"currency"`
+			TotalBalance string `json:"total_balance"`
+		} `json:"balance_infos"`
+	}
+	if err := getJSON(p.baseURL+"/user/balance", apiKey, &result); err != nil {
+		return 0, err
+	}
+
+	var balance float64
+	for _, info := range result.BalanceInfos {
+		value, err := strconv.ParseFloat(info.TotalBalance, 64)
+		if err != nil {
+			return 0, fmt.Errorf("解析余额失败: %w", err)
+		}
+		balance += value
+	}
+	return balance, nil
+}
+
+// moonshotProvider Moonshot提供商
+type moonshotProvider struct {
+	openAIProvider
+}
+
+// CheckBalance 通过 /v1/users/me/balance 查询可用余额
+func (p *moonshotProvider) CheckBalance(apiKey string) (float64, error) {
+	var result struct {
+		Code   int  `json:"code"`
+		Status bool `json:"status"`
+		Data   struct {
+			AvailableBalance float64 `json:"available_balance"`
+		} `json:"data"`
+	}
+	if err := getJSON(p.baseURL+"/v1/users/me/balance", apiKey, &result); err != nil {
+		return 0, err
+	}
+
+	if !result.Status || result.Code != 0 {
+		return 0, fmt.Errorf("API 响应错误: code %d", result.Code)
+	}
+	return result.Data.AvailableBalance, nil
+}
@@ -0,0 +1,313 @@
+/**
+  @author: Hanhai
+  @desc: 上游提供商模块，定义提供商接口，并根据密钥和模型选择对应的提供商
+**/
+
+package provider
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 提供商类型
+const (
+	TypeSiliconFlow = "siliconflow"
+	TypeDeepSeek    = "deepseek"
+	TypeMoonshot    = "moonshot"
+	TypeOpenAI      = "openai"
+)
+
+const (
+	// 远程模型列表缓存时间
+	modelsCacheTTL = 10 * time.Minute
+	// 获取远程模型列表失败后的重试间隔
+	modelsRetryInterval = time.Minute
+	// 请求提供商接口的超时时间
+	requestTimeout = 30 * time.Second
+)
+
+// Provider 上游提供商
+type Provider interface {
+	// Name 提供商名称，与密钥的Provider字段对应
+	Name() string
+	// BaseURL API基础URL，不包含/v1
+	BaseURL() string
+	// CheckBalance 查询密钥余额
+	CheckBalance(apiKey string) (float64, error)
+	// ListModels 获取提供商的模型列表
+	ListModels(apiKey string) ([]string, error)
+	// TestKey 测试密钥是否可用
+	TestKey(apiKey string) (bool, error)
+}
+
+// modelsCache 提供商远程模型列表缓存
+type modelsCache struct {
+	models    map[string]bool
+	expiresAt time.Time
+}
+
+var (
+	client      *resty.Client
+	cacheMutex  sync.Mutex
+	remoteCache = make(map[string]*modelsCache)
+	// 正在后台刷新模型列表的提供商，由cacheMutex保护
+	refreshing = make(map[string]bool)
+)
+
+// 初始化 HTTP 客户端
+func init() {
+	client = resty.New()
+	client.SetTimeout(requestTimeout)
+}
+
+// newProvider 根据配置创建提供商
+func newProvider(cfg config.ProviderConfig) Provider {
+	base := openAIProvider{name: cfg.Name, baseURL: strings.TrimRight(cfg.BaseURL, "/")}
+	switch cfg.Type {
+	case TypeSiliconFlow:
+		return &siliconFlowProvider{openAIProvider: base}
+	case TypeDeepSeek:
+		return &deepSeekProvider{openAIProvider: base}
+	case TypeMoonshot:
+		return &moonshotProvider{openAIProvider: base}
+	default:
+		return &base
+	}
+}
+
+// Default 返回默认提供商（硅基流动，使用ApiProxy.BaseURL）
+func Default() Provider {
+	return &siliconFlowProvider{openAIProvider: openAIProvider{
+		name:    config.DefaultProvider,
+		baseURL: strings.TrimRight(config.GetConfig().ApiProxy.BaseURL, "/"),
+	}}
+}
+
+// configured 返回所有已启用的额外提供商配置
+func configured() []config.ProviderConfig {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+
+	providers := make([]config.ProviderConfig, 0, len(cfg.ApiProxy.Providers))
+	for _, p := range cfg.ApiProxy.Providers {
+		if p.Enabled && p.Name != "" && p.Name != config.DefaultProvider && p.BaseURL != "" {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// List 返回默认提供商和所有已启用的额外提供商
+func List() []Provider {
+	providers := []Provider{Default()}
+	for _, p := range configured() {
+		providers = append(providers, newProvider(p))
+	}
+	return providers
+}
+
+// Get 根据名称获取提供商，不存在或未启用时返回nil
+func Get(name string) Provider {
+	if name == "" || name == config.DefaultProvider {
+		return Default()
+	}
+	for _, p := range configured() {
+		if p.Name == name {
+			return newProvider(p)
+		}
+	}
+	return nil
+}
+
+// ForKey 获取密钥所属的提供商，提供商不存在或未启用时返回nil
+func ForKey(apiKey string) Provider {
+	for _, k := range config.GetApiKeys() {
+		if k.Key == apiKey {
+			return Get(k.ProviderName())
+		}
+	}
+	// 尚未添加的密钥按默认提供商处理
+	return Default()
+}
+
+// matchModel 判断模型是否匹配配置的模型列表，支持前缀通配
+func matchModel(patterns []string, modelName string) bool {
+	lowerName := strings.ToLower(modelName)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(lowerName, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == lowerName {
+			return true
+		}
+	}
+	return false
+}
+
+// ForModel 根据模型名称选择提供商
+// 优先匹配配置了模型列表的提供商，其次查找未配置模型列表的提供商的远程模型列表，都不匹配时使用默认提供商
+// 远程模型列表只读取缓存，不在请求路径上请求提供商，缓存不存在或过期时在后台刷新
+func ForModel(modelName string) Provider {
+	if modelName == "" {
+		return Default()
+	}
+
+	providers := configured()
+	for _, p := range providers {
+		if len(p.Models) > 0 && matchModel(p.Models, modelName) {
+			return newProvider(p)
+		}
+	}
+
+	for _, p := range providers {
+		if len(p.Models) > 0 {
+			continue
+		}
+		if cachedModels(newProvider(p))[modelName] {
+			return newProvider(p)
+		}
+	}
+
+	return Default()
+}
+
+// Models 返回提供商可用的模型列表，用于合并到/v1/models中
+func Models(p Provider) []string {
+	for _, cfg := range configured() {
+		if cfg.Name != p.Name() || len(cfg.Models) == 0 {
+			continue
+		}
+		// 通配符无法列出具体模型，只返回精确的模型名
+		models := make([]string, 0, len(cfg.Models))
+		for _, m := range cfg.Models {
+			if m = strings.TrimSpace(m); m != "" && !strings.HasSuffix(m, "*") {
+				models = append(models, m)
+			}
+		}
+		return models
+	}
+
+	cached := remoteModels(p)
+	models := make([]string, 0, len(cached))
+	for m := range cached {
+		models = append(models, m)
+	}
+	return models
+}
+
+// remoteModels 获取提供商的远程模型列表，使用缓存，缓存不存在或过期时同步获取
+func remoteModels(p Provider) map[string]bool {
+	cacheMutex.Lock()
+	cache, ok := remoteCache[p.Name()]
+	cacheMutex.Unlock()
+	if ok && time.Now().Before(cache.expiresAt) {
+		return cache.models
+	}
+	return fetchModels(p)
+}
+
+// cachedModels 返回缓存的远程模型列表，不发起请求，缓存不存在或过期时在后台刷新
+// 尚未获取到模型列表时返回nil
+func cachedModels(p Provider) map[string]bool {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cache, ok := remoteCache[p.Name()]
+	if !ok || !time.Now().Before(cache.expiresAt) {
+		refreshModelsLocked(p)
+	}
+	if !ok {
+		return nil
+	}
+	return cache.models
+}
+
+// refreshModelsLocked 在后台刷新提供商的远程模型列表，同一提供商同时只有一个刷新任务，调用方需持有cacheMutex
+func refreshModelsLocked(p Provider) {
+	if refreshing[p.Name()] {
+		return
+	}
+	refreshing[p.Name()] = true
+	go func() {
+		fetchModels(p)
+		cacheMutex.Lock()
+		delete(refreshing, p.Name())
+		cacheMutex.Unlock()
+	}()
+}
+
+// RefreshModelsCache 在后台获取所有未配置模型列表的提供商的远程模型列表，启动时调用以预热缓存
+func RefreshModelsCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for _, p := range configured() {
+		if len(p.Models) == 0 {
+			refreshModelsLocked(newProvider(p))
+		}
+	}
+}
+
+// fetchModels 请求提供商的模型列表并更新缓存
+func fetchModels(p Provider) map[string]bool {
+	models := make(map[string]bool)
+	expiresAt := time.Now().Add(modelsCacheTTL)
+
+	keys := config.GetActiveApiKeysByProvider(p.Name())
+	if len(keys) == 0 {
+		expiresAt = time.Now().Add(modelsRetryInterval)
+	} else if list, err := p.ListModels(keys[0].Key); err != nil {
+		logger.Warn("获取提供商 %s 的模型列表失败: %v", p.Name(), err)
+		expiresAt = time.Now().Add(modelsRetryInterval)
+	} else {
+		for _, m := range list {
+			models[m] = true
+		}
+		logger.Info("已获取提供商 %s 的模型列表，共 %d 个模型", p.Name(), len(models))
+	}
+
+	cacheMutex.Lock()
+	remoteCache[p.Name()] = &modelsCache{models: models, expiresAt: expiresAt}
+	cacheMutex.Unlock()
+	return models
+}
+
+// ClearModelsCache 清空远程模型列表缓存，提供商配置变更后调用
+func ClearModelsCache() {
+	cacheMutex.Lock()
+	remoteCache = make(map[string]*modelsCache)
+	cacheMutex.Unlock()
+}
+
+// getJSON 使用密钥请求提供商接口并解析JSON响应
+func getJSON(url string, apiKey string, result interface{}) error {
+	resp, err := client.R().
+		SetHeader("Authorization", fmt.Sprintf("Bearer %s", apiKey)).
+		Get(url)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("API 返回状态码 %d", resp.StatusCode())
+	}
+
+	if err := json.Unmarshal(resp.Body(), result); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
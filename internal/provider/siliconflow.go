@@ -0,0 +1,69 @@
+/**
+  @author: Hanhai
+  @desc: 硅基流动提供商，通过用户信息接口查询余额
+**/
+
+package provider
+
+import (
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/config"
+	"fmt"
+	"strconv"
+)
+
+// siliconFlowProvider 硅基流动提供商
+type siliconFlowProvider struct {
+	openAIProvider
+}
+
+// SiliconFlowUserInfoResponse 硅基流动用户信息响应结构
+type SiliconFlowUserInfoResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  bool   `json:"status"`
+	Data    struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		Image         string `json:"image"`
+		Email         string `json:"email"`
+		IsAdmin       bool   `json:"isAdmin"`
+		Balance       string `json:"balance"`
+		Status        string `json:"status"`
+		Introduction  string `json:"introduction"`
+		Role          string `json:"role"`
+		ChargeBalance string `json:"chargeBalance"`
+		TotalBalance  string `json:"totalBalance"`
+		Category      string `json:"category"`
+	} `json:"data"`
+}
+
+// CheckBalance 使用硅基流动 API 的用户信息接口查询余额
+func (p *siliconFlowProvider) CheckBalance(apiKey string) (float64, error) {
+	var result SiliconFlowUserInfoResponse
+	if err := getJSON(p.baseURL+"/v1/user/info", apiKey, &result); err != nil {
+		return 0, err
+	}
+
+	// 检查 API 响应状态
+	if !result.Status || result.Code != 20000 {
+		return 0, fmt.Errorf("API 响应错误: %s", result.Message)
+	}
+
+	// 解析余额字符串为浮点数
+	balance, err := strconv.ParseFloat(result.Data.TotalBalance, 64)
+	if err != nil {
+		return 0, fmt.Errorf("解析余额失败: %w", err)
+	}
+
+	return balance, nil
+}
+
+// TestKey 默认提供商使用对话接口测试，其他硅基流动提供商通过模型列表测试
+func (p *siliconFlowProvider) TestKey(apiKey string) (bool, error) {
+	if p.name == config.DefaultProvider {
+		success, _, err := common.TestChatAPI(apiKey)
+		return success, err
+	}
+	return p.openAIProvider.TestKey(apiKey)
+}
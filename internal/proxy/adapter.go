@@ -0,0 +1,401 @@
+/**
+  @author: Hanhai
+  @desc: 协议适配模块，将其他API协议的请求转为OpenAI格式走现有代理流程，并把响应实时转换回原协议
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// protocolAdapter 定义下游协议与OpenAI格式之间的响应转换
+type protocolAdapter interface {
+	// convertResponse 转换非流式响应（包括错误响应）
+	convertResponse(status int, body []byte) []byte
+	// convertChunk 转换一个OpenAI流式数据块，返回需要写给客户端的数据
+	convertChunk(chunk map[string]interface{}) []byte
+	// finishStream 流结束时调用，返回收尾数据
+	finishStream() []byte
+	// contentType 返回响应的Content-Type
+	contentType(stream bool) string
+	// keepComments 是否向客户端保留SSE注释行（心跳等）
+	keepComments() bool
+}
+
+// protocolWriter 包装gin的响应写入器，拦截OpenAI格式输出并交给适配器转换
+type protocolWriter struct {
+	gin.ResponseWriter
+	adapter protocolAdapter
+
+	mu         sync.Mutex
+	prepared   bool
+	stream     bool
+	streamDone bool
+	finished   bool
+	pending    bytes.Buffer
+	body       bytes.Buffer
+}
+
+// newProtocolWriter 创建协议适配写入器
+func newProtocolWriter(w gin.ResponseWriter, adapter protocolAdapter) *protocolWriter {
+	return &protocolWriter{ResponseWriter: w, adapter: adapter}
+}
+
+// prepare 在第一次写入时根据Content-Type判断是否为流式响应
+func (w *protocolWriter) prepare() {
+	if w.prepared {
+		return
+	}
+	w.prepared = true
+	w.stream = strings.Contains(w.ResponseWriter.Header().Get("Content-Type"), "text/event-stream")
+	if w.stream {
+		w.ResponseWriter.Header().Set("Content-Type", w.adapter.contentType(true))
+	}
+}
+
+// Write 拦截写入的数据，流式数据按行转换，非流式数据缓存到结束时统一转换
+func (w *protocolWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.finished {
+		return len(data), nil
+	}
+
+	w.prepare()
+	if !w.stream {
+		w.body.Write(data)
+		return len(data), nil
+	}
+
+	w.pending.Write(data)
+	if err := w.processPending(false); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteString 实现gin.ResponseWriter接口
+func (w *protocolWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 只在流式响应时刷新，非流式响应需要等待转换完成
+func (w *protocolWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.prepared && w.stream && !w.finished {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// processPending 处理缓冲区中完整的SSE行，flushAll为true时处理剩余的不完整行
+func (w *protocolWriter) processPending(flushAll bool) error {
+	for {
+		data := w.pending.Bytes()
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			if !flushAll || len(data) == 0 {
+				return nil
+			}
+			idx = len(data)
+		}
+
+		line := string(bytes.TrimSpace(data[:idx]))
+		if idx < len(data) {
+			w.pending.Next(idx + 1)
+		} else {
+			w.pending.Reset()
+		}
+
+		if err := w.handleLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+// handleLine 处理单行SSE数据
+func (w *protocolWriter) handleLine(line string) error {
+	if line == "" || w.streamDone {
+		return nil
+	}
+
+	// SSE注释（心跳）
+	if strings.HasPrefix(line, ":") {
+		if !w.adapter.keepComments() {
+			return nil
+		}
+		_, err := w.ResponseWriter.Write([]byte(line + "\n\n"))
+		return err
+	}
+
+	if !strings.HasPrefix(line, "data:") {
+		return nil
+	}
+
+	payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if payload == "[DONE]" {
+		w.streamDone = true
+		_, err := w.ResponseWriter.Write(w.adapter.finishStream())
+		return err
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+		return nil
+	}
+
+	out := w.adapter.convertChunk(chunk)
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(out)
+	return err
+}
+
+// finish 在代理流程结束后调用，输出剩余的转换结果
+func (w *protocolWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.finished {
+		return
+	}
+
+	if !w.prepared {
+		// 没有任何输出，无需转换
+		w.finished = true
+		return
+	}
+
+	if w.stream {
+		w.processPending(true)
+		if !w.streamDone {
+			w.streamDone = true
+			w.ResponseWriter.Write(w.adapter.finishStream())
+		}
+		w.ResponseWriter.Flush()
+		w.finished = true
+		return
+	}
+
+	w.finished = true
+	body := w.body.Bytes()
+	// 推理模型可能被强制为流式输出，此时将SSE聚合为完整响应
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("data:")) {
+		body = aggregateChatStream(body)
+	}
+
+	status := w.ResponseWriter.Status()
+	w.ResponseWriter.Header().Set("Content-Type", w.adapter.contentType(false))
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(w.adapter.convertResponse(status, body))
+}
+
+// protocolAdapterKey 上下文中标记请求由其他协议的适配器转换而来的键
+const protocolAdapterKey = "protocol_adapter"
+
+// serveWithAdapter 以OpenAI格式请求体走现有代理流程（密钥选择、重试、统计），并通过适配器转换响应
+func serveWithAdapter(c *gin.Context, adapter protocolAdapter, path string, body []byte) {
+	c.Set(protocolAdapterKey, true)
+	writer := newProtocolWriter(c.Writer, adapter)
+	originalWriter := c.Writer
+	c.Writer = writer
+	defer func() {
+		c.Writer = originalWriter
+	}()
+
+	// 替换请求体和路径，使其看起来像一个普通的OpenAI格式请求
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Method = http.MethodPost
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.URL.Path = "/v1" + path
+	c.Params = gin.Params{{Key: "path", Value: path}}
+
+	// 其他协议的认证和版本头不需要转发到上游
+	for _, name := range []string{"x-api-key", "anthropic-version", "anthropic-beta", "x-goog-api-key"} {
+		c.Request.Header.Del(name)
+	}
+
+	HandleOpenAIProxy(c)
+	writer.finish()
+}
+
+// firstJSONObject 解析响应体中的第一个JSON对象，兼容重试时写入了多段响应的情况
+func firstJSONObject(body []byte) map[string]interface{} {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&data); err != nil {
+		return nil
+	}
+	return data
+}
+
+// extractErrorMessage 从OpenAI格式的错误响应中提取错误信息
+func extractErrorMessage(data map[string]interface{}, body []byte) string {
+	if data != nil {
+		switch e := data["error"].(type) {
+		case map[string]interface{}:
+			if msg, ok := e["message"].(string); ok && msg != "" {
+				return msg
+			}
+		case string:
+			if e != "" {
+				return e
+			}
+		}
+		if msg, ok := data["message"].(string); ok && msg != "" {
+			return msg
+		}
+	}
+	if len(body) > 0 {
+		return string(body)
+	}
+	return "unknown error"
+}
+
+// sseEvent 生成带事件名的SSE数据
+func sseEvent(event string, payload interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(event)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
+
+// aggregateChatStream 将OpenAI格式的SSE流聚合为一个完整的chat.completion响应
+func aggregateChatStream(body []byte) []byte {
+	var content, reasoning strings.Builder
+	var id, model, finishReason string
+	var usage interface{}
+	var created interface{}
+	toolCalls := make([]map[string]interface{}, 0)
+
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "[DONE]" {
+			break
+		}
+
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			continue
+		}
+		if v, ok := chunk["id"].(string); ok && id == "" {
+			id = v
+		}
+		if v, ok := chunk["model"].(string); ok && model == "" {
+			model = v
+		}
+		if v, ok := chunk["created"]; ok && created == nil {
+			created = v
+		}
+		if u, ok := chunk["usage"].(map[string]interface{}); ok {
+			usage = u
+		}
+
+		choices, _ := chunk["choices"].([]interface{})
+		if len(choices) == 0 {
+			continue
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
+			finishReason = fr
+		}
+		delta, _ := choice["delta"].(map[string]interface{})
+		if delta == nil {
+			continue
+		}
+		if s, ok := delta["content"].(string); ok {
+			content.WriteString(s)
+		}
+		if s, ok := delta["reasoning_content"].(string); ok {
+			reasoning.WriteString(s)
+		}
+		if tcs, ok := delta["tool_calls"].([]interface{}); ok {
+			for _, item := range tcs {
+				tc, _ := item.(map[string]interface{})
+				if tc == nil {
+					continue
+				}
+				index := 0
+				if idx, ok := tc["index"].(float64); ok && idx >= 0 {
+					index = int(idx)
+				}
+				for len(toolCalls) <= index {
+					toolCalls = append(toolCalls, map[string]interface{}{
+						"type":     "function",
+						"function": map[string]interface{}{"name": "", "arguments": ""},
+					})
+				}
+				call := toolCalls[index]
+				if v, ok := tc["id"].(string); ok && v != "" {
+					call["id"] = v
+				}
+				fn := call["function"].(map[string]interface{})
+				if f, ok := tc["function"].(map[string]interface{}); ok {
+					if v, ok := f["name"].(string); ok && v != "" {
+						fn["name"] = v
+					}
+					if v, ok := f["arguments"].(string); ok {
+						fn["arguments"] = fn["arguments"].(string) + v
+					}
+				}
+			}
+		}
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": content.String(),
+	}
+	if reasoning.Len() > 0 {
+		message["reasoning_content"] = reasoning.String()
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	result := map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []interface{}{
+			map[string]interface{}{
+				"index":         0,
+				"message":       message,
+				"finish_reason": finishReason,
+			},
+		},
+	}
+	if usage != nil {
+		result["usage"] = usage
+	}
+
+	data, _ := json.Marshal(result)
+	return data
+}
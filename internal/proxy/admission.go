@@ -0,0 +1,336 @@
+/**
+  @author: Hanhai
+  @desc: 请求准入控制，并发请求达到上限时按优先级排队，同优先级的客户端轮流放行，推理模型和普通模型使用独立的并发池
+**/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdmissionPriorityHeader 请求头，设置请求的排队优先级，只能低于客户端密钥的优先级，用于后台任务主动让出
+const AdmissionPriorityHeader = "X-Request-Priority"
+
+var (
+	errAdmissionQueueFull = errors.New("排队的请求数已达到上限")
+	errAdmissionTimeout   = errors.New("排队等待超时")
+)
+
+// admissionWaiter 一个正在排队的请求
+type admissionWaiter struct {
+	client   string
+	priority int
+	seq      uint64 // 入队顺序
+	ready    chan struct{}
+	admitted bool
+}
+
+// admissionPool 一个并发池，并发数达到上限时请求在队列中等待
+type admissionPool struct {
+	name     string
+	mu       sync.Mutex
+	capacity int
+	active   int
+	waiters  []*admissionWaiter
+	seq      uint64
+	turn     uint64
+	// 客户端最近一次从队列中放行的轮次，同优先级时轮次最早的客户端先放行，队列清空后重置
+	served map[string]uint64
+
+	// 启动以来的统计
+	maxQueued int
+	admitted  int64
+	waited    int64
+	timedOut  int64
+	rejected  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// 推理模型和普通模型的并发池
+var (
+	heavyAdmissionPool    = newAdmissionPool("推理模型")
+	standardAdmissionPool = newAdmissionPool("普通模型")
+)
+
+// newAdmissionPool 创建并发池
+func newAdmissionPool(name string) *admissionPool {
+	return &admissionPool{name: name, served: make(map[string]uint64)}
+}
+
+// acquire 获取一个并发名额，并发数已满时排队等待，返回排队的时间
+func (p *admissionPool) acquire(ctx context.Context, client string, priority int, capacity int, maxQueue int, maxWait time.Duration) (time.Duration, error) {
+	p.mu.Lock()
+	// 并发数上限可能在设置中被调大，先放行已在排队的请求
+	p.capacity = capacity
+	p.dispatchLocked()
+
+	if p.active < p.capacity && len(p.waiters) == 0 {
+		p.active++
+		p.admitted++
+		p.mu.Unlock()
+		return 0, nil
+	}
+	if len(p.waiters) >= maxQueue {
+		p.rejected++
+		p.mu.Unlock()
+		return 0, errAdmissionQueueFull
+	}
+
+	p.seq++
+	waiter := &admissionWaiter{client: client, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	p.waiters = append(p.waiters, waiter)
+	if len(p.waiters) > p.maxQueued {
+		p.maxQueued = len(p.waiters)
+	}
+	p.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+		err = errAdmissionTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	wait := time.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 超时的同时可能已被放行，此时按放行处理
+	if err != nil && !waiter.admitted {
+		p.removeLocked(waiter)
+		if err == errAdmissionTimeout {
+			p.timedOut++
+		}
+		return wait, err
+	}
+	p.waited++
+	p.totalWait += wait
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+	return wait, nil
+}
+
+// release 归还并发名额，并放行队列中的下一个请求
+func (p *admissionPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active--
+	p.dispatchLocked()
+}
+
+// dispatchLocked 在并发数未满时按优先级和客户端轮次放行排队的请求（已加锁）
+func (p *admissionPool) dispatchLocked() {
+	for p.active < p.capacity && len(p.waiters) > 0 {
+		index := p.nextLocked()
+		waiter := p.waiters[index]
+		p.waiters = append(p.waiters[:index], p.waiters[index+1:]...)
+
+		p.turn++
+		p.served[waiter.client] = p.turn
+		waiter.admitted = true
+		p.active++
+		p.admitted++
+		close(waiter.ready)
+	}
+	if len(p.waiters) == 0 && len(p.served) > 0 {
+		p.served = make(map[string]uint64)
+	}
+}
+
+// nextLocked 返回下一个放行的请求在队列中的位置：优先级最高，其次是最久未被放行的客户端，最后按入队顺序（已加锁）
+func (p *admissionPool) nextLocked() int {
+	best := 0
+	for i := 1; i < len(p.waiters); i++ {
+		candidate, current := p.waiters[i], p.waiters[best]
+		if candidate.priority != current.priority {
+			if candidate.priority > current.priority {
+				best = i
+			}
+			continue
+		}
+		candidateTurn, currentTurn := p.served[candidate.client], p.served[current.client]
+		if candidateTurn != currentTurn {
+			if candidateTurn < currentTurn {
+				best = i
+			}
+			continue
+		}
+		if candidate.seq < current.seq {
+			best = i
+		}
+	}
+	return best
+}
+
+// removeLocked 从队列中移除放弃排队的请求（已加锁）
+func (p *admissionPool) removeLocked(waiter *admissionWaiter) {
+	for i, w := range p.waiters {
+		if w == waiter {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(p.waiters) == 0 && len(p.served) > 0 {
+		p.served = make(map[string]uint64)
+	}
+}
+
+// AdmissionPoolStats 一个并发池的排队统计
+type AdmissionPoolStats struct {
+	Capacity  int     `json:"capacity"`    // 并发池大小
+	Active    int     `json:"active"`      // 正在处理的请求数
+	Queued    int     `json:"queued"`      // 正在排队的请求数
+	MaxQueued int     `json:"max_queued"`  // 启动以来的最大排队数
+	Admitted  int64   `json:"admitted"`    // 启动以来放行的请求数
+	Waited    int64   `json:"waited"`      // 经过排队后放行的请求数
+	TimedOut  int64   `json:"timed_out"`   // 排队超时的请求数
+	Rejected  int64   `json:"rejected"`    // 队列已满被拒绝的请求数
+	AvgWaitMs float64 `json:"avg_wait_ms"` // 排队请求的平均等待时间（毫秒）
+	MaxWaitMs int64   `json:"max_wait_ms"` // 最长等待时间（毫秒）
+}
+
+// AdmissionStats 请求准入控制统计
+type AdmissionStats struct {
+	Enabled  bool               `json:"enabled"`  // 是否启用
+	Heavy    AdmissionPoolStats `json:"heavy"`    // 推理模型并发池
+	Standard AdmissionPoolStats `json:"standard"` // 普通模型并发池
+}
+
+// stats 获取并发池的统计，并发池大小按当前配置计算
+func (p *admissionPool) stats(capacity int) AdmissionPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := AdmissionPoolStats{
+		Capacity:  capacity,
+		Active:    p.active,
+		Queued:    len(p.waiters),
+		MaxQueued: p.maxQueued,
+		Admitted:  p.admitted,
+		Waited:    p.waited,
+		TimedOut:  p.timedOut,
+		Rejected:  p.rejected,
+		MaxWaitMs: p.maxWait.Milliseconds(),
+	}
+	if p.waited > 0 {
+		stats.AvgWaitMs = float64(p.totalWait.Milliseconds()) / float64(p.waited)
+	}
+	return stats
+}
+
+// GetAdmissionStats 获取请求准入控制统计
+func GetAdmissionStats() AdmissionStats {
+	cfg := config.GetConfig()
+	heavySize, standardSize := cfg.ApiProxy.Admission.GetPoolSizes(cfg.RequestSettings.ProxyHandler.MaxConcurrency)
+	return AdmissionStats{
+		Enabled:  cfg.ApiProxy.Admission.Enabled && cfg.RequestSettings.ProxyHandler.MaxConcurrency > 0,
+		Heavy:    heavyAdmissionPool.stats(heavySize),
+		Standard: standardAdmissionPool.stats(standardSize),
+	}
+}
+
+// admissionPriority 获取请求的排队优先级，使用客户端密钥的优先级，请求头只能降低优先级
+func admissionPriority(c *gin.Context) int {
+	priority := 0
+	if clientKey, ok := middleware.GetClientKey(middleware.GetClientID(c)); ok {
+		priority = clientKey.Priority
+	}
+	if value := c.GetHeader(AdmissionPriorityHeader); value != "" {
+		if headerPriority, err := strconv.Atoi(value); err == nil && headerPriority < priority {
+			priority = headerPriority
+		}
+	}
+	return priority
+}
+
+// AdmissionMiddleware 请求准入控制，并发请求达到最大并发数时按优先级排队，排队超时或队列已满时返回503
+// 需要放在API密钥验证之后，以便按客户端区分优先级和轮流放行
+func AdmissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.GetConfig()
+		if cfg == nil || !cfg.ApiProxy.Admission.Enabled || cfg.RequestSettings.ProxyHandler.MaxConcurrency <= 0 {
+			c.Next()
+			return
+		}
+
+		// 模型列表、任务查询等不调用模型的请求不排队
+		modelName := middleware.RequestModel(c)
+		if modelName == "" {
+			c.Next()
+			return
+		}
+
+		admission := cfg.ApiProxy.Admission
+		heavySize, standardSize := admission.GetPoolSizes(cfg.RequestSettings.ProxyHandler.MaxConcurrency)
+		pool, capacity := standardAdmissionPool, standardSize
+		if resolved, _ := model.ResolveModelAlias(modelName, middleware.GetClientName(c)); isReasonModel(resolved) {
+			pool, capacity = heavyAdmissionPool, heavySize
+		}
+
+		client := middleware.GetClientID(c)
+		if client == "" {
+			client = c.ClientIP()
+		}
+		priority := admissionPriority(c)
+
+		rl := GetRequestLogger(c)
+		wait, err := pool.acquire(c.Request.Context(), client, priority, capacity, admission.GetMaxQueueSize(), admission.GetMaxWait())
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				rl.Info("客户端在%s并发池排队 %v 后断开连接", pool.name, wait.Round(time.Millisecond))
+				c.Abort()
+				return
+			}
+
+			var message, code string
+			if err == errAdmissionQueueFull {
+				code = "queue_full"
+				message = fmt.Sprintf("服务器繁忙，%s并发池的排队请求数已达到上限 %d，请稍后重试", pool.name, admission.GetMaxQueueSize())
+			} else {
+				code = "queue_timeout"
+				message = fmt.Sprintf("服务器繁忙，请求在%s并发池中排队超过 %d 秒，请稍后重试", pool.name, int(admission.GetMaxWait().Seconds()))
+			}
+			rl.Warn("请求未能进入%s并发池: %s", pool.name, message)
+
+			retryAfter := int(math.Ceil(admission.GetMaxWait().Seconds() / 2))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": message,
+					"type":    "server_busy",
+					"param":   nil,
+					"code":    code,
+				},
+			})
+			c.Abort()
+			return
+		}
+		defer pool.release()
+
+		if wait > 0 {
+			rl.Info("请求在%s并发池排队 %v 后开始处理，优先级 %d", pool.name, wait.Round(time.Millisecond), priority)
+		}
+		c.Next()
+	}
+}
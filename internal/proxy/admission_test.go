@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"flowsilicon/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitQueued 等待并发池中排队的请求数达到n
+func waitQueued(t *testing.T, p *admissionPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for p.stats(0).Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued = %d, want %d", p.stats(0).Queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdmissionPoolOrdering(t *testing.T) {
+	type request struct {
+		client   string
+		priority int
+	}
+	tests := []struct {
+		name     string
+		requests []request // 按顺序排队
+		want     []int     // 放行顺序，对应requests的下标
+	}{
+		{
+			name:     "same client in arrival order",
+			requests: []request{{"a", 0}, {"a", 0}, {"a", 0}},
+			want:     []int{0, 1, 2},
+		},
+		{
+			name:     "higher priority first",
+			requests: []request{{"a", 0}, {"b", 10}, {"c", -1}, {"d", 10}},
+			want:     []int{1, 3, 0, 2},
+		},
+		{
+			name:     "clients take turns within a priority",
+			requests: []request{{"a", 0}, {"a", 0}, {"a", 0}, {"b", 0}, {"c", 0}},
+			want:     []int{0, 3, 4, 1, 2},
+		},
+		{
+			name:     "priority beats client turns",
+			requests: []request{{"a", 5}, {"a", 5}, {"b", 0}},
+			want:     []int{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newAdmissionPool("test")
+			// 占满并发数，使后续请求排队
+			if _, err := p.acquire(context.Background(), "holder", 0, 1, 10, time.Second); err != nil {
+				t.Fatalf("acquire() error = %v", err)
+			}
+
+			admitted := make(chan int)
+			for i, r := range tt.requests {
+				go func(i int, r request) {
+					if _, err := p.acquire(context.Background(), r.client, r.priority, 1, 10, 5*time.Second); err != nil {
+						t.Errorf("request %d: acquire() error = %v", i, err)
+					}
+					admitted <- i
+				}(i, r)
+				waitQueued(t, p, i+1)
+			}
+
+			var order []int
+			for range tt.requests {
+				p.release()
+				order = append(order, <-admitted)
+			}
+			p.release()
+
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("admission order = %v, want %v", order, tt.want)
+			}
+			if stats := p.stats(1); stats.Active != 0 || stats.Queued != 0 || stats.Waited != int64(len(tt.requests)) {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestAdmissionPoolRejects(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		maxQueue int
+		maxWait  time.Duration
+		wantErr  error
+		check    func(AdmissionPoolStats) bool
+	}{
+		{"queue full", context.Background(), 0, time.Second, errAdmissionQueueFull,
+			func(s AdmissionPoolStats) bool { return s.Rejected == 1 }},
+		{"timeout", context.Background(), 10, 20 * time.Millisecond, errAdmissionTimeout,
+			func(s AdmissionPoolStats) bool { return s.TimedOut == 1 }},
+		{"client gone", canceled, 10, time.Second, context.Canceled,
+			func(s AdmissionPoolStats) bool { return s.TimedOut == 0 && s.Rejected == 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newAdmissionPool("test")
+			if _, err := p.acquire(context.Background(), "holder", 0, 1, 10, time.Second); err != nil {
+				t.Fatalf("acquire() error = %v", err)
+			}
+
+			_, err := p.acquire(tt.ctx, "a", 0, 1, tt.maxQueue, tt.maxWait)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("acquire() error = %v, want %v", err, tt.wantErr)
+			}
+			stats := p.stats(1)
+			if stats.Active != 1 || stats.Queued != 0 || !tt.check(stats) {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			// 放弃排队的请求不占用名额
+			p.release()
+			if _, err := p.acquire(context.Background(), "b", 0, 1, 0, time.Second); err != nil {
+				t.Errorf("acquire() after release error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAdmissionPoolCapacityRaised(t *testing.T) {
+	p := newAdmissionPool("test")
+	if _, err := p.acquire(context.Background(), "holder", 0, 1, 10, time.Second); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := p.acquire(context.Background(), "a", 0, 1, 10, 5*time.Second)
+		done <- err
+	}()
+	waitQueued(t, p, 1)
+
+	// 调大并发数后新请求先放行已在排队的请求
+	if _, err := p.acquire(context.Background(), "b", 0, 3, 10, time.Second); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("queued acquire() error = %v", err)
+	}
+	if stats := p.stats(3); stats.Active != 3 || stats.Queued != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestAdmissionPriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no header", "", 0},
+		{"header lowers priority", "-5", -5},
+		{"header cannot raise priority", "5", 0},
+		{"invalid header", "high", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			c.Set(middleware.ClientIDKey, "default")
+			if tt.header != "" {
+				c.Request.Header.Set(AdmissionPriorityHeader, tt.header)
+			}
+			if got := admissionPriority(c); got != tt.want {
+				t.Errorf("admissionPriority() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/**
+  @author: Hanhai
+  @desc: 模型别名响应处理，将响应中的实际模型名改写回客户端请求的别名
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelAliasWriter 将响应中的实际模型名替换为别名
+// 流式响应按SSE行写入，非流式响应一次写入，因此可以直接替换每次写入的数据
+type modelAliasWriter struct {
+	gin.ResponseWriter
+	replacements [][2][]byte
+}
+
+// Write 替换响应中的模型名后写入
+func (w *modelAliasWriter) Write(data []byte) (int, error) {
+	replaced := data
+	for _, r := range w.replacements {
+		replaced = bytes.ReplaceAll(replaced, r[0], r[1])
+	}
+	if _, err := w.ResponseWriter.Write(replaced); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteString 实现gin.ResponseWriter接口
+func (w *modelAliasWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// useModelAlias 替换响应写入器，使响应中的模型名显示为客户端请求的别名，返回恢复函数
+func useModelAlias(c *gin.Context, target string, alias string) func() {
+	targetJSON, _ := json.Marshal(target)
+	aliasJSON, _ := json.Marshal(alias)
+
+	writer := &modelAliasWriter{ResponseWriter: c.Writer}
+	for _, sep := range []string{`"model":`, `"model": `} {
+		writer.replacements = append(writer.replacements, [2][]byte{
+			append([]byte(sep), targetJSON...),
+			append([]byte(sep), aliasJSON...),
+		})
+	}
+
+	originalWriter := c.Writer
+	c.Writer = writer
+	return func() {
+		c.Writer = originalWriter
+	}
+}
+
+// requestModelName 获取请求体中的模型名
+func requestModelName(body []byte) string {
+	var requestData struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return ""
+	}
+	return requestData.Model
+}
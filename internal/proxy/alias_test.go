@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUseModelAlias(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "compact JSON",
+			writes: []string{`{"id":"1","model":"Qwen/Qwen2.5-72B-Instruct","choices":[]}`},
+			want:   `{"id":"1","model":"gpt-4o","choices":[]}`,
+		},
+		{
+			name:   "indented JSON",
+			writes: []string{`{"model": "Qwen/Qwen2.5-72B-Instruct"}`},
+			want:   `{"model": "gpt-4o"}`,
+		},
+		{
+			name: "stream lines",
+			writes: []string{
+				"data: {\"model\":\"Qwen/Qwen2.5-72B-Instruct\",\"choices\":[{\"delta\":{\"content\":\"model\"}}]}\n\n",
+				"data: [DONE]\n\n",
+			},
+			want: "data: {\"model\":\"gpt-4o\",\"choices\":[{\"delta\":{\"content\":\"model\"}}]}\n\ndata: [DONE]\n\n",
+		},
+		{
+			name:   "other models are kept",
+			writes: []string{`{"model":"Qwen/Qwen2.5-7B-Instruct"}`},
+			want:   `{"model":"Qwen/Qwen2.5-7B-Instruct"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			original := c.Writer
+
+			restore := useModelAlias(c, "Qwen/Qwen2.5-72B-Instruct", "gpt-4o")
+			for _, w := range tt.writes {
+				if n, err := c.Writer.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("Write() = %d, %v, want %d", n, err, len(w))
+				}
+			}
+			restore()
+
+			if c.Writer != original {
+				t.Error("restore did not reset the writer")
+			}
+			if got := recorder.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
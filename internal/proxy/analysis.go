@@ -8,10 +8,142 @@ package proxy
 import (
 	"encoding/json"
 	"flowsilicon/internal/logger"
-	"flowsilicon/pkg/utils"
+	"flowsilicon/pkg/tokenizer"
 	"strings"
 )
 
+// 聊天格式中每条消息的角色标记和分隔符，以及回复开头占用的令牌数
+const (
+	tokensPerMessage = 4
+	tokensPerReply   = 3
+)
+
+// LoadTokenizerVocabs 在后台加载所有分词词表并在日志中提示加载结果，词表缺失的模型族使用字符估算令牌数
+func LoadTokenizerVocabs() {
+	go func() {
+		for _, name := range tokenizer.EncodingNames() {
+			enc := tokenizer.Get(name)
+			if err := enc.Err(); err != nil {
+				logger.Warn("加载分词词表%s失败，使用字符估算令牌数: %v", name, err)
+				continue
+			}
+			logger.Info("已加载分词词表%s，共%d个令牌", name, enc.VocabSize())
+		}
+	}()
+}
+
+// countMessageTokens 计算一条聊天消息的令牌数
+func countMessageTokens(model string, message map[string]interface{}) int {
+	tokens := tokensPerMessage
+	if role, ok := message["role"].(string); ok {
+		tokens += tokenizer.CountTokens(model, role)
+	}
+	if name, ok := message["name"].(string); ok {
+		tokens += tokenizer.CountTokens(model, name)
+	}
+	tokens += tokenizer.CountTokens(model, messageText(message["content"]))
+	if toolCalls, ok := message["tool_calls"]; ok && toolCalls != nil {
+		toolCallsJSON, _ := json.Marshal(toolCalls)
+		tokens += tokenizer.CountTokens(model, string(toolCallsJSON))
+	}
+	return tokens
+}
+
+// deltaText 获取流式数据块delta或非流式响应message中的输出内容、推理内容和工具调用参数
+func deltaText(delta map[string]interface{}) string {
+	var text strings.Builder
+	if content, ok := delta["content"].(string); ok {
+		text.WriteString(content)
+	}
+	if reasoning, ok := delta["reasoning_content"].(string); ok {
+		text.WriteString(reasoning)
+	}
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, tc := range toolCalls {
+			toolCall, _ := tc.(map[string]interface{})
+			function, _ := toolCall["function"].(map[string]interface{})
+			name, _ := function["name"].(string)
+			arguments, _ := function["arguments"].(string)
+			text.WriteString(name)
+			text.WriteString(arguments)
+		}
+	}
+	return text.String()
+}
+
+// countChatTokens 计算聊天请求中所有消息和工具定义的令牌数
+func countChatTokens(model string, requestData map[string]interface{}) int {
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok {
+		return 0
+	}
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		if message, ok := msg.(map[string]interface{}); ok {
+			tokens += countMessageTokens(model, message)
+		}
+	}
+	if tools, ok := requestData["tools"].([]interface{}); ok && len(tools) > 0 {
+		toolsJSON, _ := json.Marshal(tools)
+		tokens += tokenizer.CountTokens(model, string(toolsJSON))
+	}
+	return tokens
+}
+
+// countPromptTokens 计算聊天、文本补全或嵌入请求的输入令牌数
+func countPromptTokens(model string, requestData map[string]interface{}) int {
+	promptTokens := 0
+	switch {
+	case requestData["messages"] != nil:
+		promptTokens = countChatTokens(model, requestData)
+	case requestData["prompt"] != nil:
+		prompt, _ := requestData["prompt"].(string)
+		promptTokens = tokenizer.CountTokens(model, prompt)
+	case requestData["input"] != nil:
+		if input, ok := requestData["input"].(string); ok {
+			promptTokens = tokenizer.CountTokens(model, input)
+		} else if inputs, ok := requestData["input"].([]interface{}); ok {
+			for _, item := range inputs {
+				if str, ok := item.(string); ok {
+					promptTokens += tokenizer.CountTokens(model, str)
+				}
+			}
+		}
+	}
+	return promptTokens
+}
+
+// countUsage 获取请求的输入和输出token数，优先使用上游返回的usage，没有时使用分词器计算
+func countUsage(model string, requestBody []byte, respBody []byte) (int, int) {
+	if promptTokens, completionTokens := extractTokenCounts(respBody); promptTokens > 0 || completionTokens > 0 {
+		return promptTokens, completionTokens
+	}
+
+	promptTokens := 0
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(requestBody, &requestData); err == nil {
+		if requestModel, ok := requestData["model"].(string); ok && model == "" {
+			model = requestModel
+		}
+		promptTokens = countPromptTokens(model, requestData)
+	}
+
+	completionTokens := 0
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(respBody, &responseData); err == nil {
+		choices, _ := responseData["choices"].([]interface{})
+		for _, c := range choices {
+			choice, _ := c.(map[string]interface{})
+			if message, ok := choice["message"].(map[string]interface{}); ok {
+				completionTokens += tokenizer.CountTokens(model, deltaText(message))
+			} else if text, ok := choice["text"].(string); ok {
+				completionTokens += tokenizer.CountTokens(model, text)
+			}
+		}
+	}
+	return promptTokens, completionTokens
+}
+
 // 分析请求类型和估计token数量
 func AnalyzeRequest(path string, bodyBytes []byte) (string, string, int) {
 	// 默认值
@@ -38,21 +170,8 @@ func AnalyzeRequest(path string, bodyBytes []byte) (string, string, int) {
 				logger.Info("提取到聊天模型名称: %s", modelName)
 			}
 
-			// 估计token数量
-			if messages, ok := requestData["messages"].([]interface{}); ok {
-				// 基础token：每个消息对象约100个token
-				tokenEstimate = len(messages) * 100
-
-				// 更精确估计：计算消息内容的长度
-				for _, msg := range messages {
-					if msgObj, ok := msg.(map[string]interface{}); ok {
-						if content, ok := msgObj["content"].(string); ok {
-							// 使用更精确的token估算
-							tokenEstimate += utils.EstimateStringTokens(content)
-						}
-					}
-				}
-			}
+			// 使用模型对应的分词器计算token数量
+			tokenEstimate = countChatTokens(modelName, requestData)
 		}
 	} else if strings.Contains(path, "/completions") {
 		requestType = "completion"
@@ -72,8 +191,7 @@ func AnalyzeRequest(path string, bodyBytes []byte) (string, string, int) {
 
 			// 估计token数量
 			if prompt, ok := requestData["prompt"].(string); ok {
-				// 使用更精确的token估算
-				tokenEstimate = utils.EstimateStringTokens(prompt)
+				tokenEstimate = tokenizer.CountTokens(modelName, prompt)
 			}
 		}
 	}
@@ -118,20 +236,11 @@ func AnalyzeOpenAIRequest(path string, bodyBytes []byte) (string, string, int) {
 				logger.Info("提取到聊天模型名称: %s", modelName)
 			}
 
-			// 估计token数量
+			// 使用模型对应的分词器计算token数量
 			if messages, ok := requestData["messages"].([]interface{}); ok {
 				// 便于调试，记录消息数量
 				logger.Info("消息数组长度: %d", len(messages))
-
-				// 估计所有消息的token数量
-				for _, msg := range messages {
-					if msgMap, ok := msg.(map[string]interface{}); ok {
-						if content, ok := msgMap["content"].(string); ok {
-							// 使用更精确的token估算
-							tokenEstimate += utils.EstimateStringTokens(content)
-						}
-					}
-				}
+				tokenEstimate = countChatTokens(modelName, requestData)
 			}
 		}
 	} else if strings.Contains(path, "/completions") || path == "/completions" {
@@ -152,8 +261,7 @@ func AnalyzeOpenAIRequest(path string, bodyBytes []byte) (string, string, int) {
 
 			// 估计token数量
 			if prompt, ok := requestData["prompt"].(string); ok {
-				// 使用更精确的token估算
-				tokenEstimate = utils.EstimateStringTokens(prompt)
+				tokenEstimate = tokenizer.CountTokens(modelName, prompt)
 			}
 		}
 	} else if strings.Contains(path, "/embeddings") || path == "/embeddings" {
@@ -168,12 +276,12 @@ func AnalyzeOpenAIRequest(path string, bodyBytes []byte) (string, string, int) {
 
 			// 估计embedding请求的token数量
 			if input, ok := requestData["input"].(string); ok {
-				tokenEstimate = utils.EstimateStringTokens(input)
+				tokenEstimate = tokenizer.CountTokens(modelName, input)
 			} else if inputArray, ok := requestData["input"].([]interface{}); ok {
 				// 如果input是数组，估计所有元素的总token数
 				for _, item := range inputArray {
 					if str, ok := item.(string); ok {
-						tokenEstimate += utils.EstimateStringTokens(str)
+						tokenEstimate += tokenizer.CountTokens(modelName, str)
 					}
 				}
 			}
@@ -190,13 +298,13 @@ func AnalyzeOpenAIRequest(path string, bodyBytes []byte) (string, string, int) {
 
 			// 估计重排序请求的token数量
 			if query, ok := requestData["query"].(string); ok {
-				tokenEstimate += utils.EstimateStringTokens(query)
+				tokenEstimate += tokenizer.CountTokens(modelName, query)
 			}
 
 			if documents, ok := requestData["documents"].([]interface{}); ok {
 				for _, doc := range documents {
 					if str, ok := doc.(string); ok {
-						tokenEstimate += utils.EstimateStringTokens(str)
+						tokenEstimate += tokenizer.CountTokens(modelName, str)
 					}
 				}
 			}
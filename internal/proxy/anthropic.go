@@ -0,0 +1,740 @@
+/**
+  @author: Hanhai
+  @desc: Anthropic Messages API兼容模块，将/v1/messages请求转换为OpenAI格式处理，并将响应转换回Anthropic格式
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HandleAnthropicMessages 处理Anthropic Messages API请求
+func HandleAnthropicMessages(c *gin.Context) {
+	rl := GetRequestLogger(c)
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeAnthropicError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+
+	chatRequest, err := convertAnthropicRequest(bodyBytes)
+	if err != nil {
+		writeAnthropicError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chatBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		writeAnthropicError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to build request body: %v", err))
+		return
+	}
+
+	modelName, _ := chatRequest["model"].(string)
+	rl.SetModel(modelName)
+	rl.Info("检测到Anthropic Messages请求，转换为OpenAI格式处理，模型: %s", modelName)
+
+	serveWithAdapter(c, newAnthropicAdapter(modelName, stopSequences(chatRequest)), "/chat/completions", chatBody)
+}
+
+// HandleAnthropicCountTokens 处理Anthropic的token计数请求，使用本地估算
+func HandleAnthropicCountTokens(c *gin.Context) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeAnthropicError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+
+	chatRequest, err := convertAnthropicRequest(bodyBytes)
+	if err != nil {
+		writeAnthropicError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chatBody, _ := json.Marshal(chatRequest)
+	_, _, tokenEstimate := AnalyzeOpenAIRequest("/chat/completions", chatBody)
+
+	c.JSON(http.StatusOK, gin.H{
+		"input_tokens": tokenEstimate,
+	})
+}
+
+// writeAnthropicError 以Anthropic格式返回错误
+func writeAnthropicError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    anthropicErrorType(status),
+			"message": message,
+		},
+	})
+}
+
+// anthropicErrorType 根据HTTP状态码返回Anthropic错误类型
+func anthropicErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+// convertAnthropicRequest 将Anthropic Messages请求转换为OpenAI chat/completions请求
+func convertAnthropicRequest(body []byte) (map[string]interface{}, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("Request body is invalid JSON")
+	}
+
+	rawMessages, ok := request["messages"].([]interface{})
+	if !ok || len(rawMessages) == 0 {
+		return nil, fmt.Errorf("messages: field required and must be a non-empty array")
+	}
+
+	messages := make([]interface{}, 0, len(rawMessages)+1)
+
+	// system可以是字符串或文本块数组
+	if system := anthropicText(request["system"]); system != "" {
+		messages = append(messages, map[string]interface{}{
+			"role":    "system",
+			"content": system,
+		})
+	}
+
+	for _, raw := range rawMessages {
+		msg, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := msg["role"].(string)
+
+		// 字符串内容直接使用
+		if text, ok := msg["content"].(string); ok {
+			messages = append(messages, map[string]interface{}{
+				"role":    role,
+				"content": text,
+			})
+			continue
+		}
+
+		blocks, _ := msg["content"].([]interface{})
+		if role == "assistant" {
+			messages = append(messages, convertAnthropicAssistantBlocks(blocks))
+		} else {
+			messages = append(messages, convertAnthropicUserBlocks(blocks)...)
+		}
+	}
+
+	chatRequest := map[string]interface{}{
+		"model":    request["model"],
+		"messages": messages,
+	}
+
+	for _, field := range []string{"max_tokens", "temperature", "top_p", "top_k", "stream"} {
+		if value, ok := request[field]; ok {
+			chatRequest[field] = value
+		}
+	}
+
+	if stops, ok := request["stop_sequences"].([]interface{}); ok && len(stops) > 0 {
+		chatRequest["stop"] = stops
+	}
+
+	if metadata, ok := request["metadata"].(map[string]interface{}); ok {
+		if userID, ok := metadata["user_id"].(string); ok && userID != "" {
+			chatRequest["user"] = userID
+		}
+	}
+
+	if stream, ok := request["stream"].(bool); ok && stream {
+		// 需要在message_delta中返回用量
+		chatRequest["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	// 工具定义
+	if tools, ok := request["tools"].([]interface{}); ok && len(tools) > 0 {
+		chatTools := make([]interface{}, 0, len(tools))
+		for _, t := range tools {
+			tool, ok := t.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			function := map[string]interface{}{
+				"name": tool["name"],
+			}
+			if desc, ok := tool["description"]; ok {
+				function["description"] = desc
+			}
+			if schema, ok := tool["input_schema"]; ok {
+				function["parameters"] = schema
+			}
+			chatTools = append(chatTools, map[string]interface{}{
+				"type":     "function",
+				"function": function,
+			})
+		}
+		chatRequest["tools"] = chatTools
+	}
+
+	if toolChoice, ok := request["tool_choice"].(map[string]interface{}); ok {
+		switch toolChoice["type"] {
+		case "auto":
+			chatRequest["tool_choice"] = "auto"
+		case "any":
+			chatRequest["tool_choice"] = "required"
+		case "none":
+			chatRequest["tool_choice"] = "none"
+		case "tool":
+			chatRequest["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": toolChoice["name"]},
+			}
+		}
+		if disable, ok := toolChoice["disable_parallel_tool_use"].(bool); ok && disable {
+			chatRequest["parallel_tool_calls"] = false
+		}
+	}
+
+	return chatRequest, nil
+}
+
+// anthropicText 提取字符串或文本块数组中的文本
+func anthropicText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if block, ok := item.(map[string]interface{}); ok {
+				if text, ok := block["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// convertAnthropicUserBlocks 转换用户消息的内容块，tool_result转换为独立的tool消息
+func convertAnthropicUserBlocks(blocks []interface{}) []interface{} {
+	messages := make([]interface{}, 0, 1)
+	parts := make([]interface{}, 0, len(blocks))
+	hasImage := false
+
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			parts = append(parts, map[string]interface{}{
+				"type": "text",
+				"text": block["text"],
+			})
+		case "image":
+			source, _ := block["source"].(map[string]interface{})
+			if source == nil {
+				continue
+			}
+			var url string
+			if source["type"] == "url" {
+				url, _ = source["url"].(string)
+			} else {
+				url = fmt.Sprintf("data:%v;base64,%v", source["media_type"], source["data"])
+			}
+			parts = append(parts, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": url},
+			})
+			hasImage = true
+		case "tool_result":
+			content := anthropicText(block["content"])
+			if isError, ok := block["is_error"].(bool); ok && isError && content == "" {
+				content = "error"
+			}
+			messages = append(messages, map[string]interface{}{
+				"role":         "tool",
+				"tool_call_id": block["tool_use_id"],
+				"content":      content,
+			})
+		}
+	}
+
+	if len(parts) == 0 {
+		return messages
+	}
+
+	// 纯文本内容合并为字符串，兼容不支持多模态数组的模型
+	if !hasImage {
+		texts := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if text, ok := p.(map[string]interface{})["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		return append(messages, map[string]interface{}{
+			"role":    "user",
+			"content": strings.Join(texts, "\n"),
+		})
+	}
+
+	return append(messages, map[string]interface{}{
+		"role":    "user",
+		"content": parts,
+	})
+}
+
+// convertAnthropicAssistantBlocks 转换助手消息的内容块，tool_use转换为tool_calls
+func convertAnthropicAssistantBlocks(blocks []interface{}) map[string]interface{} {
+	texts := make([]string, 0, len(blocks))
+	toolCalls := make([]interface{}, 0)
+
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			if text, ok := block["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		case "tool_use":
+			arguments, _ := json.Marshal(block["input"])
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   block["id"],
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      block["name"],
+					"arguments": string(arguments),
+				},
+			})
+		}
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": strings.Join(texts, "\n"),
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	return message
+}
+
+// stopSequences 返回转换后请求中的停止序列
+func stopSequences(chatRequest map[string]interface{}) []string {
+	stops, _ := chatRequest["stop"].([]interface{})
+	sequences := make([]string, 0, len(stops))
+	for _, item := range stops {
+		if s, ok := item.(string); ok && s != "" {
+			sequences = append(sequences, s)
+		}
+	}
+	return sequences
+}
+
+// matchStopSequence 返回上游停止时匹配的客户端停止序列，未匹配时返回空字符串
+// 上游在choice的stop_reason中返回匹配的停止序列（vLLM等），或者输出保留了停止序列时按输出末尾判断
+func matchStopSequence(sequences []string, upstreamStop string, text string) string {
+	for _, s := range sequences {
+		if s == upstreamStop {
+			return s
+		}
+	}
+	for _, s := range sequences {
+		if strings.HasSuffix(text, s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// nullableString 空字符串返回nil，用于输出JSON中的null
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// anthropicStopReason 将OpenAI的finish_reason映射为Anthropic的stop_reason，stopSequence为匹配的客户端停止序列
+func anthropicStopReason(finishReason string, stopSequence string) string {
+	switch finishReason {
+	case "stop":
+		if stopSequence != "" {
+			return "stop_sequence"
+		}
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// anthropicAdapter 将OpenAI格式的响应转换为Anthropic Messages格式
+type anthropicAdapter struct {
+	model         string
+	messageID     string
+	stopSequences []string
+
+	started      bool
+	blockIndex   int
+	blockOpen    bool
+	blockType    string
+	toolIndex    int
+	finishReason string
+	upstreamStop string // 上游返回的匹配的停止序列
+	textTail     string // 输出文本的末尾，用于判断是否以停止序列结尾
+	inputTokens  int
+	outputTokens int
+}
+
+// newAnthropicAdapter 创建Anthropic响应适配器
+func newAnthropicAdapter(model string, stopSequences []string) *anthropicAdapter {
+	return &anthropicAdapter{
+		model:         model,
+		messageID:     "msg_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		stopSequences: stopSequences,
+		toolIndex:     -1,
+	}
+}
+
+// appendText 记录输出文本的末尾，只保留最长停止序列的长度
+func (a *anthropicAdapter) appendText(text string) {
+	maxLen := 0
+	for _, s := range a.stopSequences {
+		maxLen = max(maxLen, len(s))
+	}
+	if maxLen == 0 {
+		return
+	}
+	a.textTail += text
+	if len(a.textTail) > maxLen {
+		a.textTail = a.textTail[len(a.textTail)-maxLen:]
+	}
+}
+
+func (a *anthropicAdapter) contentType(stream bool) string {
+	if stream {
+		return "text/event-stream; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (a *anthropicAdapter) keepComments() bool {
+	return true
+}
+
+// convertResponse 转换非流式响应
+func (a *anthropicAdapter) convertResponse(status int, body []byte) []byte {
+	data := firstJSONObject(body)
+
+	if status >= 400 || data == nil || data["error"] != nil {
+		if status < 400 {
+			status = http.StatusBadGateway
+		}
+		result, _ := json.Marshal(map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    anthropicErrorType(status),
+				"message": extractErrorMessage(data, body),
+			},
+		})
+		return result
+	}
+
+	content := make([]interface{}, 0, 2)
+	finishReason := ""
+	stopSequence := ""
+	if choices, ok := data["choices"].([]interface{}); ok && len(choices) > 0 {
+		choice, _ := choices[0].(map[string]interface{})
+		finishReason, _ = choice["finish_reason"].(string)
+		message, _ := choice["message"].(map[string]interface{})
+		if finishReason == "stop" {
+			upstreamStop, _ := choice["stop_reason"].(string)
+			text, _ := message["content"].(string)
+			stopSequence = matchStopSequence(a.stopSequences, upstreamStop, text)
+		}
+		if message != nil {
+			if reasoning, ok := message["reasoning_content"].(string); ok && reasoning != "" {
+				content = append(content, map[string]interface{}{
+					"type":      "thinking",
+					"thinking":  reasoning,
+					"signature": "",
+				})
+			}
+			if text, ok := message["content"].(string); ok && text != "" {
+				content = append(content, map[string]interface{}{
+					"type": "text",
+					"text": text,
+				})
+			}
+			if toolCalls, ok := message["tool_calls"].([]interface{}); ok {
+				for _, item := range toolCalls {
+					tc, _ := item.(map[string]interface{})
+					if tc == nil {
+						continue
+					}
+					fn, _ := tc["function"].(map[string]interface{})
+					input := map[string]interface{}{}
+					if args, ok := fn["arguments"].(string); ok && args != "" {
+						json.Unmarshal([]byte(args), &input)
+					}
+					content = append(content, map[string]interface{}{
+						"type":  "tool_use",
+						"id":    tc["id"],
+						"name":  fn["name"],
+						"input": input,
+					})
+				}
+			}
+		}
+	}
+
+	promptTokens, completionTokens := extractTokenCounts(body)
+	model := a.model
+	if m, ok := data["model"].(string); ok && m != "" {
+		model = m
+	}
+
+	result, _ := json.Marshal(map[string]interface{}{
+		"id":            a.messageID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         model,
+		"content":       content,
+		"stop_reason":   anthropicStopReason(finishReason, stopSequence),
+		"stop_sequence": nullableString(stopSequence),
+		"usage": map[string]interface{}{
+			"input_tokens":  promptTokens,
+			"output_tokens": completionTokens,
+		},
+	})
+	return result
+}
+
+// start 输出message_start事件
+func (a *anthropicAdapter) start() []byte {
+	if a.started {
+		return nil
+	}
+	a.started = true
+	return sseEvent("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            a.messageID,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         a.model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]interface{}{
+				"input_tokens":  0,
+				"output_tokens": 0,
+			},
+		},
+	})
+}
+
+// closeBlock 结束当前内容块
+func (a *anthropicAdapter) closeBlock() []byte {
+	if !a.blockOpen {
+		return nil
+	}
+	a.blockOpen = false
+	out := sseEvent("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": a.blockIndex,
+	})
+	a.blockIndex++
+	return out
+}
+
+// openBlock 开始一个新的内容块
+func (a *anthropicAdapter) openBlock(blockType string, block map[string]interface{}) []byte {
+	out := a.closeBlock()
+	a.blockOpen = true
+	a.blockType = blockType
+	return append(out, sseEvent("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         a.blockIndex,
+		"content_block": block,
+	})...)
+}
+
+// delta 输出content_block_delta事件
+func (a *anthropicAdapter) delta(delta map[string]interface{}) []byte {
+	return sseEvent("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": a.blockIndex,
+		"delta": delta,
+	})
+}
+
+// convertChunk 转换OpenAI流式数据块
+func (a *anthropicAdapter) convertChunk(chunk map[string]interface{}) []byte {
+	out := a.start()
+
+	if errData, ok := chunk["error"]; ok {
+		return append(out, sseEvent("error", map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "api_error",
+				"message": extractErrorMessage(map[string]interface{}{"error": errData}, nil),
+			},
+		})...)
+	}
+
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		if pt, ok := usage["prompt_tokens"].(float64); ok {
+			a.inputTokens = int(pt)
+		}
+		if ct, ok := usage["completion_tokens"].(float64); ok {
+			a.outputTokens = int(ct)
+		}
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return out
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if choice == nil {
+		return out
+	}
+	if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
+		a.finishReason = fr
+		a.upstreamStop, _ = choice["stop_reason"].(string)
+	}
+
+	delta, _ := choice["delta"].(map[string]interface{})
+	if delta == nil {
+		return out
+	}
+
+	if reasoning, ok := delta["reasoning_content"].(string); ok && reasoning != "" {
+		if !a.blockOpen || a.blockType != "thinking" {
+			out = append(out, a.openBlock("thinking", map[string]interface{}{
+				"type":     "thinking",
+				"thinking": "",
+			})...)
+		}
+		out = append(out, a.delta(map[string]interface{}{
+			"type":     "thinking_delta",
+			"thinking": reasoning,
+		})...)
+	}
+
+	if text, ok := delta["content"].(string); ok && text != "" {
+		a.appendText(text)
+		if !a.blockOpen || a.blockType != "text" {
+			out = append(out, a.openBlock("text", map[string]interface{}{
+				"type": "text",
+				"text": "",
+			})...)
+		}
+		out = append(out, a.delta(map[string]interface{}{
+			"type": "text_delta",
+			"text": text,
+		})...)
+	}
+
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, item := range toolCalls {
+			tc, _ := item.(map[string]interface{})
+			if tc == nil {
+				continue
+			}
+			index := a.toolIndex
+			if idx, ok := tc["index"].(float64); ok {
+				index = int(idx)
+			}
+			fn, _ := tc["function"].(map[string]interface{})
+			id, _ := tc["id"].(string)
+
+			if id != "" || index != a.toolIndex || !a.blockOpen || a.blockType != "tool_use" {
+				a.toolIndex = index
+				name := ""
+				if fn != nil {
+					name, _ = fn["name"].(string)
+				}
+				if id == "" {
+					id = fmt.Sprintf("toolu_%s_%d", a.messageID, index)
+				}
+				out = append(out, a.openBlock("tool_use", map[string]interface{}{
+					"type":  "tool_use",
+					"id":    id,
+					"name":  name,
+					"input": map[string]interface{}{},
+				})...)
+			}
+
+			if fn != nil {
+				if args, ok := fn["arguments"].(string); ok && args != "" {
+					out = append(out, a.delta(map[string]interface{}{
+						"type":         "input_json_delta",
+						"partial_json": args,
+					})...)
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// finishStream 输出结束事件
+func (a *anthropicAdapter) finishStream() []byte {
+	out := a.start()
+	out = append(out, a.closeBlock()...)
+
+	stopSequence := ""
+	if a.finishReason == "stop" {
+		stopSequence = matchStopSequence(a.stopSequences, a.upstreamStop, a.textTail)
+	}
+
+	out = append(out, sseEvent("message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   anthropicStopReason(a.finishReason, stopSequence),
+			"stop_sequence": nullableString(stopSequence),
+		},
+		"usage": map[string]interface{}{
+			"input_tokens":  a.inputTokens,
+			"output_tokens": a.outputTokens,
+		},
+	})...)
+
+	return append(out, sseEvent("message_stop", map[string]interface{}{
+		"type": "message_stop",
+	})...)
+}
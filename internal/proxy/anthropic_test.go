@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestConvertAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "system and string content",
+			body: `{"model":"m","max_tokens":100,"system":"be brief","messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"m","max_tokens":100,"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "system blocks and text blocks are joined",
+			body: `{"model":"m","system":[{"type":"text","text":"a"},{"type":"text","text":"b"}],"messages":[{"role":"user","content":[{"type":"text","text":"x"},{"type":"text","text":"y"}]}]}`,
+			want: `{"model":"m","messages":[{"role":"system","content":"a\nb"},{"role":"user","content":"x\ny"}]}`,
+		},
+		{
+			name: "image block becomes image_url part",
+			body: `{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"what"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]}]}`,
+			want: `{"model":"m","messages":[{"role":"user","content":[{"type":"text","text":"what"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]}]}`,
+		},
+		{
+			name: "tool use and tool result",
+			body: `{"model":"m","messages":[{"role":"user","content":"weather?"},{"role":"assistant","content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"t1","name":"get_weather","input":{"city":"sh"}}]},{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"sunny"}]}]}`,
+			want: `{"model":"m","messages":[{"role":"user","content":"weather?"},{"role":"assistant","content":"checking","tool_calls":[{"id":"t1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"sh\"}"}}]},{"role":"tool","tool_call_id":"t1","content":"sunny"}]}`,
+		},
+		{
+			name: "tools, tool_choice, stop sequences, metadata and stream",
+			body: `{"model":"m","stream":true,"stop_sequences":["END"],"metadata":{"user_id":"u1"},"tools":[{"name":"f","description":"d","input_schema":{"type":"object"}}],"tool_choice":{"type":"tool","name":"f","disable_parallel_tool_use":true},"messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"m","stream":true,"stop":["END"],"user":"u1","stream_options":{"include_usage":true},"tools":[{"type":"function","function":{"name":"f","description":"d","parameters":{"type":"object"}}}],"tool_choice":{"type":"function","function":{"name":"f"}},"parallel_tool_calls":false,"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "tool_choice any maps to required",
+			body: `{"model":"m","tool_choice":{"type":"any"},"messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"m","tool_choice":"required","messages":[{"role":"user","content":"hi"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertAnthropicRequest([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("convertAnthropicRequest() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestConvertAnthropicRequestErrors(t *testing.T) {
+	for _, body := range []string{`not json`, `{"model":"m"}`, `{"model":"m","messages":[]}`} {
+		if _, err := convertAnthropicRequest([]byte(body)); err == nil {
+			t.Errorf("convertAnthropicRequest(%s) error = nil, want error", body)
+		}
+	}
+}
+
+func TestAnthropicStopReason(t *testing.T) {
+	stops := []string{"END", "###"}
+	tests := []struct {
+		name         string
+		finishReason string
+		upstreamStop string
+		text         string
+		wantReason   string
+		wantSequence string
+	}{
+		{"natural stop", "stop", "", "done", "end_turn", ""},
+		{"stop reported by upstream", "stop", "###", "done", "stop_sequence", "###"},
+		{"upstream stop is not a client sequence", "stop", "<eos>", "done", "end_turn", ""},
+		{"output keeps the stop sequence", "stop", "", "doneEND", "stop_sequence", "END"},
+		{"length", "length", "", "doneEND", "max_tokens", ""},
+		{"tool calls", "tool_calls", "", "", "tool_use", ""},
+		{"missing finish reason", "", "", "", "end_turn", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sequence := ""
+			if tt.finishReason == "stop" {
+				sequence = matchStopSequence(stops, tt.upstreamStop, tt.text)
+			}
+			if sequence != tt.wantSequence {
+				t.Errorf("matchStopSequence() = %q, want %q", sequence, tt.wantSequence)
+			}
+			if got := anthropicStopReason(tt.finishReason, sequence); got != tt.wantReason {
+				t.Errorf("anthropicStopReason(%q, %q) = %q, want %q", tt.finishReason, sequence, got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestAnthropicAdapterConvertResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			name:   "text with reasoning",
+			status: 200,
+			body:   `{"model":"up","choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"hi","reasoning_content":"think"}}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`,
+			want:   `{"id":"msg_test","type":"message","role":"assistant","model":"up","content":[{"type":"thinking","thinking":"think","signature":""},{"type":"text","text":"hi"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":3,"output_tokens":2}}`,
+		},
+		{
+			name:   "stopped on client stop sequence",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"stop","stop_reason":"END","message":{"role":"assistant","content":"hi"}}]}`,
+			want:   `{"id":"msg_test","type":"message","role":"assistant","model":"m","content":[{"type":"text","text":"hi"}],"stop_reason":"stop_sequence","stop_sequence":"END","usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+		{
+			name:   "tool call",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":"","tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]}}]}`,
+			want:   `{"id":"msg_test","type":"message","role":"assistant","model":"m","content":[{"type":"tool_use","id":"c1","name":"f","input":{"a":1}}],"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+		{
+			name:   "upstream error",
+			status: 429,
+			body:   `{"error":{"message":"slow down"}}`,
+			want:   `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAnthropicAdapter("m", []string{"END"})
+			a.messageID = "msg_test"
+			assertJSONEqual(t, a.convertResponse(tt.status, []byte(tt.body)), tt.want)
+		})
+	}
+}
+
+// sseEvents 解析SSE输出，返回事件名和数据
+func sseEvents(t *testing.T, out []byte) ([]string, []map[string]interface{}) {
+	t.Helper()
+	var names []string
+	var payloads []map[string]interface{}
+	for _, block := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		var name string
+		for _, line := range strings.Split(block, "\n") {
+			if event, ok := strings.CutPrefix(line, "event: "); ok {
+				name = event
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var payload map[string]interface{}
+				if err := json.Unmarshal([]byte(data), &payload); err != nil {
+					t.Fatalf("invalid SSE data %s: %v", data, err)
+				}
+				names = append(names, name)
+				payloads = append(payloads, payload)
+			}
+		}
+	}
+	return names, payloads
+}
+
+func TestAnthropicAdapterStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		stops        []string
+		chunks       []string
+		wantEvents   []string
+		wantReason   string
+		wantSequence interface{}
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"choices":[{"delta":{"content":"hel"}}]}`,
+				`{"choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2}}`,
+			},
+			wantEvents:   []string{"message_start", "content_block_start", "content_block_delta", "content_block_delta", "content_block_stop", "message_delta", "message_stop"},
+			wantReason:   "end_turn",
+			wantSequence: nil,
+		},
+		{
+			name:  "thinking then text stopped on stop sequence",
+			stops: []string{"STOP"},
+			chunks: []string{
+				`{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`,
+				`{"choices":[{"delta":{"content":"answerST"}}]}`,
+				`{"choices":[{"delta":{"content":"OP"},"finish_reason":"stop"}]}`,
+			},
+			wantEvents:   []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "content_block_start", "content_block_delta", "content_block_delta", "content_block_stop", "message_delta", "message_stop"},
+			wantReason:   "stop_sequence",
+			wantSequence: "STOP",
+		},
+		{
+			name: "tool call",
+			chunks: []string{
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"c1","function":{"name":"f","arguments":""}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			},
+			wantEvents:   []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"},
+			wantReason:   "tool_use",
+			wantSequence: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAnthropicAdapter("m", tt.stops)
+			var out []byte
+			for _, chunk := range tt.chunks {
+				out = append(out, a.convertChunk(mustJSON(t, chunk))...)
+			}
+			out = append(out, a.finishStream()...)
+
+			names, payloads := sseEvents(t, out)
+			if strings.Join(names, ",") != strings.Join(tt.wantEvents, ",") {
+				t.Fatalf("events = %v, want %v", names, tt.wantEvents)
+			}
+			delta := payloads[len(payloads)-2]["delta"].(map[string]interface{})
+			if delta["stop_reason"] != tt.wantReason || delta["stop_sequence"] != tt.wantSequence {
+				t.Errorf("message_delta = %v, want stop_reason %q, stop_sequence %v", delta, tt.wantReason, tt.wantSequence)
+			}
+		})
+	}
+}
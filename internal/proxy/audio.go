@@ -0,0 +1,463 @@
+/**
+  @author: Hanhai
+  @desc: 音频请求处理模块，转发multipart格式的语音识别请求和返回二进制音频的语音合成请求，按音频秒数和字符数统计用量
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 音频请求类型，用于选择密钥
+	audioRequestType = "audio"
+	// 无法解析音频时长时按128kbps估算，每秒16000字节
+	audioBytesPerSecond = 16000
+	// 音频请求体的最大大小，与OpenAI语音识别的文件大小限制相同
+	// 请求体需要完整保存在内存中，以便更换密钥重试时重新发送
+	maxAudioRequestBytes = 25 << 20
+	// WAV文件头的长度
+	wavHeaderSize = 44
+)
+
+// audioRequest 解析后的音频请求
+type audioRequest struct {
+	body        []byte
+	contentType string
+	model       string
+	seconds     float64 // 语音识别上传的音频时长（秒）
+	characters  int     // 语音合成的文本字符数
+
+	// multipart请求中model字段值在请求体中的位置，替换模型名时只替换这一段，其他部分原样发送
+	modelStart, modelEnd int
+	modelOverride        string
+}
+
+// audioEndpoint 返回音频接口名称（transcriptions、translations或speech），不是音频请求时返回空字符串
+func audioEndpoint(path string) string {
+	path = strings.TrimPrefix(path, "/v1")
+	if !strings.HasPrefix(path, "/audio/") {
+		return ""
+	}
+	switch endpoint := strings.Trim(strings.TrimPrefix(path, "/audio/"), "/"); endpoint {
+	case "transcriptions", "translations", "speech":
+		return endpoint
+	default:
+		return ""
+	}
+}
+
+// HandleAudioRequest 处理音频请求，请求体和响应体原样转发，不经过JSON转换
+func HandleAudioRequest(c *gin.Context, targetURL string, baseURL string, endpoint string) {
+	rl := GetRequestLogger(c)
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAudioRequestBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			localAPIError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("audio request body exceeds %d MB", maxAudioRequestBytes>>20))
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+
+	var request *audioRequest
+	if endpoint == "speech" {
+		request, err = parseSpeechRequest(body)
+	} else {
+		request, err = parseTranscriptionRequest(body, c.GetHeader("Content-Type"))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": map[string]interface{}{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    400,
+			},
+		})
+		return
+	}
+
+	// 解析模型别名，别名映射时替换请求体中的模型名
+	if target, found := model.ResolveModelAlias(request.model, middleware.GetClientName(c)); found && target != request.model {
+		if err := request.replaceModel(target); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to transform request body: %v", err),
+			})
+			return
+		}
+		rl.Info("模型别名 %s 映射为: %s", request.model, target)
+		request.model = target
+	}
+	rl.SetModel(request.model)
+
+	if isModelDisabled(request.model) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": map[string]interface{}{
+				"message": fmt.Sprintf("模型 %s 已被禁用", request.model),
+				"type":    "invalid_request_error",
+				"code":    403,
+			},
+		})
+		return
+	}
+	if !middleware.CheckClientModel(c, request.model) {
+		return
+	}
+
+	targetURL = routeToProvider(c, targetURL, baseURL, request.model)
+	rl.Info("音频请求: %s, 模型: %s, 音频时长: %.1f秒, 字符数: %d", endpoint, request.model, request.seconds, request.characters)
+
+	if processAudioRequestWithRetry(c, targetURL, request) {
+		go updateModelCallCount(request.model)
+	}
+}
+
+// parseSpeechRequest 解析语音合成请求，用量按输入文本的字符数计算
+func parseSpeechRequest(body []byte) (*audioRequest, error) {
+	var requestData struct {
+		Model string `json:"model"`
+		Input string `json:"input"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %v", err)
+	}
+	if requestData.Model == "" {
+		return nil, fmt.Errorf("model field is required")
+	}
+	if requestData.Input == "" {
+		return nil, fmt.Errorf("input field is required")
+	}
+	return &audioRequest{
+		body:        body,
+		contentType: "application/json",
+		model:       requestData.Model,
+		characters:  utf8.RuneCountInString(requestData.Input),
+	}, nil
+}
+
+// parseTranscriptionRequest 解析multipart格式的语音识别请求，获取模型名并估算上传音频的时长
+// 音频文件只读取文件头并计算大小，不复制文件内容
+func parseTranscriptionRequest(body []byte, contentType string) (*audioRequest, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, fmt.Errorf("audio requests must use multipart/form-data")
+	}
+
+	request := &audioRequest{body: body, contentType: contentType}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	hasFile := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart body: %v", err)
+		}
+
+		switch part.FormName() {
+		case "model":
+			value, _ := io.ReadAll(io.LimitReader(part, 1024))
+			request.model = strings.TrimSpace(string(value))
+		case "file":
+			seconds, err := estimateAudioSeconds(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid multipart body: %v", err)
+			}
+			hasFile = true
+			request.seconds = seconds
+		}
+		part.Close()
+	}
+
+	if request.model == "" {
+		return nil, fmt.Errorf("model field is required")
+	}
+	if !hasFile {
+		return nil, fmt.Errorf("file field is required")
+	}
+	return request, nil
+}
+
+// replaceModel 替换请求中的模型名，multipart请求只替换model字段的值，音频文件不重新编码
+func (r *audioRequest) replaceModel(modelName string) error {
+	if r.contentType == "application/json" {
+		var requestData map[string]interface{}
+		if err := json.Unmarshal(r.body, &requestData); err != nil {
+			return err
+		}
+		requestData["model"] = modelName
+		body, err := json.Marshal(requestData)
+		if err != nil {
+			return err
+		}
+		r.body = body
+		return nil
+	}
+
+	_, params, err := mime.ParseMediaType(r.contentType)
+	if err != nil {
+		return err
+	}
+	start, end, ok := multipartFieldRange(r.body, params["boundary"], "model")
+	if !ok {
+		return errors.New("model field not found in multipart body")
+	}
+	r.modelStart, r.modelEnd, r.modelOverride = start, end, modelName
+	return nil
+}
+
+// bodyReader 返回发送给上游的请求体和长度，每次重试都重新创建
+func (r *audioRequest) bodyReader() (io.Reader, int64) {
+	if r.modelOverride == "" {
+		return bytes.NewReader(r.body), int64(len(r.body))
+	}
+	reader := io.MultiReader(
+		bytes.NewReader(r.body[:r.modelStart]),
+		strings.NewReader(r.modelOverride),
+		bytes.NewReader(r.body[r.modelEnd:]),
+	)
+	return reader, int64(r.modelStart + len(r.modelOverride) + len(r.body) - r.modelEnd)
+}
+
+// multipartFieldRange 返回multipart请求体中指定表单字段的值所在的位置
+func multipartFieldRange(body []byte, boundary string, name string) (int, int, bool) {
+	delimiter := []byte("--" + boundary)
+	pos := bytes.Index(body, delimiter)
+	for pos >= 0 {
+		headerStart := pos + len(delimiter)
+		headerLength := bytes.Index(body[headerStart:], []byte("\r\n\r\n"))
+		if headerLength < 0 {
+			return 0, 0, false
+		}
+		valueStart := headerStart + headerLength + 4
+		valueLength := bytes.Index(body[valueStart:], append([]byte("\r\n"), delimiter...))
+		if valueLength < 0 {
+			return 0, 0, false
+		}
+		valueEnd := valueStart + valueLength
+
+		for _, line := range strings.Split(string(body[headerStart:headerStart+headerLength]), "\r\n") {
+			header, value, found := strings.Cut(line, ":")
+			if !found || !strings.EqualFold(strings.TrimSpace(header), "Content-Disposition") {
+				continue
+			}
+			if _, params, err := mime.ParseMediaType(strings.TrimSpace(value)); err == nil && params["name"] == name {
+				return valueStart, valueEnd, true
+			}
+		}
+		pos = valueEnd + 2
+	}
+	return 0, 0, false
+}
+
+// estimateAudioSeconds 估算音频时长，WAV文件根据文件头计算，其他格式按128kbps估算
+func estimateAudioSeconds(file io.Reader) (float64, error) {
+	header := make([]byte, wavHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	rest, err := io.Copy(io.Discard, file)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(n) + rest
+
+	if n == wavHeaderSize && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE" {
+		// 标准WAV文件头中第28字节开始为每秒字节数
+		if byteRate := binary.LittleEndian.Uint32(header[28:32]); byteRate > 0 {
+			return float64(size-wavHeaderSize) / float64(byteRate), nil
+		}
+	}
+	return float64(size) / audioBytesPerSecond, nil
+}
+
+// processAudioRequestWithRetry 发送音频请求，网络错误或返回需要重试的状态码时更换密钥重试
+func processAudioRequestWithRetry(c *gin.Context, targetURL string, request *audioRequest) bool {
+	rl := GetRequestLogger(c)
+	cfg := config.GetConfig()
+	retryConfig := cfg.ApiProxy.Retry
+
+	// 语音合成按字符数选择密钥，长文本优先使用余额高的密钥
+	tokenEstimate := request.characters
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(retryConfig.RetryDelayMs) * time.Millisecond)
+		}
+
+		apiKey, err := key.GetBestKeyForRequest(audioRequestType, request.model, tokenEstimate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "No suitable API keys available",
+			})
+			return false
+		}
+		if attempt > 0 {
+			rl.Warn("音频请求第%d次重试，使用密钥: %s", attempt, utils.MaskKey(apiKey))
+			metrics.RecordRetry(request.model)
+		}
+
+		body, contentLength := request.bodyReader()
+		resp, err := sendRawRequest(c, targetURL, body, contentLength, request.contentType, apiKey)
+		canRetry := attempt < retryConfig.MaxRetries
+		if err != nil {
+			rl.Error("音频请求网络错误 -> URL: %s, Error: %v", targetURL, err)
+			key.UpdateApiKeyStatus(apiKey, false)
+			config.AddDailyRequestStat(apiKey, request.model, 1, 0, 0, false)
+			recordClientUsage(c, request.model, 0, 0, false)
+			if canRetry && retryConfig.RetryOnNetworkErrors {
+				continue
+			}
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("Failed to send audio request: %v", err),
+			})
+			return false
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest && canRetry && statusRetryable(resp.StatusCode, retryConfig) {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			rl.Warn("音频请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+			key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
+			config.AddDailyRequestStat(apiKey, request.model, 1, 0, 0, false)
+			recordClientUsage(c, request.model, 0, 0, false)
+			continue
+		}
+
+		success := writeAudioResponse(c, resp, request)
+		resp.Body.Close()
+
+		// 响应体已经写给调用方，只按状态码冷却密钥
+		if resp.StatusCode >= http.StatusBadRequest {
+			key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, nil)
+		} else {
+			key.UpdateApiKeyStatus(apiKey, success)
+		}
+		config.AddKeyRequestStat(apiKey, 1, 0)
+		config.AddDailyRequestStat(apiKey, request.model, 1, 0, 0, success)
+		recordClientUsage(c, request.model, 0, 0, success)
+		if success {
+			config.AddDailyAudioStat(request.model, request.seconds, request.characters)
+		}
+		return success
+	}
+}
+
+// statusRetryable 判断状态码是否在重试配置中
+func statusRetryable(statusCode int, retryConfig config.RetryConfig) bool {
+	for _, code := range retryConfig.RetryOnStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRawRequest 使用指定密钥发送请求，请求体不做转换，保留指定的Content-Type
+func sendRawRequest(c *gin.Context, targetURL string, body io.Reader, contentLength int64, contentType string, apiKey string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+
+	for name, values := range c.Request.Header {
+		if strings.EqualFold(name, "host") || strings.EqualFold(name, "authorization") || strings.EqualFold(name, "content-length") {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	utils.SetCommonHeaders(req, apiKey)
+	// SetCommonHeaders会设置JSON类型，multipart请求需要恢复原始的Content-Type和boundary
+	req.Header.Set("Content-Type", contentType)
+
+	timeout := time.Duration(config.GetConfig().RequestSettings.ProxyHandler.StandardTimeout) * time.Minute
+	client := utils.CreateClientWithTimeout(timeout)
+	return client.Do(req)
+}
+
+// writeAudioResponse 将上游响应原样写入客户端，音频数据边读边写
+// 语音识别返回verbose_json格式时，使用响应中的duration作为音频时长
+func writeAudioResponse(c *gin.Context, resp *http.Response, request *audioRequest) bool {
+	rl := GetRequestLogger(c)
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+
+	for _, name := range []string{"Content-Type", "Content-Disposition", "Content-Length"} {
+		if value := resp.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	if request.characters == 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		// 语音识别的文本响应较小，读取完整响应以获取音频时长
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			rl.Error("读取音频响应失败: %v", err)
+			return false
+		}
+		if success {
+			var result struct {
+				Duration float64 `json:"duration"`
+			}
+			if json.Unmarshal(respBody, &result) == nil && result.Duration > 0 {
+				request.seconds = result.Duration
+			}
+		} else {
+			rl.Error("音频请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+		}
+		c.Writer.Write(respBody)
+		return success
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				rl.Warn("客户端连接已断开: %v", writeErr)
+				return false
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rl.Error("读取音频响应失败: %v", err)
+			return false
+		}
+	}
+	if !success {
+		rl.Error("音频请求失败，状态码: %d", resp.StatusCode)
+	}
+	return success
+}
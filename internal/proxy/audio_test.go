@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wavFile 构造指定每秒字节数和数据长度的WAV文件
+func wavFile(byteRate uint32, dataSize int) []byte {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:4], "RIFF")
+	copy(header[8:12], "WAVE")
+	binary.LittleEndian.PutUint32(header[28:32], byteRate)
+	return append(header, make([]byte, dataSize)...)
+}
+
+// transcriptionBody 构造语音识别的multipart请求体
+func transcriptionBody(t *testing.T, modelName string, file []byte) ([]byte, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("model", modelName)
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(file)
+	writer.WriteField("language", "zh")
+	writer.Close()
+	return buf.Bytes(), writer.FormDataContentType()
+}
+
+func TestParseTranscriptionRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    []byte
+		seconds float64
+	}{
+		{"wav header", wavFile(32000, 64000), 2},
+		{"unknown format", bytes.Repeat([]byte{1}, 3*audioBytesPerSecond), 3},
+		{"shorter than wav header", []byte("abc"), 3.0 / audioBytesPerSecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := transcriptionBody(t, "FunAudioLLM/SenseVoiceSmall", tt.file)
+			request, err := parseTranscriptionRequest(body, contentType)
+			if err != nil {
+				t.Fatalf("parseTranscriptionRequest() error = %v", err)
+			}
+			if request.model != "FunAudioLLM/SenseVoiceSmall" {
+				t.Errorf("model = %q", request.model)
+			}
+			if request.seconds != tt.seconds {
+				t.Errorf("seconds = %v, want %v", request.seconds, tt.seconds)
+			}
+		})
+	}
+}
+
+func TestAudioRequestReplaceModel(t *testing.T) {
+	file := wavFile(32000, 1000)
+	body, contentType := transcriptionBody(t, "whisper", file)
+	request, err := parseTranscriptionRequest(body, contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := request.replaceModel("FunAudioLLM/SenseVoiceSmall"); err != nil {
+		t.Fatalf("replaceModel() error = %v", err)
+	}
+
+	reader, contentLength := request.bodyReader()
+	sent, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(sent)) != contentLength {
+		t.Errorf("content length = %d, body has %d bytes", contentLength, len(sent))
+	}
+
+	// 替换后的请求体只有model字段不同，音频文件和其他字段不变
+	want := bytes.Replace(body, []byte("\r\n\r\nwhisper\r\n"), []byte("\r\n\r\nFunAudioLLM/SenseVoiceSmall\r\n"), 1)
+	if !bytes.Equal(sent, want) {
+		t.Error("replaced body differs from the original outside the model field")
+	}
+	parsed, err := parseTranscriptionRequest(sent, contentType)
+	if err != nil {
+		t.Fatalf("parse replaced body: %v", err)
+	}
+	if parsed.model != "FunAudioLLM/SenseVoiceSmall" {
+		t.Errorf("model = %q", parsed.model)
+	}
+
+	// 重试时重新创建的请求体内容相同
+	again, _ := request.bodyReader()
+	resent, _ := io.ReadAll(again)
+	if !bytes.Equal(sent, resent) {
+		t.Error("bodyReader() returned different bodies on retry")
+	}
+}
+
+func TestMultipartFieldRange(t *testing.T) {
+	body, contentType := transcriptionBody(t, "whisper", []byte("name=\"model\"\r\n\r\nfake"))
+	boundary := contentType[strings.Index(contentType, "boundary=")+len("boundary="):]
+
+	start, end, ok := multipartFieldRange(body, boundary, "model")
+	if !ok || string(body[start:end]) != "whisper" {
+		t.Errorf("model range = %q, %v", body[start:end], ok)
+	}
+	start, end, ok = multipartFieldRange(body, boundary, "language")
+	if !ok || string(body[start:end]) != "zh" {
+		t.Errorf("language range = %q, %v", body[start:end], ok)
+	}
+	if _, _, ok := multipartFieldRange(body, boundary, "prompt"); ok {
+		t.Error("missing field found")
+	}
+}
+
+func TestHandleAudioRequestTooLarge(t *testing.T) {
+	body, contentType := transcriptionBody(t, "whisper", make([]byte, maxAudioRequestBytes))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+
+	HandleAudioRequest(c, "http://127.0.0.1:0/v1/audio/transcriptions", "http://127.0.0.1:0", "/v1/audio/transcriptions")
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,830 @@
+/**
+  @author: Hanhai
+  @desc: Batches API本地实现，在后台通过密钥池并发执行批量请求，结果写入JSONL文件，重启后从已写入的结果继续执行
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 唯一支持的完成时间窗口
+	batchCompletionWindow = "24h"
+	// 批量任务进度写入数据库的间隔
+	batchProgressInterval = time.Second
+	// 校验失败时最多记录的错误数
+	batchMaxValidationErrors = 100
+	// 列出批量任务时的默认和最大条数
+	batchDefaultListLimit = 20
+	batchMaxListLimit     = 100
+)
+
+// 批量任务支持的接口
+var batchEndpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings", "/v1/rerank"}
+
+var (
+	// 正在执行的批量任务
+	runningBatches   = make(map[string]*batchRunner)
+	runningBatchesMu sync.Mutex
+
+	// 所有批量任务共享的并发槽位，限制同时执行的批量请求总数
+	batchSlots = struct {
+		sync.Mutex
+		active int
+		wait   chan struct{} // 释放槽位时关闭，唤醒等待的请求
+	}{wait: make(chan struct{})}
+)
+
+// batchLine 输入文件中的一行请求
+type batchLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchRunner 执行中的批量任务
+type batchRunner struct {
+	mu        sync.Mutex // 保护batch字段和结果文件写入
+	batch     *config.Batch
+	ctx       context.Context
+	cancel    context.CancelFunc
+	completed atomic.Int64
+	failed    atomic.Int64
+	output    *os.File
+	errors    *os.File
+}
+
+// batchResultPaths 返回批量任务执行中写入的结果文件和错误文件路径
+func batchResultPaths(batchID string) (string, string) {
+	dir := batchFilesDir()
+	return filepath.Join(dir, batchID+"_output.jsonl"), filepath.Join(dir, batchID+"_error.jsonl")
+}
+
+// batchObject 返回OpenAI格式的批量任务对象
+func batchObject(batch *config.Batch) gin.H {
+	optional := func(v int64) interface{} {
+		if v == 0 {
+			return nil
+		}
+		return v
+	}
+	optionalString := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	optionalJSON := func(s string) interface{} {
+		var v interface{}
+		if s == "" || json.Unmarshal([]byte(s), &v) != nil {
+			return nil
+		}
+		return v
+	}
+
+	return gin.H{
+		"id":                batch.ID,
+		"object":            "batch",
+		"endpoint":          batch.Endpoint,
+		"errors":            optionalJSON(batch.Errors),
+		"input_file_id":     batch.InputFileID,
+		"completion_window": batch.CompletionWindow,
+		"status":            batch.Status,
+		"output_file_id":    optionalString(batch.OutputFileID),
+		"error_file_id":     optionalString(batch.ErrorFileID),
+		"created_at":        batch.CreatedAt,
+		"in_progress_at":    optional(batch.InProgressAt),
+		"expires_at":        optional(batch.ExpiresAt),
+		"finalizing_at":     optional(batch.FinalizingAt),
+		"completed_at":      optional(batch.CompletedAt),
+		"failed_at":         optional(batch.FailedAt),
+		"expired_at":        optional(batch.ExpiredAt),
+		"cancelling_at":     optional(batch.CancellingAt),
+		"cancelled_at":      optional(batch.CancelledAt),
+		"request_counts": gin.H{
+			"total":     batch.Total,
+			"completed": batch.Completed,
+			"failed":    batch.Failed,
+		},
+		"metadata": optionalJSON(batch.Metadata),
+	}
+}
+
+// HandleBatchesRequest 处理/v1/batches请求
+func HandleBatchesRequest(c *gin.Context) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(c.Param("path"), "/batches"), "/"), "/")
+	batchID := parts[0]
+
+	switch {
+	case batchID == "" && c.Request.Method == http.MethodPost:
+		handleCreateBatch(c)
+	case batchID == "" && c.Request.Method == http.MethodGet:
+		handleListBatches(c)
+	case len(parts) == 1 && c.Request.Method == http.MethodGet:
+		handleGetBatch(c, batchID)
+	case len(parts) == 2 && parts[1] == "cancel" && c.Request.Method == http.MethodPost:
+		handleCancelBatch(c, batchID)
+	default:
+		localAPIError(c, http.StatusNotFound, "unknown batches endpoint")
+	}
+}
+
+// handleCreateBatch 创建批量任务并在后台开始执行
+func handleCreateBatch(c *gin.Context) {
+	var request struct {
+		InputFileID      string                 `json:"input_file_id"`
+		Endpoint         string                 `json:"endpoint"`
+		CompletionWindow string                 `json:"completion_window"`
+		Metadata         map[string]interface{} `json:"metadata"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		localAPIError(c, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+	if !containsString(batchEndpoints, request.Endpoint) {
+		localAPIError(c, http.StatusBadRequest, fmt.Sprintf("endpoint must be one of: %s", strings.Join(batchEndpoints, ", ")))
+		return
+	}
+	if request.CompletionWindow == "" {
+		request.CompletionWindow = batchCompletionWindow
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		localAPIError(c, http.StatusBadRequest, "completion_window must be 24h")
+		return
+	}
+	if loadStoredFile(c, request.InputFileID) == nil {
+		return
+	}
+
+	now := time.Now()
+	batch := &config.Batch{
+		ID:               newLocalID("batch_"),
+		Endpoint:         request.Endpoint,
+		InputFileID:      request.InputFileID,
+		CompletionWindow: request.CompletionWindow,
+		Status:           config.BatchValidating,
+		Client:           middleware.GetClientID(c),
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+	}
+	if request.Metadata != nil {
+		metadata, _ := json.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err := config.SaveBatch(batch); err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create batch: %v", err))
+		return
+	}
+
+	GetRequestLogger(c).Info("已创建批量任务: %s, 接口: %s, 输入文件: %s", batch.ID, batch.Endpoint, batch.InputFileID)
+	startBatch(batch)
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+// handleListBatches 列出当前客户端的批量任务
+func handleListBatches(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(batchDefaultListLimit)))
+	if err != nil || limit <= 0 {
+		limit = batchDefaultListLimit
+	}
+	if limit > batchMaxListLimit {
+		limit = batchMaxListLimit
+	}
+
+	batches, err := config.ListBatches(middleware.GetClientID(c), limit)
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list batches: %v", err))
+		return
+	}
+	data := make([]gin.H, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batchObject(currentBatch(batch)))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": false,
+	})
+}
+
+// loadBatch 获取批量任务，不存在或不属于当前客户端时返回404
+func loadBatch(c *gin.Context, batchID string) *config.Batch {
+	batch, err := config.GetBatch(batchID)
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to load batch: %v", err))
+		return nil
+	}
+	if batch == nil || batch.Client != middleware.GetClientID(c) {
+		localAPIError(c, http.StatusNotFound, fmt.Sprintf("No such batch: %s", batchID))
+		return nil
+	}
+	return batch
+}
+
+// handleGetBatch 获取批量任务状态和进度
+func handleGetBatch(c *gin.Context, batchID string) {
+	if batch := loadBatch(c, batchID); batch != nil {
+		c.JSON(http.StatusOK, batchObject(currentBatch(batch)))
+	}
+}
+
+// handleCancelBatch 取消批量任务，正在执行的请求完成后任务变为cancelled
+func handleCancelBatch(c *gin.Context, batchID string) {
+	batch := loadBatch(c, batchID)
+	if batch == nil {
+		return
+	}
+
+	runningBatchesMu.Lock()
+	runner := runningBatches[batchID]
+	runningBatchesMu.Unlock()
+
+	if runner != nil {
+		runner.mu.Lock()
+		if runner.batch.Status == config.BatchValidating || runner.batch.Status == config.BatchInProgress {
+			runner.batch.Status = config.BatchCancelling
+			runner.batch.CancellingAt = time.Now().Unix()
+			if err := config.SaveBatch(runner.batch); err != nil {
+				logger.Error("保存批量任务 %s 状态失败: %v", batchID, err)
+			}
+			runner.cancel()
+			GetRequestLogger(c).Info("正在取消批量任务: %s", batchID)
+		}
+		runner.mu.Unlock()
+		c.JSON(http.StatusOK, batchObject(runner.snapshot()))
+		return
+	}
+
+	if batch.Finished() {
+		localAPIError(c, http.StatusConflict, fmt.Sprintf("Cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+
+	// 任务未在执行，直接结束
+	now := time.Now().Unix()
+	batch.Status = config.BatchCancelled
+	batch.CancellingAt = now
+	batch.CancelledAt = now
+	registerBatchResultFiles(batch)
+	if err := config.SaveBatch(batch); err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to cancel batch: %v", err))
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+// currentBatch 任务正在执行时返回内存中的最新状态
+func currentBatch(batch *config.Batch) *config.Batch {
+	runningBatchesMu.Lock()
+	runner := runningBatches[batch.ID]
+	runningBatchesMu.Unlock()
+	if runner == nil {
+		return batch
+	}
+	return runner.snapshot()
+}
+
+// ResumeBatches 恢复重启前未完成的批量任务
+func ResumeBatches() {
+	batches, err := config.ListUnfinishedBatches()
+	if err != nil {
+		logger.Error("获取未完成的批量任务失败: %v", err)
+		return
+	}
+
+	for _, batch := range batches {
+		if batch.Status == config.BatchCancelling {
+			batch.Status = config.BatchCancelled
+			batch.CancelledAt = time.Now().Unix()
+			registerBatchResultFiles(batch)
+			if err := config.SaveBatch(batch); err != nil {
+				logger.Error("保存批量任务 %s 状态失败: %v", batch.ID, err)
+			}
+			continue
+		}
+		logger.Info("恢复执行批量任务: %s, 状态: %s, 进度: %d/%d", batch.ID, batch.Status, batch.Completed+batch.Failed, batch.Total)
+		startBatch(batch)
+	}
+}
+
+// startBatch 在后台执行批量任务
+func startBatch(batch *config.Batch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &batchRunner{batch: batch, ctx: ctx, cancel: cancel}
+
+	runningBatchesMu.Lock()
+	runningBatches[batch.ID] = runner
+	runningBatchesMu.Unlock()
+
+	go func() {
+		defer func() {
+			runningBatchesMu.Lock()
+			delete(runningBatches, batch.ID)
+			runningBatchesMu.Unlock()
+			cancel()
+		}()
+		runner.run()
+	}()
+}
+
+// snapshot 返回带最新进度的任务副本
+func (r *batchRunner) snapshot() *config.Batch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	batch := *r.batch
+	batch.Completed = int(r.completed.Load())
+	batch.Failed = int(r.failed.Load())
+	return &batch
+}
+
+// setStatus 更新任务状态并保存
+func (r *batchRunner) setStatus(update func(batch *config.Batch)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update(r.batch)
+	r.batch.Completed = int(r.completed.Load())
+	r.batch.Failed = int(r.failed.Load())
+	if err := config.SaveBatch(r.batch); err != nil {
+		logger.Error("保存批量任务 %s 状态失败: %v", r.batch.ID, err)
+	}
+}
+
+// run 校验输入文件并执行所有未完成的请求
+func (r *batchRunner) run() {
+	batchID := r.batch.ID
+	lines, validationErrors, err := loadBatchLines(r.batch)
+	if err != nil || len(validationErrors) > 0 {
+		if err != nil {
+			validationErrors = []gin.H{{"code": "invalid_file", "message": err.Error()}}
+		}
+		errorsJSON, _ := json.Marshal(gin.H{"object": "list", "data": validationErrors})
+		r.setStatus(func(batch *config.Batch) {
+			batch.Status = config.BatchFailed
+			batch.FailedAt = time.Now().Unix()
+			batch.Errors = string(errorsJSON)
+		})
+		logger.Warn("批量任务 %s 校验失败，共 %d 个错误", batchID, len(validationErrors))
+		return
+	}
+
+	// 读取已写入的结果，跳过已完成的请求
+	outputPath, errorPath := batchResultPaths(batchID)
+	done := make(map[string]bool)
+	completed, err := loadBatchResults(outputPath, done)
+	if err == nil {
+		var failed int
+		failed, err = loadBatchResults(errorPath, done)
+		r.failed.Store(int64(failed))
+	}
+	if err != nil {
+		logger.Error("读取批量任务 %s 的结果文件失败: %v", batchID, err)
+		r.setStatus(func(batch *config.Batch) {
+			batch.Status = config.BatchFailed
+			batch.FailedAt = time.Now().Unix()
+		})
+		return
+	}
+	r.completed.Store(int64(completed))
+
+	if r.output, err = os.OpenFile(outputPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+		r.errors, err = os.OpenFile(errorPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		logger.Error("打开批量任务 %s 的结果文件失败: %v", batchID, err)
+		if r.output != nil {
+			r.output.Close()
+		}
+		r.setStatus(func(batch *config.Batch) {
+			batch.Status = config.BatchFailed
+			batch.FailedAt = time.Now().Unix()
+		})
+		return
+	}
+
+	r.setStatus(func(batch *config.Batch) {
+		if batch.Status == config.BatchValidating {
+			batch.Status = config.BatchInProgress
+			batch.InProgressAt = time.Now().Unix()
+		}
+		batch.Total = len(lines)
+	})
+
+	pending := make([]batchLine, 0, len(lines))
+	for _, line := range lines {
+		if !done[line.CustomID] {
+			pending = append(pending, line)
+		}
+	}
+	cfg := config.GetConfig()
+	concurrency := cfg.ApiProxy.Batch.GetConcurrency(cfg.RequestSettings.ProxyHandler.MaxConcurrency)
+	logger.Info("批量任务 %s 开始执行，共 %d 个请求，待执行 %d 个，并发数: %d", batchID, len(lines), len(pending), concurrency)
+
+	expired := r.execute(pending, len(lines), concurrency)
+	r.output.Close()
+	r.errors.Close()
+	r.finish(expired)
+}
+
+// execute 并发执行请求，每个请求执行前获取共享的并发槽位，返回任务是否已过期
+func (r *batchRunner) execute(lines []batchLine, total int, concurrency int) bool {
+	expiresAt := time.Unix(r.batch.ExpiresAt, 0)
+	var expired atomic.Bool
+
+	// 定时保存进度
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ticker := time.NewTicker(batchProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				config.UpdateBatchProgress(r.batch.ID, total, int(r.completed.Load()), int(r.failed.Load()))
+			case <-stopProgress:
+				return
+			}
+		}
+	}()
+
+	queue := make(chan batchLine)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range queue {
+				if !acquireBatchSlot(r.ctx) {
+					continue
+				}
+				r.executeLine(line)
+				releaseBatchSlot()
+			}
+		}()
+	}
+
+dispatch:
+	for _, line := range lines {
+		if time.Now().After(expiresAt) {
+			expired.Store(true)
+			break
+		}
+		select {
+		case queue <- line:
+		case <-r.ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	close(stopProgress)
+	<-progressDone
+	return expired.Load()
+}
+
+// acquireBatchSlot 获取批量请求的并发槽位，槽位数按当前配置计算，任务取消时返回false
+func acquireBatchSlot(ctx context.Context) bool {
+	for {
+		cfg := config.GetConfig()
+		limit := cfg.ApiProxy.Batch.GetConcurrency(cfg.RequestSettings.ProxyHandler.MaxConcurrency)
+
+		batchSlots.Lock()
+		if batchSlots.active < limit {
+			batchSlots.active++
+			batchSlots.Unlock()
+			return true
+		}
+		wait := batchSlots.wait
+		batchSlots.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// releaseBatchSlot 释放批量请求的并发槽位
+func releaseBatchSlot() {
+	batchSlots.Lock()
+	batchSlots.active--
+	close(batchSlots.wait)
+	batchSlots.wait = make(chan struct{})
+	batchSlots.Unlock()
+}
+
+// finish 根据执行结果结束任务，并登记结果文件
+func (r *batchRunner) finish(expired bool) {
+	r.setStatus(func(batch *config.Batch) {
+		now := time.Now().Unix()
+		switch {
+		case batch.Status == config.BatchCancelling:
+			batch.Status = config.BatchCancelled
+			batch.CancelledAt = now
+		case expired:
+			batch.Status = config.BatchExpired
+			batch.ExpiredAt = now
+		default:
+			batch.Status = config.BatchFinalizing
+			batch.FinalizingAt = now
+		}
+	})
+
+	r.setStatus(func(batch *config.Batch) {
+		registerBatchResultFiles(batch)
+		if batch.Status == config.BatchFinalizing {
+			batch.Status = config.BatchCompleted
+			batch.CompletedAt = time.Now().Unix()
+		}
+	})
+
+	batch := r.snapshot()
+	logger.Info("批量任务 %s 已结束，状态: %s, 成功: %d, 失败: %d", batch.ID, batch.Status, batch.Completed, batch.Failed)
+}
+
+// registerBatchResultFiles 将非空的结果文件和错误文件登记为可下载的文件
+func registerBatchResultFiles(batch *config.Batch) {
+	outputPath, errorPath := batchResultPaths(batch.ID)
+	register := func(path string, suffix string) string {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() == 0 {
+			return ""
+		}
+		file := &config.StoredFile{
+			ID:        newLocalID("file-"),
+			Filename:  batch.ID + suffix,
+			Purpose:   filePurposeBatchOutput,
+			Bytes:     info.Size(),
+			Path:      path,
+			Client:    batch.Client,
+			CreatedAt: time.Now().Unix(),
+		}
+		if err := config.SaveStoredFile(file); err != nil {
+			logger.Error("登记批量任务 %s 的结果文件失败: %v", batch.ID, err)
+			return ""
+		}
+		return file.ID
+	}
+
+	if batch.OutputFileID == "" {
+		batch.OutputFileID = register(outputPath, "_output.jsonl")
+	}
+	if batch.ErrorFileID == "" {
+		batch.ErrorFileID = register(errorPath, "_error.jsonl")
+	}
+}
+
+// loadBatchLines 读取并校验输入文件中的请求
+func loadBatchLines(batch *config.Batch) ([]batchLine, []gin.H, error) {
+	file, err := config.GetStoredFile(batch.InputFileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file == nil {
+		return nil, nil, fmt.Errorf("input file %s not found", batch.InputFileID)
+	}
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var lines []batchLine
+	var validationErrors []gin.H
+	addError := func(lineNumber int, code string, message string) {
+		if len(validationErrors) < batchMaxValidationErrors {
+			validationErrors = append(validationErrors, gin.H{"code": code, "message": message, "line": lineNumber})
+		}
+	}
+
+	client := middleware.ClientForID(batch.Client)
+	customIDs := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var line batchLine
+		switch {
+		case json.Unmarshal(text, &line) != nil:
+			addError(lineNumber, "invalid_json_line", "This line is not parseable as valid JSON.")
+		case line.CustomID == "":
+			addError(lineNumber, "missing_required_parameter", "custom_id is required.")
+		case customIDs[line.CustomID]:
+			addError(lineNumber, "duplicate_custom_id", fmt.Sprintf("The custom_id %s is duplicated.", line.CustomID))
+		case !strings.EqualFold(line.Method, http.MethodPost):
+			addError(lineNumber, "invalid_method", "Only POST is supported.")
+		case line.URL != batch.Endpoint:
+			addError(lineNumber, "mismatched_url", fmt.Sprintf("The url must match the batch endpoint %s.", batch.Endpoint))
+		case len(line.Body) == 0 || line.Body[0] != '{':
+			addError(lineNumber, "invalid_body", "body must be a JSON object.")
+		case !batchLineModelAllowed(client, line):
+			addError(lineNumber, "model_not_allowed", "The model of this request is not allowed for this API key.")
+		default:
+			customIDs[line.CustomID] = true
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(lines) == 0 && len(validationErrors) == 0 {
+		addError(0, "empty_file", "The input file contains no requests.")
+	}
+	return lines, validationErrors, nil
+}
+
+// batchLineModelAllowed 检查客户端是否可以使用请求中解析别名后的模型，未指定模型的对话和补全请求使用default别名
+func batchLineModelAllowed(client middleware.Client, line batchLine) bool {
+	var body struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(line.Body, &body)
+	modelName := body.Model
+	if modelName == "" {
+		if !strings.Contains(line.URL, "/completions") {
+			return true
+		}
+		modelName = model.DefaultAlias
+	}
+	if target, found := model.ResolveModelAlias(modelName, client.Name); found {
+		modelName = target
+	}
+	return middleware.ClientAllowsModel(client.ID, modelName)
+}
+
+// loadBatchResults 读取结果文件中已完成请求的custom_id，返回条数
+// 程序异常退出时最后一行可能不完整，这种情况下只保留完整的行重写文件
+func loadBatchResults(path string, done map[string]bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var valid [][]byte
+	truncated := false
+	for _, text := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+		var result struct {
+			CustomID string `json:"custom_id"`
+		}
+		if json.Unmarshal(text, &result) != nil || result.CustomID == "" {
+			truncated = true
+			continue
+		}
+		done[result.CustomID] = true
+		valid = append(valid, text)
+	}
+
+	if truncated {
+		content := bytes.Join(valid, []byte("\n"))
+		if len(content) > 0 {
+			content = append(content, '\n')
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return 0, err
+		}
+	}
+	return len(valid), nil
+}
+
+// executeLine 通过代理处理流程执行一个请求，结果写入结果文件或错误文件
+func (r *batchRunner) executeLine(line batchLine) {
+	requestID := newLocalID("batch_req_")
+	statusCode, body := r.send(line, requestID)
+
+	result := gin.H{
+		"id":        requestID,
+		"custom_id": line.CustomID,
+		"response": gin.H{
+			"status_code": statusCode,
+			"request_id":  requestID,
+			"body":        body,
+		},
+		"error": nil,
+	}
+
+	success := statusCode >= 200 && statusCode < 300
+	if !success {
+		var data map[string]interface{}
+		if m, ok := body.(map[string]interface{}); ok {
+			data = m
+		}
+		result["error"] = gin.H{
+			"code":    strconv.Itoa(statusCode),
+			"message": extractErrorMessage(data, nil),
+		}
+	}
+
+	encoded, _ := json.Marshal(result)
+	encoded = append(encoded, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file := r.output
+	if !success {
+		file = r.errors
+	}
+	if _, err := file.Write(encoded); err != nil {
+		logger.Error("写入批量任务 %s 的结果失败: %v", r.batch.ID, err)
+		return
+	}
+	if success {
+		r.completed.Add(1)
+	} else {
+		r.failed.Add(1)
+	}
+}
+
+// send 使用与普通请求相同的处理流程（别名、密钥选择、重试、备用模型、统计）执行请求
+func (r *batchRunner) send(line batchLine, requestID string) (int, interface{}) {
+	// 客户端密钥可能在任务执行期间被禁用、过期或用完配额，允许的模型在解析别名后检查
+	if status, code, message := middleware.CheckClientPolicy(r.batch.Client); status != 0 {
+		return status, gin.H{"error": gin.H{"message": message, "type": "client_policy_error", "code": code}}
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(line.Body, &requestData); err != nil {
+		return http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error(), "type": "invalid_request_error"}}
+	}
+	// 批量请求不支持流式输出
+	delete(requestData, "stream")
+	delete(requestData, "stream_options")
+	body, _ := json.Marshal(requestData)
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodPost, line.URL, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": gin.H{"message": err.Error(), "type": "internal_error"}}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = req
+	c.Params = gin.Params{{Key: "path", Value: strings.TrimPrefix(line.URL, "/v1")}}
+	c.Set("request_id", requestID)
+	middleware.SetClient(c, middleware.ClientForID(r.batch.Client))
+
+	HandleOpenAIProxy(c)
+
+	// 重试时可能先写入了失败的响应，使用最后一个JSON对象作为结果
+	data := lastJSONObject(recorder.Body.Bytes())
+	if data == nil {
+		return http.StatusBadGateway, gin.H{"error": gin.H{"message": "empty response", "type": "upstream_error"}}
+	}
+	if _, hasError := data["error"]; hasError {
+		statusCode := recorder.Code
+		if statusCode < http.StatusBadRequest {
+			statusCode = http.StatusInternalServerError
+		}
+		return statusCode, data
+	}
+	return http.StatusOK, data
+}
+
+// lastJSONObject 解析响应体中的最后一个JSON对象
+func lastJSONObject(body []byte) map[string]interface{} {
+	var last map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var data map[string]interface{}
+		if err := decoder.Decode(&data); err != nil {
+			return last
+		}
+		last = data
+	}
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveAsClient 以指定客户端的身份调用处理函数，返回响应
+func serveAsClient(client string, handler gin.HandlerFunc, method string, path string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+	if body == nil {
+		body = &bytes.Buffer{}
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/v1"+path, body)
+	if contentType != "" {
+		c.Request.Header.Set("Content-Type", contentType)
+	}
+	c.Params = gin.Params{{Key: "path", Value: path}}
+	c.Set(middleware.ClientIDKey, client)
+	handler(c)
+	return w
+}
+
+// listIDs 返回列表响应中的对象ID
+func listIDs(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid list response %s: %v", w.Body.String(), err)
+	}
+	ids := make([]string, 0, len(list.Data))
+	for _, item := range list.Data {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestFilesScopedToClient(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.ApiProxy.Batch.FilesDir = t.TempDir()
+	})
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("purpose", filePurposeBatch)
+	part, _ := writer.CreateFormFile("file", "input.jsonl")
+	part.Write([]byte(`{"custom_id":"a"}` + "\n"))
+	writer.Close()
+
+	w := serveAsClient("alice", HandleFilesRequest, http.MethodPost, "/files", &body, writer.FormDataContentType())
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var file struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &file)
+
+	if ids := listIDs(t, serveAsClient("bob", HandleFilesRequest, http.MethodGet, "/files", nil, "")); len(ids) != 0 {
+		t.Errorf("other client lists files %v", ids)
+	}
+	if ids := listIDs(t, serveAsClient("alice", HandleFilesRequest, http.MethodGet, "/files", nil, "")); len(ids) != 1 || ids[0] != file.ID {
+		t.Errorf("owner lists files %v, want [%s]", ids, file.ID)
+	}
+
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/files/" + file.ID},
+		{http.MethodGet, "/files/" + file.ID + "/content"},
+		{http.MethodDelete, "/files/" + file.ID},
+	} {
+		if w := serveAsClient("bob", HandleFilesRequest, request.method, request.path, nil, ""); w.Code != http.StatusNotFound {
+			t.Errorf("other client %s %s status = %d, want 404", request.method, request.path, w.Code)
+		}
+	}
+
+	if w := serveAsClient("alice", HandleFilesRequest, http.MethodGet, "/files/"+file.ID+"/content", nil, ""); w.Code != http.StatusOK {
+		t.Errorf("owner content status = %d", w.Code)
+	}
+	if w := serveAsClient("alice", HandleFilesRequest, http.MethodDelete, "/files/"+file.ID, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("owner delete status = %d", w.Code)
+	}
+}
+
+func TestBatchesScopedToClient(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.ApiProxy.Batch.FilesDir = t.TempDir()
+	})
+
+	batch := &config.Batch{
+		ID:               newLocalID("batch_"),
+		Endpoint:         "/v1/chat/completions",
+		InputFileID:      "file-input",
+		CompletionWindow: batchCompletionWindow,
+		Status:           config.BatchFailed,
+		Client:           "alice",
+		CreatedAt:        time.Now().Unix(),
+	}
+	if err := config.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := listIDs(t, serveAsClient("bob", HandleBatchesRequest, http.MethodGet, "/batches", nil, "")); len(ids) != 0 {
+		t.Errorf("other client lists batches %v", ids)
+	}
+	if ids := listIDs(t, serveAsClient("alice", HandleBatchesRequest, http.MethodGet, "/batches", nil, "")); len(ids) != 1 || ids[0] != batch.ID {
+		t.Errorf("owner lists batches %v, want [%s]", ids, batch.ID)
+	}
+	if w := serveAsClient("bob", HandleBatchesRequest, http.MethodGet, "/batches/"+batch.ID, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("other client get status = %d, want 404", w.Code)
+	}
+	if w := serveAsClient("bob", HandleBatchesRequest, http.MethodPost, "/batches/"+batch.ID+"/cancel", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("other client cancel status = %d, want 404", w.Code)
+	}
+	if w := serveAsClient("alice", HandleBatchesRequest, http.MethodGet, "/batches/"+batch.ID, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("owner get status = %d", w.Code)
+	}
+	// 已结束的任务不能取消
+	if w := serveAsClient("alice", HandleBatchesRequest, http.MethodPost, "/batches/"+batch.ID+"/cancel", nil, ""); w.Code != http.StatusConflict {
+		t.Errorf("owner cancel status = %d, want 409", w.Code)
+	}
+}
+
+func TestLoadBatchResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.jsonl")
+
+	done := make(map[string]bool)
+	if count, err := loadBatchResults(path, done); err != nil || count != 0 {
+		t.Errorf("missing file: count = %d, err = %v", count, err)
+	}
+
+	// 异常退出时最后一行只写入了一部分
+	content := `{"custom_id":"a","response":{}}` + "\n" + `{"custom_id":"b","response":{}}` + "\n" + `{"custom_id":"c","resp`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	count, err := loadBatchResults(path, done)
+	if err != nil {
+		t.Fatalf("loadBatchResults() error = %v", err)
+	}
+	if count != 2 || !done["a"] || !done["b"] || done["c"] {
+		t.Errorf("count = %d, done = %v, want a and b", count, done)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := `{"custom_id":"a","response":{}}` + "\n" + `{"custom_id":"b","response":{}}` + "\n"
+	if string(data) != want {
+		t.Errorf("rewritten file = %q, want %q", data, want)
+	}
+}
+
+func TestBatchSlots(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.ApiProxy.Batch.Concurrency = 2
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if !acquireBatchSlot(ctx) {
+			t.Fatal("acquireBatchSlot() = false")
+		}
+	}
+
+	// 槽位用完后其他任务的请求等待，任务取消时放弃等待
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if acquireBatchSlot(cancelled) {
+		t.Error("acquireBatchSlot() with cancelled context = true")
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- acquireBatchSlot(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot beyond the concurrency limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseBatchSlot()
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Error("waiting acquireBatchSlot() = false")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("released slot was not handed to the waiting request")
+	}
+	releaseBatchSlot()
+	releaseBatchSlot()
+}
@@ -0,0 +1,311 @@
+/**
+  @author: Hanhai
+  @desc: 按模型的熔断器，上游错误率过高时打开，打开期间直接失败或切换到备用模型，半开状态放行探测请求
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 关闭，正常放行请求
+	BreakerOpen     = "open"      // 打开，直接失败或切换到备用模型
+	BreakerHalfOpen = "half_open" // 半开，放行探测请求
+)
+
+// 请求结果对熔断器的影响
+const (
+	breakerSuccess = iota // 成功
+	breakerFailure        // 上游错误，计入错误率
+	breakerNeutral        // 请求本身的错误或客户端断开，不计入统计
+)
+
+// 统计窗口划分的时间段数
+const breakerBucketCount = 10
+
+// breakerBucket 统计窗口中一个时间段的请求数和失败数
+type breakerBucket struct {
+	slot     int64 // 时间段序号
+	requests int
+	failures int
+}
+
+// modelBreaker 一个模型的熔断器
+type modelBreaker struct {
+	state          string
+	buckets        [breakerBucketCount]breakerBucket
+	openedAt       time.Time
+	probes         int   // 正在进行的探测请求数
+	probeSuccesses int   // 本次半开状态中成功的探测请求数
+	trips          int64 // 启动以来打开的次数
+	rejected       int64 // 启动以来因熔断被拒绝的请求数
+}
+
+// breakerRegistry 保存所有模型的熔断器
+type breakerRegistry struct {
+	mu     sync.Mutex
+	models map[string]*modelBreaker
+}
+
+var modelBreakers = &breakerRegistry{models: make(map[string]*modelBreaker)}
+
+// bucketSlot 返回当前时间所在的时间段序号
+func bucketSlot(window time.Duration, now time.Time) int64 {
+	width := window / breakerBucketCount
+	if width <= 0 {
+		width = time.Second
+	}
+	return now.UnixNano() / int64(width)
+}
+
+// totals 返回统计窗口内的请求数和失败数
+func (b *modelBreaker) totals(slot int64) (int, int) {
+	requests, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if bucket.slot > slot-breakerBucketCount {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// trip 打开熔断器
+func (b *modelBreaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.probes = 0
+	b.probeSuccesses = 0
+	b.trips++
+}
+
+// reset 关闭熔断器并清空统计
+func (b *modelBreaker) reset() {
+	b.state = BreakerClosed
+	b.buckets = [breakerBucketCount]breakerBucket{}
+	b.probes = 0
+	b.probeSuccesses = 0
+}
+
+// allow 判断是否放行模型的请求，半开状态放行的请求为探测请求；不放行时返回建议的重试等待时间
+func (r *breakerRegistry) allow(modelName string, cfg config.CircuitBreakerConfig) (bool, bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.models[modelName]
+	if !ok || b.state == BreakerClosed {
+		return true, false, 0
+	}
+
+	now := time.Now()
+	if b.state == BreakerOpen {
+		if wait := cfg.GetOpenDuration() - now.Sub(b.openedAt); wait > 0 {
+			b.rejected++
+			return false, false, wait
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.probeSuccesses = 0
+		logger.Info("模型 %s 的熔断器进入半开状态，开始放行探测请求", modelName)
+	}
+
+	// 半开状态下正在进行和已成功的探测请求达到探测数后不再放行
+	if b.probes+b.probeSuccesses >= cfg.GetHalfOpenProbes() {
+		b.rejected++
+		return false, false, time.Second
+	}
+	b.probes++
+	return true, true, 0
+}
+
+// record 记录模型请求的结果，错误率达到阈值时打开熔断器，探测请求决定半开状态的熔断器关闭或重新打开
+func (r *breakerRegistry) record(modelName string, probe bool, outcome int, cfg config.CircuitBreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.models[modelName]
+	if !ok {
+		if outcome == breakerNeutral {
+			return
+		}
+		b = &modelBreaker{state: BreakerClosed}
+		r.models[modelName] = b
+	}
+
+	now := time.Now()
+	if probe && b.state == BreakerHalfOpen {
+		if b.probes > 0 {
+			b.probes--
+		}
+		switch outcome {
+		case breakerSuccess:
+			b.probeSuccesses++
+			if b.probeSuccesses >= cfg.GetHalfOpenProbes() {
+				b.reset()
+				logger.Info("模型 %s 的探测请求全部成功，关闭熔断器", modelName)
+			}
+		case breakerFailure:
+			b.trip(now)
+			logger.Warn("模型 %s 的探测请求失败，重新打开熔断器 %v", modelName, cfg.GetOpenDuration())
+		}
+		return
+	}
+	if outcome == breakerNeutral {
+		return
+	}
+
+	slot := bucketSlot(cfg.GetWindow(), now)
+	bucket := &b.buckets[slot%breakerBucketCount]
+	if bucket.slot != slot {
+		*bucket = breakerBucket{slot: slot}
+	}
+	bucket.requests++
+	if outcome == breakerFailure {
+		bucket.failures++
+	}
+
+	if b.state != BreakerClosed || outcome != breakerFailure {
+		return
+	}
+	requests, failures := b.totals(slot)
+	if requests >= cfg.GetMinRequests() && float64(failures)/float64(requests) >= cfg.GetErrorRate() {
+		b.trip(now)
+		logger.Warn("模型 %s 在 %v 内的 %d 个请求中失败 %d 个，打开熔断器 %v",
+			modelName, cfg.GetWindow(), requests, failures, cfg.GetOpenDuration())
+	}
+}
+
+// breakerOutcome 根据请求结果判断对熔断器的影响，只有上游错误计入错误率
+func breakerOutcome(c *gin.Context, status int, success bool) int {
+	if success {
+		return breakerSuccess
+	}
+	if c.Request.Context().Err() != nil {
+		return breakerNeutral
+	}
+	// 没有写入错误状态码说明请求在发送或读取阶段失败
+	if status < http.StatusBadRequest || status >= http.StatusInternalServerError ||
+		status == http.StatusTooManyRequests || status == http.StatusRequestTimeout {
+		return breakerFailure
+	}
+	return breakerNeutral
+}
+
+// breakerTicket 一次放行的请求，请求完成后记录结果
+type breakerTicket struct {
+	modelName string
+	probe     bool
+}
+
+// acquireBreaker 检查模型的熔断器，未启用熔断时始终放行
+func acquireBreaker(modelName string) (*breakerTicket, time.Duration, bool) {
+	cfg := config.GetConfig().ApiProxy.CircuitBreaker
+	if !cfg.Enabled || modelName == "" || modelName == "unknown" {
+		return nil, 0, true
+	}
+	allowed, probe, wait := modelBreakers.allow(modelName, cfg)
+	if !allowed {
+		return nil, wait, false
+	}
+	return &breakerTicket{modelName: modelName, probe: probe}, 0, true
+}
+
+// done 记录请求结果
+func (t *breakerTicket) done(c *gin.Context, status int, success bool) {
+	if t == nil {
+		return
+	}
+	modelBreakers.record(t.modelName, t.probe, breakerOutcome(c, status, success), config.GetConfig().ApiProxy.CircuitBreaker)
+}
+
+// writeBreakerOpenResponse 返回模型已熔断的错误
+func writeBreakerOpenResponse(c *gin.Context, modelName string, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": gin.H{
+			"message": fmt.Sprintf("模型 %s 的上游错误率过高，已暂时熔断，请在 %d 秒后重试", modelName, retryAfter),
+			"type":    "server_busy",
+			"param":   nil,
+			"code":    "circuit_open",
+		},
+	})
+}
+
+// ModelBreakerState 模型熔断器的状态
+type ModelBreakerState struct {
+	Model      string  `json:"model"`
+	State      string  `json:"state"`        // closed、open或half_open
+	Requests   int     `json:"requests"`     // 统计窗口内的请求数
+	Failures   int     `json:"failures"`     // 统计窗口内的失败数
+	ErrorRate  float64 `json:"error_rate"`   // 统计窗口内的错误率
+	OpenedAt   int64   `json:"opened_at"`    // 最近一次打开的时间（Unix秒）
+	HalfOpenAt int64   `json:"half_open_at"` // 打开状态下进入半开状态的时间（Unix秒）
+	Trips      int64   `json:"trips"`        // 启动以来打开的次数
+	Rejected   int64   `json:"rejected"`     // 启动以来因熔断被拒绝的请求数
+}
+
+// GetModelBreakerStates 获取所有有请求记录的模型的熔断器状态，按模型名排序
+func GetModelBreakerStates() []ModelBreakerState {
+	cfg := config.GetConfig().ApiProxy.CircuitBreaker
+
+	modelBreakers.mu.Lock()
+	defer modelBreakers.mu.Unlock()
+
+	now := time.Now()
+	slot := bucketSlot(cfg.GetWindow(), now)
+	states := make([]ModelBreakerState, 0, len(modelBreakers.models))
+	for modelName, b := range modelBreakers.models {
+		state := ModelBreakerState{
+			Model:    modelName,
+			State:    b.state,
+			Trips:    b.trips,
+			Rejected: b.rejected,
+		}
+		state.Requests, state.Failures = b.totals(slot)
+		if state.Requests > 0 {
+			state.ErrorRate = float64(state.Failures) / float64(state.Requests)
+		}
+		if b.trips > 0 {
+			state.OpenedAt = b.openedAt.Unix()
+		}
+		if b.state == BreakerOpen {
+			state.HalfOpenAt = b.openedAt.Add(cfg.GetOpenDuration()).Unix()
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Model < states[j].Model
+	})
+	return states
+}
+
+// ResetModelBreaker 手动关闭模型的熔断器并清空统计，模型没有熔断器时返回false
+func ResetModelBreaker(modelName string) bool {
+	modelBreakers.mu.Lock()
+	defer modelBreakers.mu.Unlock()
+
+	b, ok := modelBreakers.models[modelName]
+	if !ok {
+		return false
+	}
+	b.reset()
+	logger.Info("已手动关闭模型 %s 的熔断器", modelName)
+	return true
+}
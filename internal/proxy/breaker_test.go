@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBreakerOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		success  bool
+		canceled bool
+		want     int
+	}{
+		{"success", http.StatusOK, true, false, breakerSuccess},
+		{"no response", 0, false, false, breakerFailure},
+		{"server error", http.StatusInternalServerError, false, false, breakerFailure},
+		{"bad gateway", http.StatusBadGateway, false, false, breakerFailure},
+		{"rate limited", http.StatusTooManyRequests, false, false, breakerFailure},
+		{"request timeout", http.StatusRequestTimeout, false, false, breakerFailure},
+		{"bad request", http.StatusBadRequest, false, false, breakerNeutral},
+		{"unauthorized", http.StatusUnauthorized, false, false, breakerNeutral},
+		{"client disconnected", http.StatusBadGateway, false, true, breakerNeutral},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.canceled {
+				ctx, cancel := context.WithCancel(c.Request.Context())
+				cancel()
+				c.Request = c.Request.WithContext(ctx)
+			}
+			if got := breakerOutcome(c, tt.status, tt.success); got != tt.want {
+				t.Errorf("breakerOutcome(%d, %v) = %d, want %d", tt.status, tt.success, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerStateMachine(t *testing.T) {
+	const (
+		record = "record" // 记录一次非探测请求的结果
+		allow  = "allow"  // 检查是否放行
+		probe  = "probe"  // 记录一次探测请求的结果
+		expire = "expire" // 打开时间已过
+	)
+	type step struct {
+		action      string
+		outcome     int
+		wantAllowed bool
+		wantProbe   bool
+		wantState   string
+	}
+	cfg := config.CircuitBreakerConfig{Enabled: true, MinRequests: 4, ErrorRatePercent: 50, OpenSeconds: 30, HalfOpenProbes: 2}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below min requests",
+			steps: []step{
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: allow, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "stays closed below error rate",
+			steps: []step{
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "neutral outcomes are not counted",
+			steps: []step{
+				{action: record, outcome: breakerNeutral, wantState: ""},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: record, outcome: breakerNeutral, wantState: BreakerClosed},
+				{action: record, outcome: breakerNeutral, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "opens at error rate and rejects",
+			steps: []step{
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+				{action: record, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: record, outcome: breakerFailure, wantState: BreakerOpen},
+				{action: allow, wantAllowed: false, wantState: BreakerOpen},
+			},
+		},
+		{
+			name: "half open probes close the breaker",
+			steps: []step{
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure},
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure, wantState: BreakerOpen},
+				{action: expire, wantState: BreakerOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+				{action: allow, wantAllowed: false, wantState: BreakerHalfOpen},
+				{action: probe, outcome: breakerSuccess, wantState: BreakerHalfOpen},
+				{action: allow, wantAllowed: false, wantState: BreakerHalfOpen},
+				{action: probe, outcome: breakerSuccess, wantState: BreakerClosed},
+				{action: allow, wantAllowed: true, wantState: BreakerClosed},
+				// 关闭时清空统计，一次失败不会重新打开
+				{action: record, outcome: breakerFailure, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "failed probe reopens the breaker",
+			steps: []step{
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure},
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure, wantState: BreakerOpen},
+				{action: expire, wantState: BreakerOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+				{action: probe, outcome: breakerFailure, wantState: BreakerOpen},
+				{action: allow, wantAllowed: false, wantState: BreakerOpen},
+			},
+		},
+		{
+			name: "neutral probe frees its slot",
+			steps: []step{
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure},
+				{action: record, outcome: breakerFailure}, {action: record, outcome: breakerFailure, wantState: BreakerOpen},
+				{action: expire, wantState: BreakerOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+				{action: probe, outcome: breakerNeutral, wantState: BreakerHalfOpen},
+				{action: allow, wantAllowed: true, wantProbe: true, wantState: BreakerHalfOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &breakerRegistry{models: make(map[string]*modelBreaker)}
+			for i, s := range tt.steps {
+				switch s.action {
+				case record:
+					r.record("m", false, s.outcome, cfg)
+				case probe:
+					r.record("m", true, s.outcome, cfg)
+				case expire:
+					r.models["m"].openedAt = time.Now().Add(-cfg.GetOpenDuration())
+				case allow:
+					allowed, isProbe, wait := r.allow("m", cfg)
+					if allowed != s.wantAllowed || isProbe != s.wantProbe {
+						t.Fatalf("step %d: allow() = %v, probe %v, want %v, probe %v", i, allowed, isProbe, s.wantAllowed, s.wantProbe)
+					}
+					if !allowed && wait <= 0 {
+						t.Errorf("step %d: wait = %v, want > 0", i, wait)
+					}
+				}
+				if s.wantState == "" {
+					continue
+				}
+				if b := r.models["m"]; b == nil || b.state != s.wantState {
+					t.Fatalf("step %d (%s): state = %v, want %s", i, s.action, b, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireBreaker(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	// 默认不启用熔断，始终放行且不记录
+	setTestConfig(t, func(cfg *config.Config) {})
+	for i := 0; i < 20; i++ {
+		ticket, _, allowed := acquireBreaker("breaker-disabled")
+		if !allowed || ticket != nil {
+			t.Fatalf("acquireBreaker() with breaker disabled = %v, %v", ticket, allowed)
+		}
+		ticket.done(c, http.StatusBadGateway, false)
+	}
+	if ResetModelBreaker("breaker-disabled") {
+		t.Error("disabled breaker recorded requests")
+	}
+
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.ApiProxy.CircuitBreaker = config.CircuitBreakerConfig{Enabled: true, MinRequests: 2, OpenSeconds: 30}
+	})
+	for _, name := range []string{"", "unknown"} {
+		if ticket, _, allowed := acquireBreaker(name); !allowed || ticket != nil {
+			t.Errorf("acquireBreaker(%q) = %v, %v, want nil ticket", name, ticket, allowed)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		ticket, _, allowed := acquireBreaker("breaker-enabled")
+		if !allowed || ticket == nil {
+			t.Fatalf("acquireBreaker() = %v, %v before tripping", ticket, allowed)
+		}
+		ticket.done(c, http.StatusBadGateway, false)
+	}
+	ticket, wait, allowed := acquireBreaker("breaker-enabled")
+	if allowed || ticket != nil || wait <= 0 || wait > 30*time.Second {
+		t.Errorf("acquireBreaker() after tripping = %v, %v, %v", ticket, wait, allowed)
+	}
+
+	if !ResetModelBreaker("breaker-enabled") {
+		t.Fatal("ResetModelBreaker() = false")
+	}
+	if _, _, allowed := acquireBreaker("breaker-enabled"); !allowed {
+		t.Error("acquireBreaker() rejected after reset")
+	}
+}
@@ -0,0 +1,141 @@
+/**
+  @author: Hanhai
+  @desc: 响应缓存模块，缓存嵌入、重排序和temperature为0的非流式对话请求的响应
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CacheStatusHeader 响应头，返回响应缓存状态：HIT、MISS或BYPASS
+	CacheStatusHeader = "X-Cache"
+	// CacheBypassHeader 请求头，值为true时跳过响应缓存
+	CacheBypassHeader = "X-Cache-Bypass"
+)
+
+// responseCacheWriter 记录写入客户端的响应，请求完成后保存到缓存
+type responseCacheWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write 写入响应并记录
+func (w *responseCacheWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString 实现gin.ResponseWriter接口
+func (w *responseCacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// useResponseCache 对确定性请求使用响应缓存
+// 命中时直接返回缓存的响应并返回true；未命中时记录本次响应，调用返回的函数后写入缓存
+func useResponseCache(c *gin.Context, path string, modelName string, body []byte) (bool, func()) {
+	noop := func() {}
+	if !config.GetConfig().ApiProxy.Cache.Enabled {
+		return false, noop
+	}
+
+	cacheKey := responseCacheKey(path, modelName, body)
+	if cacheKey == "" {
+		return false, noop
+	}
+
+	rl := GetRequestLogger(c)
+	if cacheBypassed(c) {
+		config.RecordResponseCacheBypass()
+		c.Header(CacheStatusHeader, "BYPASS")
+		return false, noop
+	}
+
+	if cached, ok := config.GetCachedResponse(cacheKey); ok {
+		rl.Info("命中响应缓存: %s, 模型: %s", cacheKey[:16], modelName)
+		c.Header(CacheStatusHeader, "HIT")
+		c.Header(ServedModelHeader, modelName)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
+		return true, noop
+	}
+
+	c.Header(CacheStatusHeader, "MISS")
+	writer := &responseCacheWriter{ResponseWriter: c.Writer}
+	originalWriter := c.Writer
+	c.Writer = writer
+	return false, func() {
+		c.Writer = originalWriter
+
+		// 重试过程中可能写入多次响应，只缓存完整的JSON响应
+		if writer.Status() != http.StatusOK || !json.Valid(writer.body.Bytes()) {
+			return
+		}
+		// 由备用模型提供的响应不缓存到原模型下
+		if served := writer.Header().Get(ServedModelHeader); served != "" && served != modelName {
+			return
+		}
+		go config.SaveCachedResponse(cacheKey, path, modelName, writer.body.Bytes())
+	}
+}
+
+// cacheBypassed 判断客户端是否要求跳过响应缓存
+func cacheBypassed(c *gin.Context) bool {
+	switch strings.ToLower(c.GetHeader(CacheBypassHeader)) {
+	case "true", "1":
+		return true
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	return strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store")
+}
+
+// responseCacheKey 计算请求的缓存键，请求不可缓存时返回空字符串
+// 请求体解析后重新序列化，字段顺序和空白不同的相同请求得到相同的缓存键
+func responseCacheKey(path string, modelName string, body []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var requestData map[string]interface{}
+	if err := decoder.Decode(&requestData); err != nil {
+		return ""
+	}
+
+	path = strings.TrimPrefix(path, "/v1")
+	switch {
+	case strings.HasSuffix(path, "/embeddings"), strings.HasSuffix(path, "/rerank"):
+	case strings.HasSuffix(path, "/chat/completions"):
+		if !isDeterministicChat(requestData) {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	normalized, err := json.Marshal(requestData)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(path + "\n" + modelName + "\n" + string(normalized)))
+	return hex.EncodeToString(sum[:])
+}
+
+// isDeterministicChat 判断对话请求是否为temperature为0的非流式请求
+func isDeterministicChat(requestData map[string]interface{}) bool {
+	if stream, ok := requestData["stream"].(bool); ok && stream {
+		return false
+	}
+	temperature, ok := requestData["temperature"].(json.Number)
+	if !ok {
+		return false
+	}
+	value, err := temperature.Float64()
+	return err == nil && value == 0
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseCacheKeyCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want bool
+	}{
+		{"embeddings", "/v1/embeddings", `{"model":"BAAI/bge-m3","input":"hi"}`, true},
+		{"rerank without version", "/rerank", `{"model":"BAAI/bge-reranker-v2-m3","query":"q","documents":["a"]}`, true},
+		{"chat with temperature 0", "/v1/chat/completions", `{"model":"m","temperature":0,"messages":[]}`, true},
+		{"chat with temperature 0.0", "/v1/chat/completions", `{"model":"m","temperature":0.0,"messages":[]}`, true},
+		{"chat without temperature", "/v1/chat/completions", `{"model":"m","messages":[]}`, false},
+		{"chat with temperature", "/v1/chat/completions", `{"model":"m","temperature":0.7,"messages":[]}`, false},
+		{"streaming chat", "/v1/chat/completions", `{"model":"m","temperature":0,"stream":true,"messages":[]}`, false},
+		{"completions", "/v1/completions", `{"model":"m","temperature":0,"prompt":"hi"}`, false},
+		{"images", "/v1/images/generations", `{"model":"m","prompt":"cat"}`, false},
+		{"invalid JSON", "/v1/embeddings", `{"model":`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseCacheKey(tt.path, "m", []byte(tt.body)) != ""; got != tt.want {
+				t.Errorf("responseCacheKey(%s, %s) cacheable = %v, want %v", tt.path, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKeyNormalized(t *testing.T) {
+	key := responseCacheKey("/v1/embeddings", "BAAI/bge-m3", []byte(`{"model":"BAAI/bge-m3","input":["a","b"],"encoding_format":"float"}`))
+
+	// 字段顺序、空白和版本前缀不同的相同请求使用同一个缓存键
+	same := []struct{ path, body string }{
+		{"/v1/embeddings", `{"encoding_format":"float","input":["a","b"],"model":"BAAI/bge-m3"}`},
+		{"/v1/embeddings", "{\n  \"model\": \"BAAI/bge-m3\",\n  \"input\": [\"a\", \"b\"],\n  \"encoding_format\": \"float\"\n}"},
+		{"/embeddings", `{"model":"BAAI/bge-m3","input":["a","b"],"encoding_format":"float"}`},
+	}
+	for _, request := range same {
+		if got := responseCacheKey(request.path, "BAAI/bge-m3", []byte(request.body)); got != key {
+			t.Errorf("responseCacheKey(%s, %s) = %s, want %s", request.path, request.body, got, key)
+		}
+	}
+
+	// 请求内容、路径或实际模型不同时缓存键不同
+	different := []struct{ path, model, body string }{
+		{"/v1/embeddings", "BAAI/bge-m3", `{"model":"BAAI/bge-m3","input":["b","a"],"encoding_format":"float"}`},
+		{"/v1/rerank", "BAAI/bge-m3", `{"model":"BAAI/bge-m3","input":["a","b"],"encoding_format":"float"}`},
+		{"/v1/embeddings", "BAAI/bge-large-zh-v1.5", `{"model":"BAAI/bge-m3","input":["a","b"],"encoding_format":"float"}`},
+	}
+	for _, request := range different {
+		if got := responseCacheKey(request.path, request.model, []byte(request.body)); got == key {
+			t.Errorf("responseCacheKey(%s, %s, %s) matches the original request", request.path, request.model, request.body)
+		}
+	}
+
+	// 大整数保持原样，不会因为转换为浮点数而与相邻的数值冲突
+	first := responseCacheKey("/v1/chat/completions", "m", []byte(`{"temperature":0,"seed":9007199254740993}`))
+	second := responseCacheKey("/v1/chat/completions", "m", []byte(`{"temperature":0,"seed":9007199254740992}`))
+	if first == "" || first == second {
+		t.Error("seeds that differ beyond float64 precision share a cache key")
+	}
+}
+
+func TestCacheBypassed(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   bool
+	}{
+		{"no header", "", "", false},
+		{"bypass header", CacheBypassHeader, "true", true},
+		{"bypass header 1", CacheBypassHeader, "1", true},
+		{"bypass header false", CacheBypassHeader, "false", false},
+		{"no-cache", "Cache-Control", "no-cache", true},
+		{"no-store", "Cache-Control", "private, no-store", true},
+		{"max-age", "Cache-Control", "max-age=60", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+			if tt.header != "" {
+				c.Request.Header.Set(tt.header, tt.value)
+			}
+			if got := cacheBypassed(c); got != tt.want {
+				t.Errorf("cacheBypassed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
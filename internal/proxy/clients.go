@@ -0,0 +1,32 @@
+/**
+  @author: Hanhai
+  @desc: 客户端用量统计，按客户端记录每日请求、令牌和按模型价格计算的消费
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordClientUsage 记录发起请求的客户端的用量，用于速率限制核算、客户端统计和客户端密钥的消费金额
+// 统计按客户端名称记录，消费金额按客户端密钥ID累加
+func recordClientUsage(c *gin.Context, modelName string, promptTokens, completionTokens int, success bool) {
+	recordRateLimitUsage(c, promptTokens+completionTokens)
+
+	client := middleware.GetClient(c)
+	if client.Name == "" {
+		return
+	}
+
+	inputPrice, outputPrice := model.GetModelPrice(modelName)
+	cost := (float64(promptTokens)*inputPrice + float64(completionTokens)*outputPrice) / 1000000
+	config.AddDailyClientStat(client.Name, modelName, promptTokens, completionTokens, cost, success)
+	if clientKey, ok := middleware.GetClientKey(client.ID); ok {
+		config.AddClientKeySpent(clientKey.ID, cost)
+	}
+}
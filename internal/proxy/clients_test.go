@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restrictedClient 创建只能使用Qwen模型的客户端密钥，default别名和gpt-4o别名指向不允许的模型
+func restrictedClient(t *testing.T) middleware.Client {
+	t.Helper()
+	key := &config.ClientKey{Name: "qwen-only", Enabled: true, AllowedModels: []string{"Qwen/*"}}
+	if err := config.SaveClientKey(key); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.DeleteClientKey(key.ID) })
+	for alias, target := range map[string]string{
+		model.DefaultAlias: "deepseek-ai/DeepSeek-V3",
+		"gpt-4o":           "deepseek-ai/DeepSeek-V3",
+		"qwen":             "Qwen/Qwen2.5-7B-Instruct",
+	} {
+		if err := model.SaveModelAlias(alias, target, key.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return middleware.Client{ID: strconv.FormatInt(key.ID, 10), Name: key.Name}
+}
+
+func TestHandleOpenAIProxyClientModel(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {})
+	client := restrictedClient(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"default alias outside allowed models", `{"messages":[{"role":"user","content":"hi"}]}`},
+		{"alias outside allowed models", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`},
+		{"model outside allowed models", `{"model":"deepseek-ai/DeepSeek-V3","messages":[{"role":"user","content":"hi"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(tt.body))
+			c.Params = gin.Params{{Key: "path", Value: "/chat/completions"}}
+			middleware.SetClient(c, client)
+
+			HandleOpenAIProxy(c)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403, body = %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Error.Code != "model_not_allowed" {
+				t.Errorf("error code = %q, want model_not_allowed", resp.Error.Code)
+			}
+		})
+	}
+}
+
+func TestClientFallbacks(t *testing.T) {
+	client := restrictedClient(t)
+	fallbacks := []string{"deepseek-ai/DeepSeek-V3", "Qwen/Qwen2.5-72B-Instruct", "THUDM/glm-4-9b-chat", "Qwen/Qwen2.5-7B-Instruct"}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	middleware.SetClient(c, client)
+	want := []string{"Qwen/Qwen2.5-72B-Instruct", "Qwen/Qwen2.5-7B-Instruct"}
+	if got := clientFallbacks(c, fallbacks); !reflect.DeepEqual(got, want) {
+		t.Errorf("clientFallbacks() = %v, want %v", got, want)
+	}
+
+	// 共享密钥不限制模型
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	middleware.SetClient(c, middleware.ClientForID(config.DefaultClientName))
+	if got := clientFallbacks(c, fallbacks); !reflect.DeepEqual(got, fallbacks) {
+		t.Errorf("shared key clientFallbacks() = %v, want %v", got, fallbacks)
+	}
+}
+
+func TestBatchLineModelAllowed(t *testing.T) {
+	client := restrictedClient(t)
+	tests := []struct {
+		name string
+		line batchLine
+		want bool
+	}{
+		{"allowed model", batchLine{URL: "/v1/chat/completions", Body: json.RawMessage(`{"model":"Qwen/Qwen2.5-7B-Instruct"}`)}, true},
+		{"alias to allowed model", batchLine{URL: "/v1/chat/completions", Body: json.RawMessage(`{"model":"qwen"}`)}, true},
+		{"alias outside allowed models", batchLine{URL: "/v1/chat/completions", Body: json.RawMessage(`{"model":"gpt-4o"}`)}, false},
+		{"default alias outside allowed models", batchLine{URL: "/v1/chat/completions", Body: json.RawMessage(`{}`)}, false},
+		{"model outside allowed models", batchLine{URL: "/v1/embeddings", Body: json.RawMessage(`{"model":"BAAI/bge-m3"}`)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchLineModelAllowed(client, tt.line); got != tt.want {
+				t.Errorf("batchLineModelAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,12 @@
 
 package proxy
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
 
 // ApiError 定义API错误类型
 type ApiError struct {
@@ -17,3 +22,37 @@ type ApiError struct {
 func (e *ApiError) Error() string {
 	return fmt.Sprintf("%s (code: %d)", e.Message, e.Code)
 }
+
+// 上游返回的上下文长度超限错误中常见的内容
+var contextLengthKeywords = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"maximum context",
+	"max_seq_len",
+	"max_model_len",
+	"max_total_tokens",
+	"`max_new_tokens` must be",
+	"prompt is too long",
+	"input is too long",
+	"上下文长度",
+	"超出最大长度",
+}
+
+// errContextLengthExceeded 请求超出模型上下文长度，换用其他密钥重试也不会成功
+var errContextLengthExceeded = errors.New("请求超出模型上下文长度")
+
+// isContextLengthError 判断上游错误是否为请求超出模型上下文长度
+// 只有400和413响应才判断，速率限制等其他错误中也可能出现令牌数相关的描述
+func isContextLengthError(status int, message string) bool {
+	if status != http.StatusBadRequest && status != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	message = strings.ToLower(message)
+	for _, keyword := range contextLengthKeywords {
+		if strings.Contains(message, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
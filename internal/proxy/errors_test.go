@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsContextLengthError(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		want    bool
+	}{
+		{http.StatusBadRequest, "This model's maximum context length is 32768 tokens", true},
+		{http.StatusBadRequest, `{"code":"context_length_exceeded"}`, true},
+		{http.StatusRequestEntityTooLarge, "Prompt is too long", true},
+		{http.StatusBadRequest, "输入超出最大长度", true},
+		{http.StatusBadRequest, "Invalid parameter: temperature", false},
+		{http.StatusBadRequest, "too many tokens", false},
+		{http.StatusTooManyRequests, "Too many tokens per minute, context length limit", false},
+		{http.StatusInternalServerError, "maximum context length exceeded", false},
+	}
+	for _, tt := range tests {
+		if got := isContextLengthError(tt.status, tt.message); got != tt.want {
+			t.Errorf("isContextLengthError(%d, %q) = %v, want %v", tt.status, tt.message, got, tt.want)
+		}
+	}
+}
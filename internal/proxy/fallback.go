@@ -0,0 +1,286 @@
+/**
+  @author: Hanhai
+  @desc: 备用模型切换模块，模型繁忙、超时或返回指定状态码时按模型配置的备用链切换模型
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServedModelHeader 响应头，返回实际提供服务的模型
+const ServedModelHeader = "X-Served-Model"
+
+// fallbackWriter 暂存错误响应，确定不切换备用模型后才写入客户端
+// 成功的响应（包括流式响应）在第一次写入时直接提交，不做缓存
+type fallbackWriter struct {
+	gin.ResponseWriter
+	servedModel string
+	status      int
+	held        bytes.Buffer
+	committed   bool
+}
+
+// statusCode 返回当前记录的状态码，未设置时为200
+func (w *fallbackWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// commit 开始向客户端写入响应，之前暂存的错误响应会被丢弃
+func (w *fallbackWriter) commit() {
+	w.committed = true
+	w.held.Reset()
+	if w.servedModel != "" {
+		w.ResponseWriter.Header().Set(ServedModelHeader, w.servedModel)
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode())
+}
+
+func (w *fallbackWriter) WriteHeader(code int) {
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *fallbackWriter) WriteHeaderNow() {
+	if !w.committed && w.statusCode() < http.StatusBadRequest {
+		w.commit()
+	}
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Write 成功的响应直接写入，错误响应暂存
+func (w *fallbackWriter) Write(data []byte) (int, error) {
+	if !w.committed {
+		if w.statusCode() >= http.StatusBadRequest {
+			return w.held.Write(data)
+		}
+		w.commit()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *fallbackWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *fallbackWriter) Status() int {
+	if w.committed {
+		return w.ResponseWriter.Status()
+	}
+	return w.statusCode()
+}
+
+func (w *fallbackWriter) Size() int {
+	if w.committed {
+		return w.ResponseWriter.Size()
+	}
+	if w.held.Len() == 0 {
+		return -1
+	}
+	return w.held.Len()
+}
+
+func (w *fallbackWriter) Written() bool {
+	return w.committed || w.held.Len() > 0
+}
+
+func (w *fallbackWriter) Flush() {
+	if w.committed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// reset 丢弃暂存的错误响应，准备使用下一个模型重试
+func (w *fallbackWriter) reset(servedModel string) {
+	w.servedModel = servedModel
+	w.status = 0
+	w.held.Reset()
+}
+
+// finish 将暂存的错误响应写入客户端
+func (w *fallbackWriter) finish() {
+	if w.committed || (w.status == 0 && w.held.Len() == 0) {
+		return
+	}
+	held := append([]byte(nil), w.held.Bytes()...)
+	w.commit()
+	w.ResponseWriter.Write(held)
+}
+
+// shouldFallback 根据暂存的错误响应判断是否需要切换备用模型
+func (w *fallbackWriter) shouldFallback() bool {
+	if w.committed {
+		return false
+	}
+
+	fallbackConfig := config.GetConfig().ApiProxy.Fallback
+
+	// 没有写入任何响应说明请求在发送阶段失败（网络错误或超时）
+	if w.status == 0 && w.held.Len() == 0 {
+		return fallbackConfig.OnTimeout
+	}
+
+	status := w.statusCode()
+	if status < http.StatusBadRequest {
+		return false
+	}
+	if fallbackConfig.OnTimeout && (status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout) {
+		return true
+	}
+
+	for _, code := range fallbackConfig.GetStatusCodes() {
+		if status == code {
+			return true
+		}
+	}
+
+	body := strings.ToLower(w.held.String())
+	for _, keyword := range fallbackConfig.GetBusyKeywords() {
+		if keyword != "" && strings.Contains(body, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientFallbacks 去掉客户端密钥无权使用的备用模型
+func clientFallbacks(c *gin.Context, fallbacks []string) []string {
+	clientID := middleware.GetClientID(c)
+	allowed := make([]string, 0, len(fallbacks))
+	for _, fallback := range fallbacks {
+		if !middleware.ClientAllowsModel(clientID, fallback) {
+			GetRequestLogger(c).Warn("客户端无权使用备用模型 %s，跳过", fallback)
+			continue
+		}
+		allowed = append(allowed, fallback)
+	}
+	return allowed
+}
+
+// processOpenAIRequestWithFallback 处理OpenAI格式请求，失败时按模型的备用链切换模型
+func processOpenAIRequestWithFallback(c *gin.Context, targetURL string, transformedBody []byte, originalBody []byte, requestType string, modelName string, tokenEstimate int, path string) bool {
+	rl := GetRequestLogger(c)
+
+	var fallbacks []string
+	if modelName != "" {
+		var err error
+		if fallbacks, err = model.GetModelFallbacks(modelName); err != nil {
+			rl.Warn("获取模型 %s 的备用链失败: %v", modelName, err)
+		}
+		fallbacks = clientFallbacks(c, fallbacks)
+	}
+	if len(fallbacks) == 0 {
+		c.Header(ServedModelHeader, modelName)
+		ticket, wait, allowed := acquireBreaker(modelName)
+		if !allowed {
+			rl.Warn("模型 %s 的熔断器已打开，直接返回错误", modelName)
+			writeBreakerOpenResponse(c, modelName, wait)
+			return false
+		}
+		success := processOpenAIRequestWithRetry(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, path)
+		ticket.done(c, c.Writer.Status(), success)
+		return success
+	}
+
+	writer := &fallbackWriter{ResponseWriter: c.Writer}
+	originalWriter := c.Writer
+	c.Writer = writer
+	defer func() {
+		c.Writer = originalWriter
+	}()
+
+	// 目标URL去掉提供商地址后的部分，切换模型时拼接到备用模型的提供商地址上
+	urlSuffix := strings.TrimPrefix(targetURL, provider.ForModel(modelName).BaseURL())
+
+	chain := append([]string{modelName}, fallbacks...)
+	// 最后一个发送了请求的模型，熔断的模型不发送请求
+	lastModel := ""
+	var breakerWait time.Duration
+	for i, servedModel := range chain {
+		body := transformedBody
+		url := targetURL
+		if i > 0 {
+			if isModelDisabled(servedModel) {
+				rl.Warn("备用模型 %s 已被禁用，跳过", servedModel)
+				continue
+			}
+		}
+
+		ticket, wait, allowed := acquireBreaker(servedModel)
+		if !allowed {
+			rl.Warn("模型 %s 的熔断器已打开，跳过", servedModel)
+			if breakerWait == 0 || wait < breakerWait {
+				breakerWait = wait
+			}
+			continue
+		}
+
+		if i > 0 {
+			var err error
+			if body, err = replaceRequestModel(transformedBody, servedModel); err != nil {
+				rl.Error("替换请求模型失败: %v", err)
+				ticket.done(c, http.StatusBadRequest, false)
+				break
+			}
+			url = provider.ForModel(servedModel).BaseURL() + urlSuffix
+			if lastModel != "" {
+				rl.Warn("模型 %s 请求失败（状态码: %d），切换到备用模型 %s", lastModel, writer.status, servedModel)
+			} else {
+				rl.Warn("模型 %s 已熔断，切换到备用模型 %s", modelName, servedModel)
+			}
+		}
+
+		writer.reset(servedModel)
+		lastModel = servedModel
+		success := processOpenAIRequestWithRetry(c, url, body, originalBody, requestType, servedModel, tokenEstimate, path)
+		ticket.done(c, writer.Status(), success)
+
+		if writer.committed {
+			if i > 0 && success {
+				config.AddDailyFallbackStat(servedModel)
+			}
+			return success
+		}
+		if !writer.shouldFallback() {
+			break
+		}
+	}
+
+	// 备用链中的模型全部熔断或被禁用，没有发送请求
+	if lastModel == "" {
+		writeBreakerOpenResponse(c, modelName, breakerWait)
+	}
+	writer.finish()
+	return false
+}
+
+// replaceRequestModel 替换请求体中的模型名
+func replaceRequestModel(body []byte, modelName string) ([]byte, error) {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, err
+	}
+	requestData["model"] = modelName
+	return json.Marshal(requestData)
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestFallbackWriter 创建写入到httptest.ResponseRecorder的fallbackWriter
+func newTestFallbackWriter() (*fallbackWriter, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	return &fallbackWriter{ResponseWriter: c.Writer}, recorder
+}
+
+func TestFallbackWriterShouldFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		onTimeout bool
+		status    int
+		body      string
+		want      bool
+	}{
+		{"configured status code", false, http.StatusServiceUnavailable, `{"error":"unavailable"}`, true},
+		{"unconfigured status code", false, http.StatusBadRequest, `{"error":"bad request"}`, false},
+		{"busy keyword in body", false, http.StatusInternalServerError, `{"error":"Model Is BUSY, retry later"}`, true},
+		{"gateway timeout with on_timeout", true, http.StatusGatewayTimeout, ``, true},
+		{"gateway timeout without on_timeout", false, http.StatusGatewayTimeout, ``, false},
+		{"no response with on_timeout", true, 0, ``, true},
+		{"no response without on_timeout", false, 0, ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *config.Config) {
+				cfg.ApiProxy.Fallback = config.FallbackConfig{
+					StatusCodes:  []int{http.StatusServiceUnavailable},
+					OnTimeout:    tt.onTimeout,
+					BusyKeywords: []string{"busy"},
+				}
+			})
+
+			w, recorder := newTestFallbackWriter()
+			if tt.status != 0 {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}
+			if got := w.shouldFallback(); got != tt.want {
+				t.Errorf("shouldFallback() = %v, want %v", got, tt.want)
+			}
+			if recorder.Body.Len() != 0 {
+				t.Errorf("error response written before finish: %q", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestFallbackWriterCommit(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   []int // 每次尝试的状态码
+		wantStatus int
+		wantBody   string
+		wantModel  string
+	}{
+		{"first model succeeds", []int{200}, 200, "ok-0", "m0"},
+		{"fallback model succeeds", []int{503, 200}, 200, "ok-1", "m1"},
+		{"all models fail", []int{503, 502}, 502, "err-1", "m1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, recorder := newTestFallbackWriter()
+			for i, status := range tt.attempts {
+				w.reset(fmt.Sprintf("m%d", i))
+				w.WriteHeader(status)
+				if status < http.StatusBadRequest {
+					fmt.Fprintf(w, "ok-%d", i)
+					break
+				}
+				fmt.Fprintf(w, "err-%d", i)
+				if !w.Written() || w.Status() != status {
+					t.Fatalf("held response: Written() = %v, Status() = %d", w.Written(), w.Status())
+				}
+			}
+			w.finish()
+
+			if recorder.Code != tt.wantStatus || recorder.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", recorder.Code, recorder.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if got := recorder.Header().Get(ServedModelHeader); got != tt.wantModel {
+				t.Errorf("%s = %q, want %q", ServedModelHeader, got, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestFallbackWriterCommittedStream(t *testing.T) {
+	w, recorder := newTestFallbackWriter()
+	w.reset("m0")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeaderNow()
+	w.Write([]byte("data: {}\n\n"))
+
+	// 已经开始输出流式响应后不能再切换模型
+	if w.shouldFallback() {
+		t.Error("shouldFallback() = true after the response was committed")
+	}
+	w.finish()
+	if recorder.Body.String() != "data: {}\n\n" {
+		t.Errorf("body = %q", recorder.Body.String())
+	}
+}
+
+func TestReplaceRequestModel(t *testing.T) {
+	got, err := replaceRequestModel([]byte(`{"model":"a","stream":true}`), "b")
+	if err != nil {
+		t.Fatalf("replaceRequestModel() error = %v", err)
+	}
+	assertJSONEqual(t, got, `{"model":"b","stream":true}`)
+
+	if _, err := replaceRequestModel([]byte(`not json`), "b"); err == nil {
+		t.Error("replaceRequestModel(invalid) error = nil, want error")
+	}
+}
@@ -0,0 +1,197 @@
+/**
+  @author: Hanhai
+  @desc: Files API本地实现，保存批量任务的输入文件和结果文件
+**/
+
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量任务结果文件的用途
+const (
+	filePurposeBatch       = "batch"
+	filePurposeBatchOutput = "batch_output"
+)
+
+// newLocalID 生成带前缀的本地对象ID
+func newLocalID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// batchFilesDir 返回文件保存目录
+func batchFilesDir() string {
+	return resolveDataDir(config.GetConfig().ApiProxy.Batch.GetFilesDir())
+}
+
+// fileObject 返回OpenAI格式的文件对象
+func fileObject(file *config.StoredFile) gin.H {
+	return gin.H{
+		"id":         file.ID,
+		"object":     "file",
+		"bytes":      file.Bytes,
+		"created_at": file.CreatedAt,
+		"filename":   file.Filename,
+		"purpose":    file.Purpose,
+	}
+}
+
+// HandleFilesRequest 处理/v1/files请求
+func HandleFilesRequest(c *gin.Context) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(c.Param("path"), "/files"), "/"), "/")
+	fileID := parts[0]
+
+	switch {
+	case fileID == "" && c.Request.Method == http.MethodPost:
+		handleUploadFile(c)
+	case fileID == "" && c.Request.Method == http.MethodGet:
+		handleListFiles(c)
+	case len(parts) == 1 && c.Request.Method == http.MethodGet:
+		handleGetFile(c, fileID)
+	case len(parts) == 1 && c.Request.Method == http.MethodDelete:
+		handleDeleteFile(c, fileID)
+	case len(parts) == 2 && parts[1] == "content" && c.Request.Method == http.MethodGet:
+		handleGetFileContent(c, fileID)
+	default:
+		localAPIError(c, http.StatusNotFound, "unknown files endpoint")
+	}
+}
+
+// localAPIError 返回OpenAI格式的错误
+func localAPIError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    status,
+		},
+	})
+}
+
+// handleUploadFile 上传文件，文件内容保存到本地目录
+func handleUploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		localAPIError(c, http.StatusBadRequest, "purpose field is required")
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		localAPIError(c, http.StatusBadRequest, "file field is required")
+		return
+	}
+	if purpose == filePurposeBatch && !strings.HasSuffix(strings.ToLower(header.Filename), ".jsonl") {
+		localAPIError(c, http.StatusBadRequest, "batch input file must be a .jsonl file")
+		return
+	}
+
+	dir := batchFilesDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create files directory: %v", err))
+		return
+	}
+
+	file := &config.StoredFile{
+		ID:        newLocalID("file-"),
+		Filename:  filepath.Base(header.Filename),
+		Purpose:   purpose,
+		Bytes:     header.Size,
+		Client:    middleware.GetClientID(c),
+		CreatedAt: time.Now().Unix(),
+	}
+	file.Path = filepath.Join(dir, file.ID+".jsonl")
+	if err := c.SaveUploadedFile(header, file.Path); err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to save file: %v", err))
+		return
+	}
+	if err := config.SaveStoredFile(file); err != nil {
+		os.Remove(file.Path)
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to save file: %v", err))
+		return
+	}
+
+	GetRequestLogger(c).Info("已保存上传文件: %s (%s, %d字节)", file.ID, file.Filename, file.Bytes)
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+// handleListFiles 列出当前客户端的文件
+func handleListFiles(c *gin.Context) {
+	files, err := config.ListStoredFiles(middleware.GetClientID(c), c.Query("purpose"))
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list files: %v", err))
+		return
+	}
+
+	data := make([]gin.H, 0, len(files))
+	for i := range files {
+		data = append(data, fileObject(&files[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// loadStoredFile 获取文件记录，不存在或不属于当前客户端时返回404
+func loadStoredFile(c *gin.Context, fileID string) *config.StoredFile {
+	file, err := config.GetStoredFile(fileID)
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to load file: %v", err))
+		return nil
+	}
+	if file == nil || file.Client != middleware.GetClientID(c) {
+		localAPIError(c, http.StatusNotFound, fmt.Sprintf("No such file: %s", fileID))
+		return nil
+	}
+	return file
+}
+
+// handleGetFile 获取文件信息
+func handleGetFile(c *gin.Context, fileID string) {
+	if file := loadStoredFile(c, fileID); file != nil {
+		c.JSON(http.StatusOK, fileObject(file))
+	}
+}
+
+// handleGetFileContent 获取文件内容
+func handleGetFileContent(c *gin.Context, fileID string) {
+	if file := loadStoredFile(c, fileID); file != nil {
+		c.Header("Content-Type", "application/jsonl")
+		c.File(file.Path)
+	}
+}
+
+// handleDeleteFile 删除文件
+func handleDeleteFile(c *gin.Context, fileID string) {
+	file := loadStoredFile(c, fileID)
+	if file == nil {
+		return
+	}
+	if _, err := config.DeleteStoredFile(fileID); err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete file: %v", err))
+		return
+	}
+	if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+		GetRequestLogger(c).Warn("删除文件 %s 失败: %v", file.Path, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      fileID,
+		"object":  "file",
+		"deleted": true,
+	})
+}
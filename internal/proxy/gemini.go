@@ -0,0 +1,562 @@
+/**
+  @author: Hanhai
+  @desc: Gemini API兼容模块，将generateContent/streamGenerateContent请求转换为OpenAI格式处理，并将响应转换回Gemini格式
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGeminiRequest 处理Gemini格式的 /v1beta/models/{model}:{action} 请求
+func HandleGeminiRequest(c *gin.Context) {
+	rl := GetRequestLogger(c)
+
+	// 模型名称可能包含斜杠，例如 Qwen/Qwen2.5-7B-Instruct:generateContent
+	target := strings.TrimPrefix(c.Param("action"), "/")
+	sep := strings.LastIndex(target, ":")
+	if sep <= 0 {
+		writeGeminiError(c, http.StatusNotFound, fmt.Sprintf("Unsupported path: %s", c.Request.URL.Path))
+		return
+	}
+	modelName, action := target[:sep], target[sep+1:]
+
+	var stream bool
+	switch action {
+	case "generateContent":
+		stream = false
+	case "streamGenerateContent":
+		stream = true
+	default:
+		writeGeminiError(c, http.StatusNotFound, fmt.Sprintf("Unsupported action: %s", action))
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeGeminiError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+
+	chatRequest, err := convertGeminiRequest(bodyBytes, modelName, stream)
+	if err != nil {
+		writeGeminiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chatBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		writeGeminiError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to build request body: %v", err))
+		return
+	}
+
+	rl.SetModel(modelName)
+	rl.Info("检测到Gemini %s请求，转换为OpenAI格式处理，模型: %s", action, modelName)
+
+	// 不带alt=sse时，流式响应是逐步输出的JSON数组
+	sse := c.Query("alt") == "sse"
+	serveWithAdapter(c, newGeminiAdapter(modelName, sse), "/chat/completions", chatBody)
+}
+
+// geminiStatus 根据HTTP状态码返回Gemini错误状态
+func geminiStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+// geminiError 构建Gemini格式的错误
+func geminiError(status int, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"status":  geminiStatus(status),
+		},
+	}
+}
+
+// writeGeminiError 以Gemini格式返回错误
+func writeGeminiError(c *gin.Context, status int, message string) {
+	c.JSON(status, geminiError(status, message))
+}
+
+// convertGeminiRequest 将Gemini请求转换为OpenAI chat/completions请求
+func convertGeminiRequest(body []byte, modelName string, stream bool) (map[string]interface{}, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("Invalid JSON payload received")
+	}
+
+	contents, ok := request["contents"].([]interface{})
+	if !ok || len(contents) == 0 {
+		return nil, fmt.Errorf("contents is not specified")
+	}
+
+	messages := make([]interface{}, 0, len(contents)+1)
+	if system, ok := request["systemInstruction"].(map[string]interface{}); ok {
+		if text := geminiPartsText(system["parts"]); text != "" {
+			messages = append(messages, map[string]interface{}{"role": "system", "content": text})
+		}
+	}
+
+	// Gemini的函数调用没有ID，按函数名生成并在functionResponse中配对
+	pendingCalls := make(map[string][]string)
+	callCount := 0
+
+	for _, raw := range contents {
+		content, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := content["role"].(string)
+		parts, _ := content["parts"].([]interface{})
+
+		texts := make([]string, 0, len(parts))
+		chatParts := make([]interface{}, 0, len(parts))
+		toolCalls := make([]interface{}, 0)
+		hasImage := false
+
+		for _, p := range parts {
+			part, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if thought, ok := part["thought"].(bool); ok && thought {
+				continue
+			}
+			if text, ok := part["text"].(string); ok {
+				texts = append(texts, text)
+				chatParts = append(chatParts, map[string]interface{}{"type": "text", "text": text})
+			}
+			if inline, ok := part["inlineData"].(map[string]interface{}); ok {
+				hasImage = true
+				chatParts = append(chatParts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": fmt.Sprintf("data:%v;base64,%v", inline["mimeType"], inline["data"])},
+				})
+			}
+			if fileData, ok := part["fileData"].(map[string]interface{}); ok {
+				hasImage = true
+				chatParts = append(chatParts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": fileData["fileUri"]},
+				})
+			}
+			if call, ok := part["functionCall"].(map[string]interface{}); ok {
+				name, _ := call["name"].(string)
+				args, _ := json.Marshal(call["args"])
+				id := fmt.Sprintf("call_%d", callCount)
+				callCount++
+				pendingCalls[name] = append(pendingCalls[name], id)
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   id,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      name,
+						"arguments": string(args),
+					},
+				})
+			}
+			if result, ok := part["functionResponse"].(map[string]interface{}); ok {
+				name, _ := result["name"].(string)
+				id := fmt.Sprintf("call_%s", name)
+				if ids := pendingCalls[name]; len(ids) > 0 {
+					id = ids[0]
+					pendingCalls[name] = ids[1:]
+				}
+				output, _ := json.Marshal(result["response"])
+				messages = append(messages, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": id,
+					"content":      string(output),
+				})
+			}
+		}
+
+		if role == "model" {
+			if len(texts) == 0 && len(toolCalls) == 0 {
+				continue
+			}
+			message := map[string]interface{}{
+				"role":    "assistant",
+				"content": strings.Join(texts, ""),
+			}
+			if len(toolCalls) > 0 {
+				message["tool_calls"] = toolCalls
+			}
+			messages = append(messages, message)
+			continue
+		}
+
+		if len(chatParts) == 0 {
+			continue
+		}
+		if hasImage {
+			messages = append(messages, map[string]interface{}{"role": "user", "content": chatParts})
+		} else {
+			messages = append(messages, map[string]interface{}{"role": "user", "content": strings.Join(texts, "\n")})
+		}
+	}
+
+	chatRequest := map[string]interface{}{
+		"model":    modelName,
+		"messages": messages,
+		"stream":   stream,
+	}
+	if stream {
+		chatRequest["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	if genConfig, ok := request["generationConfig"].(map[string]interface{}); ok {
+		fields := map[string]string{
+			"temperature":      "temperature",
+			"topP":             "top_p",
+			"topK":             "top_k",
+			"maxOutputTokens":  "max_tokens",
+			"stopSequences":    "stop",
+			"candidateCount":   "n",
+			"presencePenalty":  "presence_penalty",
+			"frequencyPenalty": "frequency_penalty",
+			"seed":             "seed",
+		}
+		for from, to := range fields {
+			if value, ok := genConfig[from]; ok {
+				chatRequest[to] = value
+			}
+		}
+		if mimeType, ok := genConfig["responseMimeType"].(string); ok && mimeType == "application/json" {
+			if schema, ok := genConfig["responseSchema"]; ok {
+				chatRequest["response_format"] = map[string]interface{}{
+					"type":        "json_schema",
+					"json_schema": map[string]interface{}{"name": "response", "schema": schema},
+				}
+			} else {
+				chatRequest["response_format"] = map[string]interface{}{"type": "json_object"}
+			}
+		}
+	}
+
+	if tools, ok := request["tools"].([]interface{}); ok {
+		chatTools := make([]interface{}, 0)
+		for _, raw := range tools {
+			tool, _ := raw.(map[string]interface{})
+			declarations, _ := tool["functionDeclarations"].([]interface{})
+			for _, d := range declarations {
+				declaration, ok := d.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				function := map[string]interface{}{"name": declaration["name"]}
+				if desc, ok := declaration["description"]; ok {
+					function["description"] = desc
+				}
+				if params, ok := declaration["parameters"]; ok {
+					function["parameters"] = params
+				}
+				chatTools = append(chatTools, map[string]interface{}{"type": "function", "function": function})
+			}
+		}
+		if len(chatTools) > 0 {
+			chatRequest["tools"] = chatTools
+		}
+	}
+
+	if toolConfig, ok := request["toolConfig"].(map[string]interface{}); ok {
+		if callingConfig, ok := toolConfig["functionCallingConfig"].(map[string]interface{}); ok {
+			switch callingConfig["mode"] {
+			case "AUTO":
+				chatRequest["tool_choice"] = "auto"
+			case "ANY":
+				chatRequest["tool_choice"] = "required"
+				if names, ok := callingConfig["allowedFunctionNames"].([]interface{}); ok && len(names) == 1 {
+					chatRequest["tool_choice"] = map[string]interface{}{
+						"type":     "function",
+						"function": map[string]interface{}{"name": names[0]},
+					}
+				}
+			case "NONE":
+				chatRequest["tool_choice"] = "none"
+			}
+		}
+	}
+
+	return chatRequest, nil
+}
+
+// geminiPartsText 提取parts中的文本
+func geminiPartsText(value interface{}) string {
+	parts, _ := value.([]interface{})
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if part, ok := p.(map[string]interface{}); ok {
+			if text, ok := part["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// geminiFinishReason 将OpenAI的finish_reason映射为Gemini的finishReason
+func geminiFinishReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// geminiUsage 将OpenAI的usage转换为Gemini的usageMetadata
+func geminiUsage(usage map[string]interface{}) map[string]interface{} {
+	prompt, completion := 0, 0
+	if pt, ok := usage["prompt_tokens"].(float64); ok {
+		prompt = int(pt)
+	}
+	if ct, ok := usage["completion_tokens"].(float64); ok {
+		completion = int(ct)
+	}
+	return map[string]interface{}{
+		"promptTokenCount":     prompt,
+		"candidatesTokenCount": completion,
+		"totalTokenCount":      prompt + completion,
+	}
+}
+
+// geminiFunctionCallPart 将OpenAI的函数调用转换为Gemini的functionCall部分
+func geminiFunctionCallPart(name interface{}, arguments string) map[string]interface{} {
+	args := map[string]interface{}{}
+	if arguments != "" {
+		json.Unmarshal([]byte(arguments), &args)
+	}
+	return map[string]interface{}{
+		"functionCall": map[string]interface{}{"name": name, "args": args},
+	}
+}
+
+// geminiAdapter 将OpenAI格式的响应转换为Gemini格式
+type geminiAdapter struct {
+	model string
+	sse   bool
+
+	chunks       int
+	finishReason string
+	usage        map[string]interface{}
+	toolCalls    []map[string]interface{}
+}
+
+// newGeminiAdapter 创建Gemini响应适配器
+func newGeminiAdapter(model string, sse bool) *geminiAdapter {
+	return &geminiAdapter{model: model, sse: sse}
+}
+
+func (a *geminiAdapter) contentType(stream bool) string {
+	if stream && a.sse {
+		return "text/event-stream; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (a *geminiAdapter) keepComments() bool {
+	return a.sse
+}
+
+// candidate 构建单个候选结果
+func (a *geminiAdapter) candidate(parts []interface{}, finishReason string) map[string]interface{} {
+	candidate := map[string]interface{}{
+		"content": map[string]interface{}{"role": "model", "parts": parts},
+		"index":   0,
+	}
+	if finishReason != "" {
+		candidate["finishReason"] = finishReason
+	}
+	return candidate
+}
+
+// convertResponse 转换非流式响应
+func (a *geminiAdapter) convertResponse(status int, body []byte) []byte {
+	data := firstJSONObject(body)
+	if status >= 400 || data == nil || data["error"] != nil {
+		if status < 400 {
+			status = http.StatusInternalServerError
+		}
+		result, _ := json.Marshal(geminiError(status, extractErrorMessage(data, body)))
+		return result
+	}
+
+	candidates := make([]interface{}, 0, 1)
+	choices, _ := data["choices"].([]interface{})
+	for i, raw := range choices {
+		choice, _ := raw.(map[string]interface{})
+		if choice == nil {
+			continue
+		}
+		parts := make([]interface{}, 0, 2)
+		message, _ := choice["message"].(map[string]interface{})
+		if message != nil {
+			if reasoning, ok := message["reasoning_content"].(string); ok && reasoning != "" {
+				parts = append(parts, map[string]interface{}{"text": reasoning, "thought": true})
+			}
+			if text, ok := message["content"].(string); ok && text != "" {
+				parts = append(parts, map[string]interface{}{"text": text})
+			}
+			if toolCalls, ok := message["tool_calls"].([]interface{}); ok {
+				for _, item := range toolCalls {
+					tc, _ := item.(map[string]interface{})
+					fn, _ := tc["function"].(map[string]interface{})
+					if fn == nil {
+						continue
+					}
+					arguments, _ := fn["arguments"].(string)
+					parts = append(parts, geminiFunctionCallPart(fn["name"], arguments))
+				}
+			}
+		}
+		finishReason, _ := choice["finish_reason"].(string)
+		candidate := a.candidate(parts, geminiFinishReason(finishReason))
+		candidate["index"] = i
+		candidates = append(candidates, candidate)
+	}
+
+	response := map[string]interface{}{
+		"candidates":   candidates,
+		"modelVersion": a.model,
+	}
+	if usage, ok := data["usage"].(map[string]interface{}); ok {
+		response["usageMetadata"] = geminiUsage(usage)
+	}
+
+	result, _ := json.Marshal(response)
+	return result
+}
+
+// emit 输出一个流式数据块
+func (a *geminiAdapter) emit(payload map[string]interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	a.chunks++
+	if a.sse {
+		return []byte("data: " + string(data) + "\n\n")
+	}
+	if a.chunks == 1 {
+		return []byte("[" + string(data))
+	}
+	return []byte(",\r\n" + string(data))
+}
+
+// convertChunk 转换OpenAI流式数据块
+func (a *geminiAdapter) convertChunk(chunk map[string]interface{}) []byte {
+	if errData, ok := chunk["error"]; ok {
+		return a.emit(geminiError(http.StatusInternalServerError, extractErrorMessage(map[string]interface{}{"error": errData}, nil)))
+	}
+
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		a.usage = geminiUsage(usage)
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if choice == nil {
+		return nil
+	}
+	if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
+		a.finishReason = fr
+	}
+	delta, _ := choice["delta"].(map[string]interface{})
+	if delta == nil {
+		return nil
+	}
+
+	// 函数调用参数分片到达，结束时一次性输出完整的functionCall
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, item := range toolCalls {
+			tc, _ := item.(map[string]interface{})
+			if tc == nil {
+				continue
+			}
+			index := 0
+			if idx, ok := tc["index"].(float64); ok && idx >= 0 {
+				index = int(idx)
+			}
+			for len(a.toolCalls) <= index {
+				a.toolCalls = append(a.toolCalls, map[string]interface{}{"name": "", "arguments": ""})
+			}
+			if fn, ok := tc["function"].(map[string]interface{}); ok {
+				if name, ok := fn["name"].(string); ok && name != "" {
+					a.toolCalls[index]["name"] = name
+				}
+				if args, ok := fn["arguments"].(string); ok {
+					a.toolCalls[index]["arguments"] = a.toolCalls[index]["arguments"].(string) + args
+				}
+			}
+		}
+	}
+
+	parts := make([]interface{}, 0, 2)
+	if reasoning, ok := delta["reasoning_content"].(string); ok && reasoning != "" {
+		parts = append(parts, map[string]interface{}{"text": reasoning, "thought": true})
+	}
+	if text, ok := delta["content"].(string); ok && text != "" {
+		parts = append(parts, map[string]interface{}{"text": text})
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+
+	return a.emit(map[string]interface{}{
+		"candidates":   []interface{}{a.candidate(parts, "")},
+		"modelVersion": a.model,
+	})
+}
+
+// finishStream 输出包含finishReason和用量的最后一个数据块
+func (a *geminiAdapter) finishStream() []byte {
+	parts := make([]interface{}, 0, len(a.toolCalls))
+	for _, call := range a.toolCalls {
+		parts = append(parts, geminiFunctionCallPart(call["name"], call["arguments"].(string)))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, map[string]interface{}{"text": ""})
+	}
+
+	final := map[string]interface{}{
+		"candidates":   []interface{}{a.candidate(parts, geminiFinishReason(a.finishReason))},
+		"modelVersion": a.model,
+	}
+	if a.usage != nil {
+		final["usageMetadata"] = a.usage
+	}
+
+	out := a.emit(final)
+	if !a.sse {
+		out = append(out, ']')
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertGeminiRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		stream bool
+		want   string
+	}{
+		{
+			name: "system instruction and text",
+			body: `{"systemInstruction":{"parts":[{"text":"be brief"}]},"contents":[{"role":"user","parts":[{"text":"a"},{"text":"b"}]}]}`,
+			want: `{"model":"m","stream":false,"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"a\nb"}]}`,
+		},
+		{
+			name:   "stream with generation config",
+			body:   `{"contents":[{"parts":[{"text":"hi"}]}],"generationConfig":{"temperature":0.2,"maxOutputTokens":10,"stopSequences":["x"],"responseMimeType":"application/json"}}`,
+			stream: true,
+			want:   `{"model":"m","stream":true,"stream_options":{"include_usage":true},"temperature":0.2,"max_tokens":10,"stop":["x"],"response_format":{"type":"json_object"},"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "inline image",
+			body: `{"contents":[{"role":"user","parts":[{"text":"what"},{"inlineData":{"mimeType":"image/png","data":"AAA"}}]}]}`,
+			want: `{"model":"m","stream":false,"messages":[{"role":"user","content":[{"type":"text","text":"what"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]}]}`,
+		},
+		{
+			name: "function call and response are paired by name",
+			body: `{"contents":[{"role":"user","parts":[{"text":"weather?"}]},{"role":"model","parts":[{"text":"thinking","thought":true},{"functionCall":{"name":"get","args":{"city":"sh"}}}]},{"role":"user","parts":[{"functionResponse":{"name":"get","response":{"t":20}}}]}]}`,
+			want: `{"model":"m","stream":false,"messages":[{"role":"user","content":"weather?"},{"role":"assistant","content":"","tool_calls":[{"id":"call_0","type":"function","function":{"name":"get","arguments":"{\"city\":\"sh\"}"}}]},{"role":"tool","tool_call_id":"call_0","content":"{\"t\":20}"}]}`,
+		},
+		{
+			name: "tools and single allowed function",
+			body: `{"contents":[{"parts":[{"text":"hi"}]}],"tools":[{"functionDeclarations":[{"name":"f","description":"d","parameters":{"type":"object"}}]}],"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["f"]}}}`,
+			want: `{"model":"m","stream":false,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f","description":"d","parameters":{"type":"object"}}}],"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertGeminiRequest([]byte(tt.body), "m", tt.stream)
+			if err != nil {
+				t.Fatalf("convertGeminiRequest() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+
+	for _, body := range []string{`not json`, `{}`, `{"contents":[]}`} {
+		if _, err := convertGeminiRequest([]byte(body), "m", false); err == nil {
+			t.Errorf("convertGeminiRequest(%s) error = nil, want error", body)
+		}
+	}
+}
+
+func TestGeminiAdapterConvertResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			name:   "text with reasoning and usage",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"stop","message":{"content":"hi","reasoning_content":"r"}}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`,
+			want:   `{"candidates":[{"content":{"role":"model","parts":[{"text":"r","thought":true},{"text":"hi"}]},"index":0,"finishReason":"STOP"}],"modelVersion":"m","usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5}}`,
+		},
+		{
+			name:   "function call truncated",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"length","message":{"tool_calls":[{"function":{"name":"f","arguments":"{\"a\":1}"}}]}}]}`,
+			want:   `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"f","args":{"a":1}}}]},"index":0,"finishReason":"MAX_TOKENS"}],"modelVersion":"m"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSONEqual(t, newGeminiAdapter("m", false).convertResponse(tt.status, []byte(tt.body)), tt.want)
+		})
+	}
+
+	var errResp map[string]interface{}
+	json.Unmarshal(newGeminiAdapter("m", false).convertResponse(404, []byte(`{"error":{"message":"no model"}}`)), &errResp)
+	if errData, _ := errResp["error"].(map[string]interface{}); errData == nil || errData["code"] != float64(404) || errData["message"] != "no model" {
+		t.Errorf("error response = %v", errResp)
+	}
+}
+
+func TestGeminiAdapterStream(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"delta":{"content":"hel"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"name":"f","arguments":"{\"a\""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2}}`,
+	}
+	tests := []struct {
+		name string
+		sse  bool
+		want string
+	}{
+		{
+			name: "sse",
+			sse:  true,
+			want: "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"hel\"}],\"role\":\"model\"},\"index\":0}],\"modelVersion\":\"m\"}\n\n" +
+				"data: {\"candidates\":[{\"content\":{\"parts\":[{\"functionCall\":{\"args\":{\"a\":1},\"name\":\"f\"}}],\"role\":\"model\"},\"finishReason\":\"STOP\",\"index\":0}],\"modelVersion\":\"m\",\"usageMetadata\":{\"candidatesTokenCount\":2,\"promptTokenCount\":1,\"totalTokenCount\":3}}\n\n",
+		},
+		{
+			name: "json array",
+			want: "[{\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"hel\"}],\"role\":\"model\"},\"index\":0}],\"modelVersion\":\"m\"}" +
+				",\r\n{\"candidates\":[{\"content\":{\"parts\":[{\"functionCall\":{\"args\":{\"a\":1},\"name\":\"f\"}}],\"role\":\"model\"},\"finishReason\":\"STOP\",\"index\":0}],\"modelVersion\":\"m\",\"usageMetadata\":{\"candidatesTokenCount\":2,\"promptTokenCount\":1,\"totalTokenCount\":3}}]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newGeminiAdapter("m", tt.sse)
+			var out []byte
+			for _, chunk := range chunks {
+				out = append(out, a.convertChunk(mustJSON(t, chunk))...)
+			}
+			out = append(out, a.finishStream()...)
+			if string(out) != tt.want {
+				t.Errorf("stream output =\n%q\nwant\n%q", out, tt.want)
+			}
+		})
+	}
+}
@@ -10,15 +10,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/middleware"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
 	"flowsilicon/pkg/utils"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -77,6 +82,12 @@ func HandleApiProxy(c *gin.Context) {
 	// 获取请求路径
 	path := c.Param("path")
 
+	// 启用Ollama接口模拟时，由本地转换处理Ollama格式的请求
+	if cfg.ApiProxy.OllamaMode && isOllamaPath(path) {
+		HandleOllamaRequest(c)
+		return
+	}
+
 	// 构建目标 URL
 	targetURL := fmt.Sprintf("%s%s", baseURL, path)
 
@@ -92,6 +103,7 @@ func HandleApiProxy(c *gin.Context) {
 	// 分析请求类型和估计token数量
 	tracker.Step("分析请求")
 	requestType, modelName, tokenEstimate := AnalyzeRequest(path, bodyBytes)
+	targetURL = routeToProvider(c, targetURL, baseURL, modelName)
 	
 	// 设置日志上下文信息
 	rl.SetModel(modelName).
@@ -122,6 +134,18 @@ func HandleApiProxy(c *gin.Context) {
 	}
 }
 
+// routeToProvider 模型由其他提供商提供时，将目标URL替换为该提供商的地址
+func routeToProvider(c *gin.Context, targetURL string, baseURL string, modelName string) string {
+	upstream := provider.ForModel(modelName)
+	if upstream.Name() == config.DefaultProvider || !strings.HasPrefix(targetURL, baseURL) {
+		return targetURL
+	}
+
+	routedURL := upstream.BaseURL() + strings.TrimPrefix(targetURL, baseURL)
+	GetRequestLogger(c).Info("模型 %s 由提供商 %s 提供，转发到: %s", modelName, upstream.Name(), routedURL)
+	return routedURL
+}
+
 // isModelDisabled 检查模型是否被禁用
 func isModelDisabled(modelName string) bool {
 	cfg := config.GetConfig()
@@ -173,6 +197,7 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 
 		// 记录重试信息
 		rl.Warn("API请求第%d次重试: %s, 错误: %v", i+1, targetURL, err)
+		metrics.RecordRetry(modelName)
 
 		// 获取另一个API密钥进行重试
 		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
@@ -240,21 +265,17 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
 
-		// 更新密钥状态
-		key.UpdateApiKeyStatus(apiKey, success)
+		// 更新密钥状态，失败时按错误类型冷却密钥
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
 
-		// 统计请求数据
-		tokenCount := utils.EstimateTokenCount(bodyBytes, respBody)
-		config.AddKeyRequestStat(apiKey, 1, tokenCount)
+		// 统计请求数据，上游未返回usage时使用分词器计算
+		modelNameForStats := extractModelName(c.Request, respBody)
+		promptTokensCount, completionTokensCount := countUsage(modelNameForStats, bodyBytes, respBody)
+		config.AddKeyRequestStat(apiKey, 1, promptTokensCount+completionTokensCount)
 
 		// 更新每日统计数据
-		modelNameForStats := extractModelName(c.Request, respBody)
-		promptTokensCount, completionTokensCount := extractTokenCounts(respBody)
-		if promptTokensCount == 0 && completionTokensCount == 0 {
-			promptTokensCount = tokenCount / 2
-			completionTokensCount = tokenCount - promptTokensCount
-		}
 		config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+		recordClientUsage(c, modelNameForStats, promptTokensCount, completionTokensCount, success)
 
 		// 复制响应 headers
 		for name, values := range resp.Header {
@@ -371,8 +392,8 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 更新密钥失败记录，按错误类型冷却密钥
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
 		rl.WarnWithDuration("API请求失败，状态码: %d", resp.StatusCode)
 		return false, fmt.Errorf("API请求失败，状态码: %d", resp.StatusCode)
 	}
@@ -380,22 +401,16 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	// 更新密钥状态
 	key.UpdateApiKeyStatus(apiKey, success)
 
-	// 统计请求数据
-	tokenCount := utils.EstimateTokenCount(bodyBytes, respBody)
-	config.AddKeyRequestStat(apiKey, 1, tokenCount)
+	// 统计请求数据，上游未返回usage时使用分词器计算
+	promptTokensCount, completionTokensCount := countUsage(modelName, bodyBytes, respBody)
+	config.AddKeyRequestStat(apiKey, 1, promptTokensCount+completionTokensCount)
 
 	// 更新每日统计数据
 	// 尝试从请求中提取模型信息
 	modelNameForStats := extractModelName(c.Request, respBody)
-	// 提取令牌计数
-	promptTokensCount, completionTokensCount := extractTokenCounts(respBody)
-	if promptTokensCount == 0 && completionTokensCount == 0 {
-		// 如果无法从响应中提取令牌计数，使用估算值
-		promptTokensCount = tokenCount / 2
-		completionTokensCount = tokenCount - promptTokensCount
-	}
 	// 添加到每日统计
 	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+	recordClientUsage(c, modelNameForStats, promptTokensCount, completionTokensCount, success)
 
 	// 复制响应 headers
 	for name, values := range resp.Header {
@@ -425,6 +440,31 @@ func HandleOpenAIProxy(c *gin.Context) {
 		return
 	}
 
+	// Anthropic Messages API 兼容
+	switch c.Param("path") {
+	case "/messages":
+		HandleAnthropicMessages(c)
+		return
+	case "/messages/count_tokens":
+		HandleAnthropicCountTokens(c)
+		return
+	}
+
+	// OpenAI Responses API 在本地实现
+	if p := c.Param("path"); p == "/responses" || strings.HasPrefix(p, "/responses/") {
+		HandleResponsesRequest(c)
+		return
+	}
+
+	// OpenAI Files/Batches API 在本地实现
+	if p := c.Param("path"); p == "/files" || strings.HasPrefix(p, "/files/") {
+		HandleFilesRequest(c)
+		return
+	} else if p == "/batches" || strings.HasPrefix(p, "/batches/") {
+		HandleBatchesRequest(c)
+		return
+	}
+
 	// 对于流式请求，设置较长的超时时间
 	if strings.Contains(c.Request.URL.Path, "/chat/completions") || strings.Contains(c.Request.URL.Path, "/completions") {
 		// 检查是否可能是流式请求
@@ -514,6 +554,18 @@ func HandleOpenAIProxy(c *gin.Context) {
 		rl.Info("检测到标准版本号路径请求: %s，转发到: %s", "/v1"+path, targetURL)
 	}
 
+	// 视频生成任务需要使用提交任务时的密钥查询状态
+	if isVideoRequest(fullPath) {
+		HandleVideoRequest(c, targetURL, baseURL)
+		return
+	}
+
+	// 音频请求使用multipart上传或返回二进制音频，不经过JSON转换
+	if endpoint := audioEndpoint(fullPath); endpoint != "" {
+		HandleAudioRequest(c, targetURL, baseURL, endpoint)
+		return
+	}
+
 	// 如果是 /models 请求，使用特殊处理
 	if strings.HasSuffix(fullPath, "/models") {
 		rl.Info("检测到模型列表请求: %s", fullPath)
@@ -696,16 +748,70 @@ func HandleOpenAIProxy(c *gin.Context) {
 	requestType, modelName, tokenEstimate := AnalyzeOpenAIRequest(requestPath, bodyBytes)
 
 	// 转换请求体为硅基流动格式
-	transformedBody, err := TransformRequestBody(bodyBytes, requestPath)
+	transformedBody, trimmed, err := TransformRequestBody(bodyBytes, requestPath, middleware.GetClient(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to transform request body: %v", err),
-		})
+		// 请求体格式错误或缺少必填字段，都是客户端的问题
+		if errors.Is(err, errModelRequired) {
+			localAPIError(c, http.StatusBadRequest, "model is required: specify model in the request or configure a default model alias")
+		} else {
+			localAPIError(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		}
+		return
+	}
+	if trimmed > 0 {
+		c.Header(ContextTrimmedHeader, strconv.Itoa(trimmed))
+		rl.Info("请求超出模型上下文长度，已裁剪%d条消息", trimmed)
+	}
+
+	// 模型别名解析后使用实际的模型选择密钥，响应中的模型名改写回客户端请求的别名
+	if resolvedModel := requestModelName(transformedBody); resolvedModel != "" && resolvedModel != modelName {
+		if isModelDisabled(resolvedModel) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": map[string]interface{}{
+					"message": fmt.Sprintf("模型 %s 已被禁用", resolvedModel),
+					"type":    "invalid_request_error",
+					"code":    403,
+				},
+			})
+			return
+		}
+		if modelName != "" {
+			defer useModelAlias(c, resolvedModel, modelName)()
+		}
+		modelName = resolvedModel
+		rl.SetModel(modelName)
+	}
+	// 客户端密钥限制了可用模型时，按别名解析后的实际模型检查，包括未指定模型时使用的default别名
+	if modelName != "" && !middleware.CheckClientModel(c, modelName) {
+		return
+	}
+	targetURL = routeToProvider(c, targetURL, baseURL, modelName)
+
+	// 按客户端要求的格式改写推理内容，缓存中保存的是上游格式
+	if strings.Contains(requestPath, "/chat/completions") {
+		defer useReasoningFormat(c, modelName)()
+	}
+
+	// 确定性请求命中响应缓存时直接返回，不消耗密钥余额
+	cacheHit, saveResponseCache := useResponseCache(c, requestPath, modelName, transformedBody)
+	if cacheHit {
 		return
 	}
+	defer saveResponseCache()
 
-	// 调用带重试逻辑的函数处理OpenAI格式请求
-	success := processOpenAIRequestWithRetry(c, targetURL, transformedBody, bodyBytes, requestType, modelName, tokenEstimate, requestPath)
+	// 模拟工具调用时将模型输出的JSON转换为tool_calls，转换后的响应再写入缓存
+	if toolNames := requestToolNames(bodyBytes, modelName); len(toolNames) > 0 {
+		defer useToolEmulation(c, toolNames)()
+	}
+
+	// 调用带重试和备用模型切换逻辑的函数处理OpenAI格式请求
+	// 要求json_schema格式输出的非流式聊天请求校验模型输出，不符合时修复或使用纠正提示重试
+	var success bool
+	if schema, ok := requestJSONSchema(transformedBody); ok && config.GetConfig().ApiProxy.StructuredOutput.Enabled && strings.Contains(requestPath, "/chat/completions") {
+		success = processStructuredOutputRequest(c, targetURL, transformedBody, bodyBytes, requestType, modelName, tokenEstimate, requestPath, schema)
+	} else {
+		success = processOpenAIRequestWithFallback(c, targetURL, transformedBody, bodyBytes, requestType, modelName, tokenEstimate, requestPath)
+	}
 
 	// 如果请求成功且有模型名称，更新模型调用次数
 	if success && modelName != "" {
@@ -742,13 +848,16 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 
 	// 流式请求需要特殊处理，暂不支持重试
 	if isStreamRequest {
+		streamStart := time.Now()
+		var success bool
 		// 检查是否启用假流式
 		if cfg.RequestSettings.ProxyHandler.UseFakeStreaming {
-			handleFakeStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
+			success = handleFakeStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
 		} else {
-			handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
+			success = handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
 		}
-		return true
+		metrics.RecordStreamDuration(modelName, time.Since(streamStart))
+		return success
 	}
 
 	// 如果最大重试次数为0，直接处理一次请求
@@ -779,6 +888,7 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		// 记录重试信息
 		rl.Warn("OpenAI格式API请求第%d次重试: %s, 请求类型: %s, 模型: %s, 方法: %s, 路径: %s, 错误: %v", 
 			i+1, targetURL, requestType, modelName, c.Request.Method, path, err)
+		metrics.RecordRetry(modelName)
 
 		// 获取另一个API密钥进行重试
 		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
@@ -864,22 +974,16 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
 
-		// 更新密钥状态
-		key.UpdateApiKeyStatus(apiKey, success)
-
-		// 统计请求数据
-		tokenCount := utils.EstimateTokenCount(originalBody, respBody)
-		config.AddKeyRequestStat(apiKey, 1, tokenCount)
+		// 更新密钥状态，失败时按错误类型冷却密钥
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
 
-		// 提取令牌计数
-		promptTokensCount, completionTokensCount := extractTokenCounts(respBody)
-		if promptTokensCount == 0 && completionTokensCount == 0 {
-			promptTokensCount = tokenCount / 2
-			completionTokensCount = tokenCount - promptTokensCount
-		}
+		// 统计请求数据，上游未返回usage时使用分词器计算发送给上游的请求
+		promptTokensCount, completionTokensCount := countUsage(modelName, transformedBody, respBody)
+		config.AddKeyRequestStat(apiKey, 1, promptTokensCount+completionTokensCount)
 
 		// 添加到每日统计
 		config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+		recordClientUsage(c, modelName, promptTokensCount, completionTokensCount, success)
 
 		// 转换响应为OpenAI格式
 		openAIResponse, err := TransformResponseBody(respBody, path)
@@ -907,6 +1011,11 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 
 // shouldRetry 判断是否需要重试
 func shouldRetry(err error, retryConfig config.RetryConfig) bool {
+	// 超出上下文长度的请求换用其他密钥也会失败
+	if errors.Is(err, errContextLengthExceeded) {
+		return false
+	}
+
 	// 如果是网络错误且配置允许重试网络错误
 	if err != nil && retryConfig.RetryOnNetworkErrors {
 		return true
@@ -928,7 +1037,7 @@ func shouldRetry(err error, retryConfig config.RetryConfig) bool {
 }
 
 // 处理OpenAI流式请求
-func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) {
+func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) bool {
 	// 获取请求日志记录器
 	rl := GetRequestLogger(c)
 	
@@ -936,7 +1045,7 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	if streamCompleted, exists := c.Get("stream_completed"); exists && streamCompleted.(bool) {
 		rl.Info("检测到从流式响应完成后的后续请求，直接返回OK")
 		c.Status(http.StatusOK)
-		return
+		return true
 	}
 
 	// 检查请求体中的stream字段是否为true
@@ -947,14 +1056,14 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 			if streamBool, ok := stream.(bool); ok && !streamBool {
 				rl.Info("检测到请求中stream=false，转为非流式请求处理")
 				// 处理为非流式请求
-				_, err := processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, c.Request.URL.Path)
+				success, err := processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, c.Request.URL.Path)
 				if err != nil {
 					rl.Error("处理非流式请求失败: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{
 						"error": fmt.Sprintf("处理请求失败: %v", err),
 					})
 				}
-				return
+				return success && err == nil
 			}
 		}
 	}
@@ -968,16 +1077,19 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 				"code":    403,
 			},
 		})
-		return
+		return false
 	}
 
+	// 始终向上游请求usage数据块，客户端未要求时在HandleStreamResponse中去掉
+	transformedBody = ensureStreamUsage(transformedBody)
+
 	// 根据请求类型选择最佳的API密钥
 	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "No suitable API keys available",
 		})
-		return
+		return false
 	}
 
 	// 检查是否是推理模型（类型为7）
@@ -1006,32 +1118,41 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
 	defer cancel() // 确保函数结束时取消上下文
 
-	// 创建新的请求，使用我们的超时上下文
-	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Failed to create request: %v", err),
-		})
-		return
-	}
+	// 创建上游请求，对冲请求使用另一个密钥复用相同的请求参数
+	newRequest := func(ctx context.Context, apiKey string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
+		if err != nil {
+			return nil, err
+		}
 
-	// 复制原始请求的 headers
-	for name, values := range c.Request.Header {
-		// 跳过一些特定的 headers
-		if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
-			continue
+		// 复制原始请求的 headers
+		for name, values := range c.Request.Header {
+			// 跳过一些特定的 headers
+			if strings.ToLower(name) == "host" || strings.ToLower(name) == "authorization" {
+				continue
+			}
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
 		}
-		for _, value := range values {
-			req.Header.Add(name, value)
+
+		// 设置 Authorization header 和其他通用头
+		utils.SetCommonHeaders(req, apiKey)
+
+		// 为推理模型添加特殊请求头
+		if isReasonModelType {
+			utils.SetInferenceModelHeaders(req)
 		}
+		return req, nil
 	}
 
-	// 设置 Authorization header 和其他通用头
-	utils.SetCommonHeaders(req, apiKey)
-
-	// 为推理模型添加特殊请求头
-	if isReasonModelType {
-		utils.SetInferenceModelHeaders(req)
+	// 创建新的请求，使用我们的超时上下文
+	req, err := newRequest(ctx, apiKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to create request: %v", err),
+		})
+		return false
 	}
 
 	// 创建 HTTP 客户端，根据模型类型选择合适的超时设置和响应头
@@ -1065,7 +1186,13 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	defer clientCancel()
 
 	// 发送请求，使用上下文控制超时
-	resp, err := client.Do(req.WithContext(clientCtx))
+	// 启用请求对冲时，首个数据块超时未到达会使用另一个密钥再发送一次，使用先返回数据的响应
+	var resp *http.Response
+	if cfg.ApiProxy.Hedging.Enabled {
+		apiKey, resp, err = sendHedgedStreamRequest(c, client, clientCtx, newRequest, apiKey, requestType, modelName, tokenEstimate)
+	} else {
+		resp, err = client.Do(req.WithContext(clientCtx))
+	}
 	if err != nil {
 		// 区分连接错误和其他错误类型
 		if strings.Contains(err.Error(), "context deadline exceeded") ||
@@ -1090,18 +1217,18 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 
 		// 更新密钥失败记录
 		key.UpdateApiKeyStatus(apiKey, false)
-		return
+		return false
 	}
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
-
 		// 尝试读取错误消息
 		errBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 
+		// 更新密钥失败记录，按错误类型冷却密钥
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, errBody)
+
 		// 记录详细的状态码和错误信息
 		if err != nil {
 			rl.Error("读取错误响应体失败: %v", err)
@@ -1164,14 +1291,15 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 				"code":    errorCode,
 			},
 		})
-		return
+		return false
 	}
 
 	// 记录成功启动流式响应
 	rl.Info("成功启动流式响应，正在处理响应流...")
 
 	// 处理流式响应，传递与当前请求相同的超时上下文
-	HandleStreamResponse(c, resp.Body, apiKey, originalBody)
+	HandleStreamResponse(c, resp.Body, apiKey, modelName, transformedBody, originalBody)
+	return true
 }
 
 // 处理非流式OpenAI请求，返回是否成功处理和可能的错误
@@ -1312,9 +1440,6 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
-
 		// 尝试解析JSON错误消息
 		var errorResponse struct {
 			Code    int    `json:"code"`
@@ -1354,6 +1479,14 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 		// 记录详细错误信息
 		rl.Error("OpenAI请求失败，状态码: %d, 错误: %s", resp.StatusCode, errorMessage)
 
+		// 更新密钥失败记录，超出上下文长度是请求本身的问题，不计入密钥失败
+		contextLengthExceeded := isContextLengthError(resp.StatusCode, errorMessage)
+		if contextLengthExceeded {
+			rl.Warn("请求超出模型 %s 的上下文长度，不再重试", modelName)
+		} else {
+			key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
+		}
+
 		// 以结构化方式返回错误
 		c.JSON(resp.StatusCode, gin.H{
 			"error": gin.H{
@@ -1363,6 +1496,9 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 			},
 		})
 
+		if contextLengthExceeded {
+			return false, fmt.Errorf("%w: %s (模型: %s)", errContextLengthExceeded, errorMessage, modelName)
+		}
 		return false, fmt.Errorf("OpenAI格式API请求失败: %s (请求类型: %s, 模型: %s, 方法: %s, 路径: %s, 目标URL: %s)", 
 			errorMessage, requestType, modelName, c.Request.Method, path, targetURL)
 	}
@@ -1370,20 +1506,13 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	// 更新密钥状态
 	key.UpdateApiKeyStatus(apiKey, success)
 
-	// 统计请求数据
-	tokenCount := utils.EstimateTokenCount(originalBody, respBody)
-	config.AddKeyRequestStat(apiKey, 1, tokenCount)
-
-	// 提取令牌计数
-	promptTokensCount, completionTokensCount := extractTokenCounts(respBody)
-	if promptTokensCount == 0 && completionTokensCount == 0 {
-		// 如果无法从响应中提取令牌计数，使用估算值
-		promptTokensCount = tokenCount / 2
-		completionTokensCount = tokenCount - promptTokensCount
-	}
+	// 统计请求数据，上游未返回usage时使用分词器计算发送给上游的请求
+	promptTokensCount, completionTokensCount := countUsage(modelName, transformedBody, respBody)
+	config.AddKeyRequestStat(apiKey, 1, promptTokensCount+completionTokensCount)
 
 	// 添加到每日统计
 	config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+	recordClientUsage(c, modelName, promptTokensCount, completionTokensCount, success)
 
 	// 转换响应为OpenAI格式
 	openAIResponse, err := TransformResponseBody(respBody, path)
@@ -1511,6 +1640,29 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 					filteredModels = append(filteredModels, model)
 				}
 			}
+			// 合并其他提供商的模型
+			existing := make(map[string]bool)
+			for _, model := range filteredModels {
+				if modelObj, ok := model.(map[string]interface{}); ok {
+					if modelID, ok := modelObj["id"].(string); ok {
+						existing[modelID] = true
+					}
+				}
+			}
+			for _, p := range provider.List()[1:] {
+				for _, modelID := range provider.Models(p) {
+					if existing[modelID] || isModelDisabled(modelID) {
+						continue
+					}
+					existing[modelID] = true
+					filteredModels = append(filteredModels, map[string]interface{}{
+						"id":       modelID,
+						"object":   "model",
+						"created":  0,
+						"owned_by": p.Name(),
+					})
+				}
+			}
 			modelsResponse["data"] = filteredModels
 
 			// 将过滤后的响应转换回JSON
@@ -1527,7 +1679,8 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 		// 出错时使用原始响应
 	}
 
-	// 返回API的响应（可能经过过滤）
+	// 返回API的响应（可能经过过滤），响应体已变化，移除原始长度
+	c.Writer.Header().Del("Content-Length")
 	c.Status(resp.StatusCode)
 	c.Writer.Write(respBody)
 
@@ -1535,7 +1688,8 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 }
 
 // 处理流式响应
-func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey string, requestBody []byte) {
+// modelName为实际请求的模型，requestBody为发送给上游的请求体，用于选择分词器和统计用量；originalBody为客户端的请求体，用于判断客户端是否要求返回usage
+func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey string, modelName string, requestBody []byte, originalBody []byte) {
 	// 获取请求日志记录器
 	rl := GetRequestLogger(c)
 	
@@ -1565,14 +1719,12 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	// 创建带超时的上下文，而不是使用无限期的background上下文
 	// 检查请求体中是否包含Deepseek R1模型
 	var isDeepseekR1 bool
-	var requestData map[string]interface{}
-	if err := json.Unmarshal(requestBody, &requestData); err == nil {
-		if model, ok := requestData["model"].(string); ok {
-			if strings.Contains(strings.ToLower(model), "deepseek") && strings.Contains(model, "r1") {
-				isDeepseekR1 = true
-				rl.Info("检测到Deepseek R1模型请求，启用特殊处理模式")
-			}
-		}
+	var requestData, originalData map[string]interface{}
+	json.Unmarshal(requestBody, &requestData)
+	json.Unmarshal(originalBody, &originalData)
+	if strings.Contains(strings.ToLower(modelName), "deepseek") && strings.Contains(modelName, "r1") {
+		isDeepseekR1 = true
+		rl.Info("检测到Deepseek R1模型请求，启用特殊处理模式")
 	}
 
 	// 设置合理的超时时间，根据模型类型调整
@@ -1598,7 +1750,8 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	}
 
 	// 初始化计数器
-	var totalTokens int
+	usage := newStreamUsage(modelName, requestData)
+	clientUsage := clientRequestedUsage(originalData)
 	var eventCount int
 	var lastProgressTime = time.Now() // 上次进度更新时间
 
@@ -1739,7 +1892,8 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 
 			// 定期报告进度，避免客户端认为连接已断开
 			if time.Since(lastProgressTime) > progressInterval {
-				rl.Info("流式响应处理中，已处理 %d 个事件，约 %d tokens", eventCount, totalTokens)
+				_, completionTokens, _ := usage.counts()
+				rl.Info("流式响应处理中，已处理 %d 个事件，已输出 %d tokens", eventCount, completionTokens)
 				lastProgressTime = time.Now()
 			}
 
@@ -1798,133 +1952,16 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 						transformedData = bytes.TrimSpace(data)
 					}
 
-					// 更新token估算
+					// 统计令牌用量，客户端未要求usage时不转发上游额外返回的usage数据块
 					var jsonData map[string]interface{}
 					if err := json.Unmarshal(transformedData, &jsonData); err == nil {
-						// 首先尝试从usage中获取total_tokens
-						if usage, ok := jsonData["usage"].(map[string]interface{}); ok {
-							if tt, ok := usage["total_tokens"].(float64); ok {
-								// 更新总tokens数量为API返回的值
-								if eventCount <= 3 || eventCount%50 == 0 {
-									rl.Info("事件#%d: 从API返回的usage中读取total_tokens=%d", eventCount, int(tt))
-								}
-								// 使用API返回的token数量
-								totalTokens = int(tt)
-								// 继续处理，但不再进行token估算
-							}
-						} else if choices, ok := jsonData["choices"].([]interface{}); ok && len(choices) > 0 {
-							// 如果没有usage字段，继续使用原来的估算方法
-							if choice, ok := choices[0].(map[string]interface{}); ok {
-								if delta, ok := choice["delta"].(map[string]interface{}); ok {
-									if content, ok := delta["content"].(string); ok {
-										// 简单估算：每个字符约为0.25个token
-										tokenEstimate := int(float64(len(content)) * 0.2)
-										if tokenEstimate == 0 && len(content) > 0 {
-											tokenEstimate = 1 // 确保至少有1个token
-										}
-										totalTokens += tokenEstimate
-
-										// 每100个事件记录一次token统计情况
-										if eventCount%100 == 0 || eventCount <= 3 {
-											rl.Info("事件#%d: 内容长度=%d字符, 估计tokens=%d, 累计tokens=%d",
-												eventCount, len(content), tokenEstimate, totalTokens)
-										}
-									} else {
-										// 如果无法提取content但delta不为空，尝试其他方式估算
-										deltaJSON, _ := json.Marshal(delta)
-										deltaStr := string(deltaJSON)
-										if len(deltaStr) > 0 {
-											// 记录无法直接提取content的情况
-											if eventCount <= 10 || eventCount%100 == 0 {
-												rl.Info("事件#%d: 无法提取content，delta=%s", eventCount, deltaStr)
-											}
-
-											// 仍然尝试估算token
-											tokenEstimate := int(float64(len(deltaStr)) * 0.1) // 对JSON格式的内容降低估算比例
-											if tokenEstimate == 0 && len(deltaStr) > 0 {
-												tokenEstimate = 1
-											}
-											totalTokens += tokenEstimate
-										}
-									}
-								} else {
-									// 如果无法提取delta但choice不为空，记录问题
-									if eventCount <= 10 || eventCount%100 == 0 {
-										choiceJSON, _ := json.Marshal(choice)
-										rl.Info("事件#%d: 无法提取delta，choice=%s", eventCount, string(choiceJSON))
-									}
-
-									// 确保每个事件至少计算一些token
-									if eventCount%5 == 0 { // 每5个事件增加1个token（保守估计）
-										totalTokens += 1
-									}
-								}
-							} else {
-								// 如果无法正确解析choice，记录问题
-								if eventCount <= 10 || eventCount%100 == 0 {
-									if len(choices) > 0 {
-										choiceData, _ := json.Marshal(choices[0])
-										rl.Info("事件#%d: choice格式异常，原始数据=%s", eventCount, string(choiceData))
-									}
-								}
-
-								// 确保计数不为零
-								if eventCount%5 == 0 {
-									totalTokens += 1
-								}
-							}
-						} else {
-							// 如果无法提取choices，尝试直接从原始数据估算
-							jsonString := string(transformedData)
-							// 对Deepseek R1特殊处理
-							if isDeepseekR1 && strings.Contains(jsonString, "\"choices\"") {
-								// 从原始JSON字符串中查找content
-								contentIndex := strings.Index(jsonString, "\"content\":")
-								if contentIndex > 0 {
-									// 粗略提取content内容
-									contentStart := contentIndex + 11 // "content":"
-									contentEnd := strings.Index(jsonString[contentStart:], "\"")
-									if contentEnd > 0 {
-										content := jsonString[contentStart : contentStart+contentEnd]
-										if len(content) > 0 {
-											tokenEstimate := int(float64(len(content)) * 0.25)
-											if tokenEstimate == 0 {
-												tokenEstimate = 1
-											}
-											totalTokens += tokenEstimate
-
-											if eventCount%50 == 0 || eventCount <= 3 {
-												rl.Info("事件#%d(字符串解析): 内容长度=%d字符, 估计tokens=%d, 累计tokens=%d",
-													eventCount, len(content), tokenEstimate, totalTokens)
-											}
-										}
-									}
-								} else {
-									// 没有找到content但仍是有效事件
-									if eventCount%10 == 0 {
-										totalTokens += 1 // 每10个无内容事件算1个token
-									}
-								}
-							} else {
-								// 保守估计，每10个事件至少计1个token
-								if eventCount%10 == 0 {
-									totalTokens += 1
-
-									if eventCount <= 10 || eventCount%100 == 0 {
-										rl.Info("事件#%d: 无法提取choices，使用保守估计", eventCount)
-									}
-								}
-							}
-						}
-					} else {
-						// JSON解析失败，使用基于事件的保守估计
-						if eventCount%10 == 0 {
-							totalTokens += 1 // 每10个事件至少计1个token
-
-							if eventCount <= 10 || eventCount%100 == 0 {
-								rl.Info("事件#%d: JSON解析失败: %v", eventCount, err)
-							}
+						usage.observe(jsonData)
+						if !clientUsage && isUsageOnlyChunk(jsonData) {
+							readTimeoutChan <- nil
+							return
 						}
+					} else if eventCount <= 10 || eventCount%100 == 0 {
+						rl.Info("事件#%d: JSON解析失败: %v", eventCount, err)
 					}
 
 					// 添加到缓冲区
@@ -2106,45 +2143,28 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 		rl.Error("流式响应错误: %v", err)
 	}
 
-	// 统计请求数据
-	// 确保token统计至少有一个合理的最小值
-	if totalTokens < eventCount/4 {
-		// 如果计算的token异常少，使用事件数作为保底估计
-		minTokens := eventCount / 4 // 保守估计每4个事件至少1个token
-		rl.Info("Token估计值(%d)过低，调整为基于事件数的保底估计: %d", totalTokens, minTokens)
-		totalTokens = minTokens
-	}
-
-	// 记录最终使用的token数
-	var tokenSource string
-	if totalTokens > 0 {
-		tokenSource = "API返回或有效估算"
-	} else {
-		tokenSource = "基于事件的保底估算"
+	// 统计请求数据，上游未返回usage时按请求内容和累计的输出内容计算
+	promptTokensCount, completionTokensCount, fromUpstream := usage.counts()
+	totalTokens := promptTokensCount + completionTokensCount
+	tokenSource := "分词器计算"
+	if fromUpstream {
+		tokenSource = "API返回"
 	}
-	rl.Info("流式响应最终统计: total_tokens=%d (来源: %s)",
-		totalTokens, tokenSource)
 
 	config.AddKeyRequestStat(apiKey, 1, totalTokens)
 
 	// 更新每日统计数据
 	modelNameForStats := "unknown"
-	// 尝试从请求体中提取模型名称
-	if requestData != nil {
-		if model, ok := requestData["model"].(string); ok && model != "" {
-			modelNameForStats = model
-		}
+	if modelName != "" {
+		modelNameForStats = modelName
 	}
 
-	// 计算prompt和completion的分配比例
-	promptTokensCount := totalTokens / 3                     // 估计输入占1/3
-	completionTokensCount := totalTokens - promptTokensCount // 估计输出占2/3
-
 	// 添加到每日统计
 	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, true)
+	recordClientUsage(c, modelNameForStats, promptTokensCount, completionTokensCount, true)
 
-	rl.Info("流式响应完成，总tokens=%d (prompt=%d, completion=%d)，处理了 %d 个事件",
-		totalTokens, promptTokensCount, completionTokensCount, eventCount)
+	rl.Info("流式响应完成，总tokens=%d (prompt=%d, completion=%d，来源: %s)，处理了 %d 个事件",
+		totalTokens, promptTokensCount, completionTokensCount, tokenSource, eventCount)
 
 	// 确保响应已经完成并标记为结束
 	// 检查是否已经发送了[DONE]事件，如果没有，发送一个
@@ -2161,7 +2181,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 }
 
 // 处理假流式请求 - 调用非流式API后模拟流式返回
-func handleFakeStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) {
+func handleFakeStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) bool {
 	rl := GetRequestLogger(c)
 	
 	// 修改请求体，关闭流式
@@ -2169,7 +2189,7 @@ func handleFakeStreamRequest(c *gin.Context, targetURL string, transformedBody [
 	if err := json.Unmarshal(transformedBody, &requestData); err != nil {
 		rl.Error("解析请求体失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析请求失败"})
-		return
+		return false
 	}
 	
 	// 关闭流式
@@ -2180,11 +2200,12 @@ func handleFakeStreamRequest(c *gin.Context, targetURL string, transformedBody [
 	success, err := processOpenAIRequest(c, targetURL, nonStreamBody, originalBody, requestType, modelName, tokenEstimate, c.Request.URL.Path)
 	if !success || err != nil {
 		rl.Error("非流式API调用失败: %v", err)
-		return
+		return false
 	}
 	
 	// 假流式已在processOpenAIRequest中处理响应转换
 	rl.Info("假流式请求处理完成")
+	return true
 }
 
 // convertToFakeStream 将非流式响应转换为流式格式
@@ -2511,8 +2532,8 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 更新密钥失败记录，按错误类型冷却密钥
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
 		c.JSON(resp.StatusCode, gin.H{
 			"error": fmt.Sprintf("API请求失败，状态码: %d", resp.StatusCode),
 		})
@@ -0,0 +1,215 @@
+/**
+  @author: Hanhai
+  @desc: 流式请求对冲模块，首个数据块超时未到达时使用另一个密钥发送相同请求，使用先返回数据的响应
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/pkg/utils"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// 启动以来启用对冲的流式请求数、发送了对冲请求的次数和对冲请求胜出的次数
+	hedgeRequests atomic.Int64
+	hedgeSent     atomic.Int64
+	hedgeWins     atomic.Int64
+)
+
+// HedgeStats 请求对冲统计
+type HedgeStats struct {
+	Enabled   bool    `json:"enabled"`    // 是否启用
+	Requests  int64   `json:"requests"`   // 启用对冲的流式请求数
+	Hedged    int64   `json:"hedged"`     // 发送了对冲请求的次数
+	Wins      int64   `json:"wins"`       // 对冲请求先返回数据的次数
+	HedgeRate float64 `json:"hedge_rate"` // 对冲率
+}
+
+// GetHedgeStats 获取请求对冲统计
+func GetHedgeStats() HedgeStats {
+	stats := HedgeStats{
+		Enabled:  config.GetConfig().ApiProxy.Hedging.Enabled,
+		Requests: hedgeRequests.Load(),
+		Hedged:   hedgeSent.Load(),
+		Wins:     hedgeWins.Load(),
+	}
+	if stats.Requests > 0 {
+		stats.HedgeRate = float64(stats.Hedged) / float64(stats.Requests)
+	}
+	return stats
+}
+
+// streamAttempt 一次流式请求
+type streamAttempt struct {
+	apiKey string
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// succeeded 判断请求是否已成功返回首个数据块
+func (a *streamAttempt) succeeded() bool {
+	return a.err == nil && a.resp.StatusCode == http.StatusOK
+}
+
+// discard 关闭未使用的响应
+func (a *streamAttempt) discard() {
+	a.cancel()
+	if a.resp != nil {
+		a.resp.Body.Close()
+	}
+}
+
+// reportFailure 记录失败请求的密钥状态并关闭响应，上游返回错误状态码时按错误类型冷却密钥
+func (a *streamAttempt) reportFailure() {
+	if a.resp == nil {
+		key.UpdateApiKeyStatus(a.apiKey, false)
+		return
+	}
+	body, _ := io.ReadAll(a.resp.Body)
+	a.resp.Body.Close()
+	key.ReportApiKeyResponse(a.apiKey, a.resp.StatusCode, a.resp.Header, body)
+}
+
+// prefixedBody 先返回已读取的首个数据块，再继续读取原响应体
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// readFirstChunk 读取响应的首个数据块，读取到的数据在之后读取响应体时重新返回
+func readFirstChunk(resp *http.Response) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			resp.Body = &prefixedBody{
+				Reader: io.MultiReader(bytes.NewReader(buf[:n]), resp.Body),
+				Closer: resp.Body,
+			}
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+}
+
+// sendHedgedStreamRequest 发送流式请求，首个数据块在配置的延迟内未到达时使用另一个密钥发送对冲请求
+// 返回先收到数据的请求所用的密钥和响应，另一个请求会被取消且不计入密钥和每日统计；都失败时返回最先失败的请求
+func sendHedgedStreamRequest(c *gin.Context, client *http.Client, ctx context.Context, newRequest func(context.Context, string) (*http.Request, error), apiKey string, requestType string, modelName string, tokenEstimate int) (string, *http.Response, error) {
+	rl := GetRequestLogger(c)
+	hedgeRequests.Add(1)
+
+	results := make(chan *streamAttempt, 2)
+	// 每个请求的取消函数，按密钥区分
+	cancels := make(map[string]context.CancelFunc)
+	start := func(apiKey string) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[apiKey] = cancel
+		go func() {
+			result := &streamAttempt{apiKey: apiKey, cancel: cancel}
+			req, err := newRequest(attemptCtx, apiKey)
+			if err == nil {
+				result.resp, result.err = client.Do(req)
+			} else {
+				result.err = err
+			}
+			if result.succeeded() {
+				if err := readFirstChunk(result.resp); err != nil {
+					result.resp, result.err = nil, err
+				}
+			}
+			results <- result
+		}()
+	}
+
+	start(apiKey)
+	pending := 1
+	delay := config.GetConfig().ApiProxy.Hedging.GetDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var failed *streamAttempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			hedgeKey := pickHedgeKey(apiKey, requestType, modelName, tokenEstimate)
+			if hedgeKey == "" {
+				rl.Info("首个数据块在%v内未到达，但没有其他可用密钥，不发送对冲请求", delay)
+				continue
+			}
+			rl.Info("首个数据块在%v内未到达，使用密钥 %s 发送对冲请求", delay, utils.MaskKey(hedgeKey))
+			hedgeSent.Add(1)
+			start(hedgeKey)
+			pending++
+
+		case result := <-results:
+			pending--
+			if !result.succeeded() {
+				if failed == nil {
+					failed = result
+				} else {
+					// 两个请求都失败时只返回最先失败的请求，另一个请求在这里记录失败
+					result.reportFailure()
+				}
+				continue
+			}
+
+			// 取消其他请求，未完成的请求返回后关闭响应
+			for attemptKey, cancel := range cancels {
+				if attemptKey != result.apiKey {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go func(pending int) {
+					for i := 0; i < pending; i++ {
+						(<-results).discard()
+					}
+				}(pending)
+			}
+			// 已失败的请求不再返回给调用者，记录密钥失败
+			if failed != nil {
+				failed.reportFailure()
+			}
+
+			if result.apiKey != apiKey {
+				hedgeWins.Add(1)
+				rl.Info("对冲请求先返回数据，使用密钥 %s 的响应", utils.MaskKey(result.apiKey))
+			}
+			return result.apiKey, result.resp, nil
+		}
+	}
+
+	return failed.apiKey, failed.resp, failed.err
+}
+
+// pickHedgeKey 选择与原请求不同的密钥用于对冲请求，没有其他可用密钥时返回空字符串
+func pickHedgeKey(apiKey string, requestType string, modelName string, tokenEstimate int) string {
+	// 密钥选择大多使用轮询，多尝试几次以获得不同的密钥
+	for i := 0; i < 3; i++ {
+		hedgeKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+		if err != nil {
+			return ""
+		}
+		if hedgeKey != apiKey {
+			return hedgeKey
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeUpstream 模拟上游，按请求使用的密钥返回不同的响应
+type hedgeUpstream struct {
+	mu        sync.Mutex
+	behaviors map[string]string
+	cancelled map[string]bool
+}
+
+func (u *hedgeUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	u.mu.Lock()
+	behavior := u.behaviors[apiKey]
+	u.mu.Unlock()
+
+	switch behavior {
+	case "fast":
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: "+apiKey+"\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, "data: [DONE]\n\n")
+	case "late":
+		// 响应头立即返回，首个数据块在对冲请求发出后才到达
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "data: "+apiKey+"\n\n")
+	case "hang":
+		// 首个数据块一直不到达，直到请求被取消
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		u.mu.Lock()
+		u.cancelled[apiKey] = true
+		u.mu.Unlock()
+	case "late-error":
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	case "limited":
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// wasCancelled 等待并返回密钥对应的请求是否已被取消
+func (u *hedgeUpstream) wasCancelled(apiKey string) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		u.mu.Lock()
+		cancelled := u.cancelled[apiKey]
+		u.mu.Unlock()
+		if cancelled {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSendHedgedStreamRequest(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.ApiProxy.Hedging.Enabled = true
+		cfg.ApiProxy.Hedging.DelayMs = 20
+	})
+
+	tests := []struct {
+		name         string
+		primary      string
+		hedge        string
+		wantKey      string
+		wantStatus   int
+		wantHedged   int64
+		wantHedgeWin int64
+		// 胜出方之外的请求：被取消的请求不计入密钥统计，失败的请求冷却密钥
+		cancelled   string
+		rateLimited string
+	}{
+		{name: "primary answers before the delay", primary: "fast", hedge: "fast", wantKey: "primary", wantStatus: http.StatusOK},
+		{name: "hedge wins", primary: "hang", hedge: "fast", wantKey: "hedge", wantStatus: http.StatusOK, wantHedged: 1, wantHedgeWin: 1, cancelled: "primary"},
+		{name: "primary wins after hedge fails", primary: "late", hedge: "limited", wantKey: "primary", wantStatus: http.StatusOK, wantHedged: 1, rateLimited: "hedge"},
+		{name: "both fail", primary: "late-error", hedge: "limited", wantKey: "hedge", wantStatus: http.StatusTooManyRequests, wantHedged: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每次使用新的密钥，避免之前的冷却状态影响对冲密钥的选择
+			suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+			keys := map[string]string{
+				"primary": "sk-hedge-primary-" + suffix,
+				"hedge":   "sk-hedge-other-" + suffix,
+			}
+			upstream := &hedgeUpstream{behaviors: map[string]string{keys["primary"]: tt.primary, keys["hedge"]: tt.hedge}, cancelled: map[string]bool{}}
+			server := httptest.NewServer(upstream)
+			defer server.Close()
+			for _, apiKey := range keys {
+				config.AddApiKey(apiKey, 10)
+				defer config.MarkApiKeyForDeletion(apiKey)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			newRequest := func(ctx context.Context, apiKey string) (*http.Request, error) {
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+				if err == nil {
+					req.Header.Set("Authorization", "Bearer "+apiKey)
+				}
+				return req, err
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			hedged, wins := hedgeSent.Load(), hedgeWins.Load()
+
+			apiKey, resp, err := sendHedgedStreamRequest(c, server.Client(), ctx, newRequest, keys["primary"], "chat", "Qwen/Qwen2.5-7B-Instruct", 10)
+
+			if apiKey != keys[tt.wantKey] {
+				t.Errorf("returned key = %s, want %s", apiKey, keys[tt.wantKey])
+			}
+			if tt.wantStatus == http.StatusOK {
+				if err != nil {
+					t.Fatalf("sendHedgedStreamRequest() error = %v", err)
+				}
+				// 已读取的首个数据块在读取响应体时重新返回
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if !strings.HasPrefix(string(body), "data: "+apiKey+"\n\n") {
+					t.Errorf("body = %q, want the winner's stream from the first chunk", body)
+				}
+			} else if resp == nil || resp.StatusCode != tt.wantStatus {
+				t.Errorf("response = %v, err = %v, want status %d", resp, err, tt.wantStatus)
+			}
+
+			if got := hedgeSent.Load() - hedged; got != tt.wantHedged {
+				t.Errorf("hedged requests = %d, want %d", got, tt.wantHedged)
+			}
+			if got := hedgeWins.Load() - wins; got != tt.wantHedgeWin {
+				t.Errorf("hedge wins = %d, want %d", got, tt.wantHedgeWin)
+			}
+			if tt.cancelled != "" {
+				if !upstream.wasCancelled(keys[tt.cancelled]) {
+					t.Errorf("losing %s request was not cancelled", tt.cancelled)
+				}
+				if got := findApiKey(t, keys[tt.cancelled]); got.TotalCalls != 0 || got.ConsecutiveFailures != 0 || got.CoolingDown() {
+					t.Errorf("cancelled key stats = %d calls, %d failures, cooling %v, want untouched", got.TotalCalls, got.ConsecutiveFailures, got.CoolingDown())
+				}
+			}
+			if tt.rateLimited != "" {
+				if got := findApiKey(t, keys[tt.rateLimited]); got.CooldownReason != config.KeyCooldownRateLimited {
+					t.Errorf("failed key cooldown reason = %q, want %q", got.CooldownReason, config.KeyCooldownRateLimited)
+				}
+			}
+		})
+	}
+}
+
+// findApiKey 返回内存中的密钥状态
+func findApiKey(t *testing.T, key string) config.ApiKey {
+	t.Helper()
+	for _, k := range config.GetApiKeys() {
+		if k.Key == key {
+			return k
+		}
+	}
+	t.Fatalf("API key %s not found", key)
+	return config.ApiKey{}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/testutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, func(dir string) (func(), error) {
+		if err := model.InitModelDB(filepath.Join(dir, "models.db")); err != nil {
+			return nil, err
+		}
+		if err := config.InitConfigDB(filepath.Join(dir, "config.db")); err != nil {
+			return nil, err
+		}
+		if err := config.InitApiKeysDB(); err != nil {
+			return nil, err
+		}
+		if err := config.EnsureBatchTables(); err != nil {
+			return nil, err
+		}
+		if err := config.EnsureClientKeysTable(); err != nil {
+			return nil, err
+		}
+		return func() {
+			config.CloseConfigDB()
+			model.CloseModelDB()
+		}, nil
+	})
+}
+
+// mustJSON 解析JSON字符串，用于构造测试数据
+func mustJSON(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+// assertJSONEqual 比较两个值序列化为JSON后是否相同，忽略map的类型差异
+func assertJSONEqual(t *testing.T, got interface{}, want string) {
+	t.Helper()
+	gotBytes, ok := got.([]byte)
+	if !ok {
+		var err error
+		if gotBytes, err = json.Marshal(got); err != nil {
+			t.Fatalf("marshal got: %v", err)
+		}
+	}
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(gotBytes, &gotValue); err != nil {
+		t.Fatalf("got is not valid JSON %s: %v", gotBytes, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid want JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got  %s\nwant %s", gotBytes, want)
+	}
+}
+
+// setTestConfig 使用修改后的空配置运行测试，测试结束后恢复原配置
+func setTestConfig(t *testing.T, modify func(cfg *config.Config)) {
+	t.Helper()
+	original := config.GetConfig()
+	cfg := &config.Config{}
+	modify(cfg)
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() {
+		config.UpdateConfig(original)
+	})
+}
@@ -0,0 +1,76 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求指标中间件，按路由、实际使用的模型和状态码记录请求数和耗时
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/middleware"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按完整路径匹配的路由（不含/v1前缀）
+var metricsRoutes = map[string]bool{
+	"/chat/completions":      true,
+	"/completions":           true,
+	"/embeddings":            true,
+	"/images/generations":    true,
+	"/audio/transcriptions":  true,
+	"/audio/translations":    true,
+	"/audio/speech":          true,
+	"/video/submit":          true,
+	"/video/status":          true,
+	"/models":                true,
+	"/rerank":                true,
+	"/user/info":             true,
+	"/messages":              true,
+	"/messages/count_tokens": true,
+	// Ollama接口模拟
+	"/api/chat":       true,
+	"/api/generate":   true,
+	"/api/embed":      true,
+	"/api/embeddings": true,
+	"/api/tags":       true,
+	"/api/show":       true,
+}
+
+// 按前缀匹配的路由，路径中带有资源ID
+var metricsRoutePrefixes = []string{"/responses", "/files", "/batches", "/video/download"}
+
+// metricsRoute 返回请求路径对应的路由标签，去掉/v1前缀并合并路径中的资源ID，未知路径记为other，避免标签数无限增长
+func metricsRoute(path string) string {
+	if strings.HasPrefix(path, "/v1beta/models/") {
+		return "/v1beta/models"
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/v1"), "/")
+	if metricsRoutes[path] {
+		return path
+	}
+	for _, prefix := range metricsRoutePrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return prefix
+		}
+	}
+	return "other"
+}
+
+// MetricsMiddleware 记录代理请求的指标，需要放在API密钥验证之前，以便记录被拒绝的请求
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// 使用实际响应的模型，切换到备用模型时记为备用模型
+		modelName := c.Writer.Header().Get(ServedModelHeader)
+		if modelName == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+			// Gemini请求的模型在路径中，不需要读取请求体
+			modelName = middleware.RequestModel(c)
+		}
+		metrics.RecordRequest(metricsRoute(c.Request.URL.Path), modelName, c.Writer.Status(), time.Since(start))
+	}
+}
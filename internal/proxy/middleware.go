@@ -35,7 +35,8 @@ func RequestLoggingMiddleware() gin.HandlerFunc {
 		}
 
 		// 如果请求不是代理到外部API的，也跳过日志记录
-		if !strings.HasPrefix(c.Request.URL.Path, "/api/") && !strings.HasPrefix(c.Request.URL.Path, "/v1/") {
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/") && !strings.HasPrefix(c.Request.URL.Path, "/v1/") &&
+			!strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
 			c.Next()
 			return
 		}
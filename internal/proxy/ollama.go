@@ -0,0 +1,716 @@
+/**
+  @author: Hanhai
+  @desc: Ollama接口模拟模块，将/api/chat、/api/generate、/api/embed等请求转换为OpenAI格式处理，并以Ollama格式（NDJSON）返回
+**/
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/model"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 模拟的Ollama版本号，部分客户端会据此判断支持的功能
+const ollamaVersion = "0.6.0"
+
+// isOllamaPath 判断路径是否由Ollama模拟处理
+func isOllamaPath(path string) bool {
+	switch path {
+	case "/tags", "/show", "/chat", "/generate", "/embed", "/embeddings", "/version", "/ps":
+		return true
+	}
+	return false
+}
+
+// OllamaOnly 只对由Ollama接口模拟处理的请求应用中间件，其他 /api/* 请求按原样转发到上游
+func OllamaOnly(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.GetConfig()
+		if cfg == nil || !cfg.ApiProxy.OllamaMode || !isOllamaPath(c.Param("path")) {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
+
+// HandleOllamaRequest 处理Ollama格式的 /api/* 请求
+func HandleOllamaRequest(c *gin.Context) {
+	rl := GetRequestLogger(c)
+	path := c.Param("path")
+
+	switch path {
+	case "/version":
+		c.JSON(http.StatusOK, gin.H{"version": ollamaVersion})
+		return
+	case "/ps":
+		// 没有本地加载的模型
+		c.JSON(http.StatusOK, gin.H{"models": []interface{}{}})
+		return
+	case "/tags":
+		handleOllamaTags(c)
+		return
+	}
+
+	if c.Request.Method != http.MethodPost {
+		writeOllamaError(c, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeOllamaError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &request); err != nil {
+		writeOllamaError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	modelName, _ := request["model"].(string)
+	if modelName == "" {
+		// 旧版客户端使用name字段
+		modelName, _ = request["name"].(string)
+	}
+	if modelName == "" {
+		writeOllamaError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+	rl.SetModel(modelName)
+
+	if path == "/show" {
+		handleOllamaShow(c, modelName)
+		return
+	}
+
+	var (
+		mode       string
+		targetPath string
+		openAIBody map[string]interface{}
+	)
+	switch path {
+	case "/chat":
+		mode, targetPath = "chat", "/chat/completions"
+		openAIBody, err = convertOllamaChatRequest(request, modelName)
+	case "/generate":
+		mode, targetPath = "generate", "/chat/completions"
+		openAIBody, err = convertOllamaGenerateRequest(request, modelName)
+	case "/embed":
+		mode, targetPath = "embed", "/embeddings"
+		openAIBody = map[string]interface{}{"model": modelName, "input": request["input"]}
+	case "/embeddings":
+		mode, targetPath = "embeddings", "/embeddings"
+		openAIBody = map[string]interface{}{"model": modelName, "input": request["prompt"]}
+	}
+	if err != nil {
+		writeOllamaError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 没有提示词的generate请求在Ollama中表示加载模型，直接返回完成
+	if mode == "generate" && openAIBody == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"model":       modelName,
+			"created_at":  time.Now().UTC().Format(time.RFC3339Nano),
+			"response":    "",
+			"done":        true,
+			"done_reason": "load",
+		})
+		return
+	}
+
+	chatBody, err := json.Marshal(openAIBody)
+	if err != nil {
+		writeOllamaError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to build request body: %v", err))
+		return
+	}
+
+	rl.Info("检测到Ollama %s请求，转换为OpenAI格式处理，模型: %s", path, modelName)
+	serveWithAdapter(c, newOllamaAdapter(modelName, mode), targetPath, chatBody)
+}
+
+// writeOllamaError 以Ollama格式返回错误
+func writeOllamaError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"error": message})
+}
+
+// ollamaStream 读取stream参数，Ollama默认使用流式输出
+func ollamaStream(request map[string]interface{}) bool {
+	if stream, ok := request["stream"].(bool); ok {
+		return stream
+	}
+	return true
+}
+
+// applyOllamaOptions 将Ollama的options和format转换为OpenAI请求参数
+func applyOllamaOptions(request map[string]interface{}, chatRequest map[string]interface{}) {
+	if options, ok := request["options"].(map[string]interface{}); ok {
+		for _, name := range []string{"temperature", "top_p", "top_k", "seed", "stop", "presence_penalty", "frequency_penalty"} {
+			if value, ok := options[name]; ok {
+				chatRequest[name] = value
+			}
+		}
+		// num_predict为-1表示不限制长度
+		if numPredict, ok := options["num_predict"].(float64); ok && numPredict > 0 {
+			chatRequest["max_tokens"] = int(numPredict)
+		}
+	}
+
+	switch format := request["format"].(type) {
+	case string:
+		if format == "json" {
+			chatRequest["response_format"] = map[string]interface{}{"type": "json_object"}
+		}
+	case map[string]interface{}:
+		chatRequest["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "response",
+				"schema": format,
+			},
+		}
+	}
+
+	stream := ollamaStream(request)
+	chatRequest["stream"] = stream
+	if stream {
+		chatRequest["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+}
+
+// ollamaImageContent 将文本和Ollama的base64图片列表转换为OpenAI的多模态内容
+func ollamaImageContent(text string, images []interface{}) interface{} {
+	if len(images) == 0 {
+		return text
+	}
+	parts := make([]interface{}, 0, len(images)+1)
+	for _, item := range images {
+		data, ok := item.(string)
+		if !ok || data == "" {
+			continue
+		}
+		if !strings.HasPrefix(data, "data:") {
+			data = "data:image/jpeg;base64," + data
+		}
+		parts = append(parts, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": data},
+		})
+	}
+	if text != "" {
+		parts = append(parts, map[string]interface{}{"type": "text", "text": text})
+	}
+	return parts
+}
+
+// convertOllamaChatRequest 将Ollama的/api/chat请求转换为OpenAI chat/completions请求
+func convertOllamaChatRequest(request map[string]interface{}, modelName string) (map[string]interface{}, error) {
+	rawMessages, ok := request["messages"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("messages is required")
+	}
+
+	// 工具结果只带工具名，需要找回对应调用的ID
+	pendingCalls := make(map[string][]string)
+	messages := make([]interface{}, 0, len(rawMessages))
+	for _, raw := range rawMessages {
+		msg, _ := raw.(map[string]interface{})
+		if msg == nil {
+			continue
+		}
+		role, _ := msg["role"].(string)
+		content, _ := msg["content"].(string)
+		images, _ := msg["images"].([]interface{})
+
+		switch role {
+		case "assistant":
+			message := map[string]interface{}{"role": "assistant", "content": content}
+			if toolCalls, ok := msg["tool_calls"].([]interface{}); ok && len(toolCalls) > 0 {
+				calls := make([]interface{}, 0, len(toolCalls))
+				for _, item := range toolCalls {
+					tc, _ := item.(map[string]interface{})
+					fn, _ := tc["function"].(map[string]interface{})
+					if fn == nil {
+						continue
+					}
+					name, _ := fn["name"].(string)
+					arguments := "{}"
+					if args, ok := fn["arguments"]; ok && args != nil {
+						if s, ok := args.(string); ok {
+							arguments = s
+						} else if data, err := json.Marshal(args); err == nil {
+							arguments = string(data)
+						}
+					}
+					id := "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24]
+					pendingCalls[name] = append(pendingCalls[name], id)
+					calls = append(calls, map[string]interface{}{
+						"id":   id,
+						"type": "function",
+						"function": map[string]interface{}{
+							"name":      name,
+							"arguments": arguments,
+						},
+					})
+				}
+				message["tool_calls"] = calls
+			}
+			messages = append(messages, message)
+		case "tool":
+			name, _ := msg["tool_name"].(string)
+			if name == "" {
+				name, _ = msg["name"].(string)
+			}
+			id := "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:24]
+			if ids := pendingCalls[name]; len(ids) > 0 {
+				id = ids[0]
+				pendingCalls[name] = ids[1:]
+			}
+			messages = append(messages, map[string]interface{}{
+				"role":         "tool",
+				"tool_call_id": id,
+				"content":      content,
+			})
+		case "system":
+			messages = append(messages, map[string]interface{}{"role": "system", "content": content})
+		default:
+			messages = append(messages, map[string]interface{}{
+				"role":    "user",
+				"content": ollamaImageContent(content, images),
+			})
+		}
+	}
+
+	chatRequest := map[string]interface{}{
+		"model":    modelName,
+		"messages": messages,
+	}
+	if tools, ok := request["tools"].([]interface{}); ok && len(tools) > 0 {
+		chatRequest["tools"] = tools
+	}
+	applyOllamaOptions(request, chatRequest)
+	return chatRequest, nil
+}
+
+// convertOllamaGenerateRequest 将Ollama的/api/generate请求转换为OpenAI chat/completions请求，没有提示词时返回nil
+func convertOllamaGenerateRequest(request map[string]interface{}, modelName string) (map[string]interface{}, error) {
+	prompt, _ := request["prompt"].(string)
+	images, _ := request["images"].([]interface{})
+	if prompt == "" && len(images) == 0 {
+		return nil, nil
+	}
+
+	messages := make([]interface{}, 0, 2)
+	if system, ok := request["system"].(string); ok && system != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": system})
+	}
+	messages = append(messages, map[string]interface{}{
+		"role":    "user",
+		"content": ollamaImageContent(prompt, images),
+	})
+
+	chatRequest := map[string]interface{}{
+		"model":    modelName,
+		"messages": messages,
+	}
+	applyOllamaOptions(request, chatRequest)
+	return chatRequest, nil
+}
+
+// ollamaFamily 根据模型ID推断模型系列
+func ollamaFamily(modelID string) string {
+	name := modelID
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if idx := strings.IndexAny(name, "-_."); idx > 0 {
+		name = name[:idx]
+	}
+	return strings.ToLower(name)
+}
+
+// ollamaDetails 构建模型的details字段
+func ollamaDetails(m model.Model) map[string]interface{} {
+	family := ollamaFamily(m.ID)
+	return map[string]interface{}{
+		"parent_model":       "",
+		"format":             "api",
+		"family":             family,
+		"families":           []string{family},
+		"parameter_size":     "",
+		"quantization_level": "",
+	}
+}
+
+// ollamaCapabilities 根据模型类型返回Ollama能力列表
+func ollamaCapabilities(modelType int) []string {
+	switch modelType {
+	case 1:
+		return []string{"completion", "tools"}
+	case 5:
+		return []string{"embedding"}
+	case 7:
+		return []string{"completion", "thinking"}
+	default:
+		return []string{"completion"}
+	}
+}
+
+// ollamaModelTypeName 返回模型类型的名称
+func ollamaModelTypeName(modelType int) string {
+	switch modelType {
+	case 1:
+		return "对话"
+	case 2:
+		return "生图"
+	case 3:
+		return "视频"
+	case 4:
+		return "语音"
+	case 5:
+		return "嵌入"
+	case 6:
+		return "重排序"
+	case 7:
+		return "推理"
+	default:
+		return "未知"
+	}
+}
+
+// handleOllamaTags 以Ollama格式返回模型列表
+func handleOllamaTags(c *gin.Context) {
+	models, err := model.GetAllModels()
+	if err != nil {
+		GetRequestLogger(c).Error("获取模型列表失败: %v", err)
+		writeOllamaError(c, http.StatusInternalServerError, fmt.Sprintf("获取模型列表失败: %v", err))
+		return
+	}
+
+	modifiedAt := time.Now().UTC().Format(time.RFC3339Nano)
+	result := make([]interface{}, 0, len(models))
+	for _, m := range models {
+		if isModelDisabled(m.ID) {
+			continue
+		}
+		digest := sha256.Sum256([]byte(m.ID))
+		result = append(result, map[string]interface{}{
+			"name":        m.ID,
+			"model":       m.ID,
+			"modified_at": modifiedAt,
+			"size":        0,
+			"digest":      hex.EncodeToString(digest[:]),
+			"details":     ollamaDetails(m),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"models": result})
+}
+
+// handleOllamaShow 以Ollama格式返回模型信息
+func handleOllamaShow(c *gin.Context, modelName string) {
+	models, err := model.GetAllModels()
+	if err != nil {
+		GetRequestLogger(c).Error("获取模型列表失败: %v", err)
+		writeOllamaError(c, http.StatusInternalServerError, fmt.Sprintf("获取模型列表失败: %v", err))
+		return
+	}
+
+	for _, m := range models {
+		if m.ID != modelName || isModelDisabled(m.ID) {
+			continue
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"modelfile":  "",
+			"parameters": "",
+			"template":   "",
+			"details":    ollamaDetails(m),
+			"model_info": gin.H{
+				"general.architecture":    ollamaFamily(m.ID),
+				"flowsilicon.type":        m.Type,
+				"flowsilicon.type_name":   ollamaModelTypeName(m.Type),
+				"flowsilicon.strategy":    m.StrategyID,
+				"flowsilicon.is_free":     m.IsFree,
+				"flowsilicon.is_giftable": m.IsGiftable,
+				"flowsilicon.call_count":  m.CallCount,
+			},
+			"capabilities": ollamaCapabilities(m.Type),
+			"modified_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		return
+	}
+
+	writeOllamaError(c, http.StatusNotFound, fmt.Sprintf("model '%s' not found", modelName))
+}
+
+// ollamaAdapter 将OpenAI格式的响应转换为Ollama格式
+type ollamaAdapter struct {
+	model string
+	mode  string // chat、generate、embed、embeddings
+	start time.Time
+
+	doneReason       string
+	promptTokens     int
+	completionTokens int
+	toolCalls        []map[string]interface{}
+}
+
+// newOllamaAdapter 创建Ollama响应适配器
+func newOllamaAdapter(model string, mode string) *ollamaAdapter {
+	return &ollamaAdapter{model: model, mode: mode, start: time.Now()}
+}
+
+func (a *ollamaAdapter) contentType(stream bool) string {
+	if stream {
+		return "application/x-ndjson"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (a *ollamaAdapter) keepComments() bool {
+	return false
+}
+
+// line 生成一行NDJSON数据
+func (a *ollamaAdapter) line(payload map[string]interface{}) []byte {
+	data, _ := json.Marshal(payload)
+	return append(data, '\n')
+}
+
+// base 构建响应的公共字段
+func (a *ollamaAdapter) base() map[string]interface{} {
+	return map[string]interface{}{
+		"model":      a.model,
+		"created_at": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// message 构建chat模式的消息或generate模式的response字段
+func (a *ollamaAdapter) message(payload map[string]interface{}, content, thinking string, toolCalls []interface{}) {
+	if a.mode == "generate" {
+		payload["response"] = content
+		if thinking != "" {
+			payload["thinking"] = thinking
+		}
+		return
+	}
+	message := map[string]interface{}{"role": "assistant", "content": content}
+	if thinking != "" {
+		message["thinking"] = thinking
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	payload["message"] = message
+}
+
+// done 添加结束标记和统计字段
+func (a *ollamaAdapter) done(payload map[string]interface{}) {
+	payload["done"] = true
+	payload["done_reason"] = ollamaDoneReason(a.doneReason)
+	payload["total_duration"] = time.Since(a.start).Nanoseconds()
+	payload["load_duration"] = 0
+	payload["prompt_eval_count"] = a.promptTokens
+	payload["prompt_eval_duration"] = 0
+	payload["eval_count"] = a.completionTokens
+	payload["eval_duration"] = 0
+}
+
+// ollamaDoneReason 将OpenAI的finish_reason转换为Ollama的done_reason
+func ollamaDoneReason(finishReason string) string {
+	if finishReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+// readUsage 读取OpenAI格式的用量信息
+func (a *ollamaAdapter) readUsage(data map[string]interface{}) {
+	usage, ok := data["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if v, ok := usage["prompt_tokens"].(float64); ok {
+		a.promptTokens = int(v)
+	}
+	if v, ok := usage["completion_tokens"].(float64); ok {
+		a.completionTokens = int(v)
+	}
+}
+
+// ollamaToolCall 将OpenAI的工具调用转换为Ollama格式，参数为JSON对象
+func ollamaToolCall(name interface{}, arguments string) map[string]interface{} {
+	var args interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		args = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"function": map[string]interface{}{
+			"name":      name,
+			"arguments": args,
+		},
+	}
+}
+
+// convertResponse 转换非流式响应
+func (a *ollamaAdapter) convertResponse(status int, body []byte) []byte {
+	data := firstJSONObject(body)
+	if status >= 400 || data == nil || data["error"] != nil {
+		result, _ := json.Marshal(map[string]interface{}{"error": extractErrorMessage(data, body)})
+		return result
+	}
+
+	a.readUsage(data)
+
+	if a.mode == "embed" || a.mode == "embeddings" {
+		embeddings := make([]interface{}, 0)
+		if items, ok := data["data"].([]interface{}); ok {
+			for _, item := range items {
+				if entry, ok := item.(map[string]interface{}); ok {
+					embeddings = append(embeddings, entry["embedding"])
+				}
+			}
+		}
+		var result []byte
+		if a.mode == "embeddings" {
+			var embedding interface{} = []interface{}{}
+			if len(embeddings) > 0 {
+				embedding = embeddings[0]
+			}
+			result, _ = json.Marshal(map[string]interface{}{"embedding": embedding})
+		} else {
+			result, _ = json.Marshal(map[string]interface{}{
+				"model":             a.model,
+				"embeddings":        embeddings,
+				"total_duration":    time.Since(a.start).Nanoseconds(),
+				"load_duration":     0,
+				"prompt_eval_count": a.promptTokens,
+			})
+		}
+		return result
+	}
+
+	var content, thinking string
+	var toolCalls []interface{}
+	if choices, ok := data["choices"].([]interface{}); ok && len(choices) > 0 {
+		choice, _ := choices[0].(map[string]interface{})
+		if fr, ok := choice["finish_reason"].(string); ok {
+			a.doneReason = fr
+		}
+		if message, ok := choice["message"].(map[string]interface{}); ok {
+			content, _ = message["content"].(string)
+			thinking, _ = message["reasoning_content"].(string)
+			if calls, ok := message["tool_calls"].([]interface{}); ok {
+				for _, item := range calls {
+					tc, _ := item.(map[string]interface{})
+					fn, _ := tc["function"].(map[string]interface{})
+					if fn == nil {
+						continue
+					}
+					arguments, _ := fn["arguments"].(string)
+					toolCalls = append(toolCalls, ollamaToolCall(fn["name"], arguments))
+				}
+			}
+		}
+	}
+
+	payload := a.base()
+	a.message(payload, content, thinking, toolCalls)
+	a.done(payload)
+	result, _ := json.Marshal(payload)
+	return result
+}
+
+// convertChunk 转换OpenAI流式数据块
+func (a *ollamaAdapter) convertChunk(chunk map[string]interface{}) []byte {
+	if errData, ok := chunk["error"]; ok {
+		return a.line(map[string]interface{}{"error": extractErrorMessage(map[string]interface{}{"error": errData}, nil)})
+	}
+
+	a.readUsage(chunk)
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if choice == nil {
+		return nil
+	}
+	if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
+		a.doneReason = fr
+	}
+	delta, _ := choice["delta"].(map[string]interface{})
+	if delta == nil {
+		return nil
+	}
+
+	// 工具调用参数分片到达，结束前一次性输出
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, item := range toolCalls {
+			tc, _ := item.(map[string]interface{})
+			if tc == nil {
+				continue
+			}
+			index := 0
+			if idx, ok := tc["index"].(float64); ok && idx >= 0 {
+				index = int(idx)
+			}
+			for len(a.toolCalls) <= index {
+				a.toolCalls = append(a.toolCalls, map[string]interface{}{"name": "", "arguments": ""})
+			}
+			if fn, ok := tc["function"].(map[string]interface{}); ok {
+				if name, ok := fn["name"].(string); ok && name != "" {
+					a.toolCalls[index]["name"] = name
+				}
+				if args, ok := fn["arguments"].(string); ok {
+					a.toolCalls[index]["arguments"] = a.toolCalls[index]["arguments"].(string) + args
+				}
+			}
+		}
+	}
+
+	content, _ := delta["content"].(string)
+	thinking, _ := delta["reasoning_content"].(string)
+	if content == "" && thinking == "" {
+		return nil
+	}
+
+	payload := a.base()
+	a.message(payload, content, thinking, nil)
+	payload["done"] = false
+	return a.line(payload)
+}
+
+// finishStream 输出工具调用和包含统计信息的最后一行
+func (a *ollamaAdapter) finishStream() []byte {
+	var out []byte
+	if len(a.toolCalls) > 0 && a.mode == "chat" {
+		calls := make([]interface{}, 0, len(a.toolCalls))
+		for _, call := range a.toolCalls {
+			calls = append(calls, ollamaToolCall(call["name"], call["arguments"].(string)))
+		}
+		payload := a.base()
+		a.message(payload, "", "", calls)
+		payload["done"] = false
+		out = append(out, a.line(payload)...)
+	}
+
+	final := a.base()
+	a.message(final, "", "", nil)
+	a.done(final)
+	return append(out, a.line(final)...)
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertOllamaChatRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "defaults to streaming",
+			request: `{"messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`,
+			want:    `{"model":"m","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:    "options and json format",
+			request: `{"stream":false,"format":"json","options":{"temperature":0.1,"num_predict":32,"stop":["x"]},"messages":[{"role":"user","content":"hi"}]}`,
+			want:    `{"model":"m","stream":false,"temperature":0.1,"max_tokens":32,"stop":["x"],"response_format":{"type":"json_object"},"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:    "unlimited num_predict and schema format",
+			request: `{"stream":false,"format":{"type":"object"},"options":{"num_predict":-1},"messages":[{"role":"user","content":"hi"}]}`,
+			want:    `{"model":"m","stream":false,"response_format":{"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"}}},"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:    "images",
+			request: `{"stream":false,"messages":[{"role":"user","content":"what","images":["AAA"]}]}`,
+			want:    `{"model":"m","stream":false,"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,AAA"}},{"type":"text","text":"what"}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertOllamaChatRequest(mustJSON(t, tt.request), "m")
+			if err != nil {
+				t.Fatalf("convertOllamaChatRequest() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+
+	if _, err := convertOllamaChatRequest(mustJSON(t, `{}`), "m"); err == nil {
+		t.Error("convertOllamaChatRequest without messages error = nil, want error")
+	}
+}
+
+func TestConvertOllamaChatRequestToolCalls(t *testing.T) {
+	request := mustJSON(t, `{"stream":false,"messages":[
+		{"role":"user","content":"weather?"},
+		{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get","arguments":{"city":"sh"}}}]},
+		{"role":"tool","tool_name":"get","content":"sunny"}]}`)
+	got, err := convertOllamaChatRequest(request, "m")
+	if err != nil {
+		t.Fatalf("convertOllamaChatRequest() error = %v", err)
+	}
+
+	messages := got["messages"].([]interface{})
+	call := messages[1].(map[string]interface{})["tool_calls"].([]interface{})[0].(map[string]interface{})
+	if args := call["function"].(map[string]interface{})["arguments"]; args != `{"city":"sh"}` {
+		t.Errorf("tool call arguments = %v, want JSON string", args)
+	}
+	if result := messages[2].(map[string]interface{}); result["tool_call_id"] != call["id"] {
+		t.Errorf("tool result id = %v, want %v", result["tool_call_id"], call["id"])
+	}
+}
+
+func TestConvertOllamaGenerateRequest(t *testing.T) {
+	got, err := convertOllamaGenerateRequest(mustJSON(t, `{"prompt":"hi","system":"sys","stream":false}`), "m")
+	if err != nil {
+		t.Fatalf("convertOllamaGenerateRequest() error = %v", err)
+	}
+	assertJSONEqual(t, got, `{"model":"m","stream":false,"messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`)
+
+	// 没有提示词表示加载模型
+	if got, err := convertOllamaGenerateRequest(mustJSON(t, `{}`), "m"); got != nil || err != nil {
+		t.Errorf("convertOllamaGenerateRequest without prompt = %v, %v, want nil", got, err)
+	}
+}
+
+// ollamaLines 解析NDJSON输出，去掉随时间变化的字段
+func ollamaLines(t *testing.T, out []byte) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &payload); err != nil {
+			t.Fatalf("invalid NDJSON line %s: %v", line, err)
+		}
+		delete(payload, "created_at")
+		delete(payload, "total_duration")
+		lines = append(lines, payload)
+	}
+	return lines
+}
+
+func TestOllamaAdapterConvertResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			name:   "chat",
+			mode:   "chat",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"length","message":{"content":"hi","reasoning_content":"r"}}],"usage":{"prompt_tokens":3,"completion_tokens":2}}`,
+			want:   `{"model":"m","message":{"role":"assistant","content":"hi","thinking":"r"},"done":true,"done_reason":"length","load_duration":0,"prompt_eval_count":3,"prompt_eval_duration":0,"eval_count":2,"eval_duration":0}`,
+		},
+		{
+			name:   "chat tool call",
+			mode:   "chat",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"tool_calls","message":{"content":"","tool_calls":[{"function":{"name":"f","arguments":"{\"a\":1}"}}]}}]}`,
+			want:   `{"model":"m","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"f","arguments":{"a":1}}}]},"done":true,"done_reason":"stop","load_duration":0,"prompt_eval_count":0,"prompt_eval_duration":0,"eval_count":0,"eval_duration":0}`,
+		},
+		{
+			name:   "generate",
+			mode:   "generate",
+			status: 200,
+			body:   `{"choices":[{"finish_reason":"stop","message":{"content":"hi"}}]}`,
+			want:   `{"model":"m","response":"hi","done":true,"done_reason":"stop","load_duration":0,"prompt_eval_count":0,"prompt_eval_duration":0,"eval_count":0,"eval_duration":0}`,
+		},
+		{
+			name:   "embed",
+			mode:   "embed",
+			status: 200,
+			body:   `{"data":[{"embedding":[0.1,0.2]},{"embedding":[0.3]}],"usage":{"prompt_tokens":4}}`,
+			want:   `{"model":"m","embeddings":[[0.1,0.2],[0.3]],"load_duration":0,"prompt_eval_count":4}`,
+		},
+		{
+			name:   "legacy embeddings",
+			mode:   "embeddings",
+			status: 200,
+			body:   `{"data":[{"embedding":[0.1,0.2]}]}`,
+			want:   `{"embedding":[0.1,0.2]}`,
+		},
+		{
+			name:   "error",
+			mode:   "chat",
+			status: 404,
+			body:   `{"error":{"message":"model not found"}}`,
+			want:   `{"error":"model not found"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newOllamaAdapter("m", tt.mode)
+			assertJSONEqual(t, ollamaLines(t, a.convertResponse(tt.status, []byte(tt.body)))[0], tt.want)
+		})
+	}
+}
+
+func TestOllamaAdapterStream(t *testing.T) {
+	a := newOllamaAdapter("m", "chat")
+	var out []byte
+	for _, chunk := range []string{
+		`{"choices":[{"delta":{"content":"hel"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"name":"f","arguments":"{\"a\""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":1,"completion_tokens":2}}`,
+	} {
+		out = append(out, a.convertChunk(mustJSON(t, chunk))...)
+	}
+	out = append(out, a.finishStream()...)
+
+	lines := ollamaLines(t, out)
+	want := []string{
+		`{"model":"m","message":{"role":"assistant","content":"hel"},"done":false}`,
+		`{"model":"m","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"f","arguments":{"a":1}}}]},"done":false}`,
+		`{"model":"m","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","load_duration":0,"prompt_eval_count":1,"prompt_eval_duration":0,"eval_count":2,"eval_duration":0}`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %s", len(lines), len(want), out)
+	}
+	for i := range want {
+		assertJSONEqual(t, lines[i], want[i])
+	}
+}
+
+func TestOllamaOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		ollamaMode bool
+		path       string
+		wantApply  bool
+	}{
+		{"ollama path with emulation", true, "/chat", true},
+		{"ollama tags with emulation", true, "/tags", true},
+		{"passthrough path with emulation", true, "/v1/user/info", false},
+		{"ollama path without emulation", false, "/chat", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *config.Config) {
+				cfg.ApiProxy.OllamaMode = tt.ollamaMode
+			})
+
+			applied, reached := false, false
+			router := gin.New()
+			router.Any("/api/*path", OllamaOnly(func(c *gin.Context) {
+				applied = true
+				c.AbortWithStatus(http.StatusUnauthorized)
+			}), func(c *gin.Context) {
+				reached = true
+				c.Status(http.StatusOK)
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api"+tt.path, nil))
+
+			if applied != tt.wantApply || reached == tt.wantApply {
+				t.Errorf("middleware applied = %v, handler reached = %v, want applied %v", applied, reached, tt.wantApply)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+/**
+  @author: Hanhai
+  @desc: 下游调用方速率限制，按API密钥或IP使用令牌桶限制每分钟请求数和令牌数，响应完成后按实际用量核算
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文中保存本次请求令牌用量的键
+const rateLimitUsageKey = "rate_limit_usage"
+
+// 调用方空闲超过该时间后清理其令牌桶，此时令牌桶已经回满
+const rateLimitIdleTimeout = 10 * time.Minute
+
+// tokenBucket 令牌桶，容量为每分钟的限额，每秒恢复限额的1/60
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	updated  time.Time
+}
+
+// newTokenBucket 创建装满的令牌桶
+func newTokenBucket(capacity int, now time.Time) *tokenBucket {
+	return &tokenBucket{capacity: float64(capacity), tokens: float64(capacity), updated: now}
+}
+
+// refill 按经过的时间恢复令牌，限额变化时调整容量
+func (b *tokenBucket) refill(capacity int, now time.Time) {
+	if float64(capacity) != b.capacity {
+		b.tokens += float64(capacity) - b.capacity
+		b.capacity = float64(capacity)
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.capacity / 60
+	}
+	b.tokens = math.Min(b.tokens, b.capacity)
+	b.updated = now
+}
+
+// waitFor 返回桶内令牌恢复到amount需要等待的时间
+func (b *tokenBucket) waitFor(amount float64) time.Duration {
+	if b.tokens >= amount || b.capacity <= 0 {
+		return 0
+	}
+	return time.Duration((amount - b.tokens) / (b.capacity / 60) * float64(time.Second))
+}
+
+// remaining 返回桶内剩余的令牌数
+func (b *tokenBucket) remaining() int {
+	return int(math.Max(0, math.Floor(b.tokens)))
+}
+
+// callerBuckets 一个调用方的请求数和令牌数令牌桶，限额为0时对应的桶为nil
+type callerBuckets struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+	lastSeen time.Time
+}
+
+// rateLimiter 保存所有调用方的令牌桶
+type rateLimiter struct {
+	mu        sync.Mutex
+	callers   map[string]*callerBuckets
+	lastPrune time.Time
+}
+
+var limiter = &rateLimiter{callers: make(map[string]*callerBuckets)}
+
+// rateLimitResult 一次检查的结果，用于设置x-ratelimit-*响应头
+type rateLimitResult struct {
+	allowed           bool
+	limitType         string // 超出的限额类型：requests或tokens
+	retryAfter        time.Duration
+	limitRequests     int
+	limitTokens       int
+	remainingRequests int
+	remainingTokens   int
+	resetRequests     time.Duration
+	resetTokens       time.Duration
+}
+
+// bucketsLocked 获取调用方的令牌桶并按当前配置恢复令牌（已加锁）
+func (l *rateLimiter) bucketsLocked(caller string, limit config.RateLimitConfig, now time.Time) *callerBuckets {
+	if now.Sub(l.lastPrune) > rateLimitIdleTimeout {
+		for key, buckets := range l.callers {
+			if now.Sub(buckets.lastSeen) > rateLimitIdleTimeout {
+				delete(l.callers, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	buckets, ok := l.callers[caller]
+	if !ok {
+		buckets = &callerBuckets{}
+		l.callers[caller] = buckets
+	}
+	buckets.lastSeen = now
+
+	if limit.RequestsPerMinute <= 0 {
+		buckets.requests = nil
+	} else if buckets.requests == nil {
+		buckets.requests = newTokenBucket(limit.RequestsPerMinute, now)
+	} else {
+		buckets.requests.refill(limit.RequestsPerMinute, now)
+	}
+	if limit.TokensPerMinute <= 0 {
+		buckets.tokens = nil
+	} else if buckets.tokens == nil {
+		buckets.tokens = newTokenBucket(limit.TokensPerMinute, now)
+	} else {
+		buckets.tokens.refill(limit.TokensPerMinute, now)
+	}
+	return buckets
+}
+
+// acquire 检查调用方是否还有可用的请求数和令牌数，允许时扣除一次请求和预估的令牌数
+func (l *rateLimiter) acquire(caller string, limit config.RateLimitConfig, estimate int) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	buckets := l.bucketsLocked(caller, limit, now)
+
+	result := rateLimitResult{allowed: true}
+	if buckets.requests != nil {
+		if wait := buckets.requests.waitFor(1); wait > 0 {
+			result.allowed = false
+			result.limitType = "requests"
+			result.retryAfter = wait
+		}
+	}
+	// 预估令牌数超过限额时按限额计算，避免请求永远无法通过
+	cost := math.Min(float64(estimate), float64(limit.TokensPerMinute))
+	if result.allowed && buckets.tokens != nil {
+		if wait := buckets.tokens.waitFor(cost); wait > 0 {
+			result.allowed = false
+			result.limitType = "tokens"
+			result.retryAfter = wait
+		}
+	}
+	if result.allowed {
+		if buckets.requests != nil {
+			buckets.requests.tokens--
+		}
+		if buckets.tokens != nil {
+			buckets.tokens.tokens -= cost
+		}
+	}
+
+	if buckets.requests != nil {
+		result.limitRequests = limit.RequestsPerMinute
+		result.remainingRequests = buckets.requests.remaining()
+		result.resetRequests = buckets.requests.waitFor(buckets.requests.capacity)
+	}
+	if buckets.tokens != nil {
+		result.limitTokens = limit.TokensPerMinute
+		result.remainingTokens = buckets.tokens.remaining()
+		result.resetTokens = buckets.tokens.waitFor(buckets.tokens.capacity)
+	}
+	return result
+}
+
+// settle 按实际用量核算令牌数，实际用量少于预估时退还差额，多于预估时继续扣除，令牌数可以为负
+func (l *rateLimiter) settle(caller string, limit config.RateLimitConfig, estimate int, actual int) {
+	if limit.TokensPerMinute <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.bucketsLocked(caller, limit, time.Now())
+	if buckets.tokens == nil {
+		return
+	}
+	charged := math.Min(float64(estimate), float64(limit.TokensPerMinute))
+	buckets.tokens.tokens += charged - float64(actual)
+	buckets.tokens.tokens = math.Min(buckets.tokens.tokens, buckets.tokens.capacity)
+}
+
+// rateLimitUsage 记录一次请求的实际令牌用量，重试和备用模型的每次成功响应都会累加
+type rateLimitUsage struct {
+	mu     sync.Mutex
+	tokens int
+}
+
+// recordRateLimitUsage 累加本次请求的实际令牌用量，请求未经过速率限制时忽略
+func recordRateLimitUsage(c *gin.Context, tokens int) {
+	value, ok := c.Get(rateLimitUsageKey)
+	if !ok {
+		return
+	}
+	usage := value.(*rateLimitUsage)
+	usage.mu.Lock()
+	usage.tokens += tokens
+	usage.mu.Unlock()
+}
+
+// rateLimitCaller 获取调用方标识，使用API密钥时按客户端区分，否则按IP区分
+func rateLimitCaller(c *gin.Context) string {
+	if clientID := middleware.GetClientID(c); clientID != "" {
+		return "client:" + clientID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// estimateRequestTokens 使用请求分析预估令牌数，读取请求体后恢复
+func estimateRequestTokens(c *gin.Context) int {
+	if c.Request.Body == nil || c.Request.Method == http.MethodGet {
+		return 0
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return 0
+	}
+
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/v1/") {
+		path = strings.TrimPrefix(path, "/v1")
+	}
+	_, _, tokenEstimate := AnalyzeOpenAIRequest(path, body)
+	return tokenEstimate
+}
+
+// formatRateLimitReset 按OpenAI的格式输出重置时间，如1s、6m0s
+func formatRateLimitReset(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// setRateLimitHeaders 设置x-ratelimit-*响应头
+func setRateLimitHeaders(c *gin.Context, result rateLimitResult) {
+	if result.limitRequests > 0 {
+		c.Header("x-ratelimit-limit-requests", strconv.Itoa(result.limitRequests))
+		c.Header("x-ratelimit-remaining-requests", strconv.Itoa(result.remainingRequests))
+		c.Header("x-ratelimit-reset-requests", formatRateLimitReset(result.resetRequests))
+	}
+	if result.limitTokens > 0 {
+		c.Header("x-ratelimit-limit-tokens", strconv.Itoa(result.limitTokens))
+		c.Header("x-ratelimit-remaining-tokens", strconv.Itoa(result.remainingTokens))
+		c.Header("x-ratelimit-reset-tokens", formatRateLimitReset(result.resetTokens))
+	}
+}
+
+// RateLimitMiddleware 按调用方限制每分钟请求数和令牌数，超出时返回429，需要放在API密钥验证之后
+func RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.GetConfig()
+		if cfg == nil {
+			c.Next()
+			return
+		}
+		limit := cfg.Security.RateLimit
+		if !limit.Enabled || (limit.RequestsPerMinute <= 0 && limit.TokensPerMinute <= 0) {
+			c.Next()
+			return
+		}
+
+		caller := rateLimitCaller(c)
+		estimate := 0
+		if limit.TokensPerMinute > 0 {
+			estimate = estimateRequestTokens(c)
+		}
+
+		result := limiter.acquire(caller, limit, estimate)
+		setRateLimitHeaders(c, result)
+		if !result.allowed {
+			retryAfter := int(math.Ceil(result.retryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+			var message string
+			if result.limitType == "requests" {
+				message = fmt.Sprintf("已达到每分钟请求数限制 %d，请在 %d 秒后重试", limit.RequestsPerMinute, retryAfter)
+			} else {
+				message = fmt.Sprintf("已达到每分钟令牌数限制 %d，本次请求预估 %d 个令牌，请在 %d 秒后重试", limit.TokensPerMinute, estimate, retryAfter)
+			}
+			GetRequestLogger(c).Warn("调用方 %s 触发速率限制: %s", caller, message)
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": message,
+					"type":    result.limitType,
+					"param":   nil,
+					"code":    "rate_limit_exceeded",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		usage := &rateLimitUsage{}
+		c.Set(rateLimitUsageKey, usage)
+		c.Next()
+
+		usage.mu.Lock()
+		actual := usage.tokens
+		usage.mu.Unlock()
+		limiter.settle(caller, limit, estimate, actual)
+		if actual != estimate {
+			GetRequestLogger(c).Info("速率限制按实际用量核算: 预估 %d 个令牌，实际使用 %d 个令牌", estimate, actual)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name      string
+		tokens    float64
+		capacity  int
+		elapsed   time.Duration
+		wantLeft  int
+		wantWait1 time.Duration
+	}{
+		{"full bucket", 60, 60, 0, 60, 0},
+		{"empty bucket waits one second per token", 0, 60, 0, 0, time.Second},
+		{"refills capacity/60 per second", 0, 60, 10 * time.Second, 10, 0},
+		{"never exceeds capacity", 50, 60, time.Hour, 60, 0},
+		{"negative balance after settle", -5, 60, 2 * time.Second, 0, 4 * time.Second},
+		{"capacity raised adds the difference", 10, 120, 0, 70, 0},
+		{"capacity lowered removes the difference", 10, 30, 0, 0, 42 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTokenBucket(60, start)
+			bucket.tokens = tt.tokens
+			bucket.refill(tt.capacity, start.Add(tt.elapsed))
+			if got := bucket.remaining(); got != tt.wantLeft {
+				t.Errorf("remaining() = %d, want %d", got, tt.wantLeft)
+			}
+			if got := bucket.waitFor(1); got != tt.wantWait1 {
+				t.Errorf("waitFor(1) = %v, want %v", got, tt.wantWait1)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	type step struct {
+		estimate      int
+		wantAllowed   bool
+		wantLimitType string
+		wantRequests  int
+		wantTokens    int
+	}
+	tests := []struct {
+		name  string
+		limit config.RateLimitConfig
+		steps []step
+	}{
+		{
+			name:  "request limit",
+			limit: config.RateLimitConfig{RequestsPerMinute: 2},
+			steps: []step{
+				{0, true, "", 1, 0},
+				{0, true, "", 0, 0},
+				{0, false, "requests", 0, 0},
+			},
+		},
+		{
+			name:  "token limit charges the estimate",
+			limit: config.RateLimitConfig{TokensPerMinute: 100},
+			steps: []step{
+				{60, true, "", 0, 40},
+				{60, false, "tokens", 0, 40},
+				{40, true, "", 0, 0},
+			},
+		},
+		{
+			name:  "estimate above the limit is capped",
+			limit: config.RateLimitConfig{TokensPerMinute: 100},
+			steps: []step{
+				{500, true, "", 0, 0},
+				{1, false, "tokens", 0, 0},
+			},
+		},
+		{
+			name:  "rejected request does not consume",
+			limit: config.RateLimitConfig{RequestsPerMinute: 5, TokensPerMinute: 100},
+			steps: []step{
+				{100, true, "", 4, 0},
+				{50, false, "tokens", 4, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{callers: make(map[string]*callerBuckets)}
+			for i, s := range tt.steps {
+				result := l.acquire("client:test", tt.limit, s.estimate)
+				if result.allowed != s.wantAllowed || result.limitType != s.wantLimitType {
+					t.Fatalf("step %d: allowed = %v (%q), want %v (%q)", i, result.allowed, result.limitType, s.wantAllowed, s.wantLimitType)
+				}
+				if result.remainingRequests != s.wantRequests || result.remainingTokens != s.wantTokens {
+					t.Errorf("step %d: remaining = %d requests, %d tokens, want %d, %d",
+						i, result.remainingRequests, result.remainingTokens, s.wantRequests, s.wantTokens)
+				}
+				if !result.allowed && result.retryAfter <= 0 {
+					t.Errorf("step %d: retryAfter = %v, want > 0", i, result.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterCallersAreIndependent(t *testing.T) {
+	l := &rateLimiter{callers: make(map[string]*callerBuckets)}
+	limit := config.RateLimitConfig{RequestsPerMinute: 1}
+	if !l.acquire("client:a", limit, 0).allowed {
+		t.Fatal("first request of client a rejected")
+	}
+	if l.acquire("client:a", limit, 0).allowed {
+		t.Error("second request of client a allowed")
+	}
+	if !l.acquire("client:b", limit, 0).allowed {
+		t.Error("client b limited by client a")
+	}
+}
+
+func TestRateLimiterSettle(t *testing.T) {
+	tests := []struct {
+		name     string
+		estimate int
+		actual   int
+		want     int
+	}{
+		{"exact estimate", 40, 40, 60},
+		{"refunds unused tokens", 40, 10, 90},
+		{"charges extra usage", 40, 70, 30},
+		{"usage above the limit goes negative", 40, 150, 0},
+		{"capped estimate refunds only what was charged", 500, 0, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{callers: make(map[string]*callerBuckets)}
+			limit := config.RateLimitConfig{TokensPerMinute: 100}
+			l.acquire("client:test", limit, tt.estimate)
+			l.settle("client:test", limit, tt.estimate, tt.actual)
+
+			got := l.acquire("client:test", limit, 0).remainingTokens
+			if got != tt.want {
+				t.Errorf("remaining tokens after settle = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 未设置令牌数限额时不核算
+	l := &rateLimiter{callers: make(map[string]*callerBuckets)}
+	l.settle("client:test", config.RateLimitConfig{RequestsPerMinute: 1}, 10, 20)
+	if len(l.callers) != 0 {
+		t.Error("settle without a token limit created buckets")
+	}
+}
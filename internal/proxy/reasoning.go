@@ -0,0 +1,278 @@
+/**
+  @author: Hanhai
+  @desc: 推理内容输出格式转换，按下游客户端或请求头将reasoning_content改写为<think>标签、reasoning字段或丢弃，并统计推理令牌数
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/pkg/tokenizer"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReasoningFormatHeader 请求头，指定本次请求的推理内容输出格式：raw、think、drop或reasoning
+const ReasoningFormatHeader = "X-Reasoning-Format"
+
+// 内联推理内容时使用的标签
+const (
+	thinkOpenTag  = "<think>\n"
+	thinkCloseTag = "\n</think>\n\n"
+)
+
+// reasoningFormat 获取请求使用的推理内容输出格式，请求头优先于客户端配置
+// 其他协议的适配器需要读取原始的reasoning_content，始终保持上游格式
+func reasoningFormat(c *gin.Context) string {
+	if c.GetBool(protocolAdapterKey) {
+		return config.ReasoningFormatRaw
+	}
+	if format := strings.ToLower(strings.TrimSpace(c.GetHeader(ReasoningFormatHeader))); config.IsValidReasoningFormat(format) {
+		return format
+	}
+	return config.GetConfig().ApiProxy.Reasoning.GetFormat(middleware.GetClientName(c))
+}
+
+// rewriteReasoning 按输出格式改写message或delta中的推理内容
+// 使用think格式时，thinking记录该choice的<think>标签是否已打开，流式响应中跨数据块保持
+func rewriteReasoning(fields map[string]interface{}, format string, thinking *bool, finished bool) {
+	reasoning, _ := fields["reasoning_content"].(string)
+	_, hasReasoning := fields["reasoning_content"]
+
+	switch format {
+	case config.ReasoningFormatDrop:
+		delete(fields, "reasoning_content")
+	case config.ReasoningFormatReasoning:
+		if hasReasoning {
+			delete(fields, "reasoning_content")
+			if reasoning != "" {
+				fields["reasoning"] = reasoning
+			}
+		}
+	case config.ReasoningFormatThink:
+		delete(fields, "reasoning_content")
+		content, _ := fields["content"].(string)
+		var text strings.Builder
+		if reasoning != "" {
+			if !*thinking {
+				text.WriteString(thinkOpenTag)
+				*thinking = true
+			}
+			text.WriteString(reasoning)
+		}
+		if *thinking && (content != "" || finished) {
+			text.WriteString(thinkCloseTag)
+			*thinking = false
+		}
+		if text.Len() > 0 {
+			text.WriteString(content)
+			fields["content"] = text.String()
+		}
+	}
+}
+
+// reasoningTokensFromUsage 获取usage中上游统计的推理令牌数
+func reasoningTokensFromUsage(data map[string]interface{}) int {
+	usage, _ := data["usage"].(map[string]interface{})
+	details, _ := usage["completion_tokens_details"].(map[string]interface{})
+	tokens, _ := details["reasoning_tokens"].(float64)
+	return int(tokens)
+}
+
+// reasoningWriter 按输出格式改写响应中的推理内容，同时记录推理内容用于统计
+// 非流式响应在请求结束后统一改写；流式响应逐行改写
+type reasoningWriter struct {
+	gin.ResponseWriter
+	format    string
+	stream    bool
+	decided   bool
+	body      bytes.Buffer // 非流式响应内容，流式响应中未处理完的行
+	thinking  map[int]bool // 各choice的<think>标签是否已打开
+	reasoning strings.Builder
+	tokens    int // 上游返回的推理令牌数
+}
+
+// Write 暂存或改写响应数据
+func (w *reasoningWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.Contains(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	if w.Status() >= http.StatusBadRequest {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.stream {
+		w.body.Write(data)
+		if w.format == config.ReasoningFormatRaw {
+			return w.ResponseWriter.Write(data)
+		}
+		return len(data), nil
+	}
+
+	w.body.Write(data)
+	for {
+		line, err := w.body.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			remaining := append(line, w.body.Bytes()...)
+			w.body.Reset()
+			w.body.Write(remaining)
+			break
+		}
+		if _, err := w.ResponseWriter.Write(w.rewriteStreamLine(line)); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString 实现gin.ResponseWriter接口
+func (w *reasoningWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// rewriteStreamLine 改写流式响应中的一行
+func (w *reasoningWriter) rewriteStreamLine(line []byte) []byte {
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		return line
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(trimmed, []byte("data:")))
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return line
+	}
+	if tokens := reasoningTokensFromUsage(chunk); tokens > 0 {
+		w.tokens = tokens
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	changed := false
+	for i, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		delta, ok := choice["delta"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, hasReasoning := delta["reasoning_content"]; !hasReasoning && !w.thinking[i] {
+			continue
+		}
+		reasoning, _ := delta["reasoning_content"].(string)
+		w.reasoning.WriteString(reasoning)
+		if w.format == config.ReasoningFormatRaw {
+			continue
+		}
+
+		thinking := w.thinking[i]
+		finishReason, _ := choice["finish_reason"].(string)
+		rewriteReasoning(delta, w.format, &thinking, finishReason != "")
+		w.thinking[i] = thinking
+		changed = true
+	}
+	if !changed {
+		return line
+	}
+
+	rewritten, err := json.Marshal(chunk)
+	if err != nil {
+		return line
+	}
+	return []byte("data: " + string(rewritten) + "\n")
+}
+
+// rewriteResponse 改写非流式响应中的推理内容
+func (w *reasoningWriter) rewriteResponse(body []byte) []byte {
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return body
+	}
+	w.tokens = reasoningTokensFromUsage(responseData)
+
+	choices, _ := responseData["choices"].([]interface{})
+	changed := false
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		message, ok := choice["message"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, hasReasoning := message["reasoning_content"]; !hasReasoning {
+			continue
+		}
+		reasoning, _ := message["reasoning_content"].(string)
+		w.reasoning.WriteString(reasoning)
+		if w.format == config.ReasoningFormatRaw {
+			continue
+		}
+
+		thinking := false
+		rewriteReasoning(message, w.format, &thinking, true)
+		changed = true
+	}
+	if !changed {
+		return body
+	}
+
+	rewritten, err := json.Marshal(responseData)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// finish 写入暂存的响应
+func (w *reasoningWriter) finish() {
+	if w.stream {
+		if w.body.Len() > 0 {
+			w.ResponseWriter.Write(w.rewriteStreamLine(w.body.Bytes()))
+		}
+		return
+	}
+	if w.body.Len() == 0 {
+		return
+	}
+	body := w.rewriteResponse(w.body.Bytes())
+	if w.format != config.ReasoningFormatRaw {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// reasoningTokens 返回推理令牌数，上游未返回时使用分词器计算
+func (w *reasoningWriter) reasoningTokens(model string) int {
+	if w.tokens > 0 {
+		return w.tokens
+	}
+	if w.reasoning.Len() == 0 {
+		return 0
+	}
+	return tokenizer.CountTokens(model, w.reasoning.String())
+}
+
+// useReasoningFormat 替换响应写入器，按输出格式改写推理内容并统计推理令牌数，返回恢复函数
+func useReasoningFormat(c *gin.Context, modelName string) func() {
+	format := reasoningFormat(c)
+	writer := &reasoningWriter{ResponseWriter: c.Writer, format: format, thinking: make(map[int]bool)}
+	originalWriter := c.Writer
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = originalWriter
+
+		// 命中响应缓存的请求没有消耗令牌
+		if writer.Header().Get(CacheStatusHeader) == "HIT" {
+			return
+		}
+		if served := writer.Header().Get(ServedModelHeader); served != "" {
+			modelName = served
+		}
+		if tokens := writer.reasoningTokens(modelName); tokens > 0 {
+			config.AddDailyReasoningStat(modelName, tokens)
+			GetRequestLogger(c).Info("推理令牌数: %d, 输出格式: %s", tokens, format)
+		}
+	}
+}
@@ -0,0 +1,784 @@
+/**
+  @author: Hanhai
+  @desc: OpenAI Responses API兼容模块，在本地将/v1/responses请求转换为chat/completions处理，支持流式事件和previous_response_id串联
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newResponsesID 生成带前缀的ID
+func newResponsesID(prefix string) string {
+	return prefix + "_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// writeResponsesError 以OpenAI格式返回错误
+func writeResponsesError(c *gin.Context, status int, message string, param string, code string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"param":   param,
+			"code":    code,
+		},
+	})
+}
+
+// HandleResponsesRequest 处理Responses API请求，包括创建、查询和删除响应
+func HandleResponsesRequest(c *gin.Context) {
+	path := c.Param("path")
+	if path == "/responses" {
+		if c.Request.Method != http.MethodPost {
+			writeResponsesError(c, http.StatusMethodNotAllowed, "Only POST is supported for /v1/responses", "", "method_not_allowed")
+			return
+		}
+		handleResponsesCreate(c)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(path, "/responses/"), "/")
+	switch c.Request.Method {
+	case http.MethodGet:
+		handleResponsesRetrieve(c, id)
+	case http.MethodDelete:
+		handleResponsesDelete(c, id)
+	default:
+		writeResponsesError(c, http.StatusMethodNotAllowed, "Method not allowed", "", "method_not_allowed")
+	}
+}
+
+// handleResponsesCreate 创建响应
+func handleResponsesCreate(c *gin.Context) {
+	rl := GetRequestLogger(c)
+
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeResponsesError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err), "", "invalid_body")
+		return
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &request); err != nil {
+		writeResponsesError(c, http.StatusBadRequest, "Request body is empty or invalid JSON", "", "invalid_json")
+		return
+	}
+
+	// 加载上一轮对话
+	history := make([]interface{}, 0)
+	if previousID, ok := request["previous_response_id"].(string); ok && previousID != "" {
+		stored, err := config.GetStoredResponse(previousID, middleware.GetClientID(c))
+		if err != nil {
+			rl.Error("读取上一轮响应失败: %v", err)
+		}
+		if stored == nil {
+			writeResponsesError(c, http.StatusBadRequest, fmt.Sprintf("Previous response with id '%s' not found.", previousID), "previous_response_id", "previous_response_not_found")
+			return
+		}
+		if err := json.Unmarshal([]byte(stored.Messages), &history); err != nil {
+			rl.Error("解析上一轮对话失败: %v", err)
+		}
+	}
+
+	input, err := convertResponsesInput(request["input"])
+	if err != nil {
+		writeResponsesError(c, http.StatusBadRequest, err.Error(), "input", "invalid_input")
+		return
+	}
+
+	// 对话消息（不含instructions，instructions不会被后续轮次继承）
+	conversation := append(history, input...)
+	chatRequest := convertResponsesRequest(request, conversation)
+
+	chatBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		writeResponsesError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to build request body: %v", err), "", "server_error")
+		return
+	}
+
+	modelName, _ := request["model"].(string)
+	rl.SetModel(modelName)
+	rl.Info("检测到Responses API请求，转换为chat/completions处理，模型: %s, 历史消息: %d", modelName, len(history))
+
+	adapter := newResponsesAdapter(request)
+	serveWithAdapter(c, adapter, "/chat/completions", chatBody)
+
+	// 保存响应，供previous_response_id使用
+	if store, ok := request["store"].(bool); (!ok || store) && adapter.final != nil {
+		messages, _ := json.Marshal(append(conversation, adapter.assistantMessage()))
+		response, _ := json.Marshal(adapter.final)
+		if err := config.SaveStoredResponse(&config.StoredResponse{
+			ID:        adapter.responseID,
+			Client:    middleware.GetClientID(c),
+			Model:     modelName,
+			Messages:  string(messages),
+			Response:  string(response),
+			CreatedAt: adapter.createdAt,
+		}); err != nil {
+			rl.Error("保存响应失败: %v", err)
+		}
+	}
+}
+
+// handleResponsesRetrieve 查询已保存的响应
+func handleResponsesRetrieve(c *gin.Context, id string) {
+	stored, err := config.GetStoredResponse(id, middleware.GetClientID(c))
+	if err != nil {
+		writeResponsesError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to load response: %v", err), "", "server_error")
+		return
+	}
+	if stored == nil {
+		writeResponsesError(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id), "response_id", "not_found")
+		return
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.String(http.StatusOK, stored.Response)
+}
+
+// handleResponsesDelete 删除已保存的响应
+func handleResponsesDelete(c *gin.Context, id string) {
+	deleted, err := config.DeleteStoredResponse(id, middleware.GetClientID(c))
+	if err != nil {
+		writeResponsesError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete response: %v", err), "", "server_error")
+		return
+	}
+	if !deleted {
+		writeResponsesError(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", id), "response_id", "not_found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+}
+
+// convertResponsesInput 将Responses API的input转换为chat消息
+func convertResponsesInput(input interface{}) ([]interface{}, error) {
+	switch v := input.(type) {
+	case string:
+		return []interface{}{map[string]interface{}{"role": "user", "content": v}}, nil
+	case []interface{}:
+		messages := make([]interface{}, 0, len(v))
+		for _, raw := range v {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			itemType, _ := item["type"].(string)
+			switch itemType {
+			case "function_call":
+				toolCall := map[string]interface{}{
+					"id":   item["call_id"],
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      item["name"],
+						"arguments": item["arguments"],
+					},
+				}
+				// 连续的函数调用合并到同一条助手消息
+				if n := len(messages); n > 0 {
+					if last, ok := messages[n-1].(map[string]interface{}); ok && last["role"] == "assistant" {
+						if calls, ok := last["tool_calls"].([]interface{}); ok {
+							last["tool_calls"] = append(calls, toolCall)
+							continue
+						}
+					}
+				}
+				messages = append(messages, map[string]interface{}{
+					"role":       "assistant",
+					"content":    "",
+					"tool_calls": []interface{}{toolCall},
+				})
+			case "function_call_output":
+				output, ok := item["output"].(string)
+				if !ok {
+					data, _ := json.Marshal(item["output"])
+					output = string(data)
+				}
+				messages = append(messages, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": item["call_id"],
+					"content":      output,
+				})
+			case "", "message":
+				role, _ := item["role"].(string)
+				if role == "" {
+					continue
+				}
+				if role == "developer" {
+					role = "system"
+				}
+				messages = append(messages, map[string]interface{}{
+					"role":    role,
+					"content": convertResponsesContent(item["content"]),
+				})
+			}
+		}
+		if len(messages) == 0 {
+			return nil, fmt.Errorf("input must contain at least one message")
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("input is required and must be a string or an array")
+}
+
+// convertResponsesContent 转换消息内容，纯文本内容合并为字符串
+func convertResponsesContent(content interface{}) interface{} {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+
+	chatParts := make([]interface{}, 0, len(parts))
+	texts := make([]string, 0, len(parts))
+	hasImage := false
+	for _, raw := range parts {
+		part, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch part["type"] {
+		case "input_text", "output_text", "text":
+			text, _ := part["text"].(string)
+			texts = append(texts, text)
+			chatParts = append(chatParts, map[string]interface{}{"type": "text", "text": text})
+		case "input_image":
+			url, _ := part["image_url"].(string)
+			if url == "" {
+				continue
+			}
+			hasImage = true
+			chatParts = append(chatParts, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": url},
+			})
+		}
+	}
+
+	if !hasImage {
+		return strings.Join(texts, "\n")
+	}
+	return chatParts
+}
+
+// convertResponsesRequest 构建chat/completions请求
+func convertResponsesRequest(request map[string]interface{}, conversation []interface{}) map[string]interface{} {
+	messages := make([]interface{}, 0, len(conversation)+1)
+	if instructions, ok := request["instructions"].(string); ok && instructions != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": instructions})
+	}
+	messages = append(messages, conversation...)
+
+	chatRequest := map[string]interface{}{
+		"model":    request["model"],
+		"messages": messages,
+	}
+
+	for _, field := range []string{"temperature", "top_p", "stream", "user", "parallel_tool_calls"} {
+		if value, ok := request[field]; ok {
+			chatRequest[field] = value
+		}
+	}
+	if maxTokens, ok := request["max_output_tokens"]; ok {
+		chatRequest["max_tokens"] = maxTokens
+	}
+	if stream, ok := request["stream"].(bool); ok && stream {
+		chatRequest["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	// 只支持函数工具
+	if tools, ok := request["tools"].([]interface{}); ok && len(tools) > 0 {
+		chatTools := make([]interface{}, 0, len(tools))
+		for _, raw := range tools {
+			tool, ok := raw.(map[string]interface{})
+			if !ok || tool["type"] != "function" {
+				continue
+			}
+			function := map[string]interface{}{"name": tool["name"]}
+			for _, field := range []string{"description", "parameters", "strict"} {
+				if value, ok := tool[field]; ok {
+					function[field] = value
+				}
+			}
+			chatTools = append(chatTools, map[string]interface{}{"type": "function", "function": function})
+		}
+		if len(chatTools) > 0 {
+			chatRequest["tools"] = chatTools
+		}
+	}
+
+	switch choice := request["tool_choice"].(type) {
+	case string:
+		chatRequest["tool_choice"] = choice
+	case map[string]interface{}:
+		if choice["type"] == "function" {
+			chatRequest["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice["name"]},
+			}
+		}
+	}
+
+	// 结构化输出
+	if text, ok := request["text"].(map[string]interface{}); ok {
+		if format, ok := text["format"].(map[string]interface{}); ok {
+			switch format["type"] {
+			case "json_schema":
+				schema := map[string]interface{}{}
+				for _, field := range []string{"name", "schema", "strict", "description"} {
+					if value, ok := format[field]; ok {
+						schema[field] = value
+					}
+				}
+				chatRequest["response_format"] = map[string]interface{}{"type": "json_schema", "json_schema": schema}
+			case "json_object":
+				chatRequest["response_format"] = map[string]interface{}{"type": "json_object"}
+			}
+		}
+	}
+
+	return chatRequest
+}
+
+// responsesAdapter 将chat/completions响应转换为Responses API格式
+type responsesAdapter struct {
+	request    map[string]interface{}
+	responseID string
+	createdAt  int64
+	model      string
+
+	started      bool
+	sequence     int
+	output       []map[string]interface{}
+	current      map[string]interface{}
+	currentText  strings.Builder
+	toolIndex    int
+	finishReason string
+	usage        map[string]interface{}
+	errorMessage string
+
+	// final 成功完成时的响应对象
+	final map[string]interface{}
+}
+
+// newResponsesAdapter 创建Responses API适配器
+func newResponsesAdapter(request map[string]interface{}) *responsesAdapter {
+	model, _ := request["model"].(string)
+	return &responsesAdapter{
+		request:    request,
+		responseID: newResponsesID("resp"),
+		createdAt:  time.Now().Unix(),
+		model:      model,
+		output:     make([]map[string]interface{}, 0),
+		toolIndex:  -1,
+	}
+}
+
+func (a *responsesAdapter) contentType(stream bool) string {
+	if stream {
+		return "text/event-stream; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (a *responsesAdapter) keepComments() bool {
+	return true
+}
+
+// buildResponse 构建响应对象
+func (a *responsesAdapter) buildResponse(status string) map[string]interface{} {
+	response := map[string]interface{}{
+		"id":                   a.responseID,
+		"object":               "response",
+		"created_at":           a.createdAt,
+		"status":               status,
+		"model":                a.model,
+		"output":               a.output,
+		"error":                nil,
+		"incomplete_details":   nil,
+		"instructions":         a.request["instructions"],
+		"previous_response_id": a.request["previous_response_id"],
+		"max_output_tokens":    a.request["max_output_tokens"],
+		"temperature":          a.request["temperature"],
+		"top_p":                a.request["top_p"],
+		"tools":                a.request["tools"],
+		"tool_choice":          a.request["tool_choice"],
+		"metadata":             a.request["metadata"],
+		"parallel_tool_calls":  true,
+		"store":                true,
+		"usage":                nil,
+	}
+	if store, ok := a.request["store"].(bool); ok {
+		response["store"] = store
+	}
+	if response["tools"] == nil {
+		response["tools"] = []interface{}{}
+	}
+	if response["tool_choice"] == nil {
+		response["tool_choice"] = "auto"
+	}
+	if a.usage != nil {
+		response["usage"] = a.usage
+	}
+	if status == "incomplete" {
+		response["incomplete_details"] = map[string]interface{}{"reason": "max_output_tokens"}
+	}
+	if a.errorMessage != "" {
+		response["error"] = map[string]interface{}{"code": "server_error", "message": a.errorMessage}
+	}
+	return response
+}
+
+// finalStatus 根据finish_reason确定最终状态
+func (a *responsesAdapter) finalStatus() string {
+	if a.errorMessage != "" {
+		return "failed"
+	}
+	if a.finishReason == "length" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// setUsage 记录用量
+func (a *responsesAdapter) setUsage(usage map[string]interface{}) {
+	input, output := 0, 0
+	if pt, ok := usage["prompt_tokens"].(float64); ok {
+		input = int(pt)
+	}
+	if ct, ok := usage["completion_tokens"].(float64); ok {
+		output = int(ct)
+	}
+	a.usage = map[string]interface{}{
+		"input_tokens":  input,
+		"output_tokens": output,
+		"total_tokens":  input + output,
+	}
+}
+
+// assistantMessage 将本次输出转换为chat助手消息，用于保存对话
+func (a *responsesAdapter) assistantMessage() map[string]interface{} {
+	texts := make([]string, 0, 1)
+	toolCalls := make([]interface{}, 0)
+	for _, item := range a.output {
+		switch item["type"] {
+		case "message":
+			if parts, ok := item["content"].([]interface{}); ok {
+				for _, p := range parts {
+					if part, ok := p.(map[string]interface{}); ok {
+						if text, ok := part["text"].(string); ok {
+							texts = append(texts, text)
+						}
+					}
+				}
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   item["call_id"],
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      item["name"],
+					"arguments": item["arguments"],
+				},
+			})
+		}
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": strings.Join(texts, ""),
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	return message
+}
+
+// messageItem 创建消息输出项
+func messageItem(id string, status string, text string) map[string]interface{} {
+	content := []interface{}{}
+	if status == "completed" {
+		content = append(content, map[string]interface{}{
+			"type":        "output_text",
+			"text":        text,
+			"annotations": []interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"type":    "message",
+		"id":      id,
+		"status":  status,
+		"role":    "assistant",
+		"content": content,
+	}
+}
+
+// convertResponse 转换非流式响应
+func (a *responsesAdapter) convertResponse(status int, body []byte) []byte {
+	data := firstJSONObject(body)
+	if status >= 400 || data == nil || data["error"] != nil {
+		result, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": extractErrorMessage(data, body),
+				"type":    "api_error",
+				"param":   nil,
+				"code":    status,
+			},
+		})
+		return result
+	}
+
+	if m, ok := data["model"].(string); ok && m != "" {
+		a.model = m
+	}
+	if usage, ok := data["usage"].(map[string]interface{}); ok {
+		a.setUsage(usage)
+	}
+
+	if choices, ok := data["choices"].([]interface{}); ok && len(choices) > 0 {
+		choice, _ := choices[0].(map[string]interface{})
+		a.finishReason, _ = choice["finish_reason"].(string)
+		message, _ := choice["message"].(map[string]interface{})
+		if message != nil {
+			if reasoning, ok := message["reasoning_content"].(string); ok && reasoning != "" {
+				a.output = append(a.output, map[string]interface{}{
+					"type":    "reasoning",
+					"id":      newResponsesID("rs"),
+					"summary": []interface{}{map[string]interface{}{"type": "summary_text", "text": reasoning}},
+				})
+			}
+			text, _ := message["content"].(string)
+			toolCalls, _ := message["tool_calls"].([]interface{})
+			if text != "" || len(toolCalls) == 0 {
+				a.output = append(a.output, messageItem(newResponsesID("msg"), "completed", text))
+			}
+			for _, raw := range toolCalls {
+				tc, _ := raw.(map[string]interface{})
+				if tc == nil {
+					continue
+				}
+				fn, _ := tc["function"].(map[string]interface{})
+				a.output = append(a.output, map[string]interface{}{
+					"type":      "function_call",
+					"id":        newResponsesID("fc"),
+					"call_id":   tc["id"],
+					"name":      fn["name"],
+					"arguments": fn["arguments"],
+					"status":    "completed",
+				})
+			}
+		}
+	}
+
+	a.final = a.buildResponse(a.finalStatus())
+	result, _ := json.Marshal(a.final)
+	return result
+}
+
+// event 生成带序号的流式事件
+func (a *responsesAdapter) event(eventType string, payload map[string]interface{}) []byte {
+	payload["type"] = eventType
+	payload["sequence_number"] = a.sequence
+	a.sequence++
+	return sseEvent(eventType, payload)
+}
+
+// start 输出response.created和response.in_progress事件
+func (a *responsesAdapter) start() []byte {
+	if a.started {
+		return nil
+	}
+	a.started = true
+	out := a.event("response.created", map[string]interface{}{"response": a.buildResponse("in_progress")})
+	return append(out, a.event("response.in_progress", map[string]interface{}{"response": a.buildResponse("in_progress")})...)
+}
+
+// closeItem 结束当前输出项
+func (a *responsesAdapter) closeItem() []byte {
+	if a.current == nil {
+		return nil
+	}
+	item := a.current
+	a.current = nil
+	outputIndex := len(a.output)
+	text := a.currentText.String()
+	a.currentText.Reset()
+
+	var out []byte
+	switch item["type"] {
+	case "message":
+		part := map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+		out = append(out, a.event("response.output_text.done", map[string]interface{}{
+			"item_id": item["id"], "output_index": outputIndex, "content_index": 0, "text": text,
+		})...)
+		out = append(out, a.event("response.content_part.done", map[string]interface{}{
+			"item_id": item["id"], "output_index": outputIndex, "content_index": 0, "part": part,
+		})...)
+		item = messageItem(item["id"].(string), "completed", text)
+	case "function_call":
+		item["arguments"] = text
+		item["status"] = "completed"
+		out = append(out, a.event("response.function_call_arguments.done", map[string]interface{}{
+			"item_id": item["id"], "output_index": outputIndex, "arguments": text,
+		})...)
+	case "reasoning":
+		item["summary"] = []interface{}{map[string]interface{}{"type": "summary_text", "text": text}}
+		out = append(out, a.event("response.reasoning_summary_text.done", map[string]interface{}{
+			"item_id": item["id"], "output_index": outputIndex, "summary_index": 0, "text": text,
+		})...)
+	}
+
+	a.output = append(a.output, item)
+	return append(out, a.event("response.output_item.done", map[string]interface{}{
+		"output_index": outputIndex, "item": item,
+	})...)
+}
+
+// openItem 开始新的输出项
+func (a *responsesAdapter) openItem(item map[string]interface{}) []byte {
+	out := a.closeItem()
+	a.current = item
+	out = append(out, a.event("response.output_item.added", map[string]interface{}{
+		"output_index": len(a.output), "item": item,
+	})...)
+	if item["type"] == "message" {
+		out = append(out, a.event("response.content_part.added", map[string]interface{}{
+			"item_id": item["id"], "output_index": len(a.output), "content_index": 0,
+			"part": map[string]interface{}{"type": "output_text", "text": "", "annotations": []interface{}{}},
+		})...)
+	}
+	return out
+}
+
+// convertChunk 转换OpenAI流式数据块
+func (a *responsesAdapter) convertChunk(chunk map[string]interface{}) []byte {
+	out := a.start()
+
+	if errData, ok := chunk["error"]; ok {
+		a.errorMessage = extractErrorMessage(map[string]interface{}{"error": errData}, nil)
+		return append(out, a.event("error", map[string]interface{}{
+			"code": "server_error", "message": a.errorMessage, "param": nil,
+		})...)
+	}
+
+	if m, ok := chunk["model"].(string); ok && m != "" {
+		a.model = m
+	}
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		a.setUsage(usage)
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return out
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if choice == nil {
+		return out
+	}
+	if fr, ok := choice["finish_reason"].(string); ok && fr != "" {
+		a.finishReason = fr
+	}
+	delta, _ := choice["delta"].(map[string]interface{})
+	if delta == nil {
+		return out
+	}
+
+	if reasoning, ok := delta["reasoning_content"].(string); ok && reasoning != "" {
+		if a.current == nil || a.current["type"] != "reasoning" {
+			out = append(out, a.openItem(map[string]interface{}{
+				"type": "reasoning", "id": newResponsesID("rs"), "summary": []interface{}{},
+			})...)
+		}
+		a.currentText.WriteString(reasoning)
+		out = append(out, a.event("response.reasoning_summary_text.delta", map[string]interface{}{
+			"item_id": a.current["id"], "output_index": len(a.output), "summary_index": 0, "delta": reasoning,
+		})...)
+	}
+
+	if text, ok := delta["content"].(string); ok && text != "" {
+		if a.current == nil || a.current["type"] != "message" {
+			out = append(out, a.openItem(messageItem(newResponsesID("msg"), "in_progress", ""))...)
+		}
+		a.currentText.WriteString(text)
+		out = append(out, a.event("response.output_text.delta", map[string]interface{}{
+			"item_id": a.current["id"], "output_index": len(a.output), "content_index": 0, "delta": text,
+		})...)
+	}
+
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, raw := range toolCalls {
+			tc, _ := raw.(map[string]interface{})
+			if tc == nil {
+				continue
+			}
+			index := a.toolIndex
+			if idx, ok := tc["index"].(float64); ok {
+				index = int(idx)
+			}
+			fn, _ := tc["function"].(map[string]interface{})
+			callID, _ := tc["id"].(string)
+
+			if callID != "" || index != a.toolIndex || a.current == nil || a.current["type"] != "function_call" {
+				a.toolIndex = index
+				name := ""
+				if fn != nil {
+					name, _ = fn["name"].(string)
+				}
+				if callID == "" {
+					callID = newResponsesID("call")
+				}
+				out = append(out, a.openItem(map[string]interface{}{
+					"type": "function_call", "id": newResponsesID("fc"), "call_id": callID,
+					"name": name, "arguments": "", "status": "in_progress",
+				})...)
+			}
+
+			if fn != nil {
+				if args, ok := fn["arguments"].(string); ok && args != "" {
+					a.currentText.WriteString(args)
+					out = append(out, a.event("response.function_call_arguments.delta", map[string]interface{}{
+						"item_id": a.current["id"], "output_index": len(a.output), "delta": args,
+					})...)
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// finishStream 输出结束事件
+func (a *responsesAdapter) finishStream() []byte {
+	out := a.start()
+	out = append(out, a.closeItem()...)
+
+	status := a.finalStatus()
+	response := a.buildResponse(status)
+	if status != "failed" {
+		a.final = response
+	}
+
+	eventType := "response.completed"
+	switch status {
+	case "failed":
+		eventType = "response.failed"
+	case "incomplete":
+		eventType = "response.incomplete"
+	}
+	return append(out, a.event(eventType, map[string]interface{}{"response": response})...)
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertResponsesInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "string input",
+			input: `{"input":"hi"}`,
+			want:  `[{"role":"user","content":"hi"}]`,
+		},
+		{
+			name:  "messages with developer role and text parts",
+			input: `{"input":[{"role":"developer","content":"be brief"},{"type":"message","role":"user","content":[{"type":"input_text","text":"a"},{"type":"input_text","text":"b"}]}]}`,
+			want:  `[{"role":"system","content":"be brief"},{"role":"user","content":"a\nb"}]`,
+		},
+		{
+			name:  "image part keeps the content array",
+			input: `{"input":[{"role":"user","content":[{"type":"input_text","text":"what"},{"type":"input_image","image_url":"http://x/y.png"}]}]}`,
+			want:  `[{"role":"user","content":[{"type":"text","text":"what"},{"type":"image_url","image_url":{"url":"http://x/y.png"}}]}]`,
+		},
+		{
+			name:  "consecutive function calls are merged",
+			input: `{"input":[{"type":"function_call","call_id":"c1","name":"f","arguments":"{}"},{"type":"function_call","call_id":"c2","name":"g","arguments":"{}"},{"type":"function_call_output","call_id":"c1","output":"ok"},{"type":"function_call_output","call_id":"c2","output":{"v":1}}]}`,
+			want:  `[{"role":"assistant","content":"","tool_calls":[{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}},{"id":"c2","type":"function","function":{"name":"g","arguments":"{}"}}]},{"role":"tool","tool_call_id":"c1","content":"ok"},{"role":"tool","tool_call_id":"c2","content":"{\"v\":1}"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertResponsesInput(mustJSON(t, tt.input)["input"])
+			if err != nil {
+				t.Fatalf("convertResponsesInput() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+
+	for _, input := range []string{`{}`, `{"input":5}`, `{"input":[]}`, `{"input":[{"type":"message"}]}`} {
+		if _, err := convertResponsesInput(mustJSON(t, input)["input"]); err == nil {
+			t.Errorf("convertResponsesInput(%s) error = nil, want error", input)
+		}
+	}
+}
+
+func TestConvertResponsesRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "instructions and sampling fields",
+			request: `{"model":"m","instructions":"sys","temperature":0.5,"max_output_tokens":64,"stream":true}`,
+			want:    `{"model":"m","messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}],"temperature":0.5,"max_tokens":64,"stream":true,"stream_options":{"include_usage":true}}`,
+		},
+		{
+			name:    "only function tools are forwarded",
+			request: `{"model":"m","tools":[{"type":"web_search"},{"type":"function","name":"f","parameters":{"type":"object"},"strict":true}],"tool_choice":{"type":"function","name":"f"}}`,
+			want:    `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"},"strict":true}}],"tool_choice":{"type":"function","function":{"name":"f"}}}`,
+		},
+		{
+			name:    "json schema text format",
+			request: `{"model":"m","text":{"format":{"type":"json_schema","name":"out","schema":{"type":"object"},"strict":true}}}`,
+			want:    `{"model":"m","messages":[{"role":"user","content":"hi"}],"response_format":{"type":"json_schema","json_schema":{"name":"out","schema":{"type":"object"},"strict":true}}}`,
+		},
+	}
+	conversation := []interface{}{map[string]interface{}{"role": "user", "content": "hi"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertJSONEqual(t, convertResponsesRequest(mustJSON(t, tt.request), conversation), tt.want)
+		})
+	}
+}
+
+func TestResponsesAdapterConvertResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus string
+		wantTypes  []string
+		wantText   string
+	}{
+		{
+			name:       "text",
+			body:       `{"choices":[{"finish_reason":"stop","message":{"content":"hello"}}],"usage":{"prompt_tokens":2,"completion_tokens":1}}`,
+			wantStatus: "completed",
+			wantTypes:  []string{"message"},
+			wantText:   "hello",
+		},
+		{
+			name:       "reasoning and tool call",
+			body:       `{"choices":[{"finish_reason":"tool_calls","message":{"content":"","reasoning_content":"r","tool_calls":[{"id":"c1","function":{"name":"f","arguments":"{}"}}]}}]}`,
+			wantStatus: "completed",
+			wantTypes:  []string{"reasoning", "function_call"},
+		},
+		{
+			name:       "truncated",
+			body:       `{"choices":[{"finish_reason":"length","message":{"content":"hel"}}]}`,
+			wantStatus: "incomplete",
+			wantTypes:  []string{"message"},
+			wantText:   "hel",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newResponsesAdapter(map[string]interface{}{"model": "m"})
+			a.convertResponse(200, []byte(tt.body))
+			if a.final == nil {
+				t.Fatal("final response not recorded")
+			}
+			if a.final["status"] != tt.wantStatus {
+				t.Errorf("status = %v, want %s", a.final["status"], tt.wantStatus)
+			}
+			var types []string
+			for _, item := range a.output {
+				types = append(types, item["type"].(string))
+			}
+			if strings.Join(types, ",") != strings.Join(tt.wantTypes, ",") {
+				t.Errorf("output types = %v, want %v", types, tt.wantTypes)
+			}
+			if got := a.assistantMessage()["content"]; got != tt.wantText {
+				t.Errorf("assistant content = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+
+	a := newResponsesAdapter(map[string]interface{}{"model": "m"})
+	assertJSONEqual(t, a.convertResponse(500, []byte(`{"error":{"message":"boom"}}`)), `{"error":{"message":"boom","type":"api_error","param":null,"code":500}}`)
+	if a.final != nil {
+		t.Error("final response recorded for an error")
+	}
+}
+
+func TestResponsesAdapterStream(t *testing.T) {
+	a := newResponsesAdapter(map[string]interface{}{"model": "m", "stream": true})
+	var out []byte
+	for _, chunk := range []string{
+		`{"choices":[{"delta":{"content":"hel"}}]}`,
+		`{"choices":[{"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":2,"completion_tokens":2}}`,
+	} {
+		out = append(out, a.convertChunk(mustJSON(t, chunk))...)
+	}
+	out = append(out, a.finishStream()...)
+
+	names, payloads := sseEvents(t, out)
+	want := []string{
+		"response.created", "response.in_progress", "response.output_item.added", "response.content_part.added",
+		"response.output_text.delta", "response.output_text.delta", "response.output_text.done",
+		"response.content_part.done", "response.output_item.done", "response.completed",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", names, want)
+	}
+	for i, payload := range payloads {
+		if payload["sequence_number"] != float64(i) {
+			t.Errorf("event %d sequence_number = %v", i, payload["sequence_number"])
+		}
+	}
+	if got := a.assistantMessage()["content"]; got != "hello" {
+		t.Errorf("assistant content = %q, want %q", got, "hello")
+	}
+	if a.final == nil || a.final["usage"] == nil {
+		t.Errorf("final response = %v, want usage recorded", a.final)
+	}
+}
@@ -0,0 +1,344 @@
+/**
+  @author: Hanhai
+  @desc: 结构化输出校验，对要求json_schema格式的非流式聊天请求校验模型输出，不符合时尝试修复，仍不符合时使用纠正提示重试
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/pkg/jsonschema"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 模型输出不符合Schema时追加的纠正提示
+const schemaCorrectionTemplate = `Your previous response did not match the required JSON schema.
+Problems:
+%s
+
+Required JSON schema:
+%s
+
+Reply again with only a JSON value that satisfies the schema. Do not wrap it in markdown code fences and do not add any explanation.`
+
+// 推理模型可能把思考过程以<think>标签的形式放在content开头
+var thinkBlockPattern = regexp.MustCompile(`(?s)^\s*<think>.*?</think>`)
+
+// requestJSONSchema 获取非流式聊天请求中response_format要求的JSON Schema
+func requestJSONSchema(body []byte) (interface{}, bool) {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, false
+	}
+	if stream, _ := requestData["stream"].(bool); stream {
+		return nil, false
+	}
+	responseFormat, _ := requestData["response_format"].(map[string]interface{})
+	if formatType, _ := responseFormat["type"].(string); formatType != "json_schema" {
+		return nil, false
+	}
+
+	jsonSchema, _ := responseFormat["json_schema"].(map[string]interface{})
+	if schema, ok := jsonSchema["schema"]; ok && schema != nil {
+		return schema, true
+	}
+	// 未提供Schema时只要求输出有效的JSON
+	return map[string]interface{}{}, true
+}
+
+// structuredOutputWriter 暂存响应，校验通过后才写入客户端
+type structuredOutputWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// statusCode 返回当前记录的状态码，未设置时为200
+func (w *structuredOutputWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *structuredOutputWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *structuredOutputWriter) WriteHeaderNow() {}
+
+func (w *structuredOutputWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *structuredOutputWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *structuredOutputWriter) Status() int {
+	return w.statusCode()
+}
+
+func (w *structuredOutputWriter) Size() int {
+	if w.body.Len() == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *structuredOutputWriter) Written() bool {
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func (w *structuredOutputWriter) Flush() {}
+
+// reset 丢弃暂存的响应，准备重试
+func (w *structuredOutputWriter) reset() {
+	w.status = 0
+	w.body.Reset()
+}
+
+// writeTo 将响应写入客户端，响应体已变化，移除原始长度
+func (w *structuredOutputWriter) writeTo(writer gin.ResponseWriter, body []byte) {
+	writer.Header().Del("Content-Length")
+	writer.WriteHeader(w.statusCode())
+	writer.Write(body)
+}
+
+// processStructuredOutputRequest 处理要求json_schema格式的请求，校验模型输出，不符合时修复或使用纠正提示重试
+func processStructuredOutputRequest(c *gin.Context, targetURL string, transformedBody []byte, originalBody []byte, requestType string, modelName string, tokenEstimate int, path string, schema interface{}) bool {
+	rl := GetRequestLogger(c)
+
+	writer := &structuredOutputWriter{ResponseWriter: c.Writer}
+	originalWriter := c.Writer
+	c.Writer = writer
+	defer func() {
+		c.Writer = originalWriter
+	}()
+
+	maxRetries := config.GetConfig().ApiProxy.StructuredOutput.GetMaxRetries()
+	body := transformedBody
+	servedModel := modelName
+	var problems []string
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			rl.Warn("模型 %s 的输出不符合JSON Schema，使用纠正提示第%d次重试", servedModel, attempt)
+		}
+
+		writer.reset()
+		// 每次尝试都经过模型的熔断器和备用链，熔断时返回的503不做校验直接返回给客户端
+		success := processOpenAIRequestWithFallback(c, targetURL, body, originalBody, requestType, modelName, tokenEstimate, path)
+		if served := writer.Header().Get(ServedModelHeader); served != "" {
+			servedModel = served
+		}
+		// 上游返回错误时不做校验，直接返回给客户端
+		if !success || writer.statusCode() >= http.StatusBadRequest {
+			writer.writeTo(originalWriter, writer.body.Bytes())
+			return success
+		}
+
+		var response []byte
+		var output string
+		var repaired bool
+		response, output, repaired, problems = checkStructuredOutput(writer.body.Bytes(), schema)
+		if len(problems) == 0 {
+			outcome := config.SchemaOutcomeValid
+			switch {
+			case attempt > 0:
+				outcome = config.SchemaOutcomeRetried
+			case repaired:
+				outcome = config.SchemaOutcomeRepaired
+			}
+			config.AddDailySchemaStat(servedModel, outcome)
+			rl.Info("模型 %s 的输出符合JSON Schema，校验结果: %s", servedModel, outcome)
+			writer.writeTo(originalWriter, response)
+			return true
+		}
+
+		rl.Warn("模型 %s 的输出不符合JSON Schema: %s", servedModel, strings.Join(problems, "; "))
+		if attempt == maxRetries {
+			break
+		}
+		var err error
+		if body, err = appendSchemaCorrection(body, output, problems, schema); err != nil {
+			rl.Error("添加纠正提示失败: %v", err)
+			break
+		}
+	}
+
+	config.AddDailySchemaStat(servedModel, config.SchemaOutcomeFailed)
+	c.Writer = originalWriter
+	c.JSON(http.StatusBadGateway, gin.H{
+		"error": gin.H{
+			"message": fmt.Sprintf("模型 %s 的输出不符合要求的JSON Schema: %s", servedModel, strings.Join(problems, "; ")),
+			"type":    "invalid_response_error",
+			"code":    "json_schema_validation_failed",
+		},
+	})
+	return false
+}
+
+// checkStructuredOutput 校验响应中每个choice的输出，返回修复后的响应、第一个不符合的输出、是否经过修复和不符合的原因
+func checkStructuredOutput(respBody []byte, schema interface{}) ([]byte, string, bool, []string) {
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(respBody, &responseData); err != nil {
+		return respBody, "", false, []string{"响应不是有效的JSON"}
+	}
+	choices, _ := responseData["choices"].([]interface{})
+	if len(choices) == 0 {
+		return respBody, "", false, []string{"响应中没有输出内容"}
+	}
+
+	repaired := false
+	for i, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		content, _ := message["content"].(string)
+		// 模型调用工具时没有需要校验的输出
+		if content == "" && message["tool_calls"] != nil {
+			continue
+		}
+
+		value, text, fixed, err := repairJSONOutput(content)
+		if err != nil {
+			return respBody, content, false, []string{fmt.Sprintf("choice %d: 输出不是有效的JSON", i)}
+		}
+		if errs := jsonschema.Validate(schema, value); len(errs) > 0 {
+			return respBody, content, false, errs
+		}
+		if fixed {
+			message["content"] = text
+			repaired = true
+		}
+	}
+	if !repaired {
+		return respBody, "", false, nil
+	}
+
+	rewritten, err := json.Marshal(responseData)
+	if err != nil {
+		return respBody, "", false, []string{fmt.Sprintf("重新生成响应失败: %v", err)}
+	}
+	return rewritten, "", true, nil
+}
+
+// repairJSONOutput 解析模型输出的JSON，失败时依次去掉思考内容和代码块标记、截取JSON部分、删除多余的逗号后重试
+// 返回解析结果、修复后的文本和是否经过修复
+func repairJSONOutput(content string) (interface{}, string, bool, error) {
+	var value interface{}
+	text := strings.TrimSpace(content)
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return value, text, false, nil
+	}
+
+	repairs := []func(string) string{
+		func(s string) string { return strings.TrimSpace(thinkBlockPattern.ReplaceAllString(s, "")) },
+		stripCodeFence,
+		extractJSONText,
+		removeTrailingCommas,
+	}
+	for _, repair := range repairs {
+		text = repair(text)
+		if err := json.Unmarshal([]byte(text), &value); err == nil {
+			return value, text, true, nil
+		}
+	}
+	return nil, "", false, errors.New("无法解析为JSON")
+}
+
+// stripCodeFence 去掉markdown代码块标记，只保留第一个代码块的内容
+func stripCodeFence(text string) string {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return text
+	}
+	rest := text[start+3:]
+	// 跳过代码块的语言标记，如```json
+	if newline := strings.Index(rest, "\n"); newline >= 0 {
+		rest = rest[newline+1:]
+	}
+	if end := strings.Index(rest, "```"); end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.TrimSpace(rest)
+}
+
+// extractJSONText 截取文本中第一个对象或数组开始到最后一个对应结束符号之间的内容
+func extractJSONText(text string) string {
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return text
+	}
+	closing := "}"
+	if text[start] == '[' {
+		closing = "]"
+	}
+	end := strings.LastIndex(text, closing)
+	if end < start {
+		return text
+	}
+	return text[start : end+1]
+}
+
+// removeTrailingCommas 删除对象和数组最后一个元素后面多余的逗号，字符串中的内容保持不变
+func removeTrailingCommas(text string) string {
+	var result strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if inString {
+			result.WriteByte(ch)
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+			}
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		}
+		if ch == ',' {
+			next := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if strings.HasPrefix(next, "}") || strings.HasPrefix(next, "]") {
+				continue
+			}
+		}
+		result.WriteByte(ch)
+	}
+	return result.String()
+}
+
+// appendSchemaCorrection 在请求的消息末尾追加模型上一次的输出和纠正提示
+func appendSchemaCorrection(body []byte, output string, problems []string, schema interface{}) ([]byte, error) {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return nil, err
+	}
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok {
+		return nil, errors.New("请求中没有messages字段")
+	}
+
+	schemaJSON, _ := json.Marshal(schema)
+	correction := fmt.Sprintf(schemaCorrectionTemplate, "- "+strings.Join(problems, "\n- "), string(schemaJSON))
+	messages = append(messages,
+		map[string]interface{}{"role": "assistant", "content": output},
+		map[string]interface{}{"role": "user", "content": correction},
+	)
+	requestData["messages"] = messages
+	return json.Marshal(requestData)
+}
@@ -0,0 +1,526 @@
+/**
+  @author: Hanhai
+  @desc: 工具调用模拟模块，为不支持原生工具调用的模型注入工具说明提示词，并将模型输出的JSON转换为tool_calls
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toolPromptTemplate 注入到系统提示词中的工具说明
+const toolPromptTemplate = `You have access to the following tools:
+
+<tools>
+%s
+</tools>
+
+To call one or more tools, reply with ONLY a JSON object in exactly this format, with no other text:
+{"tool_calls": [{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}]}
+
+%s`
+
+// emulatedToolCall 模型输出的工具调用
+type emulatedToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// needsToolEmulation 判断请求是否需要模拟工具调用：请求包含工具定义且模型被标记为不支持原生工具调用
+func needsToolEmulation(requestData map[string]interface{}, modelName string) bool {
+	tools, ok := requestData["tools"].([]interface{})
+	if !ok || len(tools) == 0 || modelName == "" {
+		return false
+	}
+	return model.IsToolEmulationModel(modelName)
+}
+
+// requestToolNames 返回请求中定义的工具名称，请求不需要模拟工具调用时返回nil
+func requestToolNames(body []byte, modelName string) []string {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil || !needsToolEmulation(requestData, modelName) {
+		return nil
+	}
+	if choice, ok := requestData["tool_choice"].(string); ok && choice == "none" {
+		return nil
+	}
+
+	names := make([]string, 0)
+	for _, tool := range requestData["tools"].([]interface{}) {
+		if name := toolFunctionName(tool); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// toolFunctionName 获取工具定义中的函数名称
+func toolFunctionName(tool interface{}) string {
+	toolMap, _ := tool.(map[string]interface{})
+	function, _ := toolMap["function"].(map[string]interface{})
+	name, _ := function["name"].(string)
+	return name
+}
+
+// emulateToolCalling 将请求中的工具定义转换为系统提示词，并将历史中的工具调用和工具结果转换为普通消息
+func emulateToolCalling(requestData map[string]interface{}) {
+	tools, _ := requestData["tools"].([]interface{})
+	toolChoice := requestData["tool_choice"]
+	delete(requestData, "tools")
+	delete(requestData, "tool_choice")
+	delete(requestData, "parallel_tool_calls")
+
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok {
+		return
+	}
+	messages = convertToolMessages(messages)
+
+	if choice, ok := toolChoice.(string); !ok || choice != "none" {
+		functions := make([]interface{}, 0, len(tools))
+		for _, tool := range tools {
+			if toolMap, ok := tool.(map[string]interface{}); ok && toolMap["function"] != nil {
+				functions = append(functions, toolMap["function"])
+			}
+		}
+		toolsJSON, _ := json.MarshalIndent(functions, "", "  ")
+		prompt := fmt.Sprintf(toolPromptTemplate, toolsJSON, toolChoiceInstruction(toolChoice))
+		messages = injectSystemPrompt(messages, prompt)
+	}
+
+	requestData["messages"] = messages
+}
+
+// toolChoiceInstruction 根据tool_choice生成调用要求
+func toolChoiceInstruction(toolChoice interface{}) string {
+	if choice, ok := toolChoice.(string); ok && choice == "required" {
+		return "You MUST call at least one tool."
+	}
+	if choiceMap, ok := toolChoice.(map[string]interface{}); ok {
+		if name := toolFunctionName(choiceMap); name != "" {
+			return fmt.Sprintf("You MUST call the tool %q.", name)
+		}
+	}
+	return "If no tool is needed, reply to the user normally without any JSON."
+}
+
+// injectSystemPrompt 将提示词追加到系统消息中，没有系统消息时插入一条
+func injectSystemPrompt(messages []interface{}, prompt string) []interface{} {
+	if len(messages) > 0 {
+		if first, ok := messages[0].(map[string]interface{}); ok && first["role"] == "system" {
+			if content, ok := first["content"].(string); ok {
+				first["content"] = content + "\n\n" + prompt
+				return messages
+			}
+		}
+	}
+	system := map[string]interface{}{"role": "system", "content": prompt}
+	return append([]interface{}{system}, messages...)
+}
+
+// convertToolMessages 将助手的tool_calls转换为JSON文本，将tool角色的工具结果转换为用户消息
+func convertToolMessages(messages []interface{}) []interface{} {
+	// 记录工具调用ID对应的工具名称，用于说明工具结果来自哪个工具
+	callNames := make(map[string]string)
+	converted := make([]interface{}, 0, len(messages))
+
+	for _, msg := range messages {
+		message, ok := msg.(map[string]interface{})
+		if !ok {
+			converted = append(converted, msg)
+			continue
+		}
+
+		switch message["role"] {
+		case "assistant":
+			toolCalls, ok := message["tool_calls"].([]interface{})
+			if !ok || len(toolCalls) == 0 {
+				break
+			}
+			calls := make([]emulatedToolCall, 0, len(toolCalls))
+			for _, tc := range toolCalls {
+				call, _ := tc.(map[string]interface{})
+				name := toolFunctionName(call)
+				function, _ := call["function"].(map[string]interface{})
+				arguments, _ := function["arguments"].(string)
+				if !json.Valid([]byte(arguments)) {
+					arguments = "{}"
+				}
+				if id, ok := call["id"].(string); ok {
+					callNames[id] = name
+				}
+				calls = append(calls, emulatedToolCall{Name: name, Arguments: json.RawMessage(arguments)})
+			}
+			callsJSON, _ := json.Marshal(map[string]interface{}{"tool_calls": calls})
+
+			content := messageText(message["content"])
+			if content != "" {
+				content += "\n"
+			}
+			message = map[string]interface{}{
+				"role":    "assistant",
+				"content": content + string(callsJSON),
+			}
+
+		case "tool", "function":
+			name, _ := message["name"].(string)
+			id, _ := message["tool_call_id"].(string)
+			if name == "" {
+				name = callNames[id]
+			}
+			message = map[string]interface{}{
+				"role":    "user",
+				"content": fmt.Sprintf("Tool result (name: %s, id: %s):\n%s", name, id, messageText(message["content"])),
+			}
+		}
+		converted = append(converted, message)
+	}
+	return converted
+}
+
+// messageText 获取消息内容中的文本，内容为数组时拼接其中的文本部分
+func messageText(content interface{}) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, part := range v {
+			if partMap, ok := part.(map[string]interface{}); ok {
+				if text, ok := partMap["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	default:
+		return ""
+	}
+}
+
+// parseToolCalls 解析模型输出中的工具调用，只接受请求中定义的工具
+func parseToolCalls(content string, toolNames []string) ([]interface{}, bool) {
+	content = strings.TrimSpace(content)
+	// 去除代码块标记
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+		content = strings.TrimSpace(content)
+	}
+	if !strings.HasPrefix(content, "{") {
+		return nil, false
+	}
+
+	var output struct {
+		ToolCalls []emulatedToolCall `json:"tool_calls"`
+		emulatedToolCall
+	}
+	if err := json.Unmarshal([]byte(content), &output); err != nil {
+		return nil, false
+	}
+	calls := output.ToolCalls
+	if len(calls) == 0 && output.Name != "" {
+		// 兼容只输出单个调用的情况
+		calls = []emulatedToolCall{output.emulatedToolCall}
+	}
+	if len(calls) == 0 {
+		return nil, false
+	}
+
+	toolCalls := make([]interface{}, 0, len(calls))
+	for i, call := range calls {
+		if !containsString(toolNames, call.Name) {
+			return nil, false
+		}
+		// arguments 可能是JSON对象，也可能已经是JSON字符串
+		arguments := "{}"
+		var argumentsString string
+		if err := json.Unmarshal(call.Arguments, &argumentsString); err == nil {
+			arguments = argumentsString
+		} else if len(call.Arguments) > 0 {
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, call.Arguments); err == nil {
+				arguments = compacted.String()
+			}
+		}
+		toolCalls = append(toolCalls, map[string]interface{}{
+			"index": i,
+			"id":    newToolCallID(),
+			"type":  "function",
+			"function": map[string]interface{}{
+				"name":      call.Name,
+				"arguments": arguments,
+			},
+		})
+	}
+	return toolCalls, true
+}
+
+// containsString 判断字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newToolCallID 生成工具调用ID
+func newToolCallID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
+
+// transformToolCallResponse 将非流式响应中的工具调用JSON转换为tool_calls
+func transformToolCallResponse(body []byte, toolNames []string) []byte {
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return body
+	}
+	choices, ok := responseData["choices"].([]interface{})
+	if !ok {
+		return body
+	}
+
+	converted := false
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		content, _ := message["content"].(string)
+		toolCalls, ok := parseToolCalls(content, toolNames)
+		if !ok {
+			continue
+		}
+		for _, tc := range toolCalls {
+			delete(tc.(map[string]interface{}), "index")
+		}
+		message["content"] = nil
+		message["tool_calls"] = toolCalls
+		choice["finish_reason"] = "tool_calls"
+		converted = true
+	}
+	if !converted {
+		return body
+	}
+
+	updatedBody, err := json.Marshal(responseData)
+	if err != nil {
+		return body
+	}
+	logger.Info("已将模型输出转换为工具调用")
+	return updatedBody
+}
+
+// toolCallWriter 将模型输出的工具调用JSON转换为tool_calls
+// 非流式响应在请求结束后统一转换；流式响应中内容以JSON开头时暂存，直到结束时再判断是否为工具调用
+type toolCallWriter struct {
+	gin.ResponseWriter
+	toolNames []string
+	stream    bool
+	decided   bool
+	body      bytes.Buffer // 非流式响应内容，流式响应中未处理完的行
+	content   strings.Builder
+	buffering bool                   // 正在暂存可能是工具调用的内容
+	template  map[string]interface{} // 用于生成转换后数据块的模板
+	flushed   bool
+	skipBlank bool // 暂存的内容已随结束数据块输出，丢弃该数据块之后的空行
+}
+
+// Write 暂存或转换响应数据
+func (w *toolCallWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.Contains(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	if w.Status() >= http.StatusBadRequest {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.stream {
+		return w.body.Write(data)
+	}
+
+	w.body.Write(data)
+	for {
+		line, err := w.body.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			remaining := append(line, w.body.Bytes()...)
+			w.body.Reset()
+			w.body.Write(remaining)
+			break
+		}
+		if err := w.writeStreamLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString 实现gin.ResponseWriter接口
+func (w *toolCallWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// writeStreamLine 处理流式响应中的一行
+func (w *toolCallWriter) writeStreamLine(line []byte) error {
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		// 暂存内容时丢弃事件之间的空行，转换后的数据块会自带空行
+		if len(trimmed) == 0 && (w.buffering || w.skipBlank) {
+			w.skipBlank = false
+			return nil
+		}
+		w.skipBlank = false
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	}
+
+	w.skipBlank = false
+	data := bytes.TrimSpace(bytes.TrimPrefix(trimmed, []byte("data:")))
+	if bytes.Equal(data, []byte("[DONE]")) {
+		if err := w.flushToolCalls(""); err != nil {
+			return err
+		}
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	}
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		// usage等没有choices的数据块，先输出暂存的内容
+		if err := w.flushToolCalls(""); err != nil {
+			return err
+		}
+		_, err := w.ResponseWriter.Write(line)
+		return err
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	delta, _ := choice["delta"].(map[string]interface{})
+	content, _ := delta["content"].(string)
+	finishReason, _ := choice["finish_reason"].(string)
+	// 使用有内容的数据块作为模板，避免使用保活数据块中的字段
+	if w.template == nil || content != "" || finishReason != "" {
+		w.template = chunk
+	}
+
+	if !w.flushed && !w.buffering && content != "" {
+		// 根据第一个非空白字符判断输出是否可能是工具调用
+		if first := strings.TrimSpace(content); first != "" {
+			if strings.HasPrefix(first, "{") || strings.HasPrefix(first, "`") {
+				w.buffering = true
+			} else {
+				w.flushed = true
+			}
+		}
+	}
+
+	if w.buffering {
+		w.content.WriteString(content)
+		if finishReason != "" {
+			w.skipBlank = true
+			return w.flushToolCalls(finishReason)
+		}
+		delete(delta, "content")
+		if len(delta) == 0 || (len(delta) == 1 && delta["role"] != nil) {
+			return nil
+		}
+		return w.writeChunk(chunk)
+	}
+
+	_, err := w.ResponseWriter.Write(line)
+	return err
+}
+
+// flushToolCalls 输出暂存的内容，内容是工具调用时转换为tool_calls数据块
+func (w *toolCallWriter) flushToolCalls(finishReason string) error {
+	if !w.buffering {
+		return nil
+	}
+	w.buffering = false
+	w.flushed = true
+	content := w.content.String()
+
+	if toolCalls, ok := parseToolCalls(content, w.toolNames); ok {
+		logger.Info("已将模型流式输出转换为工具调用")
+		if err := w.writeChunk(w.newChunk(map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": toolCalls}, nil)); err != nil {
+			return err
+		}
+		return w.writeChunk(w.newChunk(map[string]interface{}{}, "tool_calls"))
+	}
+
+	var reason interface{}
+	if finishReason != "" {
+		reason = finishReason
+	}
+	return w.writeChunk(w.newChunk(map[string]interface{}{"content": content}, reason))
+}
+
+// newChunk 根据模板生成数据块
+func (w *toolCallWriter) newChunk(delta map[string]interface{}, finishReason interface{}) map[string]interface{} {
+	chunk := map[string]interface{}{"object": "chat.completion.chunk"}
+	for _, field := range []string{"id", "object", "created", "model", "system_fingerprint"} {
+		if value, ok := w.template[field]; ok {
+			chunk[field] = value
+		}
+	}
+	chunk["choices"] = []interface{}{map[string]interface{}{
+		"index":         0,
+		"delta":         delta,
+		"finish_reason": finishReason,
+	}}
+	return chunk
+}
+
+// writeChunk 写入SSE数据块
+func (w *toolCallWriter) writeChunk(chunk map[string]interface{}) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = w.ResponseWriter.Write([]byte("data: " + string(data) + "\n\n"))
+	return err
+}
+
+// finish 写入暂存的响应
+func (w *toolCallWriter) finish() {
+	if w.stream {
+		if w.body.Len() > 0 {
+			w.writeStreamLine(w.body.Bytes())
+		}
+		w.flushToolCalls("")
+		return
+	}
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(transformToolCallResponse(w.body.Bytes(), w.toolNames))
+	}
+}
+
+// useToolEmulation 替换响应写入器，将模型输出的工具调用JSON转换为tool_calls，返回恢复函数
+func useToolEmulation(c *gin.Context, toolNames []string) func() {
+	writer := &toolCallWriter{ResponseWriter: c.Writer, toolNames: toolNames}
+	originalWriter := c.Writer
+	c.Writer = writer
+	return func() {
+		writer.finish()
+		c.Writer = originalWriter
+	}
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamChunk 构造流式响应的数据行
+func streamChunk(content string, finishReason string) string {
+	delta := map[string]interface{}{}
+	if content != "" {
+		delta["content"] = content
+	}
+	var reason interface{}
+	if finishReason != "" {
+		reason = finishReason
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-1",
+		"object":  "chat.completion.chunk",
+		"model":   "THUDM/glm-4-9b-chat",
+		"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": reason}},
+	})
+	return "data: " + string(data) + "\n\n"
+}
+
+// writeToolStream 通过toolCallWriter写入流式响应，每次写入一个分片，返回客户端收到的内容
+func writeToolStream(t *testing.T, status int, writes []string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	restore := useToolEmulation(c, []string{"get_weather"})
+	c.Header("Content-Type", "text/event-stream")
+	c.Status(status)
+	for _, data := range writes {
+		if _, err := c.Writer.Write([]byte(data)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	restore()
+	return w.Body.String()
+}
+
+// parseSSEChunks 解析SSE响应中的数据块，返回数据块和是否以[DONE]结束
+func parseSSEChunks(t *testing.T, body string) ([]map[string]interface{}, bool) {
+	t.Helper()
+	if strings.Contains(body, "\n\n\n") {
+		t.Errorf("extra blank line between events: %q", body)
+	}
+	var chunks []map[string]interface{}
+	done := false
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		if done {
+			t.Errorf("data after [DONE]: %s", event)
+		}
+		chunks = append(chunks, mustJSON(t, data))
+	}
+	return chunks, done
+}
+
+// chunkDelta 返回数据块的delta和finish_reason
+func chunkDelta(chunk map[string]interface{}) (map[string]interface{}, interface{}) {
+	choice := chunk["choices"].([]interface{})[0].(map[string]interface{})
+	delta, _ := choice["delta"].(map[string]interface{})
+	return delta, choice["finish_reason"]
+}
+
+func TestToolCallWriterStreamToolCall(t *testing.T) {
+	// 工具调用JSON分散在多个数据块中，数据块本身也被拆分到不同的写入中
+	stream := streamChunk("", "") +
+		streamChunk(" {\"tool_calls\": [{\"name\": \"get_", "") +
+		streamChunk("weather\", \"arguments\": {\"city\": \"北京\"}}]}", "") +
+		streamChunk("", "stop") +
+		"data: [DONE]\n\n"
+	writes := []string{stream[:40], stream[40:200], stream[200:]}
+
+	chunks, done := parseSSEChunks(t, writeToolStream(t, http.StatusOK, writes))
+	if !done {
+		t.Error("stream does not end with [DONE]")
+	}
+	// 开头的空数据块原样输出，之后是转换后的tool_calls和结束数据块
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want keep-alive, tool_calls and finish chunks: %v", len(chunks), chunks)
+	}
+	chunks = chunks[1:]
+
+	delta, reason := chunkDelta(chunks[0])
+	if reason != nil || delta["content"] != nil {
+		t.Errorf("tool call chunk delta = %v, finish_reason = %v", delta, reason)
+	}
+	toolCalls, _ := delta["tool_calls"].([]interface{})
+	if len(toolCalls) != 1 {
+		t.Fatalf("tool_calls = %v, want one call", delta["tool_calls"])
+	}
+	call := toolCalls[0].(map[string]interface{})
+	function := call["function"].(map[string]interface{})
+	if function["name"] != "get_weather" || function["arguments"] != `{"city":"北京"}` || call["type"] != "function" {
+		t.Errorf("tool call = %v", call)
+	}
+	if id, _ := call["id"].(string); !strings.HasPrefix(id, "call_") {
+		t.Errorf("tool call id = %q", id)
+	}
+	if chunks[0]["id"] != "chatcmpl-1" || chunks[0]["model"] != "THUDM/glm-4-9b-chat" {
+		t.Errorf("chunk fields not copied from upstream: %v", chunks[0])
+	}
+
+	if _, reason := chunkDelta(chunks[1]); reason != "tool_calls" {
+		t.Errorf("finish_reason = %v, want tool_calls", reason)
+	}
+}
+
+func TestToolCallWriterStreamText(t *testing.T) {
+	// 普通文本原样输出
+	stream := streamChunk("今天", "") + streamChunk("天气很好", "") + streamChunk("", "stop") + "data: [DONE]\n\n"
+	if got := writeToolStream(t, http.StatusOK, []string{stream[:30], stream[30:]}); got != stream {
+		t.Errorf("text stream changed:\ngot  %q\nwant %q", got, stream)
+	}
+
+	// 以JSON开头但不是已定义工具的调用时，暂存的内容作为一个数据块输出
+	content := `{"tool_calls": [{"name": "delete_files", "arguments": {}}]}`
+	chunks, done := parseSSEChunks(t, writeToolStream(t, http.StatusOK, []string{
+		streamChunk(content[:20], ""), streamChunk(content[20:], ""), streamChunk("", "stop"), "data: [DONE]\n\n",
+	}))
+	if !done || len(chunks) != 1 {
+		t.Fatalf("got %d chunks, done %v, want one content chunk", len(chunks), done)
+	}
+	if delta, reason := chunkDelta(chunks[0]); delta["content"] != content || reason != "stop" || delta["tool_calls"] != nil {
+		t.Errorf("delta = %v, finish_reason = %v, want the buffered content", delta, reason)
+	}
+
+	// 上游没有发送结束标记时，请求结束后输出暂存的内容
+	chunks, _ = parseSSEChunks(t, writeToolStream(t, http.StatusOK, []string{streamChunk(`{"answer": 42}`, "")}))
+	if len(chunks) != 1 {
+		t.Fatalf("got %d chunks, want the buffered content", len(chunks))
+	}
+	if delta, _ := chunkDelta(chunks[0]); delta["content"] != `{"answer": 42}` {
+		t.Errorf("delta = %v", delta)
+	}
+}
+
+func TestToolCallWriterErrorPassThrough(t *testing.T) {
+	body := `{"error":{"message":"rate limited"}}`
+	if got := writeToolStream(t, http.StatusTooManyRequests, []string{body}); got != body {
+		t.Errorf("error body = %q, want %q", got, body)
+	}
+}
+
+func TestToolCallWriterNonStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	restore := useToolEmulation(c, []string{"get_weather"})
+	c.Header("Content-Type", "application/json")
+	c.Writer.Write([]byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant",`))
+	c.Writer.Write([]byte(`"content":"` + "```json\\n{\\\"name\\\": \\\"get_weather\\\", \\\"arguments\\\": \\\"{\\\\\\\"city\\\\\\\": \\\\\\\"上海\\\\\\\"}\\\"}\\n```" + `"},"finish_reason":"stop"}]}`))
+	restore()
+
+	response := mustJSON(t, w.Body.String())
+	choice := response["choices"].([]interface{})[0].(map[string]interface{})
+	message := choice["message"].(map[string]interface{})
+	if choice["finish_reason"] != "tool_calls" || message["content"] != nil {
+		t.Fatalf("choice = %v, want converted tool call", choice)
+	}
+	call := message["tool_calls"].([]interface{})[0].(map[string]interface{})
+	function := call["function"].(map[string]interface{})
+	if function["name"] != "get_weather" || function["arguments"] != `{"city": "上海"}` {
+		t.Errorf("tool call = %v", call)
+	}
+	if _, ok := call["index"]; ok {
+		t.Error("non-stream tool call has index")
+	}
+}
@@ -8,8 +8,10 @@ package proxy
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
 	"flowsilicon/internal/model"
 	"flowsilicon/pkg/utils"
 	"fmt"
@@ -34,18 +36,24 @@ func isReasonModel(modelName string) bool {
 	return modelType == 7
 }
 
+// errModelRequired 请求未指定模型且未配置default别名
+var errModelRequired = errors.New("model is required")
+
 // TransformRequestBody 转换请求体，处理OpenAI和硅基流动API之间的差异
-func TransformRequestBody(body []byte, path string) ([]byte, error) {
+// client 为下游客户端身份，按客户端名称解析模型别名
+// 返回转换后的请求体和因超出上下文长度被裁剪的消息数
+func TransformRequestBody(body []byte, path string, client middleware.Client) ([]byte, int, error) {
 	// 如果请求体为空，直接返回
 	if len(body) == 0 {
-		return body, nil
+		return body, 0, nil
 	}
 
 	// 解析JSON
 	var requestData map[string]interface{}
 	if err := json.Unmarshal(body, &requestData); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	trimmed := 0
 
 	// 对于无版本号路径，确保path与标准格式兼容
 	// 无版本号路径可能只有/chat而不是/chat/completions
@@ -56,12 +64,29 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		logger.Info("检测到/chat路径请求，将被视为/chat/completions")
 	}
 
+	// 解析模型别名，未指定模型的对话和补全请求使用default别名
+	requestedModel, _ := requestData["model"].(string)
+	if requestedModel == "" && strings.Contains(pathForCheck, "/completions") {
+		target, found := model.ResolveModelAlias(model.DefaultAlias, client.Name)
+		if !found {
+			logger.Error("请求未指定模型，且未配置%s别名", model.DefaultAlias)
+			return nil, 0, errModelRequired
+		}
+		requestData["model"] = target
+		logger.Info("请求未指定模型，使用默认模型: %s", target)
+	} else if requestedModel != "" {
+		if target, found := model.ResolveModelAlias(requestedModel, client.Name); found && target != requestedModel {
+			requestData["model"] = target
+			logger.Info("模型别名 %s 映射为: %s", requestedModel, target)
+		}
+	}
+
 	// 处理chat/completions请求
 	if strings.Contains(pathForCheck, "/chat/completions") {
 		// 检查是否有messages字段
 		if _, hasMessages := requestData["messages"]; !hasMessages {
 			logger.Error("chat/completions请求缺少messages字段")
-			return nil, fmt.Errorf("message field is required")
+			return nil, 0, fmt.Errorf("message field is required")
 		}
 
 		// 检查是否有model字段
@@ -90,9 +115,15 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 				requestData["timeout"] = 3600 // 60分钟
 				logger.Info("为推理模型%s设置API超时时间为60分钟", model)
 			}
-		} else {
-			// 如果没有提供模型，使用默认模型
-			requestData["model"] = "GLM-4"
+
+			// 不支持原生工具调用的模型，将工具定义转换为提示词
+			if needsToolEmulation(requestData, model) {
+				emulateToolCalling(requestData)
+				logger.Info("模型%s不支持原生工具调用，使用提示词模拟工具调用", model)
+			}
+
+			// 超出模型上下文长度时按裁剪策略丢弃或总结最早的消息
+			trimmed = trimContext(requestData, model, client)
 		}
 	}
 
@@ -102,7 +133,7 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		// 检查是否有prompt字段
 		if _, hasPrompt := requestData["prompt"]; !hasPrompt {
 			logger.Error("completions请求缺少prompt字段")
-			return nil, fmt.Errorf("prompt field is required")
+			return nil, 0, fmt.Errorf("prompt field is required")
 		}
 
 		// 检查是否有model字段
@@ -131,9 +162,6 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 				requestData["timeout"] = 3600 // 60分钟
 				logger.Info("为推理模型%s设置API超时时间为60分钟", model)
 			}
-		} else {
-			// 如果没有提供模型，使用默认模型
-			requestData["model"] = "GLM-4"
 		}
 	}
 
@@ -154,12 +182,12 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		// 检查必要字段
 		if _, ok := requestData["query"]; !ok {
 			logger.Error("请求中缺少query字段")
-			return nil, fmt.Errorf("请求中缺少query字段")
+			return nil, 0, fmt.Errorf("请求中缺少query字段")
 		}
 
 		if _, ok := requestData["documents"]; !ok {
 			logger.Error("请求中缺少documents字段")
-			return nil, fmt.Errorf("请求中缺少documents字段")
+			return nil, 0, fmt.Errorf("请求中缺少documents字段")
 		}
 
 		// 设置默认值
@@ -175,7 +203,8 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		jsonData, _ := json.Marshal(requestData)
 		logger.Info("转换后的重排序请求体: %s", string(jsonData))
 
-		return json.Marshal(requestData)
+		newBody, err := json.Marshal(requestData)
+		return newBody, 0, err
 	}
 
 	// 处理图片生成请求
@@ -195,7 +224,7 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		// 检查必要字段
 		if _, ok := requestData["prompt"]; !ok {
 			logger.Error("请求中缺少prompt字段")
-			return nil, fmt.Errorf("请求中缺少prompt字段")
+			return nil, 0, fmt.Errorf("请求中缺少prompt字段")
 		}
 
 		if _, ok := requestData["n"]; !ok {
@@ -221,7 +250,8 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		jsonData, _ := json.Marshal(requestData)
 		logger.Info("转换后的图片生成请求体: %s", string(jsonData))
 
-		return json.Marshal(requestData)
+		newBody, err := json.Marshal(requestData)
+		return newBody, 0, err
 	}
 
 	// 处理embeddings请求
@@ -251,7 +281,7 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 			}
 		} else {
 			logger.Error("请求中缺少input字段")
-			return nil, fmt.Errorf("请求中缺少input字段")
+			return nil, 0, fmt.Errorf("请求中缺少input字段")
 		}
 
 		// 硅基流动API需要的格式
@@ -265,13 +295,15 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 		jsonData, _ := json.Marshal(newRequestData)
 		logger.Info("转换后的embeddings请求体: %s", string(jsonData))
 
-		return json.Marshal(newRequestData)
+		newBody, err := json.Marshal(newRequestData)
+		return newBody, 0, err
 	}
 
 	// 不再打印转换后的请求体
 
 	// 重新序列化为JSON
-	return json.Marshal(requestData)
+	newBody, err := json.Marshal(requestData)
+	return newBody, trimmed, err
 }
 
 // TransformResponseBody 转换响应体，处理硅基流动API和OpenAI之间的差异
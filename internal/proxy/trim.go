@@ -0,0 +1,202 @@
+/**
+  @author: Hanhai
+  @desc: 上下文裁剪，聊天请求超出模型上下文长度时保留系统提示，丢弃或总结最早的消息
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextTrimmedHeader 响应头，返回因超出上下文长度被裁剪的消息数
+const ContextTrimmedHeader = "X-Context-Trimmed"
+
+// 生成摘要的超时时间和最大输出令牌数
+const (
+	contextSummaryTimeout   = 60 * time.Second
+	contextSummaryMaxTokens = 512
+)
+
+// 生成摘要使用的提示词
+const contextSummaryPrompt = `Summarize the following earlier part of a conversation between a user and an assistant. Keep the facts, decisions, names, numbers and open questions that later messages may refer to. Reply with the summary only.`
+
+// 摘要插入到请求中时使用的前缀
+const contextSummaryPrefix = "Summary of the earlier conversation:\n"
+
+// messageRole 获取消息的角色
+func messageRole(msg interface{}) string {
+	message, _ := msg.(map[string]interface{})
+	role, _ := message["role"].(string)
+	return role
+}
+
+// trimContext 按模型的上下文长度裁剪聊天请求中的消息，返回被裁剪的消息数
+// 开头的系统提示和最后一条消息始终保留；使用summarize策略时被裁剪的消息由摘要模型总结后插入到系统提示之后
+func trimContext(requestData map[string]interface{}, modelName string, client middleware.Client) int {
+	trimConfig := config.GetConfig().ApiProxy.ContextTrim
+	policy := trimConfig.GetPolicy()
+	if policy == config.ContextTrimOff {
+		return 0
+	}
+	contextLength := model.GetModelContextLength(modelName)
+	if contextLength <= 0 {
+		return 0
+	}
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok || len(messages) < 2 {
+		return 0
+	}
+
+	// 为输出预留的令牌数，优先使用请求中的max_tokens
+	reserve := trimConfig.GetReserveTokens()
+	if maxTokens, ok := requestData["max_tokens"].(float64); ok && maxTokens > 0 {
+		reserve = int(maxTokens)
+	}
+	budget := contextLength - reserve
+	if budget <= 0 {
+		logger.Warn("模型%s的上下文长度%d不足以预留%d个输出令牌，跳过上下文裁剪", modelName, contextLength, reserve)
+		return 0
+	}
+
+	total := countChatTokens(modelName, requestData)
+	if total <= budget {
+		return 0
+	}
+
+	head := 0
+	for head < len(messages) && (messageRole(messages[head]) == "system" || messageRole(messages[head]) == "developer") {
+		head++
+	}
+
+	// 从最早的对话开始按轮丢弃，一轮包括用户消息和之后的助手回复、工具结果，保证剩余的对话以用户消息开始
+	var dropped []interface{}
+	dropOldest := func() {
+		for len(messages)-head > 1 {
+			msg := messages[head]
+			messages = append(messages[:head:head], messages[head+1:]...)
+			dropped = append(dropped, msg)
+			if message, ok := msg.(map[string]interface{}); ok {
+				total -= countMessageTokens(modelName, message)
+			}
+			if role := messageRole(messages[head]); role != "assistant" && role != "tool" {
+				return
+			}
+		}
+	}
+	for total > budget && len(messages)-head > 1 {
+		dropOldest()
+	}
+	if len(dropped) == 0 {
+		return 0
+	}
+
+	if policy == config.ContextTrimSummarize {
+		summaryModel := trimConfig.GetSummaryModel()
+		summary, err := summarizeMessages(summaryModel, dropped, client)
+		if err != nil {
+			logger.Warn("使用模型%s总结被裁剪的消息失败，直接丢弃: %v", summaryModel, err)
+		} else {
+			summaryMessage := map[string]interface{}{"role": "system", "content": contextSummaryPrefix + summary}
+			messages = append(messages[:head:head], append([]interface{}{summaryMessage}, messages[head:]...)...)
+			total += countMessageTokens(modelName, summaryMessage)
+			// 摘要之后的消息仍然超出时继续丢弃
+			head++
+			for total > budget && len(messages)-head > 1 {
+				dropOldest()
+			}
+		}
+	}
+
+	requestData["messages"] = messages
+	if total > budget {
+		logger.Warn("模型%s的请求裁剪%d条消息后仍有%d个令牌，超出可用的%d个令牌", modelName, len(dropped), total, budget)
+	} else {
+		logger.Info("模型%s的请求超出上下文长度，使用%s策略裁剪了%d条消息，剩余%d个令牌", modelName, policy, len(dropped), total)
+	}
+	return len(dropped)
+}
+
+// summarizeMessages 使用摘要模型总结消息，请求通过代理发送，使用密钥池并记录统计
+func summarizeMessages(summaryModel string, messages []interface{}, client middleware.Client) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		message, _ := msg.(map[string]interface{})
+		text := messageText(message["content"])
+		if toolCalls, ok := message["tool_calls"]; ok && toolCalls != nil {
+			toolCallsJSON, _ := json.Marshal(toolCalls)
+			text += string(toolCallsJSON)
+		}
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", messageRole(msg), text)
+	}
+	if transcript.Len() == 0 {
+		return "", errors.New("被裁剪的消息没有内容")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": summaryModel,
+		"messages": []interface{}{
+			map[string]interface{}{"role": "system", "content": contextSummaryPrompt},
+			map[string]interface{}{"role": "user", "content": transcript.String()},
+		},
+		"max_tokens": contextSummaryMaxTokens,
+		"stream":     false,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), contextSummaryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = req
+	c.Params = gin.Params{{Key: "path", Value: "/chat/completions"}}
+	c.Set("request_id", newLocalID("trim"))
+	middleware.SetClient(c, client)
+
+	HandleOpenAIProxy(c)
+
+	// 重试时可能先写入了失败的响应，使用最后一个JSON对象作为结果
+	data := lastJSONObject(recorder.Body.Bytes())
+	if data == nil {
+		return "", errors.New("摘要模型没有返回内容")
+	}
+	if errData, hasError := data["error"]; hasError {
+		return "", fmt.Errorf("摘要模型返回错误: %v", errData)
+	}
+	choices, _ := data["choices"].([]interface{})
+	if len(choices) == 0 {
+		return "", errors.New("摘要模型没有返回内容")
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	message, _ := choice["message"].(map[string]interface{})
+	summary := strings.TrimSpace(messageText(message["content"]))
+	if summary == "" {
+		return "", errors.New("摘要模型返回的内容为空")
+	}
+	return summary, nil
+}
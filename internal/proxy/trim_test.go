@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"strings"
+	"testing"
+)
+
+// setModelContextLength 添加模型并设置上下文长度
+func setModelContextLength(t *testing.T, modelName string, contextLength int) {
+	t.Helper()
+	if _, err := model.SaveModels([]string{modelName}); err != nil {
+		t.Fatalf("SaveModels() error = %v", err)
+	}
+	tx, err := model.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := model.UpdateModelContextLengthWithTx(tx, modelName, contextLength); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// chatMessage 构造内容为重复文本的聊天消息
+func chatMessage(role string, name string) map[string]interface{} {
+	return map[string]interface{}{"role": role, "content": name + " " + strings.Repeat("word ", 50)}
+}
+
+// messageNames 返回消息内容的第一个词，用于比较裁剪结果
+func messageNames(requestData map[string]interface{}) []string {
+	var names []string
+	for _, msg := range requestData["messages"].([]interface{}) {
+		content, _ := msg.(map[string]interface{})["content"].(string)
+		names = append(names, strings.Fields(content)[0])
+	}
+	return names
+}
+
+func TestTrimContext(t *testing.T) {
+	const trimModel = "test/trim-model"
+	const contextLength = 100000
+	setModelContextLength(t, trimModel, contextLength)
+
+	conversation := func() []interface{} {
+		return []interface{}{
+			chatMessage("system", "s"),
+			chatMessage("user", "u1"),
+			chatMessage("assistant", "a1"),
+			chatMessage("user", "u2"),
+			chatMessage("assistant", "a2"),
+			chatMessage("user", "u3"),
+		}
+	}
+	withTools := func() []interface{} {
+		call := chatMessage("assistant", "a1")
+		call["tool_calls"] = []interface{}{map[string]interface{}{"id": "c1", "type": "function", "function": map[string]interface{}{"name": "f", "arguments": "{}"}}}
+		result := chatMessage("tool", "t1")
+		result["tool_call_id"] = "c1"
+		return []interface{}{chatMessage("user", "u1"), call, result, chatMessage("user", "u2"), chatMessage("assistant", "a2"), chatMessage("user", "u3")}
+	}
+
+	tests := []struct {
+		name        string
+		policy      string
+		model       string
+		messages    func() []interface{}
+		over        int // 请求超出可用令牌数的数量，小于0表示只留下很少的可用令牌
+		wantTrimmed int
+		wantNames   []string
+	}{
+		{"within budget", config.ContextTrimDrop, trimModel, conversation, 0, 0, []string{"s", "u1", "a1", "u2", "a2", "u3"}},
+		{"drop oldest round", config.ContextTrimDrop, trimModel, conversation, 1, 2, []string{"s", "u2", "a2", "u3"}},
+		{"keep system and last message", config.ContextTrimDrop, trimModel, conversation, -1, 4, []string{"s", "u3"}},
+		{"tool results dropped with their call", config.ContextTrimDrop, trimModel, withTools, 1, 3, []string{"u2", "a2", "u3"}},
+		{"policy off", config.ContextTrimOff, trimModel, conversation, -1, 0, []string{"s", "u1", "a1", "u2", "a2", "u3"}},
+		{"unknown context length", config.ContextTrimDrop, "test/unknown-model", conversation, -1, 0, []string{"s", "u1", "a1", "u2", "a2", "u3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *config.Config) {
+				cfg.ApiProxy.ContextTrim.Policy = tt.policy
+			})
+
+			requestData := map[string]interface{}{"model": tt.model, "messages": tt.messages()}
+			// 通过max_tokens控制可用令牌数
+			budget := 10
+			if tt.over >= 0 {
+				budget = countChatTokens(tt.model, requestData) - tt.over
+			}
+			requestData["max_tokens"] = float64(contextLength - budget)
+
+			if got := trimContext(requestData, tt.model, middleware.Client{}); got != tt.wantTrimmed {
+				t.Errorf("trimContext() = %d, want %d", got, tt.wantTrimmed)
+			}
+			if got := messageNames(requestData); strings.Join(got, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("messages = %v, want %v", got, tt.wantNames)
+			}
+		})
+	}
+}
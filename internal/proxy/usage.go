@@ -0,0 +1,113 @@
+/**
+  @author: Hanhai
+  @desc: 流式响应的令牌用量统计，始终向上游请求usage数据块，上游未返回时按累计的输出内容计算
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/pkg/tokenizer"
+	"strings"
+	"sync"
+)
+
+// ensureStreamUsage 在流式请求中开启stream_options.include_usage，让上游在最后返回usage数据块
+func ensureStreamUsage(body []byte) []byte {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return body
+	}
+	if stream, _ := requestData["stream"].(bool); !stream {
+		return body
+	}
+
+	options, _ := requestData["stream_options"].(map[string]interface{})
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	if includeUsage, _ := options["include_usage"].(bool); includeUsage {
+		return body
+	}
+	options["include_usage"] = true
+	requestData["stream_options"] = options
+
+	newBody, err := json.Marshal(requestData)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
+
+// clientRequestedUsage 判断客户端是否在请求中要求返回usage数据块
+func clientRequestedUsage(requestData map[string]interface{}) bool {
+	options, _ := requestData["stream_options"].(map[string]interface{})
+	includeUsage, _ := options["include_usage"].(bool)
+	return includeUsage
+}
+
+// isUsageOnlyChunk 判断数据块是否为只包含usage的最后一个数据块
+func isUsageOnlyChunk(chunk map[string]interface{}) bool {
+	if _, ok := chunk["usage"].(map[string]interface{}); !ok {
+		return false
+	}
+	choices, _ := chunk["choices"].([]interface{})
+	return len(choices) == 0
+}
+
+// streamUsage 统计一次流式响应的令牌用量
+type streamUsage struct {
+	mu               sync.Mutex
+	model            string
+	requestData      map[string]interface{}
+	promptTokens     int
+	completionTokens int
+	hasUsage         bool            // 上游是否返回了usage
+	output           strings.Builder // 所有choice的输出内容、推理内容和工具调用参数
+}
+
+// newStreamUsage 创建流式响应用量统计
+func newStreamUsage(model string, requestData map[string]interface{}) *streamUsage {
+	return &streamUsage{model: model, requestData: requestData}
+}
+
+// observe 记录一个数据块的usage和输出内容
+func (u *streamUsage) observe(chunk map[string]interface{}) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		promptTokens, _ := usage["prompt_tokens"].(float64)
+		completionTokens, _ := usage["completion_tokens"].(float64)
+		if promptTokens > 0 || completionTokens > 0 {
+			u.promptTokens = int(promptTokens)
+			u.completionTokens = int(completionTokens)
+			u.hasUsage = true
+		}
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	for _, c := range choices {
+		choice, _ := c.(map[string]interface{})
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			u.output.WriteString(deltaText(delta))
+		} else if text, ok := choice["text"].(string); ok {
+			u.output.WriteString(text)
+		}
+	}
+}
+
+// counts 返回输入和输出令牌数，优先使用上游返回的usage，没有时使用分词器计算
+func (u *streamUsage) counts() (int, int, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.hasUsage {
+		return u.promptTokens, u.completionTokens, true
+	}
+	promptTokens := 0
+	if u.requestData != nil {
+		promptTokens = countPromptTokens(u.model, u.requestData)
+	}
+	return promptTokens, tokenizer.CountTokens(u.model, u.output.String()), false
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsUsageOnlyChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk string
+		want  bool
+	}{
+		{"usage with empty choices", `{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2}}`, true},
+		{"usage without choices", `{"usage":{"prompt_tokens":3,"completion_tokens":2}}`, true},
+		{"content chunk", `{"choices":[{"delta":{"content":"hi"}}]}`, false},
+		{"last content chunk with usage", `{"choices":[{"delta":{"content":"hi"}}],"usage":{"prompt_tokens":3}}`, false},
+		{"null usage", `{"choices":[],"usage":null}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUsageOnlyChunk(mustJSON(t, tt.chunk)); got != tt.want {
+				t.Errorf("isUsageOnlyChunk(%s) = %v, want %v", tt.chunk, got, tt.want)
+			}
+		})
+	}
+}
+
+// streamUpstream 模拟上游流式响应，最后一个数据块只包含usage
+const streamUpstream = "data: {\"model\":\"Qwen/Qwen2.5-7B-Instruct\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hello\"}}]}\n\n" +
+	"data: {\"model\":\"Qwen/Qwen2.5-7B-Instruct\",\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":1,\"total_tokens\":8}}\n\n" +
+	"data: [DONE]\n\n"
+
+func TestHandleStreamResponseUsage(t *testing.T) {
+	setTestConfig(t, func(cfg *config.Config) {
+		cfg.RequestSettings.ProxyHandler.StandardTimeout = 1
+		cfg.RequestSettings.ProxyHandler.HeartbeatInterval = 10
+		cfg.RequestSettings.ProxyHandler.ProgressInterval = 10
+		cfg.RequestSettings.ProxyHandler.MaxFlushInterval = 100
+	})
+
+	// 客户端使用别名请求，实际请求的模型和开启usage的请求体由代理生成
+	servedModel := "Qwen/Qwen2.5-7B-Instruct"
+	sentBody := []byte(`{"model":"Qwen/Qwen2.5-7B-Instruct","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	tests := []struct {
+		name         string
+		originalBody string
+		wantUsage    bool
+	}{
+		{"client did not ask for usage", `{"model":"my-alias","stream":true,"messages":[{"role":"user","content":"hi"}]}`, false},
+		{"client asked for usage", `{"model":"my-alias","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := todayModelRequests(t, servedModel)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+			HandleStreamResponse(c, io.NopCloser(strings.NewReader(streamUpstream)), "sk-test", servedModel, sentBody, []byte(tt.originalBody))
+
+			body := w.Body.String()
+			if !strings.Contains(body, `"hello"`) || !strings.Contains(body, "data: [DONE]") {
+				t.Errorf("stream body missing content or [DONE]:\n%s", body)
+			}
+			if got := strings.Contains(body, `"usage"`); got != tt.wantUsage {
+				t.Errorf("usage chunk forwarded = %v, want %v:\n%s", got, tt.wantUsage, body)
+			}
+			// 统计记录在实际请求的模型下，而不是客户端请求的别名
+			if got := todayModelRequests(t, servedModel); got != before+1 {
+				t.Errorf("requests for %s = %d, want %d", servedModel, got, before+1)
+			}
+			if got := todayModelRequests(t, "my-alias"); got != 0 {
+				t.Errorf("requests for alias = %d, want 0", got)
+			}
+		})
+	}
+}
+
+// todayModelRequests 返回今天指定模型的请求数
+func todayModelRequests(t *testing.T, model string) int {
+	t.Helper()
+	stats, err := config.GetDailyStats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil {
+		return 0
+	}
+	return stats.Models[model].Requests
+}
@@ -0,0 +1,414 @@
+/**
+  @author: Hanhai
+  @desc: 视频生成任务模块，提交任务时记录使用的密钥，查询状态时使用同一密钥，任务成功后可将视频下载到本地
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 视频请求类型，用于选择密钥
+	videoRequestType = "video"
+	// 下载本地视频的路径前缀
+	videoDownloadPrefix = "/video/download/"
+	// 下载视频的超时时间
+	videoDownloadTimeout = 10 * time.Minute
+)
+
+// 正在下载的视频任务，避免重复下载
+var videoDownloads sync.Map
+
+// videoStatusResponse 上游返回的任务状态
+type videoStatusResponse struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Results struct {
+		Videos []struct {
+			URL string `json:"url"`
+		} `json:"videos"`
+	} `json:"results"`
+}
+
+// isVideoRequest 判断是否为视频生成任务相关请求
+func isVideoRequest(path string) bool {
+	path = strings.TrimPrefix(path, "/v1")
+	return path == "/video/submit" || path == "/video/status" || strings.HasPrefix(path, videoDownloadPrefix)
+}
+
+// HandleVideoRequest 处理视频生成任务请求
+func HandleVideoRequest(c *gin.Context, targetURL string, baseURL string) {
+	path := strings.TrimPrefix(c.Request.URL.Path, "/v1")
+	switch {
+	case path == "/video/submit":
+		handleVideoSubmit(c, targetURL, baseURL)
+	case path == "/video/status":
+		handleVideoStatus(c)
+	default:
+		handleVideoDownload(c, strings.TrimPrefix(path, videoDownloadPrefix))
+	}
+}
+
+// handleVideoSubmit 提交视频生成任务，成功后记录任务ID和使用的密钥
+func handleVideoSubmit(c *gin.Context, targetURL string, baseURL string) {
+	rl := GetRequestLogger(c)
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		localAPIError(c, http.StatusBadRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		localAPIError(c, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+	modelName, _ := requestData["model"].(string)
+	if modelName == "" {
+		localAPIError(c, http.StatusBadRequest, "model field is required")
+		return
+	}
+	prompt, _ := requestData["prompt"].(string)
+
+	// 解析模型别名
+	if target, found := model.ResolveModelAlias(modelName, middleware.GetClientName(c)); found && target != modelName {
+		rl.Info("模型别名 %s 映射为: %s", modelName, target)
+		modelName = target
+		requestData["model"] = target
+		if body, err = json.Marshal(requestData); err != nil {
+			localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to transform request body: %v", err))
+			return
+		}
+	}
+	rl.SetModel(modelName)
+
+	if isModelDisabled(modelName) {
+		localAPIError(c, http.StatusForbidden, fmt.Sprintf("模型 %s 已被禁用", modelName))
+		return
+	}
+	if !middleware.CheckClientModel(c, modelName) {
+		return
+	}
+	targetURL = routeToProvider(c, targetURL, baseURL, modelName)
+
+	retryConfig := config.GetConfig().ApiProxy.Retry
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(retryConfig.RetryDelayMs) * time.Millisecond)
+		}
+
+		apiKey, err := key.GetBestKeyForRequest(videoRequestType, modelName, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "No suitable API keys available",
+			})
+			return
+		}
+
+		resp, err := sendRawRequest(c, targetURL, bytes.NewReader(body), int64(len(body)), "application/json", apiKey)
+		canRetry := attempt < retryConfig.MaxRetries
+		if err != nil {
+			rl.Error("提交视频任务网络错误 -> URL: %s, Error: %v", targetURL, err)
+			key.UpdateApiKeyStatus(apiKey, false)
+			config.AddDailyRequestStat(apiKey, modelName, 1, 0, 0, false)
+			recordClientUsage(c, modelName, 0, 0, false)
+			if canRetry && retryConfig.RetryOnNetworkErrors {
+				continue
+			}
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("Failed to submit video job: %v", err),
+			})
+			return
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			key.UpdateApiKeyStatus(apiKey, false)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("Failed to read response body: %v", err),
+			})
+			return
+		}
+
+		success := resp.StatusCode == http.StatusOK
+		key.ReportApiKeyResponse(apiKey, resp.StatusCode, resp.Header, respBody)
+		config.AddDailyRequestStat(apiKey, modelName, 1, 0, 0, success)
+		recordClientUsage(c, modelName, 0, 0, success)
+		if !success {
+			rl.Warn("提交视频任务失败，状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+			if canRetry && statusRetryable(resp.StatusCode, retryConfig) {
+				continue
+			}
+			c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+			return
+		}
+
+		var submitResponse struct {
+			RequestID string `json:"requestId"`
+		}
+		if err := json.Unmarshal(respBody, &submitResponse); err != nil || submitResponse.RequestID == "" {
+			rl.Error("提交视频任务的响应中没有任务ID: %s", string(respBody))
+		} else {
+			now := time.Now().Unix()
+			job := &config.VideoJob{
+				RequestID: submitResponse.RequestID,
+				ApiKey:    apiKey,
+				Model:     modelName,
+				Prompt:    prompt,
+				Client:    middleware.GetClientID(c),
+				Status:    config.VideoJobInQueue,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if err := config.SaveVideoJob(job); err != nil {
+				rl.Error("保存视频任务失败: %v", err)
+			} else {
+				rl.Info("视频任务已提交: %s, 模型: %s, 密钥: %s", job.RequestID, modelName, utils.MaskKey(apiKey))
+			}
+		}
+
+		config.AddKeyRequestStat(apiKey, 1, 0)
+		go updateModelCallCount(modelName)
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+		return
+	}
+}
+
+// handleVideoStatus 查询视频生成任务状态，使用提交任务时的密钥
+func handleVideoStatus(c *gin.Context) {
+	var requestData struct {
+		RequestID string `json:"requestId"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil || requestData.RequestID == "" {
+		localAPIError(c, http.StatusBadRequest, "requestId field is required")
+		return
+	}
+
+	job, err := config.GetVideoJob(requestData.RequestID)
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to load video job: %v", err))
+		return
+	}
+	// 只能查询本客户端提交的任务，其他客户端的任务按不存在处理
+	if job == nil || job.Client != middleware.GetClientID(c) {
+		localAPIError(c, http.StatusNotFound, fmt.Sprintf("video job %s not found", requestData.RequestID))
+		return
+	}
+
+	// 已结束的任务直接返回保存的状态，不再查询上游
+	if !job.Finished() || job.Result == "" {
+		statusCode, respBody, err := pollVideoJob(job)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("Failed to query video job: %v", err),
+			})
+			return
+		}
+		if statusCode != http.StatusOK {
+			c.Data(statusCode, "application/json; charset=utf-8", respBody)
+			return
+		}
+	}
+	startVideoDownload(job)
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", videoStatusBody(job))
+}
+
+// pollVideoJob 使用提交任务时的密钥查询任务状态，并更新任务记录
+// 返回上游的状态码和响应体，状态码为200时job已更新为最新状态
+func pollVideoJob(job *config.VideoJob) (int, []byte, error) {
+	body, _ := json.Marshal(map[string]string{"requestId": job.RequestID})
+	statusURL := provider.ForModel(job.Model).BaseURL() + "/v1/video/status"
+
+	req, err := http.NewRequest(http.MethodPost, statusURL, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, nil, err
+	}
+	utils.SetCommonHeaders(req, job.ApiKey)
+	client := utils.CreateClientWithTimeout(time.Duration(config.GetConfig().RequestSettings.ProxyHandler.StandardTimeout) * time.Minute)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("查询视频任务 %s 状态失败: %v", job.RequestID, err)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("查询视频任务 %s 状态失败，状态码: %d, 响应: %s", job.RequestID, resp.StatusCode, string(respBody))
+		return resp.StatusCode, respBody, nil
+	}
+
+	var status videoStatusResponse
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return 0, nil, fmt.Errorf("invalid status response: %v", err)
+	}
+	job.Status = status.Status
+	job.Reason = status.Reason
+	job.Result = string(respBody)
+	if len(status.Results.Videos) > 0 {
+		job.VideoURL = status.Results.Videos[0].URL
+	}
+	if err := config.UpdateVideoJobStatus(job.RequestID, job.Status, job.Reason, job.VideoURL, job.Result); err != nil {
+		logger.Error("更新视频任务 %s 状态失败: %v", job.RequestID, err)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// RefreshVideoJob 查询未结束任务的最新状态，返回更新后的任务
+func RefreshVideoJob(requestID string) (*config.VideoJob, error) {
+	job, err := config.GetVideoJob(requestID)
+	if err != nil || job == nil {
+		return job, err
+	}
+	if job.Finished() {
+		return job, nil
+	}
+	statusCode, respBody, err := pollVideoJob(job)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("上游返回状态码 %d: %s", statusCode, string(respBody))
+	}
+	startVideoDownload(job)
+	return job, nil
+}
+
+// videoStatusBody 返回任务的状态响应，视频已下载到本地时添加本地下载地址
+func videoStatusBody(job *config.VideoJob) []byte {
+	if job.LocalPath == "" {
+		return []byte(job.Result)
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(job.Result), &result); err != nil {
+		return []byte(job.Result)
+	}
+	result["local_url"] = "/v1" + videoDownloadPrefix + job.RequestID
+	body, err := json.Marshal(result)
+	if err != nil {
+		return []byte(job.Result)
+	}
+	return body
+}
+
+// handleVideoDownload 返回下载到本地的视频
+func handleVideoDownload(c *gin.Context, requestID string) {
+	job, err := config.GetVideoJob(requestID)
+	if err != nil {
+		localAPIError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to load video job: %v", err))
+		return
+	}
+	if job == nil || job.LocalPath == "" || job.Client != middleware.GetClientID(c) {
+		localAPIError(c, http.StatusNotFound, fmt.Sprintf("video %s has not been downloaded", requestID))
+		return
+	}
+	c.File(job.LocalPath)
+}
+
+// videoDownloadDir 返回视频保存目录
+func videoDownloadDir() string {
+	return resolveDataDir(config.GetConfig().ApiProxy.Video.GetDownloadDir())
+}
+
+// resolveDataDir 返回数据目录的绝对路径，相对路径相对于可执行文件所在目录
+func resolveDataDir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	execPath, err := os.Executable()
+	if err != nil {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(execPath), dir)
+}
+
+// startVideoDownload 任务成功且启用了本地下载时，在后台下载视频
+func startVideoDownload(job *config.VideoJob) {
+	if job.Status == config.VideoJobSucceed && job.VideoURL != "" && job.LocalPath == "" && config.GetConfig().ApiProxy.Video.DownloadEnabled {
+		go downloadVideo(job.RequestID, job.VideoURL)
+	}
+}
+
+// downloadVideo 将视频下载到本地并记录保存路径
+func downloadVideo(requestID string, videoURL string) {
+	if _, loaded := videoDownloads.LoadOrStore(requestID, true); loaded {
+		return
+	}
+	defer videoDownloads.Delete(requestID)
+
+	dir := videoDownloadDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error("创建视频保存目录失败: %v", err)
+		return
+	}
+
+	ext := ".mp4"
+	if u, err := url.Parse(videoURL); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	localPath := filepath.Join(dir, requestID+ext)
+
+	client := utils.CreateClientWithTimeout(videoDownloadTimeout)
+	resp, err := client.Get(videoURL)
+	if err != nil {
+		logger.Error("下载视频 %s 失败: %v", requestID, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("下载视频 %s 失败，状态码: %d", requestID, resp.StatusCode)
+		return
+	}
+
+	// 先写入临时文件，下载完成后再重命名，避免返回不完整的视频
+	tmpPath := localPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		logger.Error("创建视频文件失败: %v", err)
+		return
+	}
+	_, err = io.Copy(file, resp.Body)
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		logger.Error("下载视频 %s 失败: %v", requestID, err)
+		return
+	}
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		os.Remove(tmpPath)
+		logger.Error("保存视频文件失败: %v", err)
+		return
+	}
+
+	if err := config.UpdateVideoJobLocalPath(requestID, localPath); err != nil {
+		logger.Error("记录视频 %s 本地路径失败: %v", requestID, err)
+		return
+	}
+	logger.Info("视频 %s 已下载到: %s", requestID, localPath)
+}
@@ -0,0 +1,45 @@
+/**
+  @author: Hanhai
+  @desc: 测试辅助模块，在临时目录中初始化日志后运行测试，供各个包的TestMain使用
+**/
+
+package testutil
+
+import (
+	"flowsilicon/internal/logger"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Main 切换到临时目录并初始化日志后运行测试，避免在包目录下生成logs和data
+// setup在临时目录中初始化各个包需要的数据库，返回的清理函数在测试结束后调用
+func Main(m *testing.M, setup func(dir string) (func(), error)) {
+	dir, err := os.MkdirTemp("", "flowsilicon-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	gin.SetMode(gin.TestMode)
+	logger.SetGuiMode(true)
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+
+	cleanup := func() {}
+	if setup != nil {
+		if cleanup, err = setup(dir); err != nil {
+			panic(err)
+		}
+	}
+
+	code := m.Run()
+
+	// 不调用logger.CloseLogger：日志初始化后延迟启动的清理协程会与关闭操作产生数据竞争，进程退出时日志文件会自动关闭
+	cleanup()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
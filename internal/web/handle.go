@@ -14,6 +14,8 @@ import (
 	"flowsilicon/internal/logger"
 	"flowsilicon/internal/middleware"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
+	"flowsilicon/internal/proxy"
 	"fmt"
 	"io"
 	"net/http"
@@ -63,6 +65,7 @@ func handleAddKey(c *gin.Context) {
 		Key              string  `json:"key" binding:"required"`
 		Balance          float64 `json:"balance"`
 		AllowZeroBalance bool    `json:"allow_zero_balance"`
+		Provider         string  `json:"provider"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -72,9 +75,17 @@ func handleAddKey(c *gin.Context) {
 		return
 	}
 
+	// 检查提供商是否存在
+	if provider.Get(req.Provider) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("提供商 %s 不存在或未启用", req.Provider),
+		})
+		return
+	}
+
 	// 如果未提供余额，尝试检查余额
 	if req.Balance == 0 {
-		balance, err := key.CheckKeyBalance(req.Key)
+		balance, err := key.CheckProviderKeyBalance(req.Key, req.Provider)
 		if err == nil {
 			req.Balance = balance
 		} else {
@@ -92,7 +103,7 @@ func handleAddKey(c *gin.Context) {
 	}
 
 	// 添加 API 密钥
-	config.AddApiKey(req.Key, req.Balance)
+	config.AddProviderApiKey(req.Key, req.Provider, req.Balance)
 
 	// 重新排序 API 密钥
 	config.SortApiKeysByBalance()
@@ -111,7 +122,8 @@ func handleAddKey(c *gin.Context) {
 // handleCheckKey 处理检查 API 密钥余额的请求
 func handleCheckKey(c *gin.Context) {
 	var req struct {
-		Key string `json:"key" binding:"required"`
+		Key      string `json:"key" binding:"required"`
+		Provider string `json:"provider"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -121,8 +133,14 @@ func handleCheckKey(c *gin.Context) {
 		return
 	}
 
-	// 检查 API 密钥余额
-	balance, err := key.CheckKeyBalanceManually(req.Key)
+	// 检查 API 密钥余额，指定提供商时使用该提供商的余额接口
+	var balance float64
+	var err error
+	if req.Provider != "" {
+		balance, err = key.CheckProviderKeyBalance(req.Key, req.Provider)
+	} else {
+		balance, err = key.CheckKeyBalanceManually(req.Key)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to check balance: %v", err),
@@ -221,6 +239,7 @@ func handleBatchAddKeys(c *gin.Context) {
 		Keys             []string `json:"keys" binding:"required"`
 		Balance          float64  `json:"balance"`
 		AllowZeroBalance bool     `json:"allow_zero_balance"`
+		Provider         string   `json:"provider"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -230,6 +249,14 @@ func handleBatchAddKeys(c *gin.Context) {
 		return
 	}
 
+	// 检查提供商是否存在
+	if provider.Get(req.Provider) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("提供商 %s 不存在或未启用", req.Provider),
+		})
+		return
+	}
+
 	// 添加所有 API 密钥
 	addedCount := 0
 	skippedCount := 0
@@ -238,7 +265,7 @@ func handleBatchAddKeys(c *gin.Context) {
 			// 如果未提供余额，尝试检查余额
 			balance := req.Balance
 			if balance == 0 {
-				checkedBalance, err := key.CheckKeyBalanceManually(_key)
+				checkedBalance, err := key.CheckProviderKeyBalance(_key, req.Provider)
 				if err == nil {
 					balance = checkedBalance
 				}
@@ -246,7 +273,7 @@ func handleBatchAddKeys(c *gin.Context) {
 
 			// 根据AllowZeroBalance参数决定是否添加余额小于等于0的密钥
 			if balance > 0 || req.AllowZeroBalance {
-				config.AddApiKey(_key, balance)
+				config.AddProviderApiKey(_key, req.Provider, balance)
 				addedCount++
 			} else {
 				skippedCount++
@@ -358,9 +385,238 @@ func handleStats(c *gin.Context) {
 		"total_calls":         totalCalls,
 		"success_calls":       successCalls,
 		"avg_success_rate":    avgSuccessRate,
+		"response_cache":      config.GetResponseCacheStats(),
+		"hedging":             proxy.GetHedgeStats(),
+		"admission":           proxy.GetAdmissionStats(),
+	})
+}
+
+// handleGetCacheStats 获取响应缓存统计
+func handleGetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"stats":   config.GetResponseCacheStats(),
+	})
+}
+
+// handlePurgeCache 清空响应缓存
+func handlePurgeCache(c *gin.Context) {
+	deleted, err := config.PurgeResponseCache()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("清空响应缓存失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已清空响应缓存，共删除 %d 条", deleted),
+		"deleted": deleted,
+	})
+}
+
+// clientKeyView 客户端密钥及今天的用量
+type clientKeyView struct {
+	config.ClientKey
+	Expired bool               `json:"expired"`
+	Today   config.ClientStats `json:"today"`
+}
+
+// handleListClientKeys 获取所有客户端密钥和今天的用量
+func handleListClientKeys(c *gin.Context) {
+	keys := config.ListClientKeys()
+	clients := make([]clientKeyView, 0, len(keys))
+	for _, key := range keys {
+		clients = append(clients, clientKeyView{
+			ClientKey: key,
+			Expired:   key.Expired(),
+			Today:     config.GetTodayClientStats(key.Name),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"clients": clients,
+	})
+}
+
+// handleSaveClientKey 新建或更新客户端密钥，id为0时新建，key为空时自动生成
+func handleSaveClientKey(c *gin.Context) {
+	var req config.ClientKey
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("无效的请求参数: %v", err),
+		})
+		return
+	}
+
+	// 客户端标识使用ID，重命名后需要更新按名称配置的别名、推理格式和统计
+	oldName := ""
+	if existing, ok := config.GetClientKeyByID(req.ID); ok {
+		oldName = existing.Name
+	}
+
+	if err := config.SaveClientKey(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("保存客户端密钥失败: %v", err),
+		})
+		return
+	}
+	if oldName != "" && oldName != req.Name {
+		renameClientReferences(oldName, req.Name)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "客户端密钥已保存",
+		"client":  req,
 	})
 }
 
+// renameClientReferences 客户端重命名后，将按旧名称配置的模型别名、推理内容格式和每日统计转移到新名称下
+func renameClientReferences(oldName string, newName string) {
+	if err := model.RenameModelAliasClient(oldName, newName); err != nil {
+		logger.Error("转移客户端 %s 的模型别名失败: %v", oldName, err)
+	}
+	config.RenameDailyClientStats(oldName, newName)
+
+	cfg := config.GetConfig()
+	if format, ok := cfg.ApiProxy.Reasoning.ClientFormats[oldName]; ok {
+		clientFormats := make(map[string]string, len(cfg.ApiProxy.Reasoning.ClientFormats))
+		for client, value := range cfg.ApiProxy.Reasoning.ClientFormats {
+			if client != oldName {
+				clientFormats[client] = value
+			}
+		}
+		clientFormats[newName] = format
+		cfg.ApiProxy.Reasoning.ClientFormats = clientFormats
+		config.UpdateConfig(cfg)
+		if err := config.SaveConfigToDB(); err != nil {
+			logger.Error("保存配置失败: %v", err)
+		}
+	}
+	logger.Info("客户端 %s 已重命名为 %s", oldName, newName)
+}
+
+// handleDeleteClientKey 删除客户端密钥
+func handleDeleteClientKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的客户端密钥ID",
+		})
+		return
+	}
+
+	deleted, err := config.DeleteClientKey(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("删除客户端密钥失败: %v", err),
+		})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "客户端密钥不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "客户端密钥已删除",
+	})
+}
+
+// handleResetClientKeySpent 清零客户端密钥的已消费金额
+func handleResetClientKeySpent(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的客户端密钥ID",
+		})
+		return
+	}
+
+	if err := config.ResetClientKeySpent(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("重置客户端消费失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "客户端消费已清零",
+	})
+}
+
+// 视频任务列表返回的最大条数
+const videoJobsListLimit = 50
+
+// handleListVideoJobs 获取最近的视频生成任务
+func handleListVideoJobs(c *gin.Context) {
+	jobs, err := config.ListVideoJobs(videoJobsListLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("获取视频任务失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"jobs":    jobs,
+	})
+}
+
+// handleRefreshVideoJob 使用提交任务时的密钥查询视频任务的最新状态
+func handleRefreshVideoJob(c *gin.Context) {
+	job, err := proxy.RefreshVideoJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("查询视频任务状态失败: %v", err),
+		})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "视频任务不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// handleVideoJobFile 返回下载到本地的视频文件
+func handleVideoJobFile(c *gin.Context) {
+	job, err := config.GetVideoJob(c.Param("id"))
+	if err != nil || job == nil || job.LocalPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "视频尚未下载到本地",
+		})
+		return
+	}
+	c.File(job.LocalPath)
+}
+
 // handleGetLogs 处理获取日志的请求
 func handleGetLogs(c *gin.Context) {
 	// 获取最近的日志内容
@@ -938,6 +1194,90 @@ func handleGetDailyStatsByDate(c *gin.Context) {
 	})
 }
 
+// handleListProviders 处理获取上游提供商列表的请求
+func handleListProviders(c *gin.Context) {
+	// 统计每个提供商的密钥数量
+	keyCounts := make(map[string]int)
+	for _, k := range config.GetApiKeys() {
+		keyCounts[k.ProviderName()]++
+	}
+
+	providers := make([]gin.H, 0)
+	for _, p := range provider.List() {
+		providers = append(providers, gin.H{
+			"name":      p.Name(),
+			"base_url":  p.BaseURL(),
+			"key_count": keyCounts[p.Name()],
+			"default":   p.Name() == config.DefaultProvider,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+	})
+}
+
+// providerSettings 将提供商配置转换为设置页面使用的格式
+func providerSettings(providers []config.ProviderConfig) []gin.H {
+	result := make([]gin.H, 0, len(providers))
+	for _, p := range providers {
+		models := p.Models
+		if models == nil {
+			models = []string{}
+		}
+		result = append(result, gin.H{
+			"name":     p.Name,
+			"type":     p.Type,
+			"base_url": p.BaseURL,
+			"models":   models,
+			"enabled":  p.Enabled,
+		})
+	}
+	return result
+}
+
+// parseProviderSettings 解析设置页面提交的提供商配置，忽略名称为空、重复或与默认提供商同名的项
+func parseProviderSettings(items []interface{}) []config.ProviderConfig {
+	providers := make([]config.ProviderConfig, 0, len(items))
+	seen := map[string]bool{config.DefaultProvider: true}
+	for _, item := range items {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var p config.ProviderConfig
+		p.Name, _ = data["name"].(string)
+		p.Type, _ = data["type"].(string)
+		p.BaseURL, _ = data["base_url"].(string)
+		p.Enabled, _ = data["enabled"].(bool)
+		p.Name = strings.TrimSpace(p.Name)
+		p.BaseURL = strings.TrimRight(strings.TrimSpace(p.BaseURL), "/")
+		if p.Name == "" || seen[p.Name] {
+			logger.Warn("忽略无效的提供商配置: %s", p.Name)
+			continue
+		}
+		seen[p.Name] = true
+
+		switch p.Type {
+		case provider.TypeSiliconFlow, provider.TypeDeepSeek, provider.TypeMoonshot, provider.TypeOpenAI:
+		default:
+			p.Type = provider.TypeOpenAI
+		}
+
+		if models, ok := data["models"].([]interface{}); ok {
+			for _, m := range models {
+				if name, ok := m.(string); ok && strings.TrimSpace(name) != "" {
+					p.Models = append(p.Models, strings.TrimSpace(name))
+				}
+			}
+		}
+
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 // handleGetSettings 处理获取系统设置的请求
 func handleGetSettings(c *gin.Context) {
 	// 获取当前配置
@@ -953,6 +1293,12 @@ func handleGetSettings(c *gin.Context) {
 	configData := gin.H{
 		"server": gin.H{
 			"port": cfg.Server.Port,
+			"health": gin.H{
+				"min_active_keys":          cfg.Server.Health.GetMinActiveKeys(),
+				"upstream_check":           cfg.Server.Health.UpstreamCheck,
+				"upstream_cache_seconds":   int(cfg.Server.Health.GetUpstreamCacheDuration().Seconds()),
+				"upstream_timeout_seconds": int(cfg.Server.Health.GetUpstreamTimeout().Seconds()),
+			},
 		},
 		"api_proxy": gin.H{
 			"base_url":             cfg.ApiProxy.BaseURL,
@@ -964,6 +1310,58 @@ func handleGetSettings(c *gin.Context) {
 				"retry_on_status_codes":   cfg.ApiProxy.Retry.RetryOnStatusCodes,
 				"retry_on_network_errors": cfg.ApiProxy.Retry.RetryOnNetworkErrors,
 			},
+			"fallback": gin.H{
+				"status_codes":  cfg.ApiProxy.Fallback.GetStatusCodes(),
+				"on_timeout":    cfg.ApiProxy.Fallback.OnTimeout,
+				"busy_keywords": cfg.ApiProxy.Fallback.GetBusyKeywords(),
+			},
+			"cache": gin.H{
+				"enabled":     cfg.ApiProxy.Cache.Enabled,
+				"ttl_minutes": int(cfg.ApiProxy.Cache.GetTTL() / time.Minute),
+				"max_entries": cfg.ApiProxy.Cache.GetMaxEntries(),
+				"max_size_mb": cfg.ApiProxy.Cache.GetMaxSizeBytes() >> 20,
+			},
+			"hedging": gin.H{
+				"enabled":  cfg.ApiProxy.Hedging.Enabled,
+				"delay_ms": int(cfg.ApiProxy.Hedging.GetDelay() / time.Millisecond),
+			},
+			"video": gin.H{
+				"download_enabled": cfg.ApiProxy.Video.DownloadEnabled,
+				"download_dir":     cfg.ApiProxy.Video.GetDownloadDir(),
+			},
+			"batch": gin.H{
+				"concurrency": cfg.ApiProxy.Batch.GetConcurrency(cfg.RequestSettings.ProxyHandler.MaxConcurrency),
+				"files_dir":   cfg.ApiProxy.Batch.GetFilesDir(),
+			},
+			"reasoning": gin.H{
+				"format":         cfg.ApiProxy.Reasoning.GetFormat(""),
+				"client_formats": cfg.ApiProxy.Reasoning.ClientFormats,
+			},
+			"structured_output": gin.H{
+				"enabled":     cfg.ApiProxy.StructuredOutput.Enabled,
+				"max_retries": cfg.ApiProxy.StructuredOutput.GetMaxRetries(),
+			},
+			"context_trim": gin.H{
+				"policy":         cfg.ApiProxy.ContextTrim.GetPolicy(),
+				"summary_model":  cfg.ApiProxy.ContextTrim.GetSummaryModel(),
+				"reserve_tokens": cfg.ApiProxy.ContextTrim.GetReserveTokens(),
+			},
+			"admission": gin.H{
+				"enabled":           cfg.ApiProxy.Admission.Enabled,
+				"heavy_concurrency": cfg.ApiProxy.Admission.HeavyConcurrency,
+				"max_queue_size":    cfg.ApiProxy.Admission.GetMaxQueueSize(),
+				"max_wait_seconds":  int(cfg.ApiProxy.Admission.GetMaxWait().Seconds()),
+			},
+			"circuit_breaker": gin.H{
+				"enabled":            cfg.ApiProxy.CircuitBreaker.Enabled,
+				"window_seconds":     int(cfg.ApiProxy.CircuitBreaker.GetWindow().Seconds()),
+				"min_requests":       cfg.ApiProxy.CircuitBreaker.GetMinRequests(),
+				"error_rate_percent": int(cfg.ApiProxy.CircuitBreaker.GetErrorRate() * 100),
+				"open_seconds":       int(cfg.ApiProxy.CircuitBreaker.GetOpenDuration().Seconds()),
+				"half_open_probes":   cfg.ApiProxy.CircuitBreaker.GetHalfOpenProbes(),
+			},
+			"ollama_mode": cfg.ApiProxy.OllamaMode,
+			"providers":   providerSettings(cfg.ApiProxy.Providers),
 		},
 		"proxy": gin.H{
 			"http_proxy":  cfg.Proxy.HttpProxy,
@@ -977,6 +1375,16 @@ func handleGetSettings(c *gin.Context) {
 			"expiration_minutes": cfg.Security.ExpirationMinutes,
 			"api_key_enabled":    cfg.Security.ApiKeyEnabled,
 			"api_key":            cfg.Security.ApiKey,
+			"rate_limit": gin.H{
+				"enabled":             cfg.Security.RateLimit.Enabled,
+				"requests_per_minute": cfg.Security.RateLimit.RequestsPerMinute,
+				"tokens_per_minute":   cfg.Security.RateLimit.TokensPerMinute,
+			},
+			"metrics": gin.H{
+				"enabled":     cfg.Security.Metrics.Enabled,
+				"access":      cfg.Security.Metrics.GetAccess(),
+				"listen_addr": cfg.Security.Metrics.GetListenAddr(),
+			},
 			// 不返回哈希后的密码
 		},
 		"app": gin.H{
@@ -986,7 +1394,6 @@ func handleGetSettings(c *gin.Context) {
 			"items_per_page":                cfg.App.ItemsPerPage,
 			"max_stats_entries":             cfg.App.MaxStatsEntries,
 			"recovery_interval":             cfg.App.RecoveryInterval,
-			"max_consecutive_failures":      cfg.App.MaxConsecutiveFailures,
 			"balance_weight":                cfg.App.BalanceWeight,
 			"success_rate_weight":           cfg.App.SuccessRateWeight,
 			"rpm_weight":                    cfg.App.RPMWeight,
@@ -1088,8 +1495,8 @@ func handleSaveSettings(c *gin.Context) {
 		apiKey, apiKeyExists := security["api_key"].(string)
 
 		if apiKeyEnabledExists && apiKeyEnabled {
-			// 如果当前没有API密钥，且没有提供新API密钥，则返回错误
-			if currentConfig.Security.ApiKey == "" && (!apiKeyExists || apiKey == "") {
+			// 如果当前没有API密钥，且没有提供新API密钥，也没有客户端密钥，则返回错误
+			if currentConfig.Security.ApiKey == "" && (!apiKeyExists || apiKey == "") && len(config.ListClientKeys()) == 0 {
 				c.JSON(http.StatusBadRequest, gin.H{
 					"error": "启用API密钥验证时必须设置API密钥",
 					"code":  "api_key_required",
@@ -1107,6 +1514,22 @@ func handleSaveSettings(c *gin.Context) {
 		if port, ok := server["port"].(float64); ok {
 			newConfig.Server.Port = int(port)
 		}
+
+		// 健康检查配置
+		if health, ok := server["health"].(map[string]interface{}); ok {
+			if minActiveKeys, ok := health["min_active_keys"].(float64); ok && minActiveKeys >= 0 {
+				newConfig.Server.Health.MinActiveKeys = int(minActiveKeys)
+			}
+			if upstreamCheck, ok := health["upstream_check"].(bool); ok {
+				newConfig.Server.Health.UpstreamCheck = upstreamCheck
+			}
+			if cacheSeconds, ok := health["upstream_cache_seconds"].(float64); ok && cacheSeconds >= 0 {
+				newConfig.Server.Health.UpstreamCacheSeconds = int(cacheSeconds)
+			}
+			if timeoutSeconds, ok := health["upstream_timeout_seconds"].(float64); ok && timeoutSeconds >= 0 {
+				newConfig.Server.Health.UpstreamTimeoutSeconds = int(timeoutSeconds)
+			}
+		}
 	}
 
 	// API代理设置
@@ -1117,6 +1540,15 @@ func handleSaveSettings(c *gin.Context) {
 		if modelIndex, ok := apiProxy["model_index"].(float64); ok {
 			newConfig.ApiProxy.ModelIndex = int(modelIndex)
 		}
+		if ollamaMode, ok := apiProxy["ollama_mode"].(bool); ok {
+			newConfig.ApiProxy.OllamaMode = ollamaMode
+		}
+
+		// 上游提供商
+		if providers, ok := apiProxy["providers"].([]interface{}); ok {
+			newConfig.ApiProxy.Providers = parseProviderSettings(providers)
+			provider.ClearModelsCache()
+		}
 
 		// 处理模型特定策略
 		if modelKeyStrategies, ok := apiProxy["model_key_strategies"].(map[string]interface{}); ok {
@@ -1152,6 +1584,153 @@ func handleSaveSettings(c *gin.Context) {
 				newConfig.ApiProxy.Retry.RetryOnStatusCodes = codes
 			}
 		}
+
+		// 备用模型切换配置
+		if fallback, ok := apiProxy["fallback"].(map[string]interface{}); ok {
+			if onTimeout, ok := fallback["on_timeout"].(bool); ok {
+				newConfig.ApiProxy.Fallback.OnTimeout = onTimeout
+			}
+			if statusCodes, ok := fallback["status_codes"].([]interface{}); ok {
+				codes := make([]int, 0, len(statusCodes))
+				for _, code := range statusCodes {
+					if c, ok := code.(float64); ok {
+						codes = append(codes, int(c))
+					}
+				}
+				newConfig.ApiProxy.Fallback.StatusCodes = codes
+			}
+			if busyKeywords, ok := fallback["busy_keywords"].([]interface{}); ok {
+				keywords := make([]string, 0, len(busyKeywords))
+				for _, keyword := range busyKeywords {
+					if k, ok := keyword.(string); ok && k != "" {
+						keywords = append(keywords, k)
+					}
+				}
+				newConfig.ApiProxy.Fallback.BusyKeywords = keywords
+			}
+		}
+
+		// 响应缓存配置
+		if cache, ok := apiProxy["cache"].(map[string]interface{}); ok {
+			if enabled, ok := cache["enabled"].(bool); ok {
+				newConfig.ApiProxy.Cache.Enabled = enabled
+			}
+			if ttl, ok := cache["ttl_minutes"].(float64); ok {
+				newConfig.ApiProxy.Cache.TTLMinutes = int(ttl)
+			}
+			if maxEntries, ok := cache["max_entries"].(float64); ok {
+				newConfig.ApiProxy.Cache.MaxEntries = int(maxEntries)
+			}
+			if maxSize, ok := cache["max_size_mb"].(float64); ok {
+				newConfig.ApiProxy.Cache.MaxSizeMB = int(maxSize)
+			}
+		}
+
+		// 流式请求对冲配置
+		if hedging, ok := apiProxy["hedging"].(map[string]interface{}); ok {
+			if enabled, ok := hedging["enabled"].(bool); ok {
+				newConfig.ApiProxy.Hedging.Enabled = enabled
+			}
+			if delay, ok := hedging["delay_ms"].(float64); ok {
+				newConfig.ApiProxy.Hedging.DelayMs = int(delay)
+			}
+		}
+
+		// 视频生成任务配置
+		if video, ok := apiProxy["video"].(map[string]interface{}); ok {
+			if enabled, ok := video["download_enabled"].(bool); ok {
+				newConfig.ApiProxy.Video.DownloadEnabled = enabled
+			}
+			if dir, ok := video["download_dir"].(string); ok {
+				newConfig.ApiProxy.Video.DownloadDir = strings.TrimSpace(dir)
+			}
+		}
+
+		// 批量任务配置
+		if batch, ok := apiProxy["batch"].(map[string]interface{}); ok {
+			if concurrency, ok := batch["concurrency"].(float64); ok {
+				newConfig.ApiProxy.Batch.Concurrency = int(concurrency)
+			}
+			if dir, ok := batch["files_dir"].(string); ok {
+				newConfig.ApiProxy.Batch.FilesDir = strings.TrimSpace(dir)
+			}
+		}
+
+		// 推理内容输出格式配置
+		if reasoning, ok := apiProxy["reasoning"].(map[string]interface{}); ok {
+			if format, ok := reasoning["format"].(string); ok && config.IsValidReasoningFormat(format) {
+				newConfig.ApiProxy.Reasoning.Format = format
+			}
+			if clientFormats, ok := reasoning["client_formats"].(map[string]interface{}); ok {
+				newConfig.ApiProxy.Reasoning.ClientFormats = make(map[string]string)
+				for client, value := range clientFormats {
+					if format, ok := value.(string); ok && config.IsValidReasoningFormat(format) {
+						newConfig.ApiProxy.Reasoning.ClientFormats[client] = format
+					}
+				}
+			}
+		}
+
+		// 结构化输出校验配置
+		if structuredOutput, ok := apiProxy["structured_output"].(map[string]interface{}); ok {
+			if enabled, ok := structuredOutput["enabled"].(bool); ok {
+				newConfig.ApiProxy.StructuredOutput.Enabled = enabled
+			}
+			if maxRetries, ok := structuredOutput["max_retries"].(float64); ok && maxRetries >= 0 {
+				newConfig.ApiProxy.StructuredOutput.MaxRetries = int(maxRetries)
+			}
+		}
+
+		// 上下文裁剪配置
+		if contextTrim, ok := apiProxy["context_trim"].(map[string]interface{}); ok {
+			if policy, ok := contextTrim["policy"].(string); ok && config.IsValidContextTrimPolicy(policy) {
+				newConfig.ApiProxy.ContextTrim.Policy = policy
+			}
+			if summaryModel, ok := contextTrim["summary_model"].(string); ok {
+				newConfig.ApiProxy.ContextTrim.SummaryModel = strings.TrimSpace(summaryModel)
+			}
+			if reserveTokens, ok := contextTrim["reserve_tokens"].(float64); ok {
+				newConfig.ApiProxy.ContextTrim.ReserveTokens = int(reserveTokens)
+			}
+		}
+
+		// 准入控制配置
+		if admission, ok := apiProxy["admission"].(map[string]interface{}); ok {
+			if enabled, ok := admission["enabled"].(bool); ok {
+				newConfig.ApiProxy.Admission.Enabled = enabled
+			}
+			if heavyConcurrency, ok := admission["heavy_concurrency"].(float64); ok && heavyConcurrency >= 0 {
+				newConfig.ApiProxy.Admission.HeavyConcurrency = int(heavyConcurrency)
+			}
+			if maxQueueSize, ok := admission["max_queue_size"].(float64); ok && maxQueueSize >= 0 {
+				newConfig.ApiProxy.Admission.MaxQueueSize = int(maxQueueSize)
+			}
+			if maxWaitSeconds, ok := admission["max_wait_seconds"].(float64); ok && maxWaitSeconds >= 0 {
+				newConfig.ApiProxy.Admission.MaxWaitSeconds = int(maxWaitSeconds)
+			}
+		}
+
+		// 熔断配置
+		if circuitBreaker, ok := apiProxy["circuit_breaker"].(map[string]interface{}); ok {
+			if enabled, ok := circuitBreaker["enabled"].(bool); ok {
+				newConfig.ApiProxy.CircuitBreaker.Enabled = enabled
+			}
+			if windowSeconds, ok := circuitBreaker["window_seconds"].(float64); ok && windowSeconds >= 0 {
+				newConfig.ApiProxy.CircuitBreaker.WindowSeconds = int(windowSeconds)
+			}
+			if minRequests, ok := circuitBreaker["min_requests"].(float64); ok && minRequests >= 0 {
+				newConfig.ApiProxy.CircuitBreaker.MinRequests = int(minRequests)
+			}
+			if errorRatePercent, ok := circuitBreaker["error_rate_percent"].(float64); ok && errorRatePercent >= 0 && errorRatePercent <= 100 {
+				newConfig.ApiProxy.CircuitBreaker.ErrorRatePercent = int(errorRatePercent)
+			}
+			if openSeconds, ok := circuitBreaker["open_seconds"].(float64); ok && openSeconds >= 0 {
+				newConfig.ApiProxy.CircuitBreaker.OpenSeconds = int(openSeconds)
+			}
+			if halfOpenProbes, ok := circuitBreaker["half_open_probes"].(float64); ok && halfOpenProbes >= 0 {
+				newConfig.ApiProxy.CircuitBreaker.HalfOpenProbes = int(halfOpenProbes)
+			}
+		}
 	}
 
 	// 代理设置
@@ -1191,6 +1770,32 @@ func handleSaveSettings(c *gin.Context) {
 			newConfig.Security.ApiKey = apiKey
 		}
 
+		// 处理速率限制设置
+		if rateLimit, ok := security["rate_limit"].(map[string]interface{}); ok {
+			if enabled, ok := rateLimit["enabled"].(bool); ok {
+				newConfig.Security.RateLimit.Enabled = enabled
+			}
+			if rpm, ok := rateLimit["requests_per_minute"].(float64); ok && rpm >= 0 {
+				newConfig.Security.RateLimit.RequestsPerMinute = int(rpm)
+			}
+			if tpm, ok := rateLimit["tokens_per_minute"].(float64); ok && tpm >= 0 {
+				newConfig.Security.RateLimit.TokensPerMinute = int(tpm)
+			}
+		}
+
+		// 处理指标接口设置，单独监听的地址修改后需要重启
+		if metricsSettings, ok := security["metrics"].(map[string]interface{}); ok {
+			if enabled, ok := metricsSettings["enabled"].(bool); ok {
+				newConfig.Security.Metrics.Enabled = enabled
+			}
+			if access, ok := metricsSettings["access"].(string); ok {
+				newConfig.Security.Metrics.Access = access
+			}
+			if listenAddr, ok := metricsSettings["listen_addr"].(string); ok {
+				newConfig.Security.Metrics.ListenAddr = strings.TrimSpace(listenAddr)
+			}
+		}
+
 		// 处理密码，如果提供了新密码则进行哈希处理
 		if password, ok := security["password"].(string); ok && password != "" {
 			// 使用SHA256哈希保存密码
@@ -1218,9 +1823,6 @@ func handleSaveSettings(c *gin.Context) {
 		if recoveryInterval, ok := app["recovery_interval"].(float64); ok {
 			newConfig.App.RecoveryInterval = int(recoveryInterval)
 		}
-		if maxFailures, ok := app["max_consecutive_failures"].(float64); ok {
-			newConfig.App.MaxConsecutiveFailures = int(maxFailures)
-		}
 		if hideIcon, ok := app["hide_icon"].(bool); ok {
 			newConfig.App.HideIcon = hideIcon
 		}
@@ -1624,6 +2226,21 @@ func syncModelsHandler(c *gin.Context) {
 		return
 	}
 
+	// 合并其他提供商的模型列表
+	seen := make(map[string]bool, len(modelIds))
+	for _, id := range modelIds {
+		seen[id] = true
+	}
+	for _, p := range provider.List()[1:] {
+		for _, id := range provider.Models(p) {
+			if !seen[id] {
+				seen[id] = true
+				modelIds = append(modelIds, id)
+			}
+		}
+	}
+	count = len(modelIds)
+
 	// 获取数据库中的模型数量
 	dbCount, err := model.GetModelsCount()
 	if err != nil {
@@ -1676,7 +2293,11 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 		return nil, 0, err
 	}
 
-	apikeys := config.GetActiveApiKeys()
+	// 模型列表来自默认提供商，需要使用默认提供商的密钥
+	apikeys := config.GetActiveApiKeysByProvider(config.DefaultProvider)
+	if len(apikeys) == 0 {
+		return nil, 0, fmt.Errorf("没有可用的API密钥")
+	}
 	utils.SetCommonHeaders(req, apikeys[0].Key)
 
 	// 发送请求
@@ -1890,6 +2511,44 @@ func updateModelsHandler(c *gin.Context) {
 			return
 		}
 
+		// 更新工具调用模拟
+		if err := model.UpdateModelToolEmulationWithTx(tx, m.ID, m.ToolEmulation); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("更新模型工具调用模拟失败: %v", err),
+			})
+			return
+		}
+
+		// 更新上下文长度
+		if err := model.UpdateModelContextLengthWithTx(tx, m.ID, m.ContextLength); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("更新模型上下文长度失败: %v", err),
+			})
+			return
+		}
+
+		// 更新价格
+		if err := model.UpdateModelPriceWithTx(tx, m.ID, m.InputPrice, m.OutputPrice); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("更新模型价格失败: %v", err),
+			})
+			return
+		}
+
+		// 更新备用模型链 - 未提交该字段时保持不变
+		if m.FallbackModels != nil {
+			if err := model.UpdateModelFallbacksWithTx(tx, m.ID, m.FallbackModels); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"message": fmt.Sprintf("更新模型备用链失败: %v", err),
+				})
+				return
+			}
+		}
+
 		// 更新免费状态 - 使用事务版本
 		modelIds := []string{m.ID}
 		if _, err := model.UpdateModelFreeStatusWithTx(tx, modelIds, m.IsFree); err != nil {
@@ -1985,6 +2644,107 @@ func updateModelTypeHandler(c *gin.Context) {
 	})
 }
 
+// getModelAliasesHandler 获取所有模型别名
+func getModelAliasesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"aliases": model.GetModelAliases(),
+	})
+}
+
+// saveModelAliasHandler 添加或更新模型别名
+func saveModelAliasHandler(c *gin.Context) {
+	var req struct {
+		Alias  string `json:"alias"`
+		Target string `json:"target"`
+		Client string `json:"client"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求参数失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "解析请求参数失败: " + err.Error(),
+		})
+		return
+	}
+
+	if err := model.SaveModelAlias(req.Alias, req.Target, req.Client); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("保存模型别名失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已保存模型别名 %s -> %s", req.Alias, req.Target),
+	})
+}
+
+// deleteModelAliasHandler 删除模型别名
+func deleteModelAliasHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "无效的别名ID",
+		})
+		return
+	}
+
+	if err := model.DeleteModelAlias(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("删除模型别名失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "模型别名已删除",
+	})
+}
+
+// getModelBreakersHandler 获取模型熔断器状态
+func getModelBreakersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"enabled":  config.GetConfig().ApiProxy.CircuitBreaker.Enabled,
+		"breakers": proxy.GetModelBreakerStates(),
+	})
+}
+
+// resetModelBreakerHandler 手动关闭模型的熔断器
+func resetModelBreakerHandler(c *gin.Context) {
+	var req struct {
+		Model string `json:"model"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || req.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请指定模型名称",
+		})
+		return
+	}
+
+	if !proxy.ResetModelBreaker(req.Model) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("模型 %s 没有熔断器记录", req.Model),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已关闭模型 %s 的熔断器", req.Model),
+	})
+}
+
 // handleModelManagementPage 处理模型管理页面请求
 func handleModelManagementPage(c *gin.Context) {
 	// 获取版本号
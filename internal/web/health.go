@@ -0,0 +1,181 @@
+/**
+  @author: Hanhai
+  @desc: 健康检查接口，/healthz 返回进程存活状态，/readyz 检查数据库、可用密钥和上游地址，供容器和负载均衡探针使用
+**/
+
+package web
+
+import (
+	"context"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/provider"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 健康检查的状态
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+	healthStatusSkip = "skip"
+)
+
+// 数据库检查的超时时间
+const healthDBTimeout = 2 * time.Second
+
+// 进程启动时间
+var startTime = time.Now()
+
+// healthCheck 一项检查的结果
+type healthCheck struct {
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// upstreamCheck 上游地址检查的结果，缓存一段时间
+type upstreamCheck struct {
+	healthCheck
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	CheckedAt  int64  `json:"checked_at"`
+	Cached     bool   `json:"cached"`
+}
+
+// upstreamChecker 缓存上游地址的检查结果，同一时间只有一个请求检查上游
+type upstreamChecker struct {
+	mu        sync.Mutex
+	result    upstreamCheck
+	checkedAt time.Time
+}
+
+var upstream = &upstreamChecker{}
+
+// check 返回上游地址的检查结果，缓存过期或上游地址变化时重新检查
+func (u *upstreamChecker) check(health config.HealthConfig) upstreamCheck {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	url := provider.Default().BaseURL() + "/v1/models"
+	if u.result.URL == url && time.Since(u.checkedAt) < health.GetUpstreamCacheDuration() {
+		result := u.result
+		result.Cached = true
+		return result
+	}
+
+	result := upstreamCheck{URL: url}
+	start := time.Now()
+	// 不携带API密钥，只要上游返回非5xx响应（包括401）就说明地址可达
+	client := &http.Client{Timeout: health.GetUpstreamTimeout()}
+	resp, err := client.Get(url)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Status = healthStatusFail
+		result.Message = fmt.Sprintf("请求上游失败: %v", err)
+	} else {
+		resp.Body.Close()
+		result.StatusCode = resp.StatusCode
+		if resp.StatusCode >= http.StatusInternalServerError {
+			result.Status = healthStatusFail
+			result.Message = fmt.Sprintf("上游返回状态码 %d", resp.StatusCode)
+		} else {
+			result.Status = healthStatusOK
+		}
+	}
+
+	u.checkedAt = time.Now()
+	result.CheckedAt = u.checkedAt.Unix()
+	u.result = result
+	return result
+}
+
+// checkDB 检查数据库连接
+func checkDB(ping func(ctx context.Context) error) healthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), healthDBTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ping(ctx)
+	result := healthCheck{Status: healthStatusOK, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = healthStatusFail
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// pingConfigDB 检查配置数据库连接
+func pingConfigDB(ctx context.Context) error {
+	db := config.DB()
+	if db == nil {
+		return fmt.Errorf("配置数据库未初始化")
+	}
+	return db.PingContext(ctx)
+}
+
+// handleHealthz 进程存活检查，能响应即为存活
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         healthStatusOK,
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// handleReadyz 就绪检查，所有检查通过时返回200，否则返回503
+func handleReadyz(c *gin.Context) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  healthStatusFail,
+			"message": "配置未加载",
+		})
+		return
+	}
+	health := cfg.Server.Health
+
+	checks := gin.H{}
+	ready := true
+
+	configDB := checkDB(pingConfigDB)
+	checks["config_db"] = configDB
+	ready = ready && configDB.Status == healthStatusOK
+
+	modelDB := checkDB(model.PingModelDB)
+	checks["model_db"] = modelDB
+	ready = ready && modelDB.Status == healthStatusOK
+
+	active := len(config.GetActiveApiKeys())
+	keysCheck := gin.H{
+		"status":   healthStatusOK,
+		"active":   active,
+		"required": health.GetMinActiveKeys(),
+	}
+	if active < health.GetMinActiveKeys() {
+		keysCheck["status"] = healthStatusFail
+		keysCheck["message"] = fmt.Sprintf("可用API密钥数 %d 少于 %d", active, health.GetMinActiveKeys())
+		ready = false
+	}
+	checks["api_keys"] = keysCheck
+
+	if health.UpstreamCheck {
+		result := upstream.check(health)
+		checks["upstream"] = result
+		ready = ready && result.Status == healthStatusOK
+	} else {
+		checks["upstream"] = healthCheck{Status: healthStatusSkip}
+	}
+
+	status, code := healthStatusOK, http.StatusOK
+	if !ready {
+		status, code = healthStatusFail, http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": checks,
+	})
+}
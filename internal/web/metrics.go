@@ -0,0 +1,196 @@
+/**
+  @author: Hanhai
+  @desc: Prometheus指标接口，输出代理请求指标和密钥池状态，访问方式可配置为无需认证、访问密码认证或单独监听
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/auth"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/metrics"
+	"flowsilicon/internal/provider"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 密钥状态
+const (
+	keyStateActive      = "active"
+	keyStateDisabled    = "disabled"
+	keyStateCoolingDown = "cooling_down"
+	keyStateLowBalance  = "low_balance"
+)
+
+var keyStates = []string{keyStateActive, keyStateDisabled, keyStateCoolingDown, keyStateLowBalance}
+
+func init() {
+	metrics.NewGaugeFunc("flowsilicon_api_keys",
+		"Number of API keys in the pool by provider and state.", []string{"provider", "state"}, collectKeyCounts)
+	metrics.NewGaugeFunc("flowsilicon_api_keys_balance_total",
+		"Total balance of all API keys by provider.", []string{"provider"}, collectTotalBalance)
+	metrics.NewGaugeFunc("flowsilicon_api_key_balance",
+		"Balance of each API key, labeled with the masked key.", []string{"provider", "key"}, collectKeyBalances)
+}
+
+// keyState 返回密钥的状态
+func keyState(key config.ApiKey, minBalance float64) string {
+	switch {
+	case key.Disabled:
+		return keyStateDisabled
+	case key.CoolingDown():
+		return keyStateCoolingDown
+	case key.Balance < minBalance:
+		return keyStateLowBalance
+	default:
+		return keyStateActive
+	}
+}
+
+// maskedKeyLabel 返回密钥的标签值，不在指标中暴露完整密钥
+func maskedKeyLabel(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return config.MaskKey(key)
+}
+
+// collectKeyCounts 按提供商和状态统计密钥数，每个提供商都输出所有状态
+func collectKeyCounts() []metrics.GaugeSample {
+	minBalance := config.GetConfig().App.MinBalanceThreshold
+	counts := make(map[string]map[string]int)
+	for _, key := range config.GetApiKeys() {
+		name := provider.Get(key.ProviderName()).Name()
+		if counts[name] == nil {
+			counts[name] = make(map[string]int)
+		}
+		counts[name][keyState(key, minBalance)]++
+	}
+
+	var samples []metrics.GaugeSample
+	for _, name := range sortedNames(counts) {
+		for _, state := range keyStates {
+			samples = append(samples, metrics.GaugeSample{Values: []string{name, state}, Value: float64(counts[name][state])})
+		}
+	}
+	return samples
+}
+
+// collectTotalBalance 按提供商统计密钥总余额
+func collectTotalBalance() []metrics.GaugeSample {
+	totals := make(map[string]float64)
+	for _, key := range config.GetApiKeys() {
+		totals[provider.Get(key.ProviderName()).Name()] += key.Balance
+	}
+
+	var samples []metrics.GaugeSample
+	for _, name := range sortedNames(totals) {
+		samples = append(samples, metrics.GaugeSample{Values: []string{name}, Value: totals[name]})
+	}
+	return samples
+}
+
+// collectKeyBalances 输出每个密钥的余额，脱敏后相同的密钥合并为一个标签
+func collectKeyBalances() []metrics.GaugeSample {
+	balances := make(map[string]float64)
+	labels := make(map[string][]string)
+	for _, key := range config.GetApiKeys() {
+		values := []string{provider.Get(key.ProviderName()).Name(), maskedKeyLabel(key.Key)}
+		id := strings.Join(values, "\xff")
+		balances[id] += key.Balance
+		labels[id] = values
+	}
+
+	var samples []metrics.GaugeSample
+	for _, id := range sortedNames(balances) {
+		samples = append(samples, metrics.GaugeSample{Values: labels[id], Value: balances[id]})
+	}
+	return samples
+}
+
+// sortedNames 返回排序后的键，保证指标输出顺序稳定
+func sortedNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// metricsAuthorized 检查请求是否携带正确的访问密码，支持Basic认证的密码和Bearer令牌
+func metricsAuthorized(r *http.Request, storedPassword string) bool {
+	// 未设置访问密码时不开放，避免误将指标暴露在公网
+	if storedPassword == "" {
+		return false
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return auth.VerifyPassword(password, storedPassword)
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return auth.VerifyPassword(strings.TrimSpace(token), storedPassword)
+	}
+	return false
+}
+
+// writeMetrics 输出所有指标
+func writeMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.WriteText(w); err != nil {
+		logger.Error("输出指标失败: %v", err)
+	}
+}
+
+// handleMetrics 主端口的指标接口，未启用或配置为单独监听时返回404
+func handleMetrics(c *gin.Context) {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.Security.Metrics.Enabled || cfg.Security.Metrics.GetAccess() == config.MetricsAccessListener {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if cfg.Security.Metrics.GetAccess() == config.MetricsAccessPassword && !metricsAuthorized(c.Request, cfg.Security.Password) {
+		c.Header("WWW-Authenticate", `Basic realm="metrics"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "需要访问密码才能获取指标"})
+		return
+	}
+
+	writeMetrics(c.Writer)
+}
+
+var metricsListenerOnce sync.Once
+
+// startMetricsListener 配置为单独监听时在单独的地址上提供/metrics，无需认证，修改配置后需要重启
+func startMetricsListener() {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.Security.Metrics.Enabled || cfg.Security.Metrics.GetAccess() != config.MetricsAccessListener {
+		return
+	}
+
+	metricsListenerOnce.Do(func() {
+		addr := cfg.Security.Metrics.GetListenAddr()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			writeMetrics(w)
+		})
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			logger.Info("指标接口单独监听在 %s/metrics", addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("指标接口监听 %s 失败: %v", addr, err)
+			}
+		}()
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"embed"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/provider"
 	"flowsilicon/internal/proxy"
 	"html/template"
 	"net/http"
@@ -29,16 +30,46 @@ func SetupApiProxy(router *gin.Engine) {
 	// 添加请求日志中间件
 	router.Use(proxy.RequestLoggingMiddleware())
 	
+	// 健康检查，在API密钥验证和身份验证中间件之前注册，供容器和负载均衡探针直接访问
+	router.GET("/healthz", handleHealthz)
+	router.GET("/readyz", handleReadyz)
+
+	// Prometheus指标，访问方式由安全设置决定，配置为单独监听时在单独的地址上提供
+	router.GET("/metrics", handleMetrics)
+	startMetricsListener()
+
+	// 预热上游提供商的模型列表缓存，按模型选择提供商时只读取缓存
+	provider.RefreshModelsCache()
+
+	// 从data/tokenizer目录加载分词词表，用于按模型族计算令牌数，词表缺失时使用字符估算
+	proxy.LoadTokenizerVocabs()
+
 	// 代理所有 API 请求
-	router.Any("/api/*path", proxy.HandleApiProxy)
+	// 启用Ollama接口模拟时，Ollama格式的请求与其他模型请求一样经过指标、API密钥验证、速率限制和准入控制中间件，其他请求按原样转发
+	router.Any("/api/*path",
+		proxy.OllamaOnly(proxy.MetricsMiddleware()),
+		proxy.OllamaOnly(middleware.APIKeyMiddleware()),
+		proxy.OllamaOnly(proxy.RateLimitMiddleware()),
+		proxy.OllamaOnly(proxy.AdmissionMiddleware()),
+		proxy.HandleApiProxy)
 
 	// 添加API密钥验证中间件
 	openaiGroup := router.Group("")
+	// 添加指标中间件，放在最前面以便记录被拒绝的请求
+	openaiGroup.Use(proxy.MetricsMiddleware())
 	openaiGroup.Use(middleware.APIKeyMiddleware())
+	// 添加速率限制中间件，需要在API密钥验证之后以便按密钥区分调用方
+	openaiGroup.Use(proxy.RateLimitMiddleware())
+	// 添加准入控制中间件，并发请求达到上限时按优先级排队
+	openaiGroup.Use(proxy.AdmissionMiddleware())
 
 	// 添加对 OpenAI 格式 API 的支持
+	// /v1/messages（Anthropic Messages API）和 /v1/responses（Responses API）与通配路由冲突，由 HandleOpenAIProxy 内部分发
 	openaiGroup.Any("/v1/*path", proxy.HandleOpenAIProxy)
 
+	// 添加对 Gemini 格式 API 的支持
+	openaiGroup.POST("/v1beta/models/*action", proxy.HandleGeminiRequest)
+
 	// 添加对无版本号路径的支持
 	// 聊天完成
 	openaiGroup.Any("/chat", proxy.HandleOpenAIProxy)
@@ -54,6 +85,12 @@ func SetupApiProxy(router *gin.Engine) {
 	openaiGroup.Any("/images", proxy.HandleOpenAIProxy)
 	openaiGroup.Any("/images/*path", proxy.HandleOpenAIProxy)
 
+	// 语音识别和语音合成
+	openaiGroup.Any("/audio/*path", proxy.HandleOpenAIProxy)
+
+	// 视频生成任务
+	openaiGroup.Any("/video/*path", proxy.HandleOpenAIProxy)
+
 	// 模型列表
 	openaiGroup.Any("/models", proxy.HandleOpenAIProxy)
 
@@ -158,6 +195,9 @@ func SetupWebServer(router *gin.Engine) {
 	router.DELETE("/keys/low-balance/:threshold", handleDeleteLowBalanceKeys)
 	router.GET("/test-key", handleGetTestKey)
 
+	// 上游提供商
+	router.GET("/providers", handleListProviders)
+
 	// 设置页面的-模型管理API
 	router.GET("/models/list", getModelsHandler)
 	router.POST("/models/sync", syncModelsHandler)
@@ -173,6 +213,15 @@ func SetupWebServer(router *gin.Engine) {
 	router.POST("/models-api/update", updateModelsHandler)
 	router.POST("/models-api/type", updateModelTypeHandler)
 
+	// 模型别名API
+	router.GET("/models-api/aliases", getModelAliasesHandler)
+	router.POST("/models-api/aliases", saveModelAliasHandler)
+	router.DELETE("/models-api/aliases/:id", deleteModelAliasHandler)
+
+	// 模型熔断器API
+	router.GET("/models-api/breakers", getModelBreakersHandler)
+	router.POST("/models-api/breakers/reset", resetModelBreakerHandler)
+
 	// API 密钥统计
 	router.GET("/stats", handleStats)
 
@@ -204,6 +253,21 @@ func SetupWebServer(router *gin.Engine) {
 	router.GET("/settings/config", handleGetSettings)
 	router.POST("/settings/config", handleSaveSettings)
 
+	// 响应缓存API
+	router.GET("/settings/cache", handleGetCacheStats)
+	router.POST("/settings/cache/purge", handlePurgeCache)
+
+	// 下游客户端密钥管理
+	router.GET("/settings/clients", handleListClientKeys)
+	router.POST("/settings/clients", handleSaveClientKey)
+	router.DELETE("/settings/clients/:id", handleDeleteClientKey)
+	router.POST("/settings/clients/:id/reset-spent", handleResetClientKeySpent)
+
+	// 视频生成任务API
+	router.GET("/video-jobs", handleListVideoJobs)
+	router.POST("/video-jobs/:id/refresh", handleRefreshVideoJob)
+	router.GET("/video-jobs/:id/file", handleVideoJobFile)
+
 	// 系统重启API
 	router.POST("/system/restart", handleSystemRestart)
 
@@ -14,6 +14,7 @@ let currentFilter = 'all'; // 当前筛选条件
 let currentPage = 1; // 当前页码
 let itemsPerPage = 20; // 每页显示数量
 let isModelDisabledMap = {}; // 模型禁用状态映射
+let modelBreakerMap = {}; // 模型熔断器状态映射
 
 // 模型类型映射
 const MODEL_TYPES = {
@@ -50,6 +51,15 @@ document.addEventListener('DOMContentLoaded', function() {
     // 加载模型数据
     loadModels();
     
+    // 加载模型别名
+    loadAliases();
+    
+    // 绑定保存别名事件
+    document.getElementById('alias-form').addEventListener('submit', function(event) {
+        event.preventDefault();
+        saveAlias();
+    });
+    
     // 绑定搜索框事件
     document.getElementById('model-search').addEventListener('input', function() {
         filterModels();
@@ -142,10 +152,16 @@ function loadModels() {
                         type: model.type || 1,
                         is_free: model.is_free || false,
                         is_giftable: model.is_giftable || false,
-                        strategy_id: model.strategy_id || 6
+                        strategy_id: model.strategy_id || 6,
+                        fallback_models: model.fallback_models || [],
+                        tool_emulation: model.tool_emulation || false,
+                        context_length: model.context_length || 0,
+                        input_price: model.input_price || 0,
+                        output_price: model.output_price || 0
                     };
                 });
                 debug(`加载了 ${allModels.length} 个模型`);
+                updateAliasTargetOptions();
                 // 加载模型禁用状态
                 loadModelStatus();
             } else {
@@ -174,7 +190,8 @@ function loadModelStatus() {
                 });
                 debug(`加载了 ${Object.keys(isModelDisabledMap).length} 个禁用模型`);
             }
-            renderModels();
+            // 加载模型熔断器状态
+            loadModelBreakers();
         })
         .catch(error => {
             console.error('加载模型状态失败:', error);
@@ -182,6 +199,74 @@ function loadModelStatus() {
         });
 }
 
+// 加载模型熔断器状态
+function loadModelBreakers() {
+    fetch('/models-api/breakers')
+        .then(response => response.json())
+        .then(data => {
+            modelBreakerMap = {};
+            if (data && data.breakers) {
+                data.breakers.forEach(breaker => {
+                    modelBreakerMap[breaker.model] = breaker;
+                });
+            }
+            renderModels();
+        })
+        .catch(error => {
+            console.error('加载模型熔断器状态失败:', error);
+            renderModels();
+        });
+}
+
+// 生成模型熔断器状态标签，熔断器关闭且窗口内没有失败时不显示
+function breakerBadgeHtml(modelId) {
+    const breaker = modelBreakerMap[modelId];
+    if (!breaker) {
+        return '';
+    }
+    
+    const errorRate = `${(breaker.error_rate * 100).toFixed(0)}%`;
+    const detail = `窗口内 ${breaker.requests} 个请求，失败 ${breaker.failures} 个（${errorRate}），累计熔断 ${breaker.trips} 次，拒绝 ${breaker.rejected} 个请求`;
+    let badge = '';
+    if (breaker.state === 'open') {
+        const retryAt = new Date(breaker.half_open_at * 1000).toLocaleTimeString();
+        badge = `<span class="badge bg-danger" title="${detail}">熔断中</span>
+            <div class="small text-muted mt-1">${retryAt} 后半开探测</div>`;
+    } else if (breaker.state === 'half_open') {
+        badge = `<span class="badge bg-warning text-dark" title="${detail}">半开探测中</span>`;
+    } else if (breaker.failures > 0) {
+        return `<div class="small text-muted mt-1" title="${detail}">错误率: ${errorRate}</div>`;
+    } else {
+        return '';
+    }
+    return `<div class="mt-1">${badge}
+        <button class="btn btn-sm btn-link p-0 ms-1 reset-breaker" data-id="${modelId}">重置</button></div>`;
+}
+
+// 手动关闭模型的熔断器
+function resetModelBreaker(modelId) {
+    fetch('/models-api/breakers/reset', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ model: modelId })
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                showToast(data.message, 'success');
+                loadModelBreakers();
+            } else {
+                showToast(data.message || '重置熔断器失败', 'error');
+            }
+        })
+        .catch(error => {
+            console.error('重置熔断器失败:', error);
+            showToast('重置熔断器失败: ' + error, 'error');
+        });
+}
+
 // 渲染模型列表
 function renderModels() {
     const modelsList = document.getElementById('models-list');
@@ -244,8 +329,17 @@ function renderModels() {
                 <td><span class="model-type-badge type-${model.type}">${MODEL_TYPES[model.type] || '未知'}</span></td>
                 <td><span class="free-tag ${model.is_free ? 'yes' : 'no'}">${model.is_free ? '是' : '否'}</span></td>
                 <td><span class="giftable-tag ${model.is_giftable ? 'yes' : 'no'}">${model.is_giftable ? '是' : '否'}</span></td>
-                <td><span class="strategy-tag">策略${model.strategy_id} - ${STRATEGY_TYPES[model.strategy_id] || '未知'}</span></td>
-                <td><span class="status-tag ${isDisabled ? 'disabled' : 'enabled'}">${isDisabled ? '已禁用' : '已启用'}</span></td>
+                <td>
+                    <span class="strategy-tag">策略${model.strategy_id} - ${STRATEGY_TYPES[model.strategy_id] || '未知'}</span>
+                    ${model.fallback_models.length > 0 ? `<div class="small text-muted mt-1">备用: ${model.fallback_models.join(' → ')}</div>` : ''}
+                    ${model.tool_emulation ? `<div class="small text-muted mt-1">工具调用: 提示词模拟</div>` : ''}
+                    ${model.context_length > 0 ? `<div class="small text-muted mt-1">上下文长度: ${model.context_length}</div>` : ''}
+                    ${model.input_price > 0 || model.output_price > 0 ? `<div class="small text-muted mt-1">价格: 输入 ${model.input_price} / 输出 ${model.output_price} 元/百万令牌</div>` : ''}
+                </td>
+                <td>
+                    <span class="status-tag ${isDisabled ? 'disabled' : 'enabled'}">${isDisabled ? '已禁用' : '已启用'}</span>
+                    ${breakerBadgeHtml(model.id)}
+                </td>
                 <td class="action-buttons">
                     <button class="btn btn-sm btn-outline-primary edit-model" data-id="${model.id}">编辑</button>
                     <button class="btn btn-sm btn-outline-secondary copy-model khaki-btn" data-id="${model.id}">复制</button>
@@ -266,6 +360,14 @@ function renderModels() {
                 copyModel(model);
             });
             
+            // 绑定重置熔断器按钮事件
+            const resetBreakerButton = tr.querySelector('.reset-breaker');
+            if (resetBreakerButton) {
+                resetBreakerButton.addEventListener('click', function() {
+                    resetModelBreaker(model.id);
+                });
+            }
+            
             // 绑定启用/禁用按钮事件
             const statusButton = tr.querySelector('.enable-model, .disable-model');
             statusButton.addEventListener('click', function() {
@@ -348,6 +450,11 @@ function editModel(model) {
     document.getElementById('edit-model-strategy').value = model.strategy_id || 6;
     document.getElementById('edit-model-free').checked = model.is_free;
     document.getElementById('edit-model-giftable').checked = model.is_giftable;
+    document.getElementById('edit-model-fallbacks').value = model.fallback_models.join(', ');
+    document.getElementById('edit-model-tool-emulation').checked = model.tool_emulation;
+    document.getElementById('edit-model-context-length').value = model.context_length || '';
+    document.getElementById('edit-model-input-price').value = model.input_price || '';
+    document.getElementById('edit-model-output-price').value = model.output_price || '';
     document.getElementById('edit-model-status').checked = !isModelDisabledMap[model.id];
     
     // 更新模态框标题
@@ -365,6 +472,14 @@ function saveModelEdit() {
     const isFree = document.getElementById('edit-model-free').checked;
     const isGiftable = document.getElementById('edit-model-giftable').checked;
     const isEnabled = document.getElementById('edit-model-status').checked;
+    const toolEmulation = document.getElementById('edit-model-tool-emulation').checked;
+    const contextLength = parseInt(document.getElementById('edit-model-context-length').value) || 0;
+    const inputPrice = parseFloat(document.getElementById('edit-model-input-price').value) || 0;
+    const outputPrice = parseFloat(document.getElementById('edit-model-output-price').value) || 0;
+    const fallbackModels = document.getElementById('edit-model-fallbacks').value
+        .split(',')
+        .map(m => m.trim())
+        .filter(m => m !== '' && m !== modelId);
     
     // 找到当前模型
     const modelIndex = allModels.findIndex(m => m.id === modelId);
@@ -378,6 +493,11 @@ function saveModelEdit() {
     allModels[modelIndex].strategy_id = modelStrategy;
     allModels[modelIndex].is_free = isFree;
     allModels[modelIndex].is_giftable = isGiftable;
+    allModels[modelIndex].fallback_models = fallbackModels;
+    allModels[modelIndex].tool_emulation = toolEmulation;
+    allModels[modelIndex].context_length = contextLength;
+    allModels[modelIndex].input_price = inputPrice;
+    allModels[modelIndex].output_price = outputPrice;
     
     // 更新禁用状态
     if (isEnabled) {
@@ -464,7 +584,12 @@ function saveAllChanges() {
             type: model.type,
             strategy_id: model.strategy_id,
             is_free: model.is_free,
-            is_giftable: model.is_giftable
+            is_giftable: model.is_giftable,
+            fallback_models: model.fallback_models,
+            tool_emulation: model.tool_emulation,
+            context_length: model.context_length,
+            input_price: model.input_price,
+            output_price: model.output_price
         })),
         disabled_models: Object.keys(isModelDisabledMap)
     };
@@ -502,6 +627,127 @@ function saveAllChanges() {
         });
 }
 
+// 加载模型别名
+function loadAliases() {
+    fetch('/models-api/aliases')
+        .then(response => response.json())
+        .then(data => {
+            renderAliases(data && data.aliases ? data.aliases : []);
+        })
+        .catch(error => {
+            console.error('加载模型别名失败:', error);
+            showToast('加载模型别名失败: ' + error, 'error');
+        });
+}
+
+// 渲染模型别名列表
+function renderAliases(aliases) {
+    const aliasesList = document.getElementById('aliases-list');
+    aliasesList.innerHTML = '';
+    
+    if (aliases.length === 0) {
+        aliasesList.innerHTML = '<tr><td colspan="4" class="text-center text-muted">暂无模型别名</td></tr>';
+        return;
+    }
+    
+    aliases.forEach(alias => {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `
+            <td class="model-id"></td>
+            <td class="model-id"></td>
+            <td></td>
+            <td class="action-buttons">
+                <button class="btn btn-sm btn-outline-primary edit-alias">编辑</button>
+                <button class="btn btn-sm btn-outline-danger delete-alias">删除</button>
+            </td>
+        `;
+        const cells = tr.querySelectorAll('td');
+        cells[0].textContent = alias.alias;
+        cells[1].textContent = alias.target;
+        cells[2].textContent = alias.client || '全部';
+        
+        // 编辑时将别名填入表单，保存后覆盖原有配置
+        tr.querySelector('.edit-alias').addEventListener('click', function() {
+            document.getElementById('alias-name').value = alias.alias;
+            document.getElementById('alias-target').value = alias.target;
+            document.getElementById('alias-client').value = alias.client;
+        });
+        tr.querySelector('.delete-alias').addEventListener('click', function() {
+            deleteAlias(alias);
+        });
+        aliasesList.appendChild(tr);
+    });
+}
+
+// 更新目标模型的候选列表
+function updateAliasTargetOptions() {
+    const options = document.getElementById('alias-target-options');
+    options.innerHTML = '';
+    allModels.forEach(model => {
+        const option = document.createElement('option');
+        option.value = model.id;
+        options.appendChild(option);
+    });
+}
+
+// 保存模型别名
+function saveAlias() {
+    const alias = {
+        alias: document.getElementById('alias-name').value.trim(),
+        target: document.getElementById('alias-target').value.trim(),
+        client: document.getElementById('alias-client').value.trim()
+    };
+    
+    if (!alias.alias || !alias.target) {
+        showToast('别名和目标模型不能为空', 'error');
+        return;
+    }
+    
+    fetch('/models-api/aliases', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(alias)
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                showToast(data.message, 'success');
+                document.getElementById('alias-form').reset();
+                loadAliases();
+            } else {
+                showToast(data.message || '保存模型别名失败', 'error');
+            }
+        })
+        .catch(error => {
+            console.error('保存模型别名失败:', error);
+            showToast('保存模型别名失败: ' + error, 'error');
+        });
+}
+
+// 删除模型别名
+function deleteAlias(alias) {
+    if (!confirm(`确定要删除别名 ${alias.alias} 吗？`)) {
+        return;
+    }
+    
+    fetch(`/models-api/aliases/${alias.id}`, { method: 'DELETE' })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                showToast(data.message, 'success');
+                loadAliases();
+            } else {
+                showToast(data.message || '删除模型别名失败', 'error');
+            }
+        })
+        .catch(error => {
+            console.error('删除模型别名失败:', error);
+            showToast('删除模型别名失败: ' + error, 'error');
+        });
+}
+
 // 显示Toast通知
 function showToast(message, type = 'info') {
     const toast = document.getElementById('toast-notification');
@@ -399,6 +399,8 @@ function renderKeysList() {
                     <div class="key-content">
                         <input type="checkbox" class="form-check-input key-checkbox key-select" data-key="${key.key}" ${key.disabled ? 'disabled' : ''} ${isSelected ? 'checked' : ''}>
                         <span class="key-label ms-2">${maskedKey}</span>
+                        ${key.provider ? `<span class="badge bg-secondary ms-2">${key.provider}</span>` : ''}
+                        ${cooldownBadgeHtml(key)}
                         <span class="key-score ms-2" data-score="${parseFloat(key.score || 0).toFixed(2)}">${parseFloat(key.score || 0).toFixed(2)}</span>
                         <span class="ms-2">余额: <span class="key-balance ${key.balance < minBalanceThreshold ? 'text-danger' : ''}" data-balance="${key.balance || 0}">${key.balance.toFixed(2)}</span>
                         </span>
@@ -771,6 +773,9 @@ function loadStats() {
                         <p><strong>${successRatePercent.toFixed(1)}%</strong></p>
                     </div>
                 </div>
+                ${cacheStatsHtml(data.response_cache)}
+                ${hedgeStatsHtml(data.hedging)}
+                ${admissionStatsHtml(data.admission)}
                 <div class="row">
                     <div class="col-6">
                         <p>最后使用:</p>
@@ -795,6 +800,56 @@ function loadStats() {
         });
 }
 
+// 生成响应缓存统计行，未启用缓存时不显示
+function cacheStatsHtml(cache) {
+    if (!cache || !cache.enabled) {
+        return '';
+    }
+    return `
+                <div class="row">
+                    <div class="col-6">
+                        <p>缓存命中:</p>
+                    </div>
+                    <div class="col-6 text-end">
+                        <p><strong>${cache.hits} / ${cache.hits + cache.misses} (${(cache.hit_rate * 100).toFixed(1)}%)</strong></p>
+                    </div>
+                </div>`;
+}
+
+// 生成请求对冲统计行，未启用对冲时不显示
+function hedgeStatsHtml(hedging) {
+    if (!hedging || !hedging.enabled) {
+        return '';
+    }
+    return `
+                <div class="row">
+                    <div class="col-6">
+                        <p>对冲率:</p>
+                    </div>
+                    <div class="col-6 text-end">
+                        <p><strong>${hedging.hedged} / ${hedging.requests} (${(hedging.hedge_rate * 100).toFixed(1)}%)</strong></p>
+                    </div>
+                </div>`;
+}
+
+// 生成准入控制统计行，显示每个并发池的并发数、排队数和等待时间，未启用时不显示
+function admissionStatsHtml(admission) {
+    if (!admission || !admission.enabled) {
+        return '';
+    }
+    const pools = [['推理模型并发', admission.heavy], ['普通模型并发', admission.standard]];
+    return pools.map(([label, pool]) => `
+                <div class="row">
+                    <div class="col-6">
+                        <p>${label}:</p>
+                    </div>
+                    <div class="col-6 text-end">
+                        <p><strong>${pool.active} / ${pool.capacity}</strong>
+                            <span class="text-muted small" title="排队超时 ${pool.timed_out}，队列已满 ${pool.rejected}">排队 ${pool.queued}，平均等待 ${Math.round(pool.avg_wait_ms)}ms，最长 ${pool.max_wait_ms}ms</span></p>
+                    </div>
+                </div>`).join('');
+}
+
 // 开始系统概要更新倒计时
 function startStatsUpdateCountdown(seconds) {
     if (statsUpdateCountdownTimer) {
@@ -1320,6 +1375,7 @@ function checkKeyBalance(key) {
         },
         body: JSON.stringify({
             key: key,
+            provider: getSelectedProvider('key-provider'),
         }),
     })
         .then(response => {
@@ -1382,6 +1438,7 @@ function checkKeyAvailability(key) {
         },
         body: JSON.stringify({
             key: key,
+            provider: getSelectedProvider('key-provider'),
         }),
     })
         .then(response => {
@@ -1449,6 +1506,39 @@ function addKey(key, balance) {
     }
 }
 
+// 获取选中的提供商，默认提供商返回空字符串
+function getSelectedProvider(selectId) {
+    const select = document.getElementById(selectId);
+    return select ? select.value : '';
+}
+
+// 加载上游提供商列表到添加密钥的下拉框
+function loadProviders() {
+    fetch('/providers')
+        .then(response => response.json())
+        .then(data => {
+            const providers = data.providers || [];
+            document.querySelectorAll('.provider-select').forEach(select => {
+                const current = select.value;
+                select.innerHTML = '';
+                providers.forEach(provider => {
+                    const option = document.createElement('option');
+                    // 默认提供商的密钥不记录提供商名称
+                    option.value = provider.default ? '' : provider.name;
+                    option.textContent = `${provider.name} (${provider.key_count})`;
+                    select.appendChild(option);
+                });
+                select.value = current;
+                if (select.selectedIndex < 0) {
+                    select.selectedIndex = 0;
+                }
+            });
+        })
+        .catch(error => {
+            console.error('Error loading providers:', error);
+        });
+}
+
 // 新增：向服务器添加密钥的实际函数
 function addKeyToServer(key, balance, allowZeroBalance) {
     // 显示适当的消息
@@ -1464,7 +1554,8 @@ function addKeyToServer(key, balance, allowZeroBalance) {
         body: JSON.stringify({
             key: key,
             balance: parseFloat(balance),
-            allow_zero_balance: allowZeroBalance
+            allow_zero_balance: allowZeroBalance,
+            provider: getSelectedProvider('key-provider')
         }),
     })
     .then(response => {
@@ -1560,7 +1651,8 @@ function batchAddKeysToServer(keys, balance, allowZeroBalance) {
         body: JSON.stringify({
             keys: keys,
             balance: parseFloat(balance),
-            allow_zero_balance: allowZeroBalance
+            allow_zero_balance: allowZeroBalance,
+            provider: getSelectedProvider('batch-key-provider')
         }),
     })
     .then(response => {
@@ -1776,6 +1868,26 @@ function getSelectedKeys() {
     return allKeys.filter(key => key.selected).map(key => key.key);
 }
 
+// 生成密钥冷却原因标记，速率限制冷却显示到期时间，已到期时不显示
+function cooldownBadgeHtml(key) {
+    switch (key.cooldown_reason) {
+        case 'invalid':
+            return '<span class="badge bg-danger ms-2" title="上游返回401，需要手动启用">密钥无效</span>';
+        case 'insufficient_balance':
+            return '<span class="badge bg-warning text-dark ms-2" title="下一次余额刷新时恢复">余额不足</span>';
+        case 'rate_limited': {
+            const until = (key.cooldown_until || 0) * 1000;
+            if (until <= Date.now()) {
+                return '';
+            }
+            const untilText = new Date(until).toLocaleTimeString('zh-CN');
+            return `<span class="badge bg-info text-dark ms-2" title="上游返回429，冷却到 ${untilText}">限流冷却至 ${untilText}</span>`;
+        }
+        default:
+            return '';
+    }
+}
+
 // 掩盖 API 密钥（用于日志）
 function maskKey(key) {
     if (key.length <= 6) {
@@ -2821,6 +2933,7 @@ document.addEventListener('DOMContentLoaded', function() {
     
     // 加载初始数据
     loadKeys();
+    loadProviders();
     loadStats();
     loadCurrentRequestStats();
     
@@ -3085,6 +3198,13 @@ document.addEventListener('DOMContentLoaded', function() {
     
     // 加载常用模型
     loadTopModels();
+    
+    // 加载视频任务
+    loadVideoJobs();
+    const refreshVideoJobsBtn = document.getElementById('refresh-video-jobs');
+    if (refreshVideoJobsBtn) {
+        refreshVideoJobsBtn.addEventListener('click', loadVideoJobs);
+    }
 });
 
 // 在页面关闭或切换时清除定时器
@@ -3548,6 +3668,94 @@ function loadTopModels() {
         });
 }
 
+// 视频任务状态显示
+const VIDEO_JOB_STATUS = {
+    InQueue: { text: '排队中', badge: 'bg-secondary' },
+    InProgress: { text: '生成中', badge: 'bg-info' },
+    Succeed: { text: '已完成', badge: 'bg-success' },
+    Failed: { text: '失败', badge: 'bg-danger' }
+};
+
+// 转义HTML特殊字符，视频任务的提示词和失败原因来自用户输入和上游响应
+function escapeHtml(text) {
+    return String(text)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// 加载视频任务
+function loadVideoJobs() {
+    const container = document.getElementById('video-jobs-container');
+    if (!container) {
+        return;
+    }
+    
+    fetch('/video-jobs')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success || !data.jobs || data.jobs.length === 0) {
+                container.innerHTML = '<div class="alert alert-info">暂无视频任务</div>';
+                return;
+            }
+            
+            let html = '<div class="top-models-list">';
+            data.jobs.forEach(job => {
+                const status = VIDEO_JOB_STATUS[job.status] || { text: job.status, badge: 'bg-secondary' };
+                const finished = job.status === 'Succeed' || job.status === 'Failed';
+                let link = '';
+                if (job.local_path) {
+                    link = `<a class="btn btn-sm btn-outline-success" href="/video-jobs/${encodeURIComponent(job.request_id)}/file" target="_blank">本地视频</a>`;
+                } else if (job.video_url) {
+                    link = `<a class="btn btn-sm btn-outline-primary" href="${job.video_url}" target="_blank" rel="noopener noreferrer">查看视频</a>`;
+                }
+                html += `
+                <div class="top-model-item">
+                    <div class="model-name" title="${escapeHtml(job.prompt || '')}">${escapeHtml(job.model)}</div>
+                    <div class="small text-muted">${escapeHtml(job.request_id)} · ${new Date(job.created_at * 1000).toLocaleString()}</div>
+                    ${job.reason ? `<div class="small text-danger">${escapeHtml(job.reason)}</div>` : ''}
+                    <div class="model-info">
+                        <span class="badge ${status.badge}">${status.text}</span>
+                        ${link}
+                        ${finished ? '' : `<button class="btn btn-sm btn-outline-secondary refresh-video-job-btn" data-id="${escapeHtml(job.request_id)}">查询状态</button>`}
+                    </div>
+                </div>`;
+            });
+            html += '</div>';
+            container.innerHTML = html;
+            
+            document.querySelectorAll('.refresh-video-job-btn').forEach(btn => {
+                btn.addEventListener('click', function() {
+                    refreshVideoJob(this.getAttribute('data-id'));
+                });
+            });
+        })
+        .catch(error => {
+            console.error('获取视频任务失败:', error);
+            container.innerHTML = '<p>获取视频任务失败</p>';
+        });
+}
+
+// 使用提交任务时的密钥查询视频任务状态
+function refreshVideoJob(requestId) {
+    fetch(`/video-jobs/${encodeURIComponent(requestId)}/refresh`, { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            if (data.success) {
+                showToast('视频任务状态已更新', 'success', 1500);
+                loadVideoJobs();
+            } else {
+                showToast(data.message || '查询视频任务状态失败', 'error');
+            }
+        })
+        .catch(error => {
+            console.error('查询视频任务状态失败:', error);
+            showToast('查询视频任务状态失败', 'error');
+        });
+}
+
 // 添加常用模型的样式
 document.addEventListener('DOMContentLoaded', function() {
     // 创建样式元素
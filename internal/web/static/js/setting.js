@@ -102,7 +102,13 @@ document.addEventListener('DOMContentLoaded', function() {
             // 收集表单数据
             const config = {
                 server: {
-                    port: getValue('server-port')
+                    port: getValue('server-port'),
+                    health: {
+                        min_active_keys: getValue('health-min-active-keys'),
+                        upstream_check: getValue('health-upstream-check'),
+                        upstream_cache_seconds: getValue('health-upstream-cache'),
+                        upstream_timeout_seconds: getValue('health-upstream-timeout')
+                    }
                 },
                 api_proxy: {
                     base_url: getValue('api-base-url'),
@@ -115,7 +121,59 @@ document.addEventListener('DOMContentLoaded', function() {
                             .map(code => parseInt(code.trim()))
                             .filter(code => !isNaN(code)),
                         retry_on_network_errors: getValue('retry-network-errors')
-                    }
+                    },
+                    fallback: {
+                        status_codes: parseStatusCodes(getValue('fallback-status-codes')),
+                        on_timeout: getValue('fallback-on-timeout'),
+                        busy_keywords: parseKeywords(getValue('fallback-busy-keywords'))
+                    },
+                    cache: {
+                        enabled: getValue('cache-enabled'),
+                        ttl_minutes: getValue('cache-ttl'),
+                        max_entries: getValue('cache-max-entries'),
+                        max_size_mb: getValue('cache-max-size')
+                    },
+                    hedging: {
+                        enabled: getValue('hedging-enabled'),
+                        delay_ms: getValue('hedging-delay')
+                    },
+                    video: {
+                        download_enabled: getValue('video-download-enabled'),
+                        download_dir: getValue('video-download-dir')
+                    },
+                    batch: {
+                        concurrency: getValue('batch-concurrency'),
+                        files_dir: getValue('batch-files-dir')
+                    },
+                    reasoning: {
+                        format: getValue('reasoning-format'),
+                        client_formats: parseReasoningClientFormats(getValue('reasoning-client-formats'))
+                    },
+                    structured_output: {
+                        enabled: getValue('structured-output-enabled'),
+                        max_retries: getValue('structured-output-max-retries')
+                    },
+                    context_trim: {
+                        policy: getValue('context-trim-policy'),
+                        summary_model: getValue('context-trim-summary-model'),
+                        reserve_tokens: getValue('context-trim-reserve-tokens')
+                    },
+                    admission: {
+                        enabled: getValue('admission-enabled'),
+                        heavy_concurrency: getValue('admission-heavy-concurrency'),
+                        max_queue_size: getValue('admission-max-queue-size'),
+                        max_wait_seconds: getValue('admission-max-wait')
+                    },
+                    circuit_breaker: {
+                        enabled: getValue('circuit-breaker-enabled'),
+                        window_seconds: getValue('circuit-breaker-window'),
+                        min_requests: getValue('circuit-breaker-min-requests'),
+                        error_rate_percent: getValue('circuit-breaker-error-rate'),
+                        open_seconds: getValue('circuit-breaker-open-seconds'),
+                        half_open_probes: getValue('circuit-breaker-probes')
+                    },
+                    ollama_mode: getValue('ollama-mode'),
+                    providers: collectProviders()
                 },
                 proxy: {
                     enabled: getValue('proxy-enabled'),
@@ -131,7 +189,6 @@ document.addEventListener('DOMContentLoaded', function() {
                     items_per_page: getValue('items-per-page'),
                     max_stats_entries: getValue('max-stats'),
                     [RECOVERY_INTERVAL]: getValue('recovery-interval'),
-                    max_consecutive_failures: getValue('max-failures'),
                     hide_icon: getValue('hide-icon'),
                     balance_weight: getValue('balance-weight'),
                     success_rate_weight: getValue('success-rate-weight'),
@@ -231,14 +288,30 @@ document.addEventListener('DOMContentLoaded', function() {
             // 收集表单数据
             const config = {
                 server: {
-                    port: getValue('server-port')
+                    port: getValue('server-port'),
+                    health: {
+                        min_active_keys: getValue('health-min-active-keys'),
+                        upstream_check: getValue('health-upstream-check'),
+                        upstream_cache_seconds: getValue('health-upstream-cache'),
+                        upstream_timeout_seconds: getValue('health-upstream-timeout')
+                    }
                 },
                 security:{
                     password_enabled: getValue('password-enabled'),
                     expiration_minutes: getValue('expiration-minutes'),
                     api_key_enabled: getValue('api-key-enabled'),
                     api_key: getValue('api-key'),
-                    password: getValue('password')
+                    password: getValue('password'),
+                    rate_limit: {
+                        enabled: getValue('rate-limit-enabled'),
+                        requests_per_minute: getValue('rate-limit-rpm'),
+                        tokens_per_minute: getValue('rate-limit-tpm')
+                    },
+                    metrics: {
+                        enabled: getValue('metrics-enabled'),
+                        access: getValue('metrics-access'),
+                        listen_addr: getValue('metrics-listen-addr')
+                    }
                 },
                 api_proxy: {
                     base_url: getValue('api-base-url'),
@@ -251,7 +324,59 @@ document.addEventListener('DOMContentLoaded', function() {
                             .map(code => parseInt(code.trim()))
                             .filter(code => !isNaN(code)),
                         retry_on_network_errors: getValue('retry-network-errors')
-                    }
+                    },
+                    fallback: {
+                        status_codes: parseStatusCodes(getValue('fallback-status-codes')),
+                        on_timeout: getValue('fallback-on-timeout'),
+                        busy_keywords: parseKeywords(getValue('fallback-busy-keywords'))
+                    },
+                    cache: {
+                        enabled: getValue('cache-enabled'),
+                        ttl_minutes: getValue('cache-ttl'),
+                        max_entries: getValue('cache-max-entries'),
+                        max_size_mb: getValue('cache-max-size')
+                    },
+                    hedging: {
+                        enabled: getValue('hedging-enabled'),
+                        delay_ms: getValue('hedging-delay')
+                    },
+                    video: {
+                        download_enabled: getValue('video-download-enabled'),
+                        download_dir: getValue('video-download-dir')
+                    },
+                    batch: {
+                        concurrency: getValue('batch-concurrency'),
+                        files_dir: getValue('batch-files-dir')
+                    },
+                    reasoning: {
+                        format: getValue('reasoning-format'),
+                        client_formats: parseReasoningClientFormats(getValue('reasoning-client-formats'))
+                    },
+                    structured_output: {
+                        enabled: getValue('structured-output-enabled'),
+                        max_retries: getValue('structured-output-max-retries')
+                    },
+                    context_trim: {
+                        policy: getValue('context-trim-policy'),
+                        summary_model: getValue('context-trim-summary-model'),
+                        reserve_tokens: getValue('context-trim-reserve-tokens')
+                    },
+                    admission: {
+                        enabled: getValue('admission-enabled'),
+                        heavy_concurrency: getValue('admission-heavy-concurrency'),
+                        max_queue_size: getValue('admission-max-queue-size'),
+                        max_wait_seconds: getValue('admission-max-wait')
+                    },
+                    circuit_breaker: {
+                        enabled: getValue('circuit-breaker-enabled'),
+                        window_seconds: getValue('circuit-breaker-window'),
+                        min_requests: getValue('circuit-breaker-min-requests'),
+                        error_rate_percent: getValue('circuit-breaker-error-rate'),
+                        open_seconds: getValue('circuit-breaker-open-seconds'),
+                        half_open_probes: getValue('circuit-breaker-probes')
+                    },
+                    ollama_mode: getValue('ollama-mode'),
+                    providers: collectProviders()
                 },
                 proxy: {
                     enabled: getValue('proxy-enabled'),
@@ -267,7 +392,6 @@ document.addEventListener('DOMContentLoaded', function() {
                     items_per_page: getValue('items-per-page'),
                     max_stats_entries: getValue('max-stats'),
                     [RECOVERY_INTERVAL]: getValue('recovery-interval'),
-                    max_consecutive_failures: getValue('max-failures'),
                     hide_icon: getValue('hide-icon'),
                     balance_weight: getValue('balance-weight'),
                     success_rate_weight: getValue('success-rate-weight'),
@@ -357,6 +481,36 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     });
     
+    // 绑定添加上游提供商按钮点击事件
+    document.getElementById('add-provider-btn').addEventListener('click', function() {
+        addProviderRow({ type: 'openai', enabled: true });
+    });
+
+    // 绑定清空响应缓存按钮点击事件
+    document.getElementById('purge-cache-btn').addEventListener('click', purgeResponseCache);
+    loadCacheStats();
+
+    // 绑定客户端密钥管理事件
+    document.getElementById('save-client-key-btn').addEventListener('click', saveClientKey);
+    document.getElementById('reset-client-key-form-btn').addEventListener('click', resetClientKeyForm);
+    document.getElementById('client-keys-list').addEventListener('click', function(event) {
+        const button = event.target.closest('button[data-action]');
+        if (!button) return;
+        const id = parseInt(button.dataset.id);
+        const action = button.dataset.action;
+        if (action === 'edit') {
+            editClientKey(id);
+        } else if (action === 'copy') {
+            const client = clientKeysList.find(k => k.id === id);
+            if (client) copyToClipboard(client.key, false);
+        } else if (action === 'reset-spent') {
+            resetClientKeySpent(id);
+        } else if (action === 'delete') {
+            deleteClientKey(id);
+        }
+    });
+    loadClientKeys();
+
     // 绑定添加模型策略按钮点击事件
     document.getElementById('add-model-strategy').addEventListener('click', function() {
         addModelStrategy();
@@ -707,6 +861,11 @@ function populateForm(config) {
 
     // 服务器设置
     setValue('server-port', config.server.port);
+    const health = config.server.health || {};
+    setValue('health-min-active-keys', health.min_active_keys);
+    setValue('health-upstream-check', health.upstream_check);
+    setValue('health-upstream-cache', health.upstream_cache_seconds);
+    setValue('health-upstream-timeout', health.upstream_timeout_seconds);
 
     // API代理设置
     setValue('api-base-url', config.api_proxy.base_url);
@@ -735,6 +894,67 @@ function populateForm(config) {
     setValue('retry-status-codes', config.api_proxy.retry.retry_on_status_codes.join(','));
     setValue('retry-network-errors', config.api_proxy.retry.retry_on_network_errors);
     
+    // 备用模型切换配置
+    const fallback = config.api_proxy.fallback || {};
+    setValue('fallback-status-codes', (fallback.status_codes || []).join(','));
+    setValue('fallback-on-timeout', fallback.on_timeout);
+    setValue('fallback-busy-keywords', (fallback.busy_keywords || []).join(','));
+    
+    // 响应缓存配置
+    const cache = config.api_proxy.cache || {};
+    setValue('cache-enabled', cache.enabled);
+    setValue('cache-ttl', cache.ttl_minutes);
+    setValue('cache-max-entries', cache.max_entries);
+    setValue('cache-max-size', cache.max_size_mb);
+    
+    // 流式请求对冲配置
+    const hedging = config.api_proxy.hedging || {};
+    setValue('hedging-enabled', hedging.enabled);
+    setValue('hedging-delay', hedging.delay_ms);
+    
+    // 视频生成任务配置
+    const video = config.api_proxy.video || {};
+    setValue('video-download-enabled', video.download_enabled);
+    setValue('video-download-dir', video.download_dir);
+    
+    // 批量任务配置
+    const batch = config.api_proxy.batch || {};
+    setValue('batch-concurrency', batch.concurrency);
+    setValue('batch-files-dir', batch.files_dir);
+    
+    // 推理内容输出格式配置
+    const reasoning = config.api_proxy.reasoning || {};
+    setValue('reasoning-format', reasoning.format || 'raw');
+    setValue('reasoning-client-formats', formatReasoningClientFormats(reasoning.client_formats));
+    
+    // 结构化输出校验配置
+    const structuredOutput = config.api_proxy.structured_output || {};
+    setValue('structured-output-enabled', structuredOutput.enabled);
+    setValue('structured-output-max-retries', structuredOutput.max_retries);
+    
+    // 上下文裁剪配置
+    const contextTrim = config.api_proxy.context_trim || {};
+    setValue('context-trim-policy', contextTrim.policy || 'off');
+    setValue('context-trim-summary-model', contextTrim.summary_model);
+    setValue('context-trim-reserve-tokens', contextTrim.reserve_tokens);
+    
+    // 准入控制配置
+    const admission = config.api_proxy.admission || {};
+    setValue('admission-enabled', admission.enabled);
+    setValue('admission-heavy-concurrency', admission.heavy_concurrency);
+    setValue('admission-max-queue-size', admission.max_queue_size);
+    setValue('admission-max-wait', admission.max_wait_seconds);
+    
+    const circuitBreaker = config.api_proxy.circuit_breaker || {};
+    setValue('circuit-breaker-enabled', circuitBreaker.enabled);
+    setValue('circuit-breaker-window', circuitBreaker.window_seconds);
+    setValue('circuit-breaker-min-requests', circuitBreaker.min_requests);
+    setValue('circuit-breaker-error-rate', circuitBreaker.error_rate_percent);
+    setValue('circuit-breaker-open-seconds', circuitBreaker.open_seconds);
+    setValue('circuit-breaker-probes', circuitBreaker.half_open_probes);
+    setValue('ollama-mode', config.api_proxy.ollama_mode);
+    renderProviders(config.api_proxy.providers || []);
+    
     // 代理设置
     setValue('proxy-enabled', config.proxy.enabled);
     setValue('proxy-type', config.proxy.proxy_type);
@@ -750,6 +970,16 @@ function populateForm(config) {
         // API密钥设置
         setValue('api-key-enabled', config.security.api_key_enabled);
         setValue('api-key', config.security.api_key || '');
+        if (config.security.rate_limit) {
+            setValue('rate-limit-enabled', config.security.rate_limit.enabled);
+            setValue('rate-limit-rpm', config.security.rate_limit.requests_per_minute);
+            setValue('rate-limit-tpm', config.security.rate_limit.tokens_per_minute);
+        }
+        if (config.security.metrics) {
+            setValue('metrics-enabled', config.security.metrics.enabled);
+            setValue('metrics-access', config.security.metrics.access);
+            setValue('metrics-listen-addr', config.security.metrics.listen_addr);
+        }
     }
     
     // 应用设置
@@ -759,7 +989,6 @@ function populateForm(config) {
     setValue('items-per-page', config.app.items_per_page);
     setValue('max-stats', config.app.max_stats_entries);
     setValue('recovery-interval', config.app[RECOVERY_INTERVAL]);
-    setValue('max-failures', config.app.max_consecutive_failures);
     setValue('hide-icon', config.app.hide_icon);
     
     // 权重配置
@@ -821,6 +1050,80 @@ function populateForm(config) {
     }
 }
 
+/**
+ * 渲染上游提供商表格
+ * @param {Array} providers - 提供商配置列表
+ */
+function renderProviders(providers) {
+    const tableBody = document.getElementById('providers-body');
+    if (!tableBody) return;
+
+    tableBody.innerHTML = '';
+    providers.forEach(provider => addProviderRow(provider));
+}
+
+/**
+ * 添加一行提供商配置
+ * @param {Object} provider - 提供商配置
+ */
+function addProviderRow(provider) {
+    const tableBody = document.getElementById('providers-body');
+    const types = ['openai', 'siliconflow', 'deepseek', 'moonshot'];
+    const row = document.createElement('tr');
+    row.className = 'provider-row';
+    row.innerHTML = `
+        <td><input type="text" class="form-control form-control-sm provider-name" placeholder="deepseek"></td>
+        <td>
+            <select class="form-select form-select-sm provider-type">
+                ${types.map(type => `<option value="${type}">${type}</option>`).join('')}
+            </select>
+        </td>
+        <td><input type="text" class="form-control form-control-sm provider-base-url" placeholder="https://api.deepseek.com"></td>
+        <td><input type="text" class="form-control form-control-sm provider-models" placeholder="deepseek-*"></td>
+        <td class="text-center">
+            <input class="form-check-input provider-enabled" type="checkbox">
+        </td>
+        <td>
+            <button type="button" class="btn btn-sm btn-danger provider-remove">
+                <i class="bi bi-trash"></i> 删除
+            </button>
+        </td>
+    `;
+
+    row.querySelector('.provider-name').value = provider.name || '';
+    row.querySelector('.provider-type').value = provider.type || 'openai';
+    row.querySelector('.provider-base-url').value = provider.base_url || '';
+    row.querySelector('.provider-models').value = (provider.models || []).join(',');
+    row.querySelector('.provider-enabled').checked = provider.enabled !== false;
+    row.querySelector('.provider-remove').addEventListener('click', () => row.remove());
+
+    tableBody.appendChild(row);
+}
+
+/**
+ * 收集提供商配置
+ * @returns {Array} - 提供商配置列表
+ */
+function collectProviders() {
+    const providers = [];
+    document.querySelectorAll('#providers-body .provider-row').forEach(row => {
+        const name = row.querySelector('.provider-name').value.trim();
+        if (!name) return;
+
+        providers.push({
+            name: name,
+            type: row.querySelector('.provider-type').value,
+            base_url: row.querySelector('.provider-base-url').value.trim(),
+            models: row.querySelector('.provider-models').value
+                .split(',')
+                .map(model => model.trim())
+                .filter(model => model !== ''),
+            enabled: row.querySelector('.provider-enabled').checked
+        });
+    });
+    return providers;
+}
+
 /**
  * 更新模型策略表格
  */
@@ -1152,6 +1455,36 @@ function setValue(id, value) {
     }
 }
 
+/**
+ * 解析"客户端=格式"形式的推理内容输出格式配置，每行一个
+ * @param {string} text - 配置文本
+ * @returns {Object} 客户端到格式的映射
+ */
+function parseReasoningClientFormats(text) {
+    const formats = {};
+    (text || '').split('\n').forEach(line => {
+        const index = line.lastIndexOf('=');
+        if (index <= 0) {
+            return;
+        }
+        const client = line.slice(0, index).trim();
+        const format = line.slice(index + 1).trim();
+        if (client && format) {
+            formats[client] = format;
+        }
+    });
+    return formats;
+}
+
+/**
+ * 将推理内容输出格式配置转换为"客户端=格式"形式的文本
+ * @param {Object} formats - 客户端到格式的映射
+ * @returns {string} 配置文本
+ */
+function formatReasoningClientFormats(formats) {
+    return Object.entries(formats || {}).map(([client, format]) => `${client}=${format}`).join('\n');
+}
+
 /**
  * 获取表单元素的值
  * @param {string} id - 元素id
@@ -1233,7 +1566,13 @@ function saveSettings(callback) {
     // 收集表单数据
     const config = {
         server: {
-            port: getValue('server-port')
+            port: getValue('server-port'),
+            health: {
+                min_active_keys: getValue('health-min-active-keys'),
+                upstream_check: getValue('health-upstream-check'),
+                upstream_cache_seconds: getValue('health-upstream-cache'),
+                upstream_timeout_seconds: getValue('health-upstream-timeout')
+            }
         },
         api_proxy: {
             base_url: getValue('api-base-url'),
@@ -1242,7 +1581,59 @@ function saveSettings(callback) {
                 retry_delay_ms: getValue('retry-delay'),
                 retry_on_status_codes: parseStatusCodes(getValue('retry-status-codes')),
                 retry_on_network_errors: getValue('retry-network-errors')
-            }
+            },
+            fallback: {
+                status_codes: parseStatusCodes(getValue('fallback-status-codes')),
+                on_timeout: getValue('fallback-on-timeout'),
+                busy_keywords: parseKeywords(getValue('fallback-busy-keywords'))
+            },
+            cache: {
+                enabled: getValue('cache-enabled'),
+                ttl_minutes: getValue('cache-ttl'),
+                max_entries: getValue('cache-max-entries'),
+                max_size_mb: getValue('cache-max-size')
+            },
+            hedging: {
+                enabled: getValue('hedging-enabled'),
+                delay_ms: getValue('hedging-delay')
+            },
+            video: {
+                download_enabled: getValue('video-download-enabled'),
+                download_dir: getValue('video-download-dir')
+            },
+            batch: {
+                concurrency: getValue('batch-concurrency'),
+                files_dir: getValue('batch-files-dir')
+            },
+            reasoning: {
+                format: getValue('reasoning-format'),
+                client_formats: parseReasoningClientFormats(getValue('reasoning-client-formats'))
+            },
+            structured_output: {
+                enabled: getValue('structured-output-enabled'),
+                max_retries: getValue('structured-output-max-retries')
+            },
+            context_trim: {
+                policy: getValue('context-trim-policy'),
+                summary_model: getValue('context-trim-summary-model'),
+                reserve_tokens: getValue('context-trim-reserve-tokens')
+            },
+            admission: {
+                enabled: getValue('admission-enabled'),
+                heavy_concurrency: getValue('admission-heavy-concurrency'),
+                max_queue_size: getValue('admission-max-queue-size'),
+                max_wait_seconds: getValue('admission-max-wait')
+            },
+            circuit_breaker: {
+                enabled: getValue('circuit-breaker-enabled'),
+                window_seconds: getValue('circuit-breaker-window'),
+                min_requests: getValue('circuit-breaker-min-requests'),
+                error_rate_percent: getValue('circuit-breaker-error-rate'),
+                open_seconds: getValue('circuit-breaker-open-seconds'),
+                half_open_probes: getValue('circuit-breaker-probes')
+            },
+            ollama_mode: getValue('ollama-mode'),
+            providers: collectProviders()
         },
         proxy: {
             http_proxy: getValue('http-proxy'),
@@ -1255,7 +1646,17 @@ function saveSettings(callback) {
             password_enabled: getValue('password-enabled'),
             expiration_minutes: getValue('expiration-minutes'),
             api_key_enabled: getValue('api-key-enabled'),
-            api_key: getValue('api-key')
+            api_key: getValue('api-key'),
+            rate_limit: {
+                enabled: getValue('rate-limit-enabled'),
+                requests_per_minute: getValue('rate-limit-rpm'),
+                tokens_per_minute: getValue('rate-limit-tpm')
+            },
+            metrics: {
+                enabled: getValue('metrics-enabled'),
+                access: getValue('metrics-access'),
+                listen_addr: getValue('metrics-listen-addr')
+            }
         },
         app: {
             title: appTitle,
@@ -1264,7 +1665,6 @@ function saveSettings(callback) {
             items_per_page: getValue('items-per-page'),
             max_stats_entries: getValue('max-stats'),
             recovery_interval: getValue('recovery-interval'),
-            max_consecutive_failures: getValue('max-failures'),
             model_key_strategies: collectModelStrategies(),
             hide_icon: getValue('hide-icon'),
             balance_weight: getValue('balance-weight'),
@@ -1320,8 +1720,8 @@ function saveSettings(callback) {
         // 检查是否有现有API密钥（通过检查api-key-enabled复选框是否已经被选中）
         const apiKeyEnabledOrig = document.getElementById('api-key-enabled').hasAttribute('data-orig-checked');
         
-        // 如果没有已存在的API密钥（新启用API密钥验证）且没有提供新API密钥
-        if (!apiKeyEnabledOrig && !apiKey) {
+        // 如果没有已存在的API密钥（新启用API密钥验证）且没有提供新API密钥，也没有客户端密钥
+        if (!apiKeyEnabledOrig && !apiKey && clientKeysList.length === 0) {
             showToast('启用API密钥验证时必须设置API密钥', 'error');
             // 聚焦API密钥输入框
             document.getElementById('api-key').focus();
@@ -1488,6 +1888,240 @@ function parseStatusCodes(codesStr) {
         .filter(code => !isNaN(code));
 }
 
+// 解析逗号分隔的关键词为数组
+function parseKeywords(keywordsStr) {
+    if (!keywordsStr) return [];
+    return keywordsStr.split(',')
+        .map(keyword => keyword.trim())
+        .filter(keyword => keyword !== '');
+}
+
+// 加载响应缓存统计
+function loadCacheStats() {
+    fetch('/settings/cache')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) return;
+            const stats = data.stats;
+            const sizeMB = (stats.size_bytes / 1024 / 1024).toFixed(2);
+            document.getElementById('cache-stats').textContent =
+                `当前缓存 ${stats.entries} 条 (${sizeMB} MB)，命中 ${stats.hits} 次，未命中 ${stats.misses} 次，命中率 ${(stats.hit_rate * 100).toFixed(1)}%`;
+        })
+        .catch(error => {
+            console.error('加载缓存统计失败:', error);
+            document.getElementById('cache-stats').textContent = '加载缓存统计失败';
+        });
+}
+
+// 清空响应缓存
+function purgeResponseCache() {
+    if (!confirm('确定要清空所有响应缓存吗？')) {
+        return;
+    }
+    fetch('/settings/cache/purge', { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            showToast(data.message, data.success ? 'success' : 'error');
+            loadCacheStats();
+        })
+        .catch(error => {
+            showToast('清空缓存失败: ' + error, 'error');
+        });
+}
+
+// 客户端密钥列表
+let clientKeysList = [];
+
+// 转义HTML特殊字符，客户端名称和模型列表来自用户输入
+function escapeHtml(text) {
+    return String(text)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// 加载客户端密钥
+function loadClientKeys() {
+    fetch('/settings/clients')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.success) return;
+            clientKeysList = data.clients || [];
+            renderClientKeys();
+        })
+        .catch(error => {
+            console.error('加载客户端密钥失败:', error);
+            document.getElementById('client-keys-list').innerHTML =
+                '<tr><td colspan="7" class="text-danger">加载客户端密钥失败</td></tr>';
+        });
+}
+
+// 渲染客户端密钥列表
+function renderClientKeys() {
+    const tbody = document.getElementById('client-keys-list');
+    if (clientKeysList.length === 0) {
+        tbody.innerHTML = '<tr><td colspan="7" class="text-muted">暂无客户端密钥</td></tr>';
+        return;
+    }
+
+    tbody.innerHTML = clientKeysList.map(client => {
+        let status = '<span class="badge bg-success">启用</span>';
+        if (!client.enabled) {
+            status = '<span class="badge bg-secondary">已禁用</span>';
+        } else if (client.expired) {
+            status = '<span class="badge bg-danger">已过期</span>';
+        }
+        const expires = client.expires_at > 0
+            ? `<div class="small text-muted">至 ${new Date(client.expires_at * 1000).toLocaleString()}</div>`
+            : '';
+        const maskedKey = client.key.length > 10 ? client.key.substring(0, 10) + '***' : '***';
+        const models = client.allowed_models && client.allowed_models.length > 0
+            ? escapeHtml(client.allowed_models.join(', '))
+            : '<span class="text-muted">不限制</span>';
+        const requestQuota = client.daily_request_quota > 0 ? client.daily_request_quota : '∞';
+        const tokenQuota = client.daily_token_quota > 0 ? client.daily_token_quota : '∞';
+        const budget = client.budget > 0 ? client.budget.toFixed(2) : '∞';
+        return `
+            <tr>
+                <td>${escapeHtml(client.name)}</td>
+                <td>
+                    <code>${escapeHtml(maskedKey)}</code>
+                    <button type="button" class="btn btn-sm btn-link p-0 ms-1" data-action="copy" data-id="${client.id}" title="复制密钥"><i class="bi bi-clipboard"></i></button>
+                </td>
+                <td>${status}${expires}</td>
+                <td class="small">${models}</td>
+                <td class="small">${client.today.requests - client.today.failed}/${requestQuota}<br>${client.today.tokens}/${tokenQuota}</td>
+                <td class="small">${client.spent.toFixed(4)}/${budget}</td>
+                <td>
+                    <button type="button" class="btn btn-sm btn-outline-primary" data-action="edit" data-id="${client.id}">编辑</button>
+                    <button type="button" class="btn btn-sm btn-outline-secondary" data-action="reset-spent" data-id="${client.id}">清零消费</button>
+                    <button type="button" class="btn btn-sm btn-outline-danger" data-action="delete" data-id="${client.id}">删除</button>
+                </td>
+            </tr>
+        `;
+    }).join('');
+}
+
+// 将Unix秒转换为datetime-local输入框的值
+function toDateTimeLocal(seconds) {
+    const date = new Date(seconds * 1000);
+    const pad = n => String(n).padStart(2, '0');
+    return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}T${pad(date.getHours())}:${pad(date.getMinutes())}`;
+}
+
+// 编辑客户端密钥，将数据填充到表单
+function editClientKey(id) {
+    const client = clientKeysList.find(k => k.id === id);
+    if (!client) return;
+
+    document.getElementById('client-key-id').value = client.id;
+    document.getElementById('client-key-name').value = client.name;
+    document.getElementById('client-key-key').value = client.key;
+    document.getElementById('client-key-expires').value = client.expires_at > 0 ? toDateTimeLocal(client.expires_at) : '';
+    document.getElementById('client-key-models').value = (client.allowed_models || []).join(', ');
+    document.getElementById('client-key-request-quota').value = client.daily_request_quota || '';
+    document.getElementById('client-key-token-quota').value = client.daily_token_quota || '';
+    document.getElementById('client-key-budget').value = client.budget || '';
+    document.getElementById('client-key-priority').value = client.priority || '';
+    document.getElementById('client-key-enabled').checked = client.enabled;
+    document.getElementById('save-client-key-text').textContent = '保存客户端密钥';
+    document.getElementById('client-key-name').focus();
+}
+
+// 重置客户端密钥表单
+function resetClientKeyForm() {
+    document.getElementById('client-key-id').value = '0';
+    ['client-key-name', 'client-key-key', 'client-key-expires', 'client-key-models',
+        'client-key-request-quota', 'client-key-token-quota', 'client-key-budget', 'client-key-priority'].forEach(id => {
+        document.getElementById(id).value = '';
+    });
+    document.getElementById('client-key-enabled').checked = true;
+    document.getElementById('save-client-key-text').textContent = '添加客户端密钥';
+}
+
+// 保存客户端密钥
+function saveClientKey() {
+    const name = document.getElementById('client-key-name').value.trim();
+    if (!name) {
+        showToast('请输入客户端名称', 'error');
+        document.getElementById('client-key-name').focus();
+        return;
+    }
+
+    const expires = document.getElementById('client-key-expires').value;
+    const client = {
+        id: parseInt(document.getElementById('client-key-id').value) || 0,
+        name: name,
+        key: document.getElementById('client-key-key').value.trim(),
+        enabled: document.getElementById('client-key-enabled').checked,
+        expires_at: expires ? Math.floor(new Date(expires).getTime() / 1000) : 0,
+        allowed_models: document.getElementById('client-key-models').value
+            .split(',')
+            .map(m => m.trim())
+            .filter(m => m !== ''),
+        daily_request_quota: parseInt(document.getElementById('client-key-request-quota').value) || 0,
+        daily_token_quota: parseInt(document.getElementById('client-key-token-quota').value) || 0,
+        budget: parseFloat(document.getElementById('client-key-budget').value) || 0,
+        priority: parseInt(document.getElementById('client-key-priority').value) || 0
+    };
+
+    fetch('/settings/clients', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(client)
+    })
+        .then(response => response.json())
+        .then(data => {
+            showToast(data.message, data.success ? 'success' : 'error');
+            if (!data.success) return;
+            // 新建时复制自动生成的密钥
+            if (client.id === 0 && !client.key && data.client) {
+                copyToClipboard(data.client.key, true);
+            }
+            resetClientKeyForm();
+            loadClientKeys();
+        })
+        .catch(error => {
+            showToast('保存客户端密钥失败: ' + error, 'error');
+        });
+}
+
+// 删除客户端密钥
+function deleteClientKey(id) {
+    const client = clientKeysList.find(k => k.id === id);
+    if (!client || !confirm(`确定要删除客户端密钥 ${client.name} 吗？使用该密钥的请求将被拒绝`)) {
+        return;
+    }
+    fetch(`/settings/clients/${id}`, { method: 'DELETE' })
+        .then(response => response.json())
+        .then(data => {
+            showToast(data.message, data.success ? 'success' : 'error');
+            loadClientKeys();
+        })
+        .catch(error => {
+            showToast('删除客户端密钥失败: ' + error, 'error');
+        });
+}
+
+// 清零客户端密钥的已消费金额
+function resetClientKeySpent(id) {
+    const client = clientKeysList.find(k => k.id === id);
+    if (!client || !confirm(`确定要将客户端 ${client.name} 的已消费金额清零吗？`)) {
+        return;
+    }
+    fetch(`/settings/clients/${id}/reset-spent`, { method: 'POST' })
+        .then(response => response.json())
+        .then(data => {
+            showToast(data.message, data.success ? 'success' : 'error');
+            loadClientKeys();
+        })
+        .catch(error => {
+            showToast('清零客户端消费失败: ' + error, 'error');
+        });
+}
+
 // 收集模型策略配置
 function collectModelStrategies() {
     // 直接返回全局变量中的模型策略
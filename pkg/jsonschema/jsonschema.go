@@ -0,0 +1,379 @@
+/**
+  @author: Hanhai
+  @desc: JSON Schema校验，支持结构化输出常用的关键字：类型、枚举、数值和字符串范围、对象属性、数组元素、组合和$ref引用
+**/
+
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 单次校验最多返回的错误数
+const maxErrors = 20
+
+// validator 保存Schema根节点和校验过程中收集的错误
+type validator struct {
+	root   interface{}
+	errors []string
+	depth  int
+}
+
+// Validate 校验JSON值是否符合Schema，返回不符合的位置和原因，符合时返回nil
+// value应为encoding/json解码得到的值
+func Validate(schema interface{}, value interface{}) []string {
+	v := &validator{root: schema}
+	v.validate(schema, value, "$")
+	return v.errors
+}
+
+// ValidateJSON 解析JSON文本并校验是否符合Schema
+func ValidateJSON(schema interface{}, data []byte) []string {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []string{fmt.Sprintf("$: 不是有效的JSON: %v", err)}
+	}
+	return Validate(schema, value)
+}
+
+// addError 记录一个校验错误
+func (v *validator) addError(path string, format string, args ...interface{}) {
+	if len(v.errors) >= maxErrors {
+		return
+	}
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// valid 判断值是否符合子Schema，不记录错误
+func (v *validator) valid(schema interface{}, value interface{}, path string) bool {
+	sub := &validator{root: v.root, depth: v.depth}
+	sub.validate(schema, value, path)
+	return len(sub.errors) == 0
+}
+
+// validate 按Schema校验值，错误记录到v.errors
+func (v *validator) validate(schema interface{}, value interface{}, path string) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.addError(path, "不允许出现该值")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, value, path)
+	}
+}
+
+// validateObjectSchema 按对象形式的Schema校验值
+func (v *validator) validateObjectSchema(schema map[string]interface{}, value interface{}, path string) {
+	// 防止循环引用导致无限递归
+	if v.depth > 64 {
+		v.addError(path, "Schema引用层级过深")
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			v.addError(path, "%v", err)
+			return
+		}
+		v.depth++
+		v.validate(target, value, path)
+		v.depth--
+	}
+
+	if types, ok := schemaTypes(schema["type"]); ok {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addError(path, "类型应为%s，实际为%s", strings.Join(types, "或"), typeOf(value))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if reflect.DeepEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.addError(path, "值不在枚举范围内: %s", compactJSON(enum))
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !reflect.DeepEqual(constValue, value) {
+		v.addError(path, "值应为%s", compactJSON(constValue))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		v.validateNumber(schema, val, path)
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	}
+
+	v.validateCombinators(schema, value, path)
+}
+
+// validateString 校验字符串长度和正则
+func (v *validator) validateString(schema map[string]interface{}, value string, path string) {
+	length := utf8.RuneCountInString(value)
+	if min, ok := schema["minLength"].(float64); ok && float64(length) < min {
+		v.addError(path, "长度不能小于%v", min)
+	}
+	if max, ok := schema["maxLength"].(float64); ok && float64(length) > max {
+		v.addError(path, "长度不能大于%v", max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(value) {
+			v.addError(path, "不匹配正则%s", pattern)
+		}
+	}
+}
+
+// validateNumber 校验数值范围
+func (v *validator) validateNumber(schema map[string]interface{}, value float64, path string) {
+	if min, ok := schema["minimum"].(float64); ok && value < min {
+		v.addError(path, "不能小于%v", min)
+	}
+	if max, ok := schema["maximum"].(float64); ok && value > max {
+		v.addError(path, "不能大于%v", max)
+	}
+	if min, ok := schema["exclusiveMinimum"].(float64); ok && value <= min {
+		v.addError(path, "必须大于%v", min)
+	}
+	if max, ok := schema["exclusiveMaximum"].(float64); ok && value >= max {
+		v.addError(path, "必须小于%v", max)
+	}
+	if multiple, ok := schema["multipleOf"].(float64); ok && multiple > 0 {
+		if quotient := value / multiple; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.addError(path, "必须是%v的倍数", multiple)
+		}
+	}
+}
+
+// validateObject 校验对象的属性
+func (v *validator) validateObject(schema map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, exists := value[name]; !exists {
+					v.addError(path, "缺少必需属性%s", name)
+				}
+			}
+		}
+	}
+	if min, ok := schema["minProperties"].(float64); ok && float64(len(value)) < min {
+		v.addError(path, "属性数不能少于%v", min)
+	}
+	if max, ok := schema["maxProperties"].(float64); ok && float64(len(value)) > max {
+		v.addError(path, "属性数不能多于%v", max)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	// 按属性名排序，使错误顺序稳定
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propertyPath := path + "." + name
+		matched := false
+		if propertySchema, ok := properties[name]; ok {
+			matched = true
+			v.validate(propertySchema, value[name], propertyPath)
+		}
+		for pattern, propertySchema := range patternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(name) {
+				matched = true
+				v.validate(propertySchema, value[name], propertyPath)
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok {
+			if !allowed {
+				v.addError(path, "不允许的属性%s", name)
+			}
+			continue
+		}
+		v.validate(additional, value[name], propertyPath)
+	}
+}
+
+// validateArray 校验数组元素
+func (v *validator) validateArray(schema map[string]interface{}, value []interface{}, path string) {
+	if min, ok := schema["minItems"].(float64); ok && float64(len(value)) < min {
+		v.addError(path, "元素数不能少于%v", min)
+	}
+	if max, ok := schema["maxItems"].(float64); ok && float64(len(value)) > max {
+		v.addError(path, "元素数不能多于%v", max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					v.addError(path, "第%d和第%d个元素重复", i, j)
+				}
+			}
+		}
+	}
+
+	// prefixItems或数组形式的items按位置校验，其余元素使用items校验
+	prefixItems, _ := schema["prefixItems"].([]interface{})
+	items := schema["items"]
+	if tuple, ok := items.([]interface{}); ok {
+		prefixItems = tuple
+		items = schema["additionalItems"]
+	}
+	for i, item := range value {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefixItems) {
+			v.validate(prefixItems[i], item, itemPath)
+		} else if items != nil {
+			v.validate(items, item, itemPath)
+		}
+	}
+}
+
+// validateCombinators 校验allOf、anyOf、oneOf和not
+func (v *validator) validateCombinators(schema map[string]interface{}, value interface{}, path string) {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			v.validate(sub, value, path)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.valid(sub, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.addError(path, "不符合anyOf中的任何一个Schema")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.valid(sub, value, path) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.addError(path, "应只符合oneOf中的一个Schema，实际符合%d个", count)
+		}
+	}
+	if not, ok := schema["not"]; ok && v.valid(not, value, path) {
+		v.addError(path, "不应符合not中的Schema")
+	}
+}
+
+// resolveRef 解析文档内的$ref引用，如#/$defs/Item
+func (v *validator) resolveRef(ref string) (interface{}, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("不支持的$ref引用: %s", ref)
+	}
+
+	node := v.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("无法解析$ref引用: %s", ref)
+		}
+		if node, ok = object[part]; !ok {
+			return nil, fmt.Errorf("无法解析$ref引用: %s", ref)
+		}
+	}
+	return node, nil
+}
+
+// schemaTypes 获取Schema中的type，可以是字符串或字符串数组
+func schemaTypes(t interface{}) ([]string, bool) {
+	switch typ := t.(type) {
+	case string:
+		return []string{typ}, true
+	case []interface{}:
+		types := make([]string, 0, len(typ))
+		for _, item := range typ {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+// matchesType 判断值是否为指定的JSON类型
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeOf(value) == t
+	}
+}
+
+// typeOf 返回值的JSON类型名称
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// compactJSON 将值转换为紧凑的JSON文本，用于错误信息
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{
+			name:   "type matches",
+			schema: `{"type":"string"}`,
+			value:  `"hello"`,
+		},
+		{
+			name:   "type mismatch",
+			schema: `{"type":"string"}`,
+			value:  `1`,
+			want:   []string{"$: 类型应为string，实际为number"},
+		},
+		{
+			name:   "nullable type list",
+			schema: `{"type":["integer","null"]}`,
+			value:  `null`,
+		},
+		{
+			name:   "integer rejects fraction",
+			schema: `{"type":"integer"}`,
+			value:  `1.5`,
+			want:   []string{"$: 类型应为integer，实际为number"},
+		},
+		{
+			name:   "enum and const",
+			schema: `{"enum":["a","b"],"const":"a"}`,
+			value:  `"c"`,
+			want:   []string{`$: 值不在枚举范围内: ["a","b"]`, `$: 值应为"a"`},
+		},
+		{
+			name:   "string length counts runes and pattern",
+			schema: `{"type":"string","minLength":3,"maxLength":4,"pattern":"^[a-z]+$"}`,
+			value:  `"你好"`,
+			want:   []string{"$: 长度不能小于3", "$: 不匹配正则^[a-z]+$"},
+		},
+		{
+			name:   "number range and multipleOf",
+			schema: `{"type":"number","minimum":0,"exclusiveMaximum":10,"multipleOf":0.5}`,
+			value:  `10`,
+			want:   []string{"$: 必须小于10"},
+		},
+		{
+			name:   "number not a multiple",
+			schema: `{"type":"number","multipleOf":0.5}`,
+			value:  `1.2`,
+			want:   []string{"$: 必须是0.5的倍数"},
+		},
+		{
+			name:   "required and additional properties",
+			schema: `{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"}},"required":["name","age"],"additionalProperties":false}`,
+			value:  `{"name":1,"extra":true}`,
+			want:   []string{"$: 缺少必需属性age", "$: 不允许的属性extra", "$.name: 类型应为string，实际为number"},
+		},
+		{
+			name:   "additional properties schema and pattern properties",
+			schema: `{"type":"object","patternProperties":{"^x-":{"type":"string"}},"additionalProperties":{"type":"number"}}`,
+			value:  `{"x-id":"a","count":"1"}`,
+			want:   []string{"$.count: 类型应为number，实际为string"},
+		},
+		{
+			name:   "array items and uniqueness",
+			schema: `{"type":"array","items":{"type":"integer"},"minItems":1,"maxItems":3,"uniqueItems":true}`,
+			value:  `[1,"2",1,4]`,
+			want:   []string{"$: 元素数不能多于3", "$: 第0和第2个元素重复", "$[1]: 类型应为integer，实际为string"},
+		},
+		{
+			name:   "prefix items",
+			schema: `{"type":"array","prefixItems":[{"type":"string"},{"type":"number"}],"items":false}`,
+			value:  `["a",1,true]`,
+			want:   []string{"$[2]: 不允许出现该值"},
+		},
+		{
+			name:   "anyOf",
+			schema: `{"anyOf":[{"type":"string"},{"type":"number"}]}`,
+			value:  `true`,
+			want:   []string{"$: 不符合anyOf中的任何一个Schema"},
+		},
+		{
+			name:   "oneOf matches both",
+			schema: `{"oneOf":[{"type":"number"},{"type":"integer"}]}`,
+			value:  `1`,
+			want:   []string{"$: 应只符合oneOf中的一个Schema，实际符合2个"},
+		},
+		{
+			name:   "allOf and not",
+			schema: `{"allOf":[{"type":"string"},{"minLength":2}],"not":{"const":"ab"}}`,
+			value:  `"ab"`,
+			want:   []string{"$: 不应符合not中的Schema"},
+		},
+		{
+			name:   "ref to defs",
+			schema: `{"type":"object","properties":{"item":{"$ref":"#/$defs/Item"}},"$defs":{"Item":{"type":"object","required":["id"]}}}`,
+			value:  `{"item":{}}`,
+			want:   []string{"$.item: 缺少必需属性id"},
+		},
+		{
+			name:   "recursive ref",
+			schema: `{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}},"name":{"type":"string"}}}`,
+			value:  `{"name":"a","children":[{"name":"b","children":[{"name":1}]}]}`,
+			want:   []string{"$.children[0].children[0].name: 类型应为string，实际为number"},
+		},
+		{
+			name:   "unresolvable ref",
+			schema: `{"$ref":"#/$defs/Missing"}`,
+			value:  `1`,
+			want:   []string{"$: 无法解析$ref引用: #/$defs/Missing"},
+		},
+		{
+			name:   "external ref is not supported",
+			schema: `{"$ref":"http://example.com/schema"}`,
+			value:  `1`,
+			want:   []string{"$: 不支持的$ref引用: http://example.com/schema"},
+		},
+		{
+			name:   "self ref loop stops",
+			schema: `{"$ref":"#"}`,
+			value:  `1`,
+			want:   []string{"$: Schema引用层级过深"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatalf("invalid schema: %v", err)
+			}
+			if got := ValidateJSON(schema, []byte(tt.value)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateJSON(%s) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJSONInvalid(t *testing.T) {
+	got := ValidateJSON(map[string]interface{}{"type": "object"}, []byte(`{"a":`))
+	if len(got) != 1 {
+		t.Fatalf("ValidateJSON(invalid) = %q, want one error", got)
+	}
+}
+
+func TestValidateMaxErrors(t *testing.T) {
+	schema := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	value := make([]interface{}, maxErrors+5)
+	for i := range value {
+		value[i] = float64(i)
+	}
+	if got := Validate(schema, value); len(got) != maxErrors {
+		t.Errorf("len(Validate()) = %d, want %d", len(got), maxErrors)
+	}
+}
@@ -0,0 +1,317 @@
+/**
+  @author: Hanhai
+  @desc: 分词器，使用词表目录中的BPE词表按模型族计算令牌数，词表缺失时退回到字符估算
+**/
+
+package tokenizer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 词表文件所在目录，词表不随程序发布，需要按README.md的说明生成后放到该目录
+// 文件名为<编码名称>.tiktoken，格式与tiktoken相同：每行为base64编码的令牌和它的序号，可以使用gzip压缩
+var vocabDir = filepath.Join("data", "tokenizer")
+
+// SetVocabDir 设置词表文件所在目录，需要在第一次计算令牌数之前调用
+func SetVocabDir(dir string) {
+	vocabDir = dir
+}
+
+// 编码名称
+const (
+	Cl100kBase = "cl100k_base" // OpenAI cl100k，未识别的模型使用该编码
+	Qwen2      = "qwen2"       // 通义千问Qwen2/Qwen2.5/Qwen3、QwQ
+	DeepSeekV3 = "deepseek_v3" // DeepSeek V3/R1
+	GLM4       = "glm4"        // 智谱GLM-4
+)
+
+// 各编码的预分词规则
+// RE2不支持\s+(?!\S)这样的零宽断言，末尾的\s+由splitPieces处理：后面还有内容时保留最后一个空白字符给下一个片段
+var patterns = map[string]string{
+	Cl100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	Qwen2:      `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	GLM4:       `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	// DeepSeek的预分词将数字、中日文和其他文字分开处理，这里使用等价的简化规则
+	DeepSeekV3: `\p{N}{1,3}|[\x{4E00}-\x{9FA5}\x{3040}-\x{309F}\x{30A0}-\x{30FF}]+|[\r\n]|\s?\p{L}+|\s?[^\s\p{L}\p{N}]+|\s+`,
+}
+
+// Encoding BPE编码
+type Encoding struct {
+	name    string
+	pattern *regexp.Regexp
+	once    sync.Once
+	ranks   map[string]int
+	err     error
+}
+
+var (
+	encodings   = make(map[string]*Encoding)
+	encodingsMu sync.Mutex
+)
+
+// getEncoding 获取指定名称的编码，词表在第一次使用时加载
+func getEncoding(name string) *Encoding {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc
+	}
+	enc := &Encoding{name: name, pattern: regexp.MustCompile(patterns[name])}
+	encodings[name] = enc
+	return enc
+}
+
+// EncodingNameForModel 根据模型ID选择编码
+func EncodingNameForModel(model string) string {
+	lower := strings.ToLower(model)
+	switch {
+	case strings.Contains(lower, "qwen") || strings.Contains(lower, "qwq"):
+		return Qwen2
+	case strings.Contains(lower, "deepseek"):
+		return DeepSeekV3
+	case strings.Contains(lower, "glm"):
+		return GLM4
+	default:
+		return Cl100kBase
+	}
+}
+
+// ForModel 返回模型使用的编码
+func ForModel(model string) *Encoding {
+	return getEncoding(EncodingNameForModel(model))
+}
+
+// CountTokens 计算文本在指定模型下的令牌数
+func CountTokens(model string, text string) int {
+	if text == "" {
+		return 0
+	}
+	return ForModel(model).Count(text)
+}
+
+// Name 返回编码名称
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// load 在第一次使用时加载词表
+func (e *Encoding) load() {
+	e.once.Do(func() {
+		e.ranks, e.err = loadVocab(e.name)
+	})
+}
+
+// Available 判断编码的词表是否可用
+func (e *Encoding) Available() bool {
+	e.load()
+	return e.err == nil
+}
+
+// Err 返回加载词表的错误，词表可用时为nil
+func (e *Encoding) Err() error {
+	e.load()
+	return e.err
+}
+
+// VocabSize 返回词表中的令牌数，词表不可用时为0
+func (e *Encoding) VocabSize() int {
+	e.load()
+	return len(e.ranks)
+}
+
+// EncodingNames 返回所有编码名称
+func EncodingNames() []string {
+	return []string{Cl100kBase, Qwen2, DeepSeekV3, GLM4}
+}
+
+// Get 返回指定名称的编码
+func Get(name string) *Encoding {
+	return getEncoding(name)
+}
+
+// Count 计算文本的令牌数，词表不可用时使用字符估算
+func (e *Encoding) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	if !e.Available() {
+		return estimateTokens(text)
+	}
+
+	count := 0
+	for _, piece := range splitPieces(e.pattern, text) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += bytePairCount([]byte(piece), e.ranks)
+	}
+	return count
+}
+
+// estimateTokens 词表不可用时按字符估算令牌数：汉字每个算一个令牌，其他字符每5个算一个令牌
+func estimateTokens(text string) int {
+	otherChars, chineseChars := 0, 0
+	for _, r := range text {
+		if r >= 0x4E00 && r <= 0x9FFF {
+			chineseChars++
+		} else {
+			otherChars++
+		}
+	}
+	return (otherChars+4)/5 + chineseChars
+}
+
+// splitPieces 按预分词规则切分文本
+func splitPieces(pattern *regexp.Regexp, text string) []string {
+	var pieces []string
+	for pos := 0; pos < len(text); {
+		loc := pattern.FindStringIndex(text[pos:])
+		if loc == nil || loc[1] == 0 {
+			// 规则无法匹配的字符单独作为一个片段
+			pieces = append(pieces, text[pos:])
+			break
+		}
+		if loc[0] > 0 {
+			pieces = append(pieces, text[pos:pos+loc[0]])
+		}
+
+		piece := text[pos+loc[0] : pos+loc[1]]
+		end := pos + loc[1]
+		// 模拟\s+(?!\S)：空白后面还有内容时，最后一个空白字符留给下一个片段
+		if end < len(text) && isSpaceOnly(piece) && !strings.HasSuffix(piece, "\n") && !strings.HasSuffix(piece, "\r") {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				piece = piece[:len(piece)-size]
+			}
+		}
+		pieces = append(pieces, piece)
+		pos += loc[0] + len(piece)
+	}
+	return pieces
+}
+
+// isSpaceOnly 判断字符串是否只包含空白字符
+func isSpaceOnly(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// bytePairCount 对不在词表中的片段执行BPE合并，返回合并后的令牌数
+func bytePairCount(piece []byte, ranks map[string]int) int {
+	if len(piece) <= 1 {
+		return len(piece)
+	}
+
+	const noRank = int(^uint(0) >> 1)
+	// parts[i]为第i个令牌的起始位置，rankOf(i)为合并第i和第i+1个令牌后的序号
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	rankOf := func(i int) int {
+		if i+2 >= len(parts) {
+			return noRank
+		}
+		if rank, ok := ranks[string(piece[parts[i]:parts[i+2]])]; ok {
+			return rank
+		}
+		return noRank
+	}
+	pairRanks := make([]int, len(parts))
+	for i := range pairRanks {
+		pairRanks[i] = rankOf(i)
+	}
+
+	for len(parts) > 2 {
+		minRank, minIndex := noRank, -1
+		for i := 0; i < len(parts)-2; i++ {
+			if pairRanks[i] < minRank {
+				minRank, minIndex = pairRanks[i], i
+			}
+		}
+		if minIndex < 0 {
+			break
+		}
+
+		// 合并minIndex和minIndex+1，然后更新相邻的合并序号
+		parts = append(parts[:minIndex+1], parts[minIndex+2:]...)
+		pairRanks = append(pairRanks[:minIndex+1], pairRanks[minIndex+2:]...)
+		pairRanks[minIndex] = rankOf(minIndex)
+		if minIndex > 0 {
+			pairRanks[minIndex-1] = rankOf(minIndex - 1)
+		}
+	}
+	return len(parts) - 1
+}
+
+// loadVocab 从词表目录中加载词表，优先使用未压缩的词表文件
+func loadVocab(name string) (map[string]int, error) {
+	for _, file := range []string{name + ".tiktoken", name + ".tiktoken.gz"} {
+		f, err := os.Open(filepath.Join(vocabDir, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var reader io.Reader = f
+		if strings.HasSuffix(file, ".gz") {
+			gz, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			reader = gz
+		}
+		return parseVocab(reader)
+	}
+	return nil, fmt.Errorf("词表文件%s不存在", filepath.Join(vocabDir, name+".tiktoken"))
+}
+
+// parseVocab 解析tiktoken格式的词表
+func parseVocab(reader io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("词表格式错误: %s", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("词表令牌解码失败: %s", fields[0])
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("词表序号错误: %s", fields[1])
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, errors.New("词表为空")
+	}
+	return ranks, nil
+}
@@ -0,0 +1,204 @@
+package tokenizer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newTestEncoding 使用给定的词表创建编码，不读取词表目录
+func newTestEncoding(name string, ranks map[string]int) *Encoding {
+	enc := &Encoding{name: name, pattern: regexp.MustCompile(patterns[name]), ranks: ranks}
+	enc.once.Do(func() {})
+	return enc
+}
+
+func TestEncodingNameForModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"Qwen/Qwen2.5-72B-Instruct", Qwen2},
+		{"Qwen/QwQ-32B", Qwen2},
+		{"deepseek-ai/DeepSeek-V3", DeepSeekV3},
+		{"deepseek-ai/DeepSeek-R1", DeepSeekV3},
+		{"THUDM/glm-4-9b-chat", GLM4},
+		{"gpt-4o-mini", Cl100kBase},
+		{"", Cl100kBase},
+	}
+	for _, tt := range tests {
+		if got := EncodingNameForModel(tt.model); got != tt.want {
+			t.Errorf("EncodingNameForModel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestSplitPieces(t *testing.T) {
+	pattern := regexp.MustCompile(patterns[Cl100kBase])
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", []string{"hello", " world"}},
+		{"Hello, world!", []string{"Hello", ",", " world", "!"}},
+		{"a  b", []string{"a", " ", " b"}},
+		{"I'm here", []string{"I", "'m", " here"}},
+		{"12345", []string{"123", "45"}},
+		{"line\n\nnext", []string{"line", "\n\n", "next"}},
+		{"end  ", []string{"end", "  "}},
+	}
+	for _, tt := range tests {
+		if got := splitPieces(pattern, tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitPieces(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBytePairCount(t *testing.T) {
+	ranks := map[string]int{"ab": 0, "cd": 1, "abcd": 2, "bc": 3}
+	tests := []struct {
+		piece string
+		want  int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"ab", 1},
+		{"abcd", 1}, // ab、cd先合并，再合并为abcd
+		{"abc", 2},  // ab的序号比bc小
+		{"xbc", 2},
+		{"xyz", 3},
+	}
+	for _, tt := range tests {
+		if got := bytePairCount([]byte(tt.piece), ranks); got != tt.want {
+			t.Errorf("bytePairCount(%q) = %d, want %d", tt.piece, got, tt.want)
+		}
+	}
+}
+
+func TestParseVocab(t *testing.T) {
+	line := func(token string, rank string) string {
+		return base64.StdEncoding.EncodeToString([]byte(token)) + " " + rank
+	}
+	ranks, err := parseVocab(strings.NewReader(line("a", "0") + "\n\n" + line(" b", "1") + "\n"))
+	if err != nil {
+		t.Fatalf("parseVocab() error = %v", err)
+	}
+	if want := map[string]int{"a": 0, " b": 1}; !reflect.DeepEqual(ranks, want) {
+		t.Errorf("parseVocab() = %v, want %v", ranks, want)
+	}
+
+	for _, bad := range []string{"", "YQ==", "YQ== x", "!!! 1"} {
+		if _, err := parseVocab(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseVocab(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestLoadVocab(t *testing.T) {
+	original := vocabDir
+	SetVocabDir(t.TempDir())
+	t.Cleanup(func() { SetVocabDir(original) })
+
+	content := base64.StdEncoding.EncodeToString([]byte("a")) + " 0\n" + base64.StdEncoding.EncodeToString([]byte("b")) + " 1\n"
+	if err := os.WriteFile(filepath.Join(vocabDir, "plain.tiktoken"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(content))
+	gz.Close()
+	if err := os.WriteFile(filepath.Join(vocabDir, "packed.tiktoken.gz"), compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"a": 0, "b": 1}
+	for _, name := range []string{"plain", "packed"} {
+		ranks, err := loadVocab(name)
+		if err != nil {
+			t.Fatalf("loadVocab(%q) error = %v", name, err)
+		}
+		if !reflect.DeepEqual(ranks, want) {
+			t.Errorf("loadVocab(%q) = %v, want %v", name, ranks, want)
+		}
+	}
+	if _, err := loadVocab("missing"); err == nil {
+		t.Error("loadVocab(missing) error = nil, want error")
+	}
+}
+
+func TestCountWithVocab(t *testing.T) {
+	ranks := map[string]int{"he": 0, "ll": 1, "hell": 2, "hello": 3, " w": 4, "or": 5, " wor": 6, "ld": 7, " world": 8}
+	enc := newTestEncoding(Cl100kBase, ranks)
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hello world", 2},
+		{"hell", 1},
+		{"help", 3}, // he + l + p
+	}
+	for _, tt := range tests {
+		if got := enc.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hello world", 3},
+		{"你好", 2},
+		{"你好abc", 3},
+	}
+	for _, tt := range tests {
+		if got := estimateTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// 使用tiktoken和各模型官方分词器得到的令牌数，词表目录中没有对应词表时检查退回到字符估算
+func TestVocabCounts(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     int
+	}{
+		{Cl100kBase, "hello world", 2},
+		{Cl100kBase, "Hello, world!", 4},
+		{Cl100kBase, "tiktoken is great!", 6},
+		{Qwen2, "hello world", 2},
+		{Qwen2, "Hello, world!", 4},
+		{DeepSeekV3, "hello world", 2},
+		{DeepSeekV3, "Hello, world!", 4},
+		{GLM4, "hello world", 2},
+		{GLM4, "Hello, world!", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+"/"+tt.text, func(t *testing.T) {
+			enc := Get(tt.encoding)
+			if err := enc.Err(); err != nil {
+				if got := enc.Count(tt.text); got != estimateTokens(tt.text) {
+					t.Errorf("Count(%q) without vocab = %d, want estimate %d", tt.text, got, estimateTokens(tt.text))
+				}
+				t.Skipf("词表%s不可用: %v", tt.encoding, err)
+			}
+			if got := enc.Count(tt.text); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}